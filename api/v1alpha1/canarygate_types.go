@@ -1,6 +1,8 @@
 package v1alpha1
 
 import (
+	"slices"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -12,14 +14,61 @@ type CanaryGateSpec struct {
 	Rollout                string `json:"rollout,omitempty"`
 	ConfirmTrafficIncrease string `json:"confirm-traffic-increase,omitempty"`
 	ConfirmPromotion       string `json:"confirm-promotion,omitempty"`
+	ConfirmFinalize        string `json:"confirm-finalize,omitempty"`
 	PostRollout            string `json:"post-rollout,omitempty"`
 	Rollback               string `json:"rollback,omitempty"`
 	Target                 Target `json:"target,omitempty"`
+	// Targets creates a Canary for each target with the same gates. Target is used when Targets is empty.
+	Targets []Target `json:"targets,omitempty"`
+	// TargetSelector creates a Canary for each Deployment in any namespace which matches the labels, named after the
+	// Deployment. Target and Targets are ignored when it is set.
+	TargetSelector *metav1.LabelSelector `json:"targetSelector,omitempty"`
+
+	// DisabledGates lists the gates, including "event", whose webhooks are not injected into the Canary
+	DisabledGates []string `json:"disabledGates,omitempty"`
+
+	// WebhookTimeout is the timeout of the injected webhooks, e.g. "5s". The default timeout of the controller is used when it is empty.
+	WebhookTimeout string `json:"webhookTimeout,omitempty"`
+
+	// WebhookRetries is the number of retries of the injected webhooks. The default retries of the controller are used when it is not set.
+	WebhookRetries *int `json:"webhookRetries,omitempty"`
+
+	// WebhookMetadata is added to the metadata of the injected webhooks, so it is sent with the notifications. The values
+	// are Go templates of the CanaryGate, e.g. "{{ .Labels.team }}". The keys of the gate metadata, e.g. gate_name, are
+	// reserved and are ignored.
+	WebhookMetadata map[string]string `json:"webhookMetadata,omitempty"`
+
+	// OwnedCanary makes the Flagger Canary deleted together with the CanaryGate.
+	// An owner reference is used when the Canary is in the same namespace, otherwise a finalizer.
+	OwnedCanary bool `json:"ownedCanary,omitempty"`
+
+	// Schedule opens the gates only during the allowed time windows
+	Schedule *Schedule `json:"schedule,omitempty"`
+
+	// Approvals is the number of distinct users who must open a gate before it is opened, keyed by gate name
+	Approvals map[string]int `json:"approvals,omitempty"`
+
+	// RequireApproval lists the gates which are closed by default and are closed again once their webhook has used an
+	// approval, so each use of the gate requires a new approval.
+	RequireApproval []string `json:"requireApproval,omitempty"`
+
+	// Dependencies lists the gates which must be opened before a gate can be opened, keyed by gate name.
+	// It overrides DefaultDependencies of the listed gates. An empty list removes the dependencies of a gate.
+	Dependencies map[string][]string `json:"dependencies,omitempty"`
+
+	// Backend selects the progressive delivery tool which calls the gates, either "flagger" or "argo".
+	// The default backend of the controller is used when it is empty.
+	// +kubebuilder:validation:Enum=flagger;argo
+	Backend string `json:"backend,omitempty"`
 
 	// Flagger contains the raw spec for the Flagger Canary resource.
 	// We use RawExtension to capture all fields dynamically.
 	// +kubebuilder:pruning:PreserveUnknownFields
-	Flagger runtime.RawExtension `json:"flagger"`
+	Flagger runtime.RawExtension `json:"flagger,omitempty"`
+
+	// Argo contains the raw spec for the Argo Rollout resource. The canary strategy is required.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Argo runtime.RawExtension `json:"argo,omitempty"`
 }
 
 // Target defines target Flagger Canary resource
@@ -28,20 +77,117 @@ type Target struct {
 	Namespace string `json:"namespace,omitempty"`
 }
 
+// Schedule defines the time windows in which the gates are opened. Outside the windows the gates are closed.
+type Schedule struct {
+	// Timezone (IANA name, e.g. Asia/Bangkok) of the windows. Defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// Windows lists the time windows of the gates
+	Windows []ScheduleWindow `json:"windows,omitempty"`
+}
+
+// ScheduleWindow defines a daily time window of a gate
+type ScheduleWindow struct {
+	// Gate name, e.g. confirm-promotion
+	Gate string `json:"gate"`
+	// Days of the week, e.g. "Mon-Fri" or "Mon,Wed,Fri". Defaults to every day.
+	Days string `json:"days,omitempty"`
+	// Start time (HH:MM) of the window
+	Start string `json:"start"`
+	// End time (HH:MM) of the window. An end before the start ends the window on the next day.
+	End string `json:"end"`
+}
+
+// GateChange records an open or close of a gate
+type GateChange struct {
+	// Time (RFC3339) of the change
+	Time string `json:"time"`
+	// Gate name
+	Gate string `json:"gate"`
+	// Gate status after the change
+	Status string `json:"status"`
+	// User who changed the gate
+	User string `json:"user,omitempty"`
+	// Reason of a manual rollback
+	Reason string `json:"reason,omitempty"`
+}
+
+// GateDecision records the last answer of the webhook of a gate
+type GateDecision struct {
+	// Decision is approved or rejected
+	Decision string `json:"decision"`
+	// Time (RFC3339) when the webhook was answered
+	Time string `json:"time"`
+}
+
 // CanaryGateStatus defines the observed state of CanaryGate
 type CanaryGateStatus struct {
 	// Name of the canary
 	Name string `json:"name"`
 	// Namespace of the canary
 	Namespace string `json:"namespace"`
-	// Gate status
+	// Status is opened when every gate lets the canary progress, or closed when a gate holds it
 	Status string `json:"status"`
+	// Gates holds the live state of each gate in the gate store, opened or closed, keyed by gate name
+	Gates map[string]string `json:"gates,omitempty"`
 	// Gate Message
 	Message string `json:"message,omitempty"`
+	// Phase is the last phase of the canary analysis received from the webhooks
+	Phase string `json:"phase,omitempty"`
 	// Gate Target (Name and Namespace)
 	Target string `json:"target,omitempty"`
+	// Expiry holds the time (RFC3339) when an opened gate reverts to its default state, keyed by gate name
+	Expiry map[string]string `json:"expiry,omitempty"`
+	// ChangedBy holds the user who last opened or closed the gate, keyed by gate name
+	ChangedBy map[string]string `json:"changedBy,omitempty"`
+	// Messages holds the IDs of the notification messages, keyed by channel
+	Messages map[string]string `json:"messages,omitempty"`
+	// Approvers holds the users who approved a gate which requires multiple approvals and is not opened yet, keyed by gate name
+	Approvers map[string][]string `json:"approvers,omitempty"`
+	// ClosedAt holds the time (RFC3339) when the gate was last closed, keyed by gate name. It is removed when the gate is opened.
+	ClosedAt map[string]string `json:"closedAt,omitempty"`
+	// RolledBackAt is the time (RFC3339) when the canary was last rolled back
+	RolledBackAt string `json:"rolledBackAt,omitempty"`
+	// Decisions holds the last answer of the webhook of each gate, keyed by gate name
+	Decisions map[string]GateDecision `json:"decisions,omitempty"`
+	// ScheduledAt holds the time (RFC3339) of the last schedule window boundary applied, keyed by gate name
+	ScheduledAt map[string]string `json:"scheduledAt,omitempty"`
+	// History holds the last gate changes, the oldest first
+	History []GateChange `json:"history,omitempty"`
+	// SelectedTargets holds the targets which matched spec.targetSelector, so the resources of the targets which no
+	// longer match are deleted
+	SelectedTargets []Target `json:"selectedTargets,omitempty"`
+	// Conditions holds the latest observations of the CanaryGate. Ready reports whether the Canary is reconciled.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ConditionReady reports whether the Flagger Canary is reconciled from the CanaryGate
+const ConditionReady = "Ready"
+
+// ConditionDependencies reports whether every opened gate has its dependencies opened
+const ConditionDependencies = "DependenciesSatisfied"
+
+// ConditionBackoff reports whether the reconcile of the CanaryGate has failed and is retried with a backoff
+const ConditionBackoff = "ReconcileBackoff"
+
+// DefaultDependencies follows the canary lifecycle: each gate requires the gate of the previous stage.
+// The rollback gate has no dependency.
+var DefaultDependencies = map[string][]string{
+	"pre-rollout":              {"confirm-rollout"},
+	"rollout":                  {"pre-rollout"},
+	"confirm-traffic-increase": {"rollout"},
+	"confirm-promotion":        {"confirm-traffic-increase"},
+	"confirm-finalize":         {"confirm-promotion"},
+	"post-rollout":             {"confirm-finalize"},
 }
 
+// Backends of the CanaryGate
+const (
+	BackendFlagger = "flagger"
+	BackendArgo    = "argo"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 
@@ -63,7 +209,90 @@ type CanaryGateList struct {
 	Items           []CanaryGate `json:"items"`
 }
 
+// GetTargets returns the targets of the CanaryGate
+func (s *CanaryGateSpec) GetTargets() []Target {
+	if len(s.Targets) > 0 {
+		return s.Targets
+	}
+	return []Target{s.Target}
+}
+
+// GetGate returns the status of the gate by its name
+func (s *CanaryGateSpec) GetGate(gate string) string {
+	switch gate {
+	case "confirm-rollout":
+		return s.ConfirmRollout
+	case "pre-rollout":
+		return s.PreRollout
+	case "rollout":
+		return s.Rollout
+	case "confirm-traffic-increase":
+		return s.ConfirmTrafficIncrease
+	case "confirm-promotion":
+		return s.ConfirmPromotion
+	case "confirm-finalize":
+		return s.ConfirmFinalize
+	case "post-rollout":
+		return s.PostRollout
+	case "rollback":
+		return s.Rollback
+	}
+	return ""
+}
+
+// SetGate sets the status of the gate by its name. An empty status resets the gate to its default state.
+func (s *CanaryGateSpec) SetGate(gate string, status string) {
+	switch gate {
+	case "confirm-rollout":
+		s.ConfirmRollout = status
+	case "pre-rollout":
+		s.PreRollout = status
+	case "rollout":
+		s.Rollout = status
+	case "confirm-traffic-increase":
+		s.ConfirmTrafficIncrease = status
+	case "confirm-promotion":
+		s.ConfirmPromotion = status
+	case "confirm-finalize":
+		s.ConfirmFinalize = status
+	case "post-rollout":
+		s.PostRollout = status
+	case "rollback":
+		s.Rollback = status
+	}
+}
+
+// GetDependencies returns the gates which must be opened before the gate is opened, including the dependencies of
+// the dependencies, in the order they are found. A gate which depends on itself through a cycle is included.
+func (s *CanaryGateSpec) GetDependencies(gate string) []string {
+	direct := func(g string) []string {
+		if deps, ok := s.Dependencies[g]; ok {
+			return deps
+		}
+		return DefaultDependencies[g]
+	}
+	var result []string
+	seen := map[string]bool{}
+	queue := direct(gate)
+	for len(queue) > 0 {
+		g := queue[0]
+		queue = queue[1:]
+		if seen[g] {
+			continue
+		}
+		seen[g] = true
+		result = append(result, g)
+		queue = append(queue, direct(g)...)
+	}
+	return result
+}
+
 func init() {
 	// Run `controller-gen object paths=./api/v1beta1/..` to get the generated code
 	SchemeBuilder.Register(&CanaryGate{}, &CanaryGateList{})
 }
+
+// RequiresApproval reports whether the gate is listed in RequireApproval, so each use of the gate requires a new approval
+func (s *CanaryGateSpec) RequiresApproval(gate string) bool {
+	return slices.Contains(s.RequireApproval, gate)
+}
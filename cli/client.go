@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/KongZ/canary-gate/handler"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+	"k8s.io/client-go/kubernetes"
+)
+
+// gateClient sends the requests to the canary-gate service. The requests go through the API server proxy of
+// a canary-gate pod by default, or directly to the service URL when --server-url is set.
+type gateClient struct {
+	clientset *kubernetes.Clientset
+	// httpClient and serverURL are set when the CLI talks directly to the service
+	httpClient *http.Client
+	serverURL  string
+	// basePath is the path prefix of the service
+	basePath string
+}
+
+// newGateClient creates the client of the command. The Kubernetes config is loaded in the direct mode only
+// when the cluster is set, since the bulk actions still list the CanaryGates from the API server.
+func newGateClient(cmd *cli.Command, clusterAlias string) (*gateClient, error) {
+	basePath := handler.BasePath(cmd.String("base-path"))
+	if cmd.String("server-url") == "" {
+		clientset, err := loadKubernetesConfig(cmd.String("kubeconfig"), clusterAlias)
+		if err != nil {
+			return nil, err
+		}
+		return &gateClient{clientset: clientset, basePath: basePath}, nil
+	}
+	serverURL, err := parseServerURL(cmd.String("server-url"))
+	if err != nil {
+		return nil, err
+	}
+	// a plain client is enough for a service behind an Ingress or a port-forward
+	httpClient := &http.Client{}
+	if cmd.String("client-cert") != "" || cmd.String("client-key") != "" || cmd.String("ca-cert") != "" {
+		if httpClient, err = newTLSClient(cmd.String("client-cert"), cmd.String("client-key"), cmd.String("ca-cert")); err != nil {
+			return nil, err
+		}
+	}
+	client := &gateClient{httpClient: httpClient, serverURL: serverURL, basePath: basePath}
+	if clusterAlias != "" {
+		if client.clientset, err = loadKubernetesConfig(cmd.String("kubeconfig"), clusterAlias); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// parseServerURL validates the URL of --server-url and returns it without the trailing slash
+func parseServerURL(serverURL string) (string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid server URL '%s', expected http://<host> or https://<host>", serverURL)
+	}
+	return strings.TrimSuffix(serverURL, "/"), nil
+}
+
+// newTLSClient creates the HTTP client which presents the client certificate, and verifies the service
+// with the CA when it is set, or with the system roots.
+func newTLSClient(certFile string, keyFile string, caFile string) (*http.Client, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file '%s'", caFile)
+		}
+		config.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Transport: transport}, nil
+}
+
+// clusterOf returns the cluster alias of the command, which is optional when the CLI talks directly to the service.
+func clusterOf(cmd *cli.Command, defaults cliDefaults) (string, error) {
+	clusterAlias := defaults.flag(cmd, "cluster")
+	if clusterAlias == "" && cmd.String("server-url") != "" {
+		return "", nil
+	}
+	return clusterName(clusterAlias)
+}
+
+// servicePath returns the path of the canary path under the base path, which is the proxy path of a canary-gate pod
+// of the namespace unless the CLI talks directly to the service.
+func (c *gateClient) servicePath(ctx context.Context, namespace string, method string, canaryPath string) (string, error) {
+	canaryPath = c.basePath + canaryPath
+	if c.httpClient != nil {
+		log.Trace().Str("server", c.serverURL).Str("path", canaryPath).Msg("Sending request directly to service")
+		return canaryPath, nil
+	}
+	return findProxyPath(ctx, c.clientset, namespace, method, canaryPath)
+}
+
+// cluster returns the clientset of the API server, which is required to list the CanaryGates.
+func (c *gateClient) cluster() (*kubernetes.Clientset, error) {
+	if c.clientset == nil {
+		return nil, fmt.Errorf("cluster name is required to list the CanaryGates")
+	}
+	return c.clientset, nil
+}
+
+// statusError is the error response of the service when the CLI talks directly to the service
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("request to service failed with status %d: %s", e.code, e.body)
+}
+
+// directRequest sends a request to the service URL and returns the raw response body
+func (c *gateClient) directRequest(ctx context.Context, method string, path string, token string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.serverURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid request to %s: %w", path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to service failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	rawBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get raw response from service: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, &statusError{code: resp.StatusCode, body: strings.TrimSpace(string(rawBody))}
+	}
+	return rawBody, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+	"sigs.k8s.io/yaml"
+)
+
+// configFileName is the config file of the CLI in the home directory, which can be overridden by $CANARY_GATE_CONFIG
+const configFileName = ".canary-gate.yaml"
+
+// cliDefaults holds the default values of the --cluster, --namespace and --deployment flags
+type cliDefaults struct {
+	Cluster    string `json:"cluster,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	Deployment string `json:"deployment,omitempty"`
+}
+
+// cliConfig is the content of the config file. The defaults of a context override the top-level defaults.
+//
+//	cluster: my-cluster
+//	contexts:
+//	  demo:
+//	    namespace: gate-namespace
+//	    deployment: demo
+type cliConfig struct {
+	cliDefaults
+	Contexts map[string]cliDefaults `json:"contexts,omitempty"`
+}
+
+// loadDefaults reads the config file and returns the defaults of the context selected by --ctx.
+// A missing config file has no defaults, unless it is set by $CANARY_GATE_CONFIG.
+func loadDefaults(cmd *cli.Command) (cliDefaults, error) {
+	path := os.Getenv("CANARY_GATE_CONFIG")
+	explicit := path != ""
+	if !explicit {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Trace().Err(err).Msg("Unable to find the home directory, the config file is ignored")
+			return cliDefaults{}, nil
+		}
+		path = filepath.Join(home, configFileName)
+	}
+	config, err := readConfig(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		config = &cliConfig{}
+	} else if err != nil {
+		return cliDefaults{}, err
+	}
+	defaults := config.cliDefaults
+	name := cmd.String("ctx")
+	if name == "" {
+		return defaults, nil
+	}
+	selected, ok := config.Contexts[name]
+	if !ok {
+		return cliDefaults{}, fmt.Errorf("context '%s' is not found in config file '%s'", name, path)
+	}
+	if selected.Cluster != "" {
+		defaults.Cluster = selected.Cluster
+	}
+	if selected.Namespace != "" {
+		defaults.Namespace = selected.Namespace
+	}
+	if selected.Deployment != "" {
+		defaults.Deployment = selected.Deployment
+	}
+	return defaults, nil
+}
+
+// readConfig decodes the config file
+func readConfig(path string) (*cliConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file '%s': %w", path, err)
+	}
+	var config cliConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to decode config file '%s': %w", path, err)
+	}
+	log.Trace().Str("path", path).Msg("Config file loaded")
+	return &config, nil
+}
+
+// flag returns the value of the flag, or its default from the config file when the flag is not set
+func (d cliDefaults) flag(cmd *cli.Command, name string) string {
+	if value := cmd.String(name); value != "" {
+		return value
+	}
+	switch name {
+	case "cluster":
+		return d.Cluster
+	case "namespace":
+		return d.Namespace
+	case "deployment":
+		return d.Deployment
+	}
+	return ""
+}
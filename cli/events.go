@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// tailEvents prints the Kubernetes events of the CanaryGate as they are recorded, until interrupted. The events which
+// are still kept by the cluster are printed first.
+// The deployment is the first argument, or the --deployment flag.
+func tailEvents(ctx context.Context, cmd *cli.Command) error {
+	defaults, err := loadDefaults(cmd)
+	if err != nil {
+		return err
+	}
+	clusterAlias, err := clusterName(defaults.flag(cmd, "cluster"))
+	if err != nil {
+		return err
+	}
+	deployment := cmd.Args().First()
+	if deployment == "" {
+		deployment = defaults.flag(cmd, "deployment")
+	}
+	name := gateNameOf(cmd, deployment)
+	if name == "" {
+		return fmt.Errorf("deployment name is required")
+	}
+	namespace := namespaceOf(cmd, defaults, clusterAlias)
+	clientset, err := loadKubernetesConfig(cmd.String("kubeconfig"), clusterAlias)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return followEvents(ctx, log.Logger, clientset, namespace, name)
+}
+
+// followEvents watches the events of the CanaryGate and prints them with the logger. The watch is resumed when the API
+// server closes it, and it returns when the context is done.
+func followEvents(ctx context.Context, logger zerolog.Logger, client kubernetes.Interface, namespace string, name string) error {
+	selector := fields.Set{"involvedObject.kind": "CanaryGate", "involvedObject.name": name}.AsSelector().String()
+	resourceVersion := ""
+	for {
+		watcher, err := client.CoreV1().Events(namespace).Watch(ctx, metav1.ListOptions{FieldSelector: selector, ResourceVersion: resourceVersion})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to watch the events of CanaryGate '%s/%s': %w", namespace, name, err)
+		}
+		for result := range watcher.ResultChan() {
+			if result.Type == watch.Error {
+				watcher.Stop()
+				err := apierrors.FromObject(result.Object)
+				if !apierrors.IsResourceExpired(err) && !apierrors.IsGone(err) {
+					return fmt.Errorf("failed to watch the events of CanaryGate '%s/%s': %w", namespace, name, err)
+				}
+				// the last event is too old to resume from, so the kept events are printed again
+				resourceVersion = ""
+				break
+			}
+			event, ok := result.Object.(*corev1.Event)
+			if !ok || result.Type == watch.Deleted {
+				continue
+			}
+			resourceVersion = event.ResourceVersion
+			// the field selector is not applied by every client
+			if event.InvolvedObject.Kind == "CanaryGate" && event.InvolvedObject.Name == name {
+				printEvent(logger, event)
+			}
+		}
+		watcher.Stop()
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// printEvent prints an event of the CanaryGate. The state of a changed gate is a field, so it is colored like the
+// state of the other commands.
+func printEvent(logger zerolog.Logger, event *corev1.Event) {
+	line := logger.Info()
+	if event.Type == corev1.EventTypeWarning {
+		line = logger.Warn()
+	}
+	line = line.Str("at", eventTime(event).Format(time.RFC3339)).Str("reason", event.Reason)
+	if status := eventStatus(event.Message); status != "" {
+		line = line.Str("status", status)
+	}
+	if event.Count > 1 {
+		line = line.Int32("count", event.Count)
+	}
+	line.Msg(event.Message)
+}
+
+// eventTime returns the time when the event was last recorded
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+// eventStatus returns the state of the gate in the message of an event, e.g. "Gate [ns/name=rollback] is set to
+// [opened]", or empty
+func eventStatus(message string) string {
+	for _, status := range []string{store.GATE_OPEN, store.GATE_CLOSE} {
+		if strings.Contains(message, "["+status+"]") {
+			return status
+		}
+	}
+	return ""
+}
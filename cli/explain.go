@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/KongZ/canary-gate/handler"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/urfave/cli/v3"
+)
+
+// gateExplanation describes the stage of the Flagger Canary process which checks a gate
+type gateExplanation struct {
+	gate service.HookType
+	// stage describes when the gate is checked
+	stage string
+	// opened and closed describe what happens next when the gate is in the state
+	opened string
+	closed string
+}
+
+// gateExplanations lists the gates in the order of the Flagger Canary process
+var gateExplanations = []gateExplanation{
+	{
+		gate:   service.HookConfirmRollout,
+		stage:  "When a new version is detected, it will check the <confirm-rollout> gate.",
+		opened: "it will proceed to the next stage.",
+		closed: "it will halt the process and wait until the gate is opened.",
+	},
+	{
+		gate:   service.HookPreRollout,
+		stage:  "Next, it will check the <pre-rollout> gate. This stage is not depicted in the diagram.",
+		opened: "it will proceed to the next stage.",
+		closed: "it will halt the process and wait until the gate is opened.",
+	},
+	{
+		gate:   service.HookRollout,
+		stage:  "Flagger will begin increasing traffic based on the configuration in CanaryGate. Before each traffic increase, it will check the <rollout> gate.",
+		opened: "it will proceed to the next stage.",
+		closed: "it will halt the process and continue monitoring metrics. If metrics indicate failure, it will initiate a rollback.",
+	},
+	{
+		gate:   service.HookConfirmTrafficIncrease,
+		stage:  "Then, it will check the <confirm-traffic-increase> gate.",
+		opened: "it will continue to increase traffic and proceed to the next stage.",
+		closed: "it will halt the process.",
+	},
+	{
+		gate:   service.HookConfirmPromotion,
+		stage:  "After increasing traffic until it reaches the maximum weight, it will check the <confirm-promotion> gate.",
+		opened: "it will proceed to promote to the new version.",
+		closed: "it will halt the process and continue monitoring metrics. If metrics indicate failure, it will initiate a rollback.",
+	},
+	{
+		gate:   service.HookConfirmFinalize,
+		stage:  "Together with the <confirm-promotion> gate, it will check the <confirm-finalize> gate before the promotion is finalized. This stage is not depicted in the diagram.",
+		opened: "it will finalize the promotion to the new version.",
+		closed: "it will halt the process before the new version is copied to the primary.",
+	},
+	{
+		gate:   service.HookPostRollout,
+		stage:  "Flagger will copy the canary deployment specification template over to the primary. After promotion is finalized, the <post-rollout> gate is checked. This stage is not depicted in the diagram.",
+		opened: "the process is completed.",
+		closed: "the process is pending finalization.",
+	},
+	{
+		gate:   service.HookRollback,
+		stage:  "The <rollback> gate is continuously monitored throughout the process.",
+		opened: "the rollback process is initiated.",
+		closed: "the rollout process continues.",
+	},
+}
+
+// explainSteps returns the numbered stages of the Flagger Canary process
+func explainSteps() string {
+	var b strings.Builder
+	for i, e := range gateExplanations {
+		fmt.Fprintf(&b, "%d. %s\n   * If the gate is open, %s\n   * If the gate is closed, %s\n\n", i+1, e.stage, e.opened, e.closed)
+	}
+	return b.String()
+}
+
+// findExplanation returns the explanation of the gate
+func findExplanation(gate string) (gateExplanation, bool) {
+	for _, e := range gateExplanations {
+		if string(e.gate) == gate {
+			return e, true
+		}
+	}
+	return gateExplanation{}, false
+}
+
+// explain prints the role of a gate and, when a deployment is given, its current state and what happens next.
+// Without a gate it shows the diagram of the whole process.
+func explain(ctx context.Context, cmd *cli.Command) error {
+	gate := cmd.Args().First()
+	if gate == "" {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+	e, ok := findExplanation(gate)
+	if !ok {
+		names := make([]string, 0, len(gateExplanations))
+		for _, e := range gateExplanations {
+			names = append(names, string(e.gate))
+		}
+		return fmt.Errorf("unknown gate '%s', expected one of %s", gate, strings.Join(names, ", "))
+	}
+	fmt.Printf("%s\n  * If the gate is open, %s\n  * If the gate is closed, %s\n", e.stage, e.opened, e.closed)
+
+	defaults, err := loadDefaults(cmd)
+	if err != nil {
+		return err
+	}
+	name := gateNameOf(cmd, defaults.flag(cmd, "deployment"))
+	if name == "" {
+		return nil
+	}
+	clusterAlias, err := clusterOf(cmd, defaults)
+	if err != nil {
+		return err
+	}
+	namespace := namespaceOf(cmd, defaults, clusterAlias)
+	method := "POST"
+	payload := &handler.CanaryGatePayload{
+		Type:      e.gate,
+		Name:      name,
+		Namespace: namespace,
+	}
+
+	//  Load Kubernetes Configuration
+	client, err := newGateClient(cmd, clusterAlias)
+	if err != nil {
+		return err
+	}
+
+	proxyPath, err := client.servicePath(ctx, namespace, method, "/status")
+	if err != nil {
+		return err
+	}
+	statusMap, err := requestAndRead(ctx, client, method, proxyPath, requestOptionsOf(cmd), payload, map[string][]handler.CanaryGateStatus{})
+	if err != nil {
+		return err
+	}
+	for _, statuses := range *statusMap {
+		for _, s := range statuses {
+			if s.Type == e.gate {
+				fmt.Printf("\nThe gate is %s for [%s/%s]. Next, %s\n", s.Status, namespace, name, e.next(s.Status))
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("status of gate '%s' is not found for [%s/%s]", gate, namespace, name)
+}
+
+// next describes what happens next when the gate is in the state
+func (e gateExplanation) next(status string) string {
+	if status == store.GATE_OPEN {
+		return e.opened
+	}
+	return e.closed
+}
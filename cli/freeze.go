@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/KongZ/canary-gate/handler"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+// freezeGates returns the action which freezes or unfreezes the confirm gates of every canary on the server. The
+// frozen gates are answered closed, regardless of their own state.
+func freezeGates(frozen bool) cli.ActionFunc {
+	return func(ctx context.Context, cmd *cli.Command) error {
+		defaults, err := loadDefaults(cmd)
+		if err != nil {
+			return err
+		}
+		clusterAlias, err := clusterOf(cmd, defaults)
+		if err != nil {
+			return err
+		}
+		namespace := namespaceOf(cmd, defaults, clusterAlias)
+		payload := &handler.FreezePayload{
+			Frozen: frozen,
+			User:   currentUser(cmd.String("kubeconfig"), clusterAlias),
+		}
+		if frozen {
+			payload.Reason = strings.TrimSpace(cmd.String("reason"))
+		}
+		client, err := newGateClient(cmd, clusterAlias)
+		if err != nil {
+			return err
+		}
+		proxyPath, err := client.servicePath(ctx, namespace, "POST", "/freeze")
+		if err != nil {
+			return err
+		}
+		freeze, err := requestAndRead(ctx, client, "POST", proxyPath, requestOptionsOf(cmd), payload, store.Freeze{})
+		if err != nil {
+			return err
+		}
+		event := log.Info().Bool("frozen", freeze.Frozen).Str("by", freeze.User).Str("at", freeze.Time.Format(time.RFC3339))
+		if freeze.Reason != "" {
+			event = event.Str("reason", freeze.Reason)
+		}
+		if freeze.Frozen {
+			event.Msgf("The confirm gates of every canary are frozen on [%s]", clusterAlias)
+		} else {
+			event.Msgf("The confirm gates of every canary are unfrozen on [%s]", clusterAlias)
+		}
+		return nil
+	}
+}
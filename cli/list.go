@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	piggysecv1alpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/urfave/cli/v3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// canaryGateResource is the resource of the CanaryGates read with the dynamic client
+var canaryGateResource = piggysecv1alpha1.GroupVersion.WithResource("canarygates")
+
+// gateSummary is a row of the list command
+type gateSummary struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Target    string `json:"target"`
+	// Status is "opened" when every gate lets the canary progress, or "closed" when a gate holds it
+	Status string `json:"status"`
+	// Blocking lists the closed gates, and the rollback gate when it is opened
+	Blocking  []string `json:"blocking,omitempty"`
+	Phase     string   `json:"phase,omitempty"`
+	Ready     string   `json:"ready"`
+	LastEvent string   `json:"lastEvent,omitempty"`
+}
+
+// list prints the CanaryGates of the namespace.
+func list(ctx context.Context, cmd *cli.Command) error {
+	defaults, err := loadDefaults(cmd)
+	if err != nil {
+		return err
+	}
+	clusterAlias, err := clusterName(defaults.flag(cmd, "cluster"))
+	if err != nil {
+		return err
+	}
+	namespace := namespaceOf(cmd, defaults, clusterAlias)
+	output := cmd.String("output")
+	if output != "" && output != "json" && output != "yaml" {
+		return fmt.Errorf("unknown output format '%s', use json or yaml", output)
+	}
+	client, err := loadDynamicClient(cmd.String("kubeconfig"), clusterAlias)
+	if err != nil {
+		return err
+	}
+	summaries, err := listSummaries(ctx, client, namespace, cmd.String("selector"))
+	if err != nil {
+		return err
+	}
+	return printSummaries(os.Stdout, summaries, output)
+}
+
+// listSummaries reads the CanaryGates of the namespace which match the label selector.
+func listSummaries(ctx context.Context, client dynamic.Interface, namespace string, selector string) ([]gateSummary, error) {
+	list, err := client.Resource(canaryGateResource).Namespace(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CanaryGates in namespace '%s': %w", namespace, err)
+	}
+	summaries := make([]gateSummary, 0, len(list.Items))
+	for _, item := range list.Items {
+		var gate piggysecv1alpha1.CanaryGate
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &gate); err != nil {
+			return nil, fmt.Errorf("failed to decode CanaryGate '%s': %w", item.GetName(), err)
+		}
+		summaries = append(summaries, summarize(&gate))
+	}
+	return summaries, nil
+}
+
+// summarize builds the list row of a CanaryGate
+func summarize(gate *piggysecv1alpha1.CanaryGate) gateSummary {
+	targets := make([]string, 0, len(gate.Spec.GetTargets()))
+	for _, target := range gate.Spec.GetTargets() {
+		targets = append(targets, target.Namespace+"/"+target.Name)
+	}
+	summary := gateSummary{
+		Name:      gate.Name,
+		Namespace: gate.Namespace,
+		Target:    strings.Join(targets, ","),
+		Status:    store.GATE_OPEN,
+		Phase:     gate.Status.Phase,
+		Ready:     string(metav1.ConditionUnknown),
+		LastEvent: gate.Status.Message,
+	}
+	gates := store.GatesOf(gate)
+	for _, t := range store.GateTypes {
+		// an opened rollback gate holds the canary like a closed gate
+		if gates[t] == (t == service.HookRollback) {
+			summary.Blocking = append(summary.Blocking, string(t))
+			summary.Status = store.GATE_CLOSE
+		}
+	}
+	if ready := meta.FindStatusCondition(gate.Status.Conditions, piggysecv1alpha1.ConditionReady); ready != nil {
+		summary.Ready = string(ready.Status)
+	}
+	return summary
+}
+
+// printSummaries writes the summaries as a table, or as JSON or YAML
+func printSummaries(w io.Writer, summaries []gateSummary, output string) error {
+	switch output {
+	case "json":
+		body, err := json.MarshalIndent(summaries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(body))
+		return err
+	case "yaml":
+		body, err := yaml.Marshal(summaries)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(body)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tTARGET\tSTATUS\tBLOCKING GATES\tPHASE\tREADY\tLAST EVENT")
+	for _, s := range summaries {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Name, s.Target, s.Status, dash(strings.Join(s.Blocking, ",")), dash(s.Phase), s.Ready, dash(s.LastEvent))
+	}
+	return tw.Flush()
+}
+
+// dash shows a dash for an empty column
+func dash(val string) string {
+	if val == "" {
+		return "-"
+	}
+	return val
+}
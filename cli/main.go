@@ -3,25 +3,42 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 
+	piggysecv1alpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
 	"github.com/KongZ/canary-gate/handler"
 	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v3"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-const cliVersion = "0.1.3"
+// Build information of the CLI, set through -ldflags "-X main.version=..."
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
 
 // main is the entry point of the application.
 func main() {
@@ -71,23 +88,31 @@ const serviceLabel = "app=canary-gate"
 const servicePortName = "http"
 const defaultNamespace = "canary-gate"
 
+// inClusterAlias selects the service account of the pod instead of a kubeconfig context
+const inClusterAlias = "in-cluster"
+
+// serviceAccountTokenPath is the token mounted into pods, which tells that the CLI runs inside a cluster
+var serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
 // createCliApp creates the CLI application using urfave/cli.
 func createCliApp() *cli.Command {
 	const OpenCommand = "open"
 	const CloseCommand = "close"
+	const ResetCommand = "reset"
 	const StatusCommand = "status"
+	const HistoryCommand = "history"
 	var verboseCount int
 	flags := []cli.Flag{
 		&cli.StringFlag{
 			Name:     "cluster",
 			Aliases:  []string{"c"},
-			Usage:    "The alias of the Kubernetes cluster to use (as defined in your kubeconfig)",
+			Usage:    "The alias of the Kubernetes cluster to use (as defined in your kubeconfig), or 'in-cluster' to use the service account of the pod",
 			Required: false,
 		},
 		&cli.StringFlag{
 			Name:     "namespace",
 			Aliases:  []string{"n"},
-			Usage:    "The namespace where the CanaryGate resources is located",
+			Usage:    "The namespace where the CanaryGate resources is located. Defaults to the namespace of the kubeconfig context, then canary-gate",
 			Required: false,
 		},
 		&cli.StringFlag{
@@ -96,6 +121,11 @@ func createCliApp() *cli.Command {
 			Usage:    "The name of the deployment to target",
 			Required: false,
 		},
+		&cli.StringFlag{
+			Name:     "gate-name",
+			Usage:    "The name of the CanaryGate, when it differs from the deployment. Defaults to --deployment",
+			Required: false,
+		},
 		&cli.BoolFlag{
 			Name:    "verbose",
 			Usage:   "Enable verbose logging",
@@ -108,6 +138,176 @@ func createCliApp() *cli.Command {
 			},
 		},
 	}
+	bulkFlags := []cli.Flag{
+		&cli.BoolFlag{
+			Name:     "all-deployments",
+			Usage:    "Apply the action to all CanaryGates in the namespace instead of --deployment",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "selector",
+			Aliases:  []string{"l"},
+			Usage:    "Apply the action to the CanaryGates matching the label selector instead of --deployment",
+			Required: false,
+		},
+	}
+	dryRunFlag := &cli.BoolFlag{
+		Name:     "dry-run",
+		Usage:    "Validate the change and print the would-be status without changing the gate",
+		Required: false,
+	}
+	forceFlag := &cli.BoolFlag{
+		Name:     "force",
+		Usage:    "Open a confirm gate during the cooldown after a rollback",
+		Required: false,
+	}
+	openFlags := append(slices.Concat(flags, bulkFlags),
+		&cli.DurationFlag{
+			Name:     "ttl",
+			Usage:    "Revert the gate to its default state after the given duration (e.g. 30m)",
+			Required: false,
+		},
+		dryRunFlag,
+		forceFlag,
+		&cli.BoolFlag{
+			Name:     "wait",
+			Usage:    "Wait until the canary reaches --wait-phase after opening the gate. Fails when the canary fails",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "wait-phase",
+			Usage:    "The phase of the canary which --wait waits for",
+			Value:    string(service.PhaseSucceeded),
+			Required: false,
+		},
+		&cli.DurationFlag{
+			Name:     "wait-timeout",
+			Usage:    "The maximum time of --wait",
+			Value:    30 * time.Minute,
+			Required: false,
+		},
+	)
+	closeFlags := append(slices.Concat(flags, bulkFlags), dryRunFlag)
+	resetFlags := slices.Concat(flags, bulkFlags)
+	statusFlags := append(slices.Clone(flags),
+		&cli.BoolFlag{
+			Name:     "watch",
+			Aliases:  []string{"w"},
+			Usage:    "Poll the status until interrupted",
+			Required: false,
+		},
+		&cli.DurationFlag{
+			Name:     "interval",
+			Usage:    "The polling interval of --watch",
+			Value:    2 * time.Second,
+			Required: false,
+		},
+	)
+	listFlags := append(slices.DeleteFunc(slices.Clone(flags), targetFlag),
+		&cli.StringFlag{
+			Name:     "selector",
+			Aliases:  []string{"l"},
+			Usage:    "List the CanaryGates matching the label selector",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "output",
+			Aliases:  []string{"o"},
+			Usage:    "The output format, json or yaml. Defaults to a table",
+			Required: false,
+		},
+	)
+	exportFlags := append(slices.DeleteFunc(slices.Clone(flags), targetFlag),
+		&cli.StringFlag{
+			Name:     "selector",
+			Aliases:  []string{"l"},
+			Usage:    "Export the CanaryGates matching the label selector",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "output",
+			Aliases:  []string{"o"},
+			Usage:    "The file to write the gates to. Defaults to stdout",
+			Required: false,
+		},
+	)
+	renderFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:     "file",
+			Aliases:  []string{"f"},
+			Usage:    "The CanaryGate file to render, or - to read stdin",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "endpoint",
+			Usage:    "The URL of the canary-gate service which Flagger calls, which is set by CANARY_GATE_ENDPOINT of the controller",
+			Value:    defaultEndpoint,
+			Sources:  cli.EnvVars("CANARY_GATE_ENDPOINT"),
+			Required: false,
+		},
+	}
+	importFlags := append(slices.DeleteFunc(slices.Clone(flags), targetFlag),
+		&cli.BoolFlag{
+			Name:     "include-rollback",
+			Usage:    "Also import the rollback gate. Opening it rolls back the running canaries",
+			Required: false,
+		},
+	)
+	rollbackFlags := append(slices.Clone(flags),
+		&cli.StringFlag{
+			Name:     "reason",
+			Aliases:  []string{"r"},
+			Usage:    "The reason of the rollback, which is recorded in the history and sent with the notification",
+			Required: true,
+		},
+	)
+	unfreezeFlags := slices.DeleteFunc(slices.Clone(flags), targetFlag)
+	freezeFlags := append(slices.Clone(unfreezeFlags),
+		&cli.StringFlag{
+			Name:     "reason",
+			Aliases:  []string{"r"},
+			Usage:    "The reason of the freeze, which is given in the answers of the frozen gates",
+			Required: false,
+		},
+	)
+	selectFlags := append(slices.DeleteFunc(slices.Clone(flags), targetFlag),
+		&cli.StringFlag{
+			Name:     "selector",
+			Aliases:  []string{"l"},
+			Usage:    "Change the gate of the CanaryGates matching the label selector",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:     "all-namespaces",
+			Aliases:  []string{"A"},
+			Usage:    "Select the CanaryGates of all namespaces instead of --namespace",
+			Required: false,
+		},
+	)
+	selectOpenFlags := append(slices.Clone(selectFlags),
+		&cli.DurationFlag{
+			Name:     "ttl",
+			Usage:    "Revert the gates to their default state after the given duration (e.g. 30m)",
+			Required: false,
+		},
+		forceFlag,
+	)
+	watchFlags := append(slices.Clone(flags),
+		&cli.DurationFlag{
+			Name:     "interval",
+			Usage:    "The polling interval of the progress",
+			Value:    2 * time.Second,
+			Required: false,
+		},
+	)
+	historyFlags := append(slices.Clone(flags),
+		&cli.IntFlag{
+			Name:     "limit",
+			Usage:    "The maximum number of changes to show",
+			Value:    20,
+			Required: false,
+		},
+	)
 	return &cli.Command{
 		Name:  "canary-gate",
 		Usage: "A CLI tool to interact with canary gate in the Flagger",
@@ -135,19 +335,28 @@ canary-gate status all --cluster my-cluster --namespace gate-namespace --deploym
 			{
 				Name:  OpenCommand,
 				Usage: "Open a canary gate.",
-				UsageText: `canary-gate open <gate-name> <global-options>
+				UsageText: `canary-gate open <gate-name> [<gate-name>...] <global-options>
 
 Example: 
 # CanaryGate is located within the 'gate-namespace' namespace, with the name 'my-deployment' on the 'my-cluster' cluster.
 
 # Open the confirm-rollout gate. 
-canary-gate open confirm-rollout --cluster my-cluster --namespace gate-namespace --deployment my-deployment`,
-				Flags: flags,
+canary-gate open confirm-rollout --cluster my-cluster --namespace gate-namespace --deployment my-deployment
+
+# Open the confirm-promotion gate for 30 minutes. 
+canary-gate open confirm-promotion --ttl 30m --cluster my-cluster --namespace gate-namespace --deployment my-deployment
+
+# Open the confirm-promotion gate and wait until the canary is promoted. 
+canary-gate open confirm-promotion --wait --wait-timeout 15m --cluster my-cluster --namespace gate-namespace --deployment my-deployment
+
+# Open the confirm-rollout and confirm-traffic-increase gates together. 
+canary-gate open confirm-rollout confirm-traffic-increase --cluster my-cluster --namespace gate-namespace --deployment my-deployment`,
+				Flags: openFlags,
 				Commands: []*cli.Command{
 					{
 						Name:  string(service.HookConfirmRollout),
 						Usage: "Enable the rollout of a new version.",
-						Flags: flags,
+						Flags: openFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, OpenCommand)
 						},
@@ -156,7 +365,7 @@ canary-gate open confirm-rollout --cluster my-cluster --namespace gate-namespace
 						Name:   string(service.HookPreRollout),
 						Usage:  "Allow the canary gate to adavance from pre-rollout state.",
 						Hidden: true, // Hide this gate. It it not useful.
-						Flags:  flags,
+						Flags:  openFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, OpenCommand)
 						},
@@ -164,7 +373,7 @@ canary-gate open confirm-rollout --cluster my-cluster --namespace gate-namespace
 					{
 						Name:  string(service.HookRollout),
 						Usage: "Allow rollout to be continued.",
-						Flags: flags,
+						Flags: openFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, OpenCommand)
 						},
@@ -172,7 +381,7 @@ canary-gate open confirm-rollout --cluster my-cluster --namespace gate-namespace
 					{
 						Name:  string(service.HookConfirmTrafficIncrease),
 						Usage: "Confirm the traffic increase after a rollout.",
-						Flags: flags,
+						Flags: openFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, OpenCommand)
 						},
@@ -180,7 +389,15 @@ canary-gate open confirm-rollout --cluster my-cluster --namespace gate-namespace
 					{
 						Name:  string(service.HookConfirmPromotion),
 						Usage: "Allow to promote the canary version to production.",
-						Flags: flags,
+						Flags: openFlags,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							return run(ctx, cmd, OpenCommand)
+						},
+					},
+					{
+						Name:  string(service.HookConfirmFinalize),
+						Usage: "Allow to finalize the promotion of the canary version.",
+						Flags: openFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, OpenCommand)
 						},
@@ -189,7 +406,7 @@ canary-gate open confirm-rollout --cluster my-cluster --namespace gate-namespace
 						Name:   string(service.HookPostRollout),
 						Usage:  "Confirm the post-rollout tasks.",
 						Hidden: true, // Hide this gate. It it not useful.
-						Flags:  flags,
+						Flags:  openFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, OpenCommand)
 						},
@@ -197,7 +414,7 @@ canary-gate open confirm-rollout --cluster my-cluster --namespace gate-namespace
 					{
 						Name:  string(service.HookRollback),
 						Usage: "Tell the canary gate to rollback the canary version. This gate can be opened during analysis or while waiting for a confirmation",
-						Flags: flags,
+						Flags: openFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, OpenCommand)
 						},
@@ -207,19 +424,22 @@ canary-gate open confirm-rollout --cluster my-cluster --namespace gate-namespace
 			{
 				Name:  CloseCommand,
 				Usage: "Close a canary gate.",
-				UsageText: `canary-gate close <gate-name> <global-options>
+				UsageText: `canary-gate close <gate-name> [<gate-name>...] <global-options>
 
 Example: 
 # CanaryGate is located within the 'gate-namespace' namespace, with the name 'my-deployment' on the 'my-cluster' cluster.
 
 # Close the confirm-rollout gate. 
-canary-gate close confirm-rollout --cluster my-cluster --namespace gate-namespace --deployment my-deployment`,
-				Flags: flags,
+canary-gate close confirm-rollout --cluster my-cluster --namespace gate-namespace --deployment my-deployment
+
+# Close the confirm-promotion gate of all CanaryGates in the namespace. 
+canary-gate close confirm-promotion --cluster my-cluster --namespace gate-namespace --all-deployments`,
+				Flags: closeFlags,
 				Commands: []*cli.Command{
 					{
 						Name:  string(service.HookConfirmRollout),
 						Usage: "Halt the rollout of a new version until confirm-rollout gate is opened again.",
-						Flags: flags,
+						Flags: closeFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, CloseCommand)
 						},
@@ -228,7 +448,7 @@ canary-gate close confirm-rollout --cluster my-cluster --namespace gate-namespac
 						Name:   string(service.HookPreRollout),
 						Usage:  "The canary advancement is paused if a pre-rollout gate is closed.",
 						Hidden: true, // Hide this gate. It it not useful.
-						Flags:  flags,
+						Flags:  closeFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, CloseCommand)
 						},
@@ -236,7 +456,7 @@ canary-gate close confirm-rollout --cluster my-cluster --namespace gate-namespac
 					{
 						Name:  string(service.HookRollout),
 						Usage: "Pause the rollout process and rollback if metrics check fails.",
-						Flags: flags,
+						Flags: closeFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, CloseCommand)
 						},
@@ -244,7 +464,7 @@ canary-gate close confirm-rollout --cluster my-cluster --namespace gate-namespac
 					{
 						Name:  string(service.HookConfirmTrafficIncrease),
 						Usage: "Pause the traffic increase after a rollout.",
-						Flags: flags,
+						Flags: closeFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, CloseCommand)
 						},
@@ -252,7 +472,15 @@ canary-gate close confirm-rollout --cluster my-cluster --namespace gate-namespac
 					{
 						Name:  string(service.HookConfirmPromotion),
 						Usage: "Halt the promotion of the canary version to production. While the promotion is paused, it will continue to run the metrics checks and rollout gate.",
-						Flags: flags,
+						Flags: closeFlags,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							return run(ctx, cmd, CloseCommand)
+						},
+					},
+					{
+						Name:  string(service.HookConfirmFinalize),
+						Usage: "Halt the finalization of the promotion before the canary version is copied to the primary.",
+						Flags: closeFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, CloseCommand)
 						},
@@ -261,7 +489,7 @@ canary-gate close confirm-rollout --cluster my-cluster --namespace gate-namespac
 						Name:   string(service.HookPostRollout),
 						Usage:  "Halt the post-rollout tasks",
 						Hidden: true, // Hide this gate. It it not useful.
-						Flags:  flags,
+						Flags:  closeFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, CloseCommand)
 						},
@@ -269,13 +497,26 @@ canary-gate close confirm-rollout --cluster my-cluster --namespace gate-namespac
 					{
 						Name:  string(service.HookRollback),
 						Usage: "Close the rollback gate. The rollback is still allowed if metrics check fails.",
-						Flags: flags,
+						Flags: closeFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, CloseCommand)
 						},
 					},
 				},
 			},
+			{
+				Name:  ResetCommand,
+				Usage: "Reset a canary gate to its default state, which is closed for the rollback gate and opened for the others.",
+				UsageText: `canary-gate reset <gate-name> <global-options>
+
+Example: 
+# CanaryGate is located within the 'gate-namespace' namespace, with the name 'my-deployment' on the 'my-cluster' cluster.
+
+# Reset the confirm-promotion gate, so it follows the default state again. 
+canary-gate reset confirm-promotion --cluster my-cluster --namespace gate-namespace --deployment my-deployment`,
+				Flags:    resetFlags,
+				Commands: resetCommands(resetFlags, func(ctx context.Context, cmd *cli.Command) error { return run(ctx, cmd, ResetCommand) }),
+			},
 			{
 				Name:  StatusCommand,
 				Usage: "Check status of a canary gate.",
@@ -288,13 +529,16 @@ Example:
 canary-gate status confirm-rollout --cluster my-cluster --namespace gate-namespace --deployment my-deployment
 
 # Check the status of a all gates
-canary-gate status all --cluster my-cluster --namespace gate-namespace --deployment my-deployment`,
-				Flags: flags,
+canary-gate status all --cluster my-cluster --namespace gate-namespace --deployment my-deployment
+
+# Watch the status of all gates every 5 seconds
+canary-gate status all --watch --interval 5s --cluster my-cluster --namespace gate-namespace --deployment my-deployment`,
+				Flags: statusFlags,
 				Commands: []*cli.Command{
 					{
 						Name:  "all",
 						Usage: "View status of all gates.",
-						Flags: flags,
+						Flags: statusFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, StatusCommand)
 						},
@@ -302,7 +546,7 @@ canary-gate status all --cluster my-cluster --namespace gate-namespace --deploym
 					{
 						Name:  string(service.HookConfirmRollout),
 						Usage: "View the status of the confirm-rollout gate.",
-						Flags: flags,
+						Flags: statusFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, StatusCommand)
 						},
@@ -310,7 +554,7 @@ canary-gate status all --cluster my-cluster --namespace gate-namespace --deploym
 					{
 						Name:   string(service.HookPreRollout),
 						Usage:  "View the status of the pre-rollout gate.",
-						Flags:  flags,
+						Flags:  statusFlags,
 						Hidden: true, // Hide this gate. It it not useful.
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, StatusCommand)
@@ -319,7 +563,7 @@ canary-gate status all --cluster my-cluster --namespace gate-namespace --deploym
 					{
 						Name:  string(service.HookRollout),
 						Usage: "View the status of the rollout gate.",
-						Flags: flags,
+						Flags: statusFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, StatusCommand)
 						},
@@ -327,7 +571,7 @@ canary-gate status all --cluster my-cluster --namespace gate-namespace --deploym
 					{
 						Name:  string(service.HookConfirmTrafficIncrease),
 						Usage: "View the status of the confirm-traffic-increase gate.",
-						Flags: flags,
+						Flags: statusFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, StatusCommand)
 						},
@@ -335,7 +579,15 @@ canary-gate status all --cluster my-cluster --namespace gate-namespace --deploym
 					{
 						Name:  string(service.HookConfirmPromotion),
 						Usage: "View the status of the confirm-promotion gate.",
-						Flags: flags,
+						Flags: statusFlags,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							return run(ctx, cmd, StatusCommand)
+						},
+					},
+					{
+						Name:  string(service.HookConfirmFinalize),
+						Usage: "View the status of the confirm-finalize gate.",
+						Flags: statusFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, StatusCommand)
 						},
@@ -344,7 +596,7 @@ canary-gate status all --cluster my-cluster --namespace gate-namespace --deploym
 						Name:   string(service.HookPostRollout),
 						Usage:  "View the status of the post-rollout gate.",
 						Hidden: true, // Hide this gate. It it not useful.
-						Flags:  flags,
+						Flags:  statusFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, StatusCommand)
 						},
@@ -352,7 +604,7 @@ canary-gate status all --cluster my-cluster --namespace gate-namespace --deploym
 					{
 						Name:  string(service.HookRollback),
 						Usage: "View the status of the rollback gate.",
-						Flags: flags,
+						Flags: statusFlags,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							return run(ctx, cmd, StatusCommand)
 						},
@@ -360,40 +612,163 @@ canary-gate status all --cluster my-cluster --namespace gate-namespace --deploym
 				},
 			},
 			{
-				Name:      "explain",
-				Usage:     "View the diagram and explain how of canary gate work",
-				UsageText: "View the diagram and explain how of canary gate work",
-				Description: "Displays the diagram of the canary gate workflow, showing how each gate work with open/close command.\n\n" +
-					diagram + `
-Each gate controls the flow of the Flagger Canary process.
+				Name:  HistoryCommand,
+				Usage: "View the last changes of a canary gate.",
+				UsageText: `canary-gate history <gate-name> <global-options>
+
+Example: 
+# View who opened or closed the confirm-promotion gate. 
+canary-gate history confirm-promotion --cluster my-cluster --namespace gate-namespace --deployment my-deployment
+
+# View the last 10 changes of all gates
+canary-gate history all --limit 10 --cluster my-cluster --namespace gate-namespace --deployment my-deployment`,
+				Flags:    historyFlags,
+				Commands: historyCommands(historyFlags),
+			},
+			{
+				Name:  "watch",
+				Usage: "Show the progress of a canary on a single line until it succeeds or fails.",
+				UsageText: `canary-gate watch <deployment> <global-options>
+
+Example: 
+# Follow the canary of 'my-deployment' in the 'gate-namespace' namespace of the 'my-cluster' cluster.
+# It exits with 0 when the canary succeeds, and with 1 when it fails.
+canary-gate watch my-deployment --cluster my-cluster --namespace gate-namespace`,
+				Flags:  watchFlags,
+				Action: watchProgress,
+			},
+			{
+				Name:  "events",
+				Usage: "Print the Kubernetes events of a CanaryGate as they are recorded, e.g. the gate changes and the reconcile results.",
+				UsageText: `canary-gate events <deployment> <global-options>
 
-1. When a new version is detected, it will check the <confirm-rollout> gate.
-   * If the gate is open, it will proceed to the next stage.
-   * If the gate is closed, it will halt the process and wait until the gate is opened.
+Example: 
+# Follow the events of the CanaryGate of 'my-deployment' in the 'gate-namespace' namespace of the 'my-cluster' cluster.
+canary-gate events my-deployment --cluster my-cluster --namespace gate-namespace`,
+				Flags:  flags,
+				Action: tailEvents,
+			},
+			{
+				Name:  "rollback",
+				Usage: "Roll back a canary now with a reason.",
+				UsageText: `canary-gate rollback <deployment> --reason <reason> <global-options>
 
-2. Next, it will check the <pre-rollout> gate. This stage is not depicted in the diagram.
-   * If the gate is open, it will proceed to the next stage.
-   * If the gate is closed, it will halt the process and wait until the gate is opened.
+Example: 
+# Roll back 'my-deployment' in the 'gate-namespace' namespace of the 'my-cluster' cluster.
+canary-gate rollback my-deployment --reason "error rate of checkout is increasing" --cluster my-cluster --namespace gate-namespace`,
+				Flags:  rollbackFlags,
+				Action: rollback,
+			},
+			{
+				Name:  "freeze",
+				Usage: "Close the confirm gates of every canary on the server, regardless of their own state.",
+				UsageText: `canary-gate freeze [--reason <reason>] <global-options>
 
-3. Flagger will begin increasing traffic based on the configuration in CanaryGate. Before each traffic increase, it will check the <rollout> and <confirm-traffic-increase> gates.
-   * If <rollout> is open, it will proceed to the next stage.
-   * If <rollout> is closed, it will halt the process and continue monitoring metrics. If metrics indicate failure, it will initiate a rollback.
-   * If <confirm-traffic-increase> is open, it will continue to increase traffic and proceed to the next stage.
-   * If <confirm-traffic-increase> is closed, it will halt the process.
+Example: 
+# Hold every canary of the 'my-cluster' cluster during a maintenance. The gates keep their state.
+canary-gate freeze --reason "database maintenance" --cluster my-cluster`,
+				Flags:  freezeFlags,
+				Action: freezeGates(true),
+			},
+			{
+				Name:  "unfreeze",
+				Usage: "Give the confirm gates of every canary on the server their own state again.",
+				UsageText: `canary-gate unfreeze <global-options>
 
-4. After increasing traffic until it reaches the maximum weight, it will check the <confirm-promotion> gate.
-   * If the gate is open, it will proceed to promote to the new version.
-   * If the gate is closed, it will halt the process and continue monitoring metrics. If metrics indicate failure, it will initiate a rollback.
+Example: 
+# Release the canaries of the 'my-cluster' cluster after a maintenance.
+canary-gate unfreeze --cluster my-cluster`,
+				Flags:  unfreezeFlags,
+				Action: freezeGates(false),
+			},
+			{
+				Name:  "select",
+				Usage: "Open or close a gate of every CanaryGate matching a label selector on the server.",
+				UsageText: `canary-gate select <open|close> <gate-name> --selector <selector> <global-options>
+
+Example: 
+# Hold the promotions of the CanaryGates labeled team=payments in every namespace during a release freeze.
+canary-gate select close confirm-promotion --selector team=payments --all-namespaces --cluster my-cluster
+
+# Release the promotions of the CanaryGates labeled team=payments in the 'gate-namespace' namespace.
+canary-gate select open confirm-promotion --selector team=payments --cluster my-cluster --namespace gate-namespace`,
+				Commands: []*cli.Command{
+					{
+						Name:      "open",
+						Usage:     "Open the gate of the selected CanaryGates.",
+						ArgsUsage: "<gate-name>",
+						Flags:     selectOpenFlags,
+						Action:    selectGates("/selector/open"),
+					},
+					{
+						Name:      "close",
+						Usage:     "Close the gate of the selected CanaryGates.",
+						ArgsUsage: "<gate-name>",
+						Flags:     selectFlags,
+						Action:    selectGates("/selector/close"),
+					},
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "List the CanaryGates of a namespace.",
+				UsageText: `canary-gate list <global-options>
+
+Example: 
+# List the CanaryGates in the 'gate-namespace' namespace of the 'my-cluster' cluster.
+canary-gate list --cluster my-cluster --namespace gate-namespace
+
+# List the CanaryGates labeled team=payments as YAML.
+canary-gate list --cluster my-cluster --namespace gate-namespace --selector team=payments -o yaml`,
+				Flags:  listFlags,
+				Action: list,
+			},
+			{
+				Name:  "export",
+				Usage: "Write the state of the gates of the CanaryGates of a namespace to a file.",
+				UsageText: `canary-gate export -o <file> <global-options>
+
+Example: 
+# Export the gates of the CanaryGates in the 'gate-namespace' namespace of the 'my-cluster' cluster.
+canary-gate export --cluster my-cluster --namespace gate-namespace -o gates.json`,
+				Flags:  exportFlags,
+				Action: export,
+			},
+			{
+				Name:  "import",
+				Usage: "Open or close the gates to the state of an exported file, and print the changed gates.",
+				UsageText: `canary-gate import <file> <global-options>
+
+Example: 
+# Restore the gates of gates.json on the 'other-cluster' cluster. The namespace of the file is used without --namespace.
+canary-gate import gates.json --cluster other-cluster`,
+				Flags:  importFlags,
+				Action: importSnapshot,
+			},
+			{
+				Name:  "render",
+				Usage: "Print the Flagger Canary which the controller creates for a CanaryGate file, without a cluster.",
+				UsageText: `canary-gate render -f <file> [--endpoint <url>] <global-options>
 
-5. Flagger will copy the canary deployment specification template over to the primary. After promotion is finalized, the <post-rollout> gate is checked. This stage is not depicted in the diagram.
-   * If the gate is open, the process is completed.
-   * If the gate is closed, the process is pending finalization.
+Example: 
+# Print the Flagger Canary of canarygate.yaml with the gates calling the service in the canary-gate namespace.
+canary-gate render -f canarygate.yaml`,
+				Flags:  renderFlags,
+				Action: render,
+			},
+			{
+				Name:  "explain",
+				Usage: "View the diagram and explain how of canary gate work, or the effect of a single gate",
+				UsageText: `canary-gate explain [gate] <global-options>
 
-6. The <rollback> gate is continuously monitored throughout the process.
-   * If the gate is open, the rollback process is initiated.
-   * If the gate is closed, the rollout process continues.
+Example: 
+# Explain the confirm-promotion gate and its current state for 'my-deployment'.
+canary-gate explain confirm-promotion --cluster my-cluster --namespace gate-namespace --deployment my-deployment`,
+				Description: "Displays the diagram of the canary gate workflow, showing how each gate work with open/close command.\n\n" +
+					diagram + `
+Each gate controls the flow of the Flagger Canary process.
 
-Example of canarygate CRD file:
+` + explainSteps() + `Example of canarygate CRD file:
 
 apiVersion: piggysec.com/v1alpha1
 kind: CanaryGate
@@ -419,6 +794,8 @@ spec:
 
 The configuration described will set up the Flagger Canary within the 'demons' namespace, identified by the name 'demo'. It will duplicate all configurations located under the 'flagger' field to the Flagger Canary. Following this, the Flagger Canary will be managed by the canary-gate controller; if the CanaryGate is altered, the controller will adjust the Flagger Canary as needed.
 `,
+				Flags:  flags,
+				Action: explain,
 			},
 			{
 				Name:      "version",
@@ -428,24 +805,87 @@ The configuration described will set up the Flagger Canary within the 'demons' n
 					&cli.StringFlag{
 						Name:     "cluster",
 						Aliases:  []string{"c"},
-						Usage:    "The alias of the Kubernetes cluster to use (as defined in your kubeconfig)",
+						Usage:    "The alias of the Kubernetes cluster to use (as defined in your kubeconfig), or 'in-cluster' to use the service account of the pod",
 						Required: false,
 					},
 					&cli.StringFlag{
 						Name:     "namespace",
 						Aliases:  []string{"n"},
-						Usage:    "The namespace where the CanaryGate resources is located",
+						Usage:    "The namespace where the CanaryGate resources is located. Defaults to the namespace of the kubeconfig context, then canary-gate",
 						Required: false,
 					},
 				},
 				Action: func(ctx context.Context, c *cli.Command) error {
 					log.Info().Msg("For more information, visit https://github.com/KongZ/canary-gate")
-					log.Info().Str("version", cliVersion).Msg("canary-gate CLI version")
+					log.Info().
+						Str("version", version).
+						Str("commit", commit).
+						Str("build date", buildDate).
+						Msg("canary-gate CLI version")
 					return serverVersion(ctx, c)
 				},
 			},
 		},
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "token",
+				Usage:    "The API token of the canary-gate service",
+				Sources:  cli.EnvVars("CANARY_GATE_API_TOKEN"),
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "ctx",
+				Usage:    "The context of the config file (~/.canary-gate.yaml or $CANARY_GATE_CONFIG) which supplies the defaults of --cluster, --namespace and --deployment",
+				Sources:  cli.EnvVars("CANARY_GATE_CONTEXT"),
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "timeout",
+				Usage:    "The maximum duration of a request to the canary-gate service, including its retries. 0 waits forever",
+				Value:    30 * time.Second,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "retries",
+				Usage:    "The number of retries of a request which fails with a transient error, e.g. connection refused or 5xx",
+				Value:    3,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "server-url",
+				Usage:    "The URL of the canary-gate service, e.g. http://localhost:8080 of a port-forward or https://canary-gate.example.com:8443. The requests are sent directly to the service instead of through the API server proxy",
+				Sources:  cli.EnvVars("CANARY_GATE_SERVER_URL"),
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "base-path",
+				Usage:    "The path prefix of the canary-gate service, which is set by CANARY_GATE_BASE_PATH of the service, e.g. /canary-gate",
+				Sources:  cli.EnvVars("CANARY_GATE_BASE_PATH"),
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "client-cert",
+				Usage:    "The client certificate file which authenticates the CLI to the service of --server-url",
+				Sources:  cli.EnvVars("CANARY_GATE_CLIENT_CERT"),
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "client-key",
+				Usage:    "The key file of --client-cert",
+				Sources:  cli.EnvVars("CANARY_GATE_CLIENT_KEY"),
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "ca-cert",
+				Usage:    "The CA file which verifies the certificate of the service of --server-url. Defaults to the system roots",
+				Sources:  cli.EnvVars("CANARY_GATE_CA_CERT"),
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "kubeconfig",
+				Usage:    "Path to the kubeconfig file. Defaults to $KUBECONFIG or ~/.kube/config",
+				Required: false,
+			},
 			&cli.BoolFlag{
 				Name:    "verbose",
 				Usage:   "Enable verbose logging",
@@ -475,51 +915,181 @@ func setLogLevel(level int) error {
 
 // run contains the main logic of the command.
 func run(ctx context.Context, cmd *cli.Command, gate string) error {
-	clusterAlias := cmd.String("cluster")
-	if clusterAlias == "" {
-		return fmt.Errorf("cluster name is required")
+	defaults, err := loadDefaults(cmd)
+	if err != nil {
+		return err
+	}
+	clusterAlias, err := clusterOf(cmd, defaults)
+	if err != nil {
+		return err
 	}
-	deployment := cmd.String("deployment")
-	if deployment == "" {
+	deployment := defaults.flag(cmd, "deployment")
+	name := gateNameOf(cmd, deployment)
+	selector := cmd.String("selector")
+	bulk := (gate == "open" || gate == "close" || gate == "reset") && name == "" && (cmd.Bool("all-deployments") || selector != "")
+	if name == "" && !bulk {
 		return fmt.Errorf("deployment name is required")
 	}
-	namespace := cmd.String("namespace")
-	if namespace == "" {
-		namespace = defaultNamespace
-		log.Debug().Msgf("Namespace is not specified, using default namespace '%s'", defaultNamespace)
+	wait := gate == "open" && cmd.Bool("wait")
+	if wait && (bulk || cmd.Bool("dry-run")) {
+		return fmt.Errorf("--wait cannot be used with --dry-run, --all-deployments or --selector")
 	}
+	namespace := namespaceOf(cmd, defaults, clusterAlias)
 	method := "POST"
 	canaryPath := fmt.Sprintf("/%s", gate)
-	payload := &handler.CanaryGatePayload{
+	query := url.Values{}
+	if (gate == "open" || gate == "close") && cmd.Bool("dry-run") {
+		query.Set("dryRun", "true")
+	}
+	if gate == "open" && cmd.Bool("force") {
+		query.Set("force", "true")
+	}
+	if len(query) > 0 {
+		canaryPath += "?" + query.Encode()
+	}
+	payload := handler.CanaryGatePayload{
 		Type:      service.HookType(cmd.Name),
-		Name:      deployment,
+		Name:      name,
 		Namespace: namespace,
 	}
+	if (gate == "open" || gate == "close") && cmd.Args().Present() {
+		types, err := gateTypesOf(cmd)
+		if err != nil {
+			return err
+		}
+		payload.Type, payload.Types = "", types
+	}
+	if ttl := cmd.Duration("ttl"); gate == "open" && ttl > 0 {
+		payload.TTL = ttl.String()
+	}
+	if gate == "open" || gate == "close" || gate == "reset" {
+		payload.User = currentUser(cmd.String("kubeconfig"), clusterAlias)
+	}
 
 	log.Debug().
 		Str("cluster", clusterAlias).
 		Str("action", canaryPath).
 		Str("gate", string(payload.Type)).
+		Interface("gates", payload.Types).
 		Str("namespace", namespace).
 		Str("deployment", deployment).
+		Str("gate-name", name).
+		Str("selector", selector).
+		Str("user", payload.User).
 		Msg("Starting operation")
 
 	//  Load Kubernetes Configuration
-	clientset, err := loadKubernetesConfig(clusterAlias)
+	client, err := newGateClient(cmd, clusterAlias)
 	if err != nil {
 		return err
 	}
 
-	proxyPath, err := findProxyPath(ctx, clientset, namespace, method, canaryPath)
+	proxyPath, err := client.servicePath(ctx, namespace, method, canaryPath)
 	if err != nil {
 		return err
 	}
+	if gate == "status" && cmd.Bool("watch") {
+		return watchGate(ctx, client, method, proxyPath, requestOptionsOf(cmd), &payload, cmd.Duration("interval"))
+	}
+	if !bulk {
+		err := requestGate(ctx, client, method, proxyPath, requestOptionsOf(cmd), &payload)
+		if err != nil || !wait {
+			return err
+		}
+		return waitForPhase(ctx, client, requestOptionsOf(cmd), payload, service.Phase(cmd.String("wait-phase")), cmd.Duration("wait-timeout"))
+	}
 
-	// Print the Response
-	var statusMap *map[string][]handler.CanaryGateStatus
-	if statusMap, err = requestAndRead(ctx, clientset, method, proxyPath, payload, map[string][]handler.CanaryGateStatus{}); err != nil {
+	// Apply the action to each CanaryGate
+	clientset, err := client.cluster()
+	if err != nil {
 		return err
 	}
+	deployments, err := listCanaryGates(ctx, clientset, namespace, selector)
+	if err != nil {
+		return err
+	}
+	if len(deployments) == 0 {
+		return fmt.Errorf("no CanaryGates found in namespace '%s'", namespace)
+	}
+	var failed []string
+	for _, name := range deployments {
+		target := payload
+		target.Name = name
+		if err := requestGate(ctx, client, method, proxyPath, requestOptionsOf(cmd), &target); err != nil {
+			log.Error().Err(err).Msgf("Unable to %s gate for [%s]", gate, name)
+			failed = append(failed, name)
+		}
+	}
+	log.Info().
+		Int("succeeded", len(deployments)-len(failed)).
+		Int("failed", len(failed)).
+		Msgf("Canary Gate %v %s is applied to %d deployments", gateNames(payload), gate, len(deployments))
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to %s gate for %s", gate, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// gateTypesOf returns the gate of the command followed by the gates in the arguments, which are opened or closed
+// together in a single request.
+func gateTypesOf(cmd *cli.Command) ([]service.HookType, error) {
+	types := []service.HookType{service.HookType(cmd.Name)}
+	for _, arg := range cmd.Args().Slice() {
+		t := service.HookType(arg)
+		if !slices.Contains(store.GateTypes, t) {
+			return nil, fmt.Errorf("unknown gate '%s'", arg)
+		}
+		if slices.Contains(types, t) {
+			return nil, fmt.Errorf("gate '%s' is repeated", arg)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// gateNameOf returns the name of the CanaryGate, which is the deployment unless --gate-name is set
+func gateNameOf(cmd *cli.Command, deployment string) string {
+	if name := cmd.String("gate-name"); name != "" {
+		return name
+	}
+	return deployment
+}
+
+// targetFlag reports whether the flag selects a single CanaryGate, which the commands of the namespace do not accept
+func targetFlag(f cli.Flag) bool {
+	return f.Names()[0] == "deployment" || f.Names()[0] == "gate-name"
+}
+
+// gateNames returns the gates of the payload for the logs
+func gateNames(payload handler.CanaryGatePayload) []service.HookType {
+	if len(payload.Types) > 0 {
+		return payload.Types
+	}
+	return []service.HookType{payload.Type}
+}
+
+// resetCommands creates a reset command of each gate. The pre-rollout and post-rollout gates are hidden like the
+// open and close commands.
+func resetCommands(flags []cli.Flag, action cli.ActionFunc) []*cli.Command {
+	commands := make([]*cli.Command, 0, len(store.GateTypes))
+	for _, gate := range store.GateTypes {
+		commands = append(commands, &cli.Command{
+			Name:   string(gate),
+			Usage:  fmt.Sprintf("Reset the %s gate to its default state.", gate),
+			Hidden: gate == service.HookPreRollout || gate == service.HookPostRollout,
+			Flags:  flags,
+			Action: action,
+		})
+	}
+	return commands
+}
+
+// requestGate sends the gate request and prints the response.
+func requestGate[P any](ctx context.Context, client *gateClient, method string, proxyPath string, opts requestOptions, payload P) error {
+	statusMap, err := requestAndRead(ctx, client, method, proxyPath, opts, payload, map[string][]handler.CanaryGateStatus{})
+	if err != nil {
+		return cooldownError(err)
+	}
 	for _, v := range *statusMap {
 		pad := "%-25s"
 		if len(v) == 1 {
@@ -531,27 +1101,250 @@ func run(ctx context.Context, cmd *cli.Command, gate string) error {
 					Str("last event", s.Status).
 					Msgf("Canary Gate Status for [%s]", s.Name)
 			} else {
-				log.Info().
+				event := log.Info().
 					Str("gate", fmt.Sprintf(pad, string(s.Type))).
-					Str("status", s.Status).
-					Msgf("Canary Gate Status for [%s]", s.Name)
+					Str("status", s.Status)
+				if s.ChangedBy != "" {
+					event = event.Str("by", s.ChangedBy)
+				}
+				if s.RequiredApprovals > 0 {
+					event = event.Str("approvals", fmt.Sprintf("%d/%d", s.Approvals, s.RequiredApprovals))
+				}
+				if s.LastDecision != "" {
+					event = event.Str("last decision", fmt.Sprintf("%s at %s", s.LastDecision, s.LastDecisionAt))
+				}
+				if s.Frozen {
+					event = event.Bool("frozen", true)
+				}
+				if s.DryRun {
+					event.Msgf("Canary Gate Dry Run for [%s], the gate is not changed", s.Name)
+					continue
+				}
+				event.Msgf("Canary Gate Status for [%s]", s.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// cooldownError explains the conflict of a confirm gate which is opened during the cooldown after a rollback, or
+// returns the error
+func cooldownError(err error) error {
+	body, ok := conflictBody(err)
+	if !ok {
+		return err
+	}
+	var conflict handler.CooldownConflict
+	if json.Unmarshal([]byte(body), &conflict) != nil || conflict.Remaining == "" {
+		return err
+	}
+	return fmt.Errorf("gate '%s' cannot be opened for %s after the rollback at %s, retry later or use --force",
+		conflict.Gate, conflict.Remaining, conflict.RolledBackAt.Format(time.RFC3339))
+}
+
+// conflictBody returns the body of a 409 Conflict answered by the service, directly or through the pod proxy
+func conflictBody(err error) (string, bool) {
+	var direct *statusError
+	if errors.As(err, &direct) {
+		return direct.body, direct.code == http.StatusConflict
+	}
+	var status k8serrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Code != http.StatusConflict || status.Status().Details == nil {
+		return "", false
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type == metav1.CauseTypeUnexpectedServerResponse {
+			return cause.Message, true
+		}
+	}
+	return "", false
+}
+
+// watchGate redraws the gate status every interval until interrupted.
+func watchGate(ctx context.Context, client *gateClient, method string, proxyPath string, opts requestOptions, payload *handler.CanaryGatePayload, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// clear the screen and move the cursor to the top
+		fmt.Print("\x1b[H\x1b[2J")
+		if err := requestGate(ctx, client, method, proxyPath, opts, payload); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Error().Err(err).Msg("Unable to get the status")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitInterval is the polling interval of --wait
+var waitInterval = 5 * time.Second
+
+// waitForPhase polls the status of the canary of the opened gate until the canary reaches the phase. It fails when
+// the canary fails or the timeout passes. The phase is the phase of the last webhook of Flagger.
+func waitForPhase(ctx context.Context, client *gateClient, opts requestOptions, opened handler.CanaryGatePayload, phase service.Phase, timeout time.Duration) error {
+	proxyPath, err := client.servicePath(ctx, opened.Namespace, "POST", "/status")
+	if err != nil {
+		return err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	payload := handler.CanaryGatePayload{Type: gateNames(opened)[0], Name: opened.Name, Namespace: opened.Namespace}
+	canary := fmt.Sprintf("%s/%s", opened.Namespace, opened.Name)
+	ticker := time.NewTicker(waitInterval)
+	defer ticker.Stop()
+	var last service.Phase
+	for {
+		statusMap, err := requestAndRead(ctx, client, "POST", proxyPath, opts, &payload, map[string][]handler.CanaryGateStatus{})
+		if err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msgf("Unable to get the status of [%s]", canary)
+		}
+		if err == nil {
+			for _, s := range (*statusMap)[canary] {
+				if s.Type != service.HookEvent {
+					continue
+				}
+				if s.Phase != last {
+					log.Info().Str("phase", string(s.Phase)).Str("last event", s.Status).Msgf("Waiting for [%s] to be %s", canary, phase)
+					last = s.Phase
+				}
+				switch s.Phase {
+				case phase:
+					return nil
+				case service.PhaseFailed:
+					return fmt.Errorf("canary [%s] failed: %s", canary, s.Status)
+				}
 			}
 		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %s waiting for [%s] to be %s, the last phase is '%s'", timeout, canary, phase, last)
+		case <-ticker.C:
+		}
+	}
+}
+
+// listCanaryGates returns the names of the CanaryGates in the namespace which match the label selector.
+func listCanaryGates(ctx context.Context, clientset *kubernetes.Clientset, namespace string, selector string) ([]string, error) {
+	req := clientset.CoreV1().RESTClient().Get().
+		AbsPath("/apis", piggysecv1alpha1.GroupVersion.Group, piggysecv1alpha1.GroupVersion.Version, "namespaces", namespace, "canarygates")
+	if selector != "" {
+		req = req.Param("labelSelector", selector)
+	}
+	rawBody, err := req.DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CanaryGates in namespace '%s': %w", namespace, err)
+	}
+	var list piggysecv1alpha1.CanaryGateList
+	if err := json.Unmarshal(rawBody, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode CanaryGates: %w", err)
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		names = append(names, item.Name)
+	}
+	return names, nil
+}
+
+// historyCommands creates the history subcommands of all gates.
+func historyCommands(flags []cli.Flag) []*cli.Command {
+	commands := []*cli.Command{}
+	for _, gate := range append([]service.HookType{service.HookAll}, store.GateTypes...) {
+		commands = append(commands, &cli.Command{
+			Name:   string(gate),
+			Usage:  fmt.Sprintf("View the changes of the %s gate.", gate),
+			Flags:  flags,
+			Hidden: gate == service.HookPreRollout || gate == service.HookPostRollout, // Hide these gates. They are not useful.
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				return history(ctx, cmd)
+			},
+		})
+	}
+	return commands
+}
+
+// history prints the last changes of the gates.
+func history(ctx context.Context, cmd *cli.Command) error {
+	defaults, err := loadDefaults(cmd)
+	if err != nil {
+		return err
+	}
+	clusterAlias, err := clusterOf(cmd, defaults)
+	if err != nil {
+		return err
+	}
+	name := gateNameOf(cmd, defaults.flag(cmd, "deployment"))
+	if name == "" {
+		return fmt.Errorf("deployment name is required")
+	}
+	namespace := namespaceOf(cmd, defaults, clusterAlias)
+	method := "POST"
+	path := "/history"
+	payload := &handler.CanaryGatePayload{
+		Type:      service.HookType(cmd.Name),
+		Name:      name,
+		Namespace: namespace,
+		Limit:     cmd.Int("limit"),
+	}
+
+	//  Load Kubernetes Configuration
+	client, err := newGateClient(cmd, clusterAlias)
+	if err != nil {
+		return err
+	}
+
+	proxyPath, err := client.servicePath(ctx, namespace, method, path)
+	if err != nil {
+		return err
+	}
+
+	// Print the Response
+	var entries *[]store.HistoryEntry
+	if entries, err = requestAndRead(ctx, client, method, proxyPath, requestOptionsOf(cmd), payload, []store.HistoryEntry{}); err != nil {
+		return err
+	}
+	if len(*entries) == 0 {
+		log.Info().Msgf("No changes of [%s/%s]", namespace, name)
+	}
+	for _, e := range *entries {
+		event := log.Info().
+			Str("time", e.Time.Local().Format(time.RFC3339)).
+			Str("gate", fmt.Sprintf("%-25s", string(e.Type))).
+			Str("status", e.Status)
+		if e.User != "" {
+			event = event.Str("by", e.User)
+		}
+		if e.Reason != "" {
+			event = event.Str("reason", e.Reason)
+		}
+		event.Msgf("Canary Gate History for [%s]", name)
 	}
 	return nil
 }
 
 // serverVersion get the server version of the canary gate service.
 func serverVersion(ctx context.Context, cmd *cli.Command) error {
-	clusterAlias := cmd.String("cluster")
-	if clusterAlias == "" {
-		return fmt.Errorf("cluster name is required")
+	defaults, err := loadDefaults(cmd)
+	if err != nil {
+		return err
 	}
-	namespace := cmd.String("namespace")
-	if namespace == "" {
-		namespace = defaultNamespace
-		log.Debug().Msgf("Namespace is not specified, using default namespace '%s'", defaultNamespace)
+	clusterAlias, err := clusterOf(cmd, defaults)
+	if err != nil {
+		return err
 	}
+	namespace := namespaceOf(cmd, defaults, clusterAlias)
 	method := "GET"
 	path := "/version"
 
@@ -562,47 +1355,139 @@ func serverVersion(ctx context.Context, cmd *cli.Command) error {
 		Msg("Starting operation")
 
 	//  Load Kubernetes Configuration
-	clientset, err := loadKubernetesConfig(clusterAlias)
+	client, err := newGateClient(cmd, clusterAlias)
 	if err != nil {
-		return fmt.Errorf("failed to create kubernetes clientset: %w", err)
+		return fmt.Errorf("failed to create canary-gate client: %w", err)
 	}
 
-	proxyPath, err := findProxyPath(ctx, clientset, namespace, method, path)
+	proxyPath, err := client.servicePath(ctx, namespace, method, path)
 	if err != nil {
 		return err
 	}
 
 	// Print the Response
 	var v *handler.ServerVersion
-	if v, err = requestAndRead(ctx, clientset, method, proxyPath, "", handler.ServerVersion{}); err != nil {
+	if v, err = requestAndRead(ctx, client, method, proxyPath, requestOptionsOf(cmd), "", handler.ServerVersion{}); err != nil {
 		return fmt.Errorf("failed to read response payload: %w", err)
 	}
 	log.Info().
 		Str("version", v.Version).
+		Str("commit", v.Commit).
+		Str("build date", v.BuildDate).
 		Msg("Canary Gate Server Version")
 	return nil
 }
 
+// requestOptions controls the requests to the canary-gate service
+type requestOptions struct {
+	// token is the API token of the service
+	token string
+	// timeout bounds the request and its retries, 0 waits forever
+	timeout time.Duration
+	// attempts is the number of attempts of a request which fails with a transient error
+	attempts int
+}
+
+// requestOptionsOf reads the request options from the global flags
+func requestOptionsOf(cmd *cli.Command) requestOptions {
+	return requestOptions{
+		token:    cmd.String("token"),
+		timeout:  cmd.Duration("timeout"),
+		attempts: int(cmd.Int("retries")) + 1,
+	}
+}
+
+// retryDelay is the delay before the first retry, which doubles on each retry up to maxRetryDelay
+var retryDelay = 500 * time.Millisecond
+
+const maxRetryDelay = 5 * time.Second
+
 // requestAndRead a shortcut function to send a request and read the response payload.
-func requestAndRead[P any, R any](ctx context.Context, clientset *kubernetes.Clientset, method string, proxyPath string, payload P, response R) (*R, error) {
+// Transient errors, e.g. a restarting pod, are retried with backoff until the attempts or the timeout are exhausted.
+func requestAndRead[P any, R any](ctx context.Context, client *gateClient, method string, proxyPath string, opts requestOptions, payload P, response R) (*R, error) {
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		rawBody, err := request(ctx, client, method, proxyPath, opts.token, payload)
+		if err == nil {
+			// Print the Response
+			return readPayload(rawBody, response)
+		}
+		if attempt >= opts.attempts || !isTransient(err) {
+			return new(R), err
+		}
+		log.Debug().Err(err).Msgf("Request to %s failed, retrying in %s (attempt %d of %d)", proxyPath, delay, attempt+1, opts.attempts)
+		select {
+		case <-ctx.Done():
+			return new(R), fmt.Errorf("request to pod proxy failed: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// request sends a request to the pod proxy, or directly to the service, and returns the raw response body
+func request[P any](ctx context.Context, client *gateClient, method string, proxyPath string, token string, payload P) ([]byte, error) {
+	if client.httpClient != nil {
+		return client.directRequest(ctx, method, proxyPath, token, writePayload(&payload))
+	}
 	// Use AbsPath to set the full path for the request, bypassing the builder.
-	req := clientset.CoreV1().RESTClient().Verb(method).AbsPath(proxyPath)
+	// The query of the path is set as parameters since AbsPath escapes it.
+	path, query, _ := strings.Cut(proxyPath, "?")
+	req := client.clientset.CoreV1().RESTClient().Verb(method).AbsPath(path)
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query of %s: %w", proxyPath, err)
+	}
+	for k, v := range params {
+		for _, val := range v {
+			req.Param(k, val)
+		}
+	}
 	req.Body(writePayload(&payload))
 	req.SetHeader("Content-Type", "application/json")
+	if token != "" {
+		// The API server drops the Authorization header when proxying to the pod
+		req.SetHeader(handler.TokenHeader, token)
+	}
 
 	// Execute the request and get the raw result.
 	result := req.Do(ctx)
 	if err := result.Error(); err != nil {
-		return new(R), fmt.Errorf("request to pod proxy failed: %w", err)
+		return nil, fmt.Errorf("request to pod proxy failed: %w", err)
 	}
 
 	// Get the raw response body.
 	rawBody, err := result.Raw()
 	if err != nil {
-		return new(R), fmt.Errorf("failed to get raw response from proxy: %w", err)
+		return nil, fmt.Errorf("failed to get raw response from proxy: %w", err)
 	}
-	// Print the Response
-	return readPayload(rawBody, response)
+	return rawBody, nil
+}
+
+// isTransient checks whether a failed request may succeed when it is retried: the connection failed,
+// or the proxy or the service answered with 429 or 5xx.
+func isTransient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if utilnet.IsConnectionRefused(err) || utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err) {
+		return true
+	}
+	var status k8serrors.APIStatus
+	if errors.As(err, &status) {
+		code := status.Status().Code
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	var direct *statusError
+	if errors.As(err, &direct) {
+		return direct.code == http.StatusTooManyRequests || direct.code >= http.StatusInternalServerError
+	}
+	return false
 }
 
 // findProxyPath constructs the path to the Kubernetes API server proxy for the specified service and canary path.
@@ -648,23 +1533,117 @@ func findProxyPath(ctx context.Context, clientset *kubernetes.Clientset, namespa
 }
 
 // loadKubernetesConfig loads the Kubernetes configuration for the specified cluster alias.
-func loadKubernetesConfig(clusterAlias string) (*kubernetes.Clientset, error) {
-	kubeconfigPath := filepath.Join(os.Getenv("HOME"), ".kube", "config")
-	configLoadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath}
-	configOverrides := &clientcmd.ConfigOverrides{CurrentContext: clusterAlias}
-	kubeconfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(configLoadingRules, configOverrides)
+// The kubeconfig path overrides the KUBECONFIG environment variable and the default ~/.kube/config when set.
+func loadKubernetesConfig(kubeconfigPath string, clusterAlias string) (*kubernetes.Clientset, error) {
+	restConfig, err := loadRestConfig(kubeconfigPath, clusterAlias)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+	return clientset, nil
+}
+
+// loadDynamicClient creates a dynamic client for the specified cluster alias, which reads the CanaryGates
+// without their typed client.
+func loadDynamicClient(kubeconfigPath string, clusterAlias string) (dynamic.Interface, error) {
+	restConfig, err := loadRestConfig(kubeconfigPath, clusterAlias)
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes dynamic client: %w", err)
+	}
+	return client, nil
+}
 
-	restConfig, err := kubeconfig.ClientConfig()
+// loadRestConfig loads the REST config of the cluster alias, or of the service account of the pod for 'in-cluster'.
+func loadRestConfig(kubeconfigPath string, clusterAlias string) (*rest.Config, error) {
+	var restConfig *rest.Config
+	var err error
+	if clusterAlias == inClusterAlias {
+		restConfig, err = rest.InClusterConfig()
+	} else {
+		restConfig, err = newClientConfig(kubeconfigPath, clusterAlias).ClientConfig()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to load kubernetes config for cluster '%s': %w", clusterAlias, err)
 	}
 	log.Trace().Str("host", restConfig.Host).Msg("Kubernetes config loaded")
+	return restConfig, nil
+}
 
-	clientset, err := kubernetes.NewForConfig(restConfig)
+// clusterName returns the cluster alias of the --cluster flag. When the flag is empty inside a pod,
+// the service account of the pod is used, so the CLI can run from a Job without a kubeconfig.
+func clusterName(clusterAlias string) (string, error) {
+	if clusterAlias != "" {
+		return clusterAlias, nil
+	}
+	if _, err := os.Stat(serviceAccountTokenPath); err == nil {
+		log.Debug().Msg("Cluster is not specified, using the in-cluster config")
+		return inClusterAlias, nil
+	}
+	return "", fmt.Errorf("cluster name is required")
+}
+
+// newClientConfig creates a client config which follows the kubectl loading rules.
+func newClientConfig(kubeconfigPath string, clusterAlias string) clientcmd.ClientConfig {
+	configLoadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	configLoadingRules.ExplicitPath = kubeconfigPath
+	configOverrides := &clientcmd.ConfigOverrides{CurrentContext: clusterAlias}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(configLoadingRules, configOverrides)
+}
+
+// currentUser returns the user of the kubeconfig context, or $USER when the context has no user.
+func currentUser(kubeconfigPath string, clusterAlias string) string {
+	rawConfig, err := newClientConfig(kubeconfigPath, clusterAlias).RawConfig()
+	if err == nil {
+		contextName := clusterAlias
+		if contextName == "" {
+			contextName = rawConfig.CurrentContext
+		}
+		if kubeContext, ok := rawConfig.Contexts[contextName]; ok && kubeContext.AuthInfo != "" {
+			return kubeContext.AuthInfo
+		}
+	}
+	return os.Getenv("USER")
+}
+
+// namespaceOf returns the namespace of the command. When --namespace is omitted, it falls back to the namespace of
+// the kubeconfig context like kubectl does, and then to the canary-gate namespace.
+func namespaceOf(cmd *cli.Command, defaults cliDefaults, clusterAlias string) string {
+	if namespace := defaults.flag(cmd, "namespace"); namespace != "" {
+		return namespace
+	}
+	if namespace := contextNamespace(cmd.String("kubeconfig"), clusterAlias); namespace != "" {
+		log.Debug().Msgf("Namespace is not specified, using namespace '%s' of the kubeconfig context", namespace)
+		return namespace
+	}
+	log.Debug().Msgf("Namespace is not specified, using default namespace '%s'", defaultNamespace)
+	return defaultNamespace
+}
+
+// contextNamespace returns the namespace of the kubeconfig context, or empty when the context has no namespace.
+// The raw config is read since ClientConfig.Namespace() answers "default" for a context without a namespace.
+func contextNamespace(kubeconfigPath string, clusterAlias string) string {
+	if clusterAlias == inClusterAlias {
+		return ""
+	}
+	rawConfig, err := newClientConfig(kubeconfigPath, clusterAlias).RawConfig()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+		return ""
 	}
-	return clientset, nil
+	contextName := clusterAlias
+	if contextName == "" {
+		contextName = rawConfig.CurrentContext
+	}
+	if kubeContext, ok := rawConfig.Contexts[contextName]; ok {
+		return kubeContext.Namespace
+	}
+	return ""
 }
 
 // findServiceByLabel finds the first service that matches the given label selector.
@@ -685,7 +1664,8 @@ func findServiceByLabel(clientset *kubernetes.Clientset, namespace, labelSelecto
 // findRunningPod locates a running pod associated with a given Kubernetes service.
 // It first retrieves the service definition to find its label selector. Then, it
 // lists all pods matching that selector within the specified namespace. It iterates
-// through the resulting pods and returns the first one that is in the 'Running' state.
+// through the resulting pods and returns the first one that is Ready, or the first
+// one that is in the 'Running' state when none is Ready.
 //
 // An error is returned if the service cannot be found, if the service has no
 // selector, if no pods match the selector, or if none of the matching pods are
@@ -706,15 +1686,41 @@ func findRunningPod(ctx context.Context, clientset *kubernetes.Clientset, namesp
 	if err != nil || len(pods.Items) == 0 {
 		return nil, fmt.Errorf("failed to find any pods for service '%s' with selector '%s': %w", svc, labelSelector, err)
 	}
-	for i := range pods.Items {
-		pod := &pods.Items[i]
-		if pod.Status.Phase == corev1.PodRunning {
-			return pod, nil
-		}
+	if pod := selectPod(pods.Items); pod != nil {
+		return pod, nil
 	}
 	return nil, fmt.Errorf("no running pods found")
 }
 
+// selectPod returns the first running pod which is Ready, falling back to the first running pod.
+// Pods which are being deleted are skipped.
+func selectPod(pods []corev1.Pod) *corev1.Pod {
+	var running *corev1.Pod
+	for i := range pods {
+		pod := &pods[i]
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		if isPodReady(pod) {
+			return pod
+		}
+		if running == nil {
+			running = pod
+		}
+	}
+	return running
+}
+
+// isPodReady checks the Ready condition of the pod
+func isPodReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
 // findPodPortFromServicePort resolves a service port to a numeric pod container port.
 func findPodPortFromServicePort(pod *corev1.Pod, service *corev1.Service, servicePortName string) (int, error) {
 	var servicePort *corev1.ServicePort
@@ -0,0 +1,912 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	piggysecv1alpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/handler"
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	kfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: %[1]s
+  cluster:
+    server: https://%[1]s.example.com
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s
+users:
+- name: %[1]s
+  user:
+    token: test-token
+current-context: %[1]s
+`
+
+func writeKubeconfig(t *testing.T, cluster string) string {
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, fmt.Appendf(nil, testKubeconfig, cluster), 0o600))
+	return path
+}
+
+func TestNewClientConfig(t *testing.T) {
+	t.Setenv("KUBECONFIG", writeKubeconfig(t, "env-cluster"))
+
+	// KUBECONFIG is used when the kubeconfig flag is not set
+	restConfig, err := newClientConfig("", "env-cluster").ClientConfig()
+	require.NoError(t, err)
+	require.Equal(t, "https://env-cluster.example.com", restConfig.Host)
+
+	// the kubeconfig flag overrides KUBECONFIG
+	restConfig, err = newClientConfig(writeKubeconfig(t, "flag-cluster"), "flag-cluster").ClientConfig()
+	require.NoError(t, err)
+	require.Equal(t, "https://flag-cluster.example.com", restConfig.Host)
+
+	// the cluster alias must exist in the kubeconfig
+	_, err = newClientConfig("", "unknown-cluster").ClientConfig()
+	require.Error(t, err)
+}
+
+func TestCurrentUser(t *testing.T) {
+	t.Setenv("USER", "local-user")
+	kubeconfig := writeKubeconfig(t, "test-cluster")
+
+	// the user of the kubeconfig context
+	require.Equal(t, "test-cluster", currentUser(kubeconfig, "test-cluster"))
+
+	// $USER when the context is not found
+	require.Equal(t, "local-user", currentUser(kubeconfig, "unknown-cluster"))
+}
+
+func TestClusterName(t *testing.T) {
+	defer func(path string) {
+		serviceAccountTokenPath = path
+	}(serviceAccountTokenPath)
+	serviceAccountTokenPath = filepath.Join(t.TempDir(), "token")
+
+	// the flag is required outside of a pod
+	_, err := clusterName("")
+	require.Error(t, err)
+	cluster, err := clusterName("my-cluster")
+	require.NoError(t, err)
+	require.Equal(t, "my-cluster", cluster)
+
+	// the service account token selects the in-cluster config
+	require.NoError(t, os.WriteFile(serviceAccountTokenPath, []byte("token"), 0o600))
+	cluster, err = clusterName("")
+	require.NoError(t, err)
+	require.Equal(t, inClusterAlias, cluster)
+	cluster, err = clusterName("my-cluster")
+	require.NoError(t, err)
+	require.Equal(t, "my-cluster", cluster)
+}
+
+func testPod(name string, phase corev1.PodPhase, ready bool, deleting bool) corev1.Pod {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+	if deleting {
+		now := metav1.Now()
+		pod.DeletionTimestamp = &now
+	}
+	return pod
+}
+
+func TestSelectPod(t *testing.T) {
+	pending := testPod("pending", corev1.PodPending, false, false)
+	running := testPod("running", corev1.PodRunning, false, false)
+	ready := testPod("ready", corev1.PodRunning, true, false)
+	deleting := testPod("deleting", corev1.PodRunning, true, true)
+
+	// a Ready pod is preferred over a merely Running pod
+	require.Equal(t, "ready", selectPod([]corev1.Pod{pending, running, deleting, ready}).Name)
+	// fall back to a Running pod when none is Ready
+	require.Equal(t, "running", selectPod([]corev1.Pod{pending, deleting, running}).Name)
+	// pods which are being deleted or not running are skipped
+	require.Nil(t, selectPod([]corev1.Pod{pending, deleting}))
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("CANARY_GATE_CONFIG", "")
+	load := func(args ...string) (cliDefaults, error) {
+		var defaults cliDefaults
+		var err error
+		cmd := &cli.Command{
+			Name: "test",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "ctx"},
+				&cli.StringFlag{Name: "cluster"},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				defaults, err = loadDefaults(c)
+				if err == nil {
+					defaults.Cluster = defaults.flag(c, "cluster")
+				}
+				return nil
+			},
+		}
+		require.NoError(t, cmd.Run(context.Background(), append([]string{"test"}, args...)))
+		return defaults, err
+	}
+
+	// no defaults without the config file
+	defaults, err := load()
+	require.NoError(t, err)
+	require.Equal(t, cliDefaults{}, defaults)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`cluster: my-cluster
+namespace: gate-namespace
+contexts:
+  demo:
+    deployment: demo
+  other:
+    cluster: other-cluster
+    deployment: other
+`), 0o600))
+	t.Setenv("CANARY_GATE_CONFIG", path)
+	defaults, err = load()
+	require.NoError(t, err)
+	require.Equal(t, cliDefaults{Cluster: "my-cluster", Namespace: "gate-namespace"}, defaults)
+
+	// a context overrides the top-level defaults
+	defaults, err = load("--ctx", "other")
+	require.NoError(t, err)
+	require.Equal(t, cliDefaults{Cluster: "other-cluster", Namespace: "gate-namespace", Deployment: "other"}, defaults)
+
+	// flags take precedence over the config file
+	defaults, err = load("--ctx", "demo", "--cluster", "flag-cluster")
+	require.NoError(t, err)
+	require.Equal(t, cliDefaults{Cluster: "flag-cluster", Namespace: "gate-namespace", Deployment: "demo"}, defaults)
+
+	_, err = load("--ctx", "unknown")
+	require.Error(t, err)
+
+	// the config file set by $CANARY_GATE_CONFIG must exist
+	t.Setenv("CANARY_GATE_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+	_, err = load()
+	require.Error(t, err)
+}
+
+func TestListSummaries(t *testing.T) {
+	newGate := func(name string, spec map[string]any, status map[string]any) *unstructured.Unstructured {
+		gate := &unstructured.Unstructured{Object: map[string]any{"spec": spec, "status": status}}
+		gate.SetGroupVersionKind(piggysecv1alpha1.GroupVersion.WithKind("CanaryGate"))
+		gate.SetNamespace("gate-ns")
+		gate.SetName(name)
+		return gate
+	}
+	client := dfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		canaryGateResource: "CanaryGateList",
+	},
+		newGate("demo", map[string]any{
+			"target":            map[string]any{"namespace": "demo-ns", "name": "demo"},
+			"confirm-promotion": "closed",
+		}, map[string]any{
+			"message":    "Gate [demo-ns/demo=confirm-promotion] is set to [closed]",
+			"phase":      "WaitingPromotion",
+			"conditions": []any{map[string]any{"type": "Ready", "status": "True", "reason": "Reconciled", "lastTransitionTime": "2025-01-02T03:04:05Z"}},
+		}),
+		newGate("other", map[string]any{
+			"target": map[string]any{"namespace": "other-ns", "name": "other"},
+		}, map[string]any{}),
+	)
+
+	summaries, err := listSummaries(context.TODO(), client, "gate-ns", "")
+	require.NoError(t, err)
+	require.Len(t, summaries, 2)
+	require.Equal(t, gateSummary{
+		Name:      "demo",
+		Namespace: "gate-ns",
+		Target:    "demo-ns/demo",
+		Status:    "closed",
+		Blocking:  []string{"confirm-promotion"},
+		Phase:     "WaitingPromotion",
+		Ready:     "True",
+		LastEvent: "Gate [demo-ns/demo=confirm-promotion] is set to [closed]",
+	}, summaries[0])
+	require.Equal(t, gateSummary{Name: "other", Namespace: "gate-ns", Target: "other-ns/other", Status: "opened", Ready: "Unknown"}, summaries[1])
+
+	var out bytes.Buffer
+	require.NoError(t, printSummaries(&out, summaries, ""))
+	require.Contains(t, out.String(), "NAME")
+	require.Contains(t, out.String(), "confirm-promotion")
+	out.Reset()
+	require.NoError(t, printSummaries(&out, summaries, "json"))
+	require.Contains(t, out.String(), `"blocking": [`)
+	out.Reset()
+	require.NoError(t, printSummaries(&out, summaries, "yaml"))
+	require.Contains(t, out.String(), "- blocking:\n  - confirm-promotion\n")
+}
+
+func TestRequestAndReadRetry(t *testing.T) {
+	retryDelay = time.Millisecond
+	defer func() { retryDelay = 500 * time.Millisecond }()
+	var calls atomic.Int32
+	failures := int32(2)
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte(`{"version":"v1.2.3"}`))
+	}))
+	defer server.Close()
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+	client := &gateClient{clientset: clientset}
+
+	// transient errors are retried
+	v, err := requestAndRead(context.TODO(), client, "GET", "/version", requestOptions{attempts: 3}, "", handler.ServerVersion{})
+	require.NoError(t, err)
+	require.Equal(t, "v1.2.3", v.Version)
+	require.Equal(t, int32(3), calls.Load())
+
+	// the attempts are exhausted
+	calls.Store(0)
+	_, err = requestAndRead(context.TODO(), client, "GET", "/version", requestOptions{attempts: 2}, "", handler.ServerVersion{})
+	require.Error(t, err)
+	require.Equal(t, int32(2), calls.Load())
+
+	// other errors are not retried
+	calls.Store(0)
+	status = http.StatusBadRequest
+	_, err = requestAndRead(context.TODO(), client, "GET", "/version", requestOptions{attempts: 3}, "", handler.ServerVersion{})
+	require.Error(t, err)
+	require.Equal(t, int32(1), calls.Load())
+
+	// the timeout bounds the retries
+	calls.Store(0)
+	failures = 100
+	status = http.StatusBadGateway
+	retryDelay = time.Second
+	_, err = requestAndRead(context.TODO(), client, "GET", "/version", requestOptions{attempts: 10, timeout: 50 * time.Millisecond}, "", handler.ServerVersion{})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestRequestQuery(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+
+	// the query of the proxy path is sent as parameters
+	_, err = request(context.TODO(), &gateClient{clientset: clientset}, "POST", "/api/v1/namespaces/ns/pods/pod:8080/proxy/open?dryRun=true", "", "")
+	require.NoError(t, err)
+	require.Equal(t, "true", query.Get("dryRun"))
+}
+
+// writeTestCert signs a certificate of the name with the parent, or self-signs a CA when the parent is nil,
+// and writes its PEM files to the directory
+func writeTestCert(t *testing.T, dir string, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func TestDirectRequest(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeTestCert(t, dir, "ca", nil, nil)
+	writeTestCert(t, dir, "server", ca, caKey)
+	writeTestCert(t, dir, "client", ca, caKey)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	var user, token string
+	tlsConfig, err := handler.NewTLSConfig(path("server.crt"), path("server.key"), path("ca.crt"))
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = r.TLS.PeerCertificates[0].Subject.CommonName
+		token = r.Header.Get("Authorization")
+		if r.URL.Path != "/version" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"version":"v1.2.3"}`))
+	}))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	// the client certificate authenticates the CLI
+	httpClient, err := newTLSClient(path("client.crt"), path("client.key"), path("ca.crt"))
+	require.NoError(t, err)
+	client := &gateClient{httpClient: httpClient, serverURL: server.URL}
+	v, err := requestAndRead(context.TODO(), client, "GET", "/version", requestOptions{attempts: 1, token: "api-token"}, "", handler.ServerVersion{})
+	require.NoError(t, err)
+	require.Equal(t, "v1.2.3", v.Version)
+	require.Equal(t, "client", user)
+	require.Equal(t, "Bearer api-token", token)
+
+	// the error status is not transient
+	_, err = requestAndRead(context.TODO(), client, "GET", "/unknown", requestOptions{attempts: 3}, "", handler.ServerVersion{})
+	require.Error(t, err)
+	require.False(t, isTransient(err))
+
+	// the service rejects the CLI without a client certificate
+	httpClient, err = newTLSClient("", "", path("ca.crt"))
+	require.NoError(t, err)
+	client = &gateClient{httpClient: httpClient, serverURL: server.URL}
+	_, err = requestAndRead(context.TODO(), client, "GET", "/version", requestOptions{attempts: 1}, "", handler.ServerVersion{})
+	require.Error(t, err)
+}
+
+func TestDirectRequestPlain(t *testing.T) {
+	var method, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		_, _ = w.Write([]byte(`{"version":"v1.2.3"}`))
+	}))
+	defer server.Close()
+
+	serverURL, err := parseServerURL(server.URL + "/")
+	require.NoError(t, err)
+	client := &gateClient{httpClient: &http.Client{}, serverURL: serverURL}
+	v, err := requestAndRead(context.TODO(), client, "GET", "/version", requestOptions{attempts: 1}, "", handler.ServerVersion{})
+	require.NoError(t, err)
+	require.Equal(t, "v1.2.3", v.Version)
+	require.Equal(t, "GET", method)
+	require.Equal(t, "/version", path)
+
+	for _, invalid := range []string{"localhost:8080", "ftp://localhost", "http://"} {
+		_, err = parseServerURL(invalid)
+		require.Errorf(t, err, "server URL '%s' should be invalid", invalid)
+	}
+}
+
+func TestResetCommand(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	h := handler.NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	server := httptest.NewServer(h.ResetGate())
+	defer server.Close()
+	key := store.StoreKey{Namespace: "gate-ns", Name: "demo", Type: service.HookConfirmPromotion}
+	storage.GateClose(t.Context(), key, "alice")
+
+	err = createCliApp().Run(context.TODO(), []string{"canary-gate", "reset", string(key.Type),
+		"--server-url", server.URL, "--namespace", key.Namespace, "--deployment", key.Name})
+	require.NoError(t, err)
+	require.True(t, storage.IsGateOpen(context.TODO(), key))
+}
+
+func TestBasePath(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	h := handler.NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	mux := http.NewServeMux()
+	mux.Handle("/close", h.CloseGate())
+	server := httptest.NewServer(handler.Mount("/canary-gate", mux))
+	defer server.Close()
+	key := store.StoreKey{Namespace: "gate-ns", Name: "demo", Type: service.HookConfirmPromotion}
+	args := []string{"canary-gate", "close", string(key.Type), "--server-url", server.URL, "--namespace", key.Namespace, "--deployment", key.Name, "--retries", "0"}
+
+	require.Error(t, createCliApp().Run(context.TODO(), args))
+	require.True(t, storage.IsGateOpen(context.TODO(), key))
+	require.NoError(t, createCliApp().Run(context.TODO(), append(args, "--base-path", "canary-gate/")))
+	require.False(t, storage.IsGateOpen(context.TODO(), key))
+}
+
+func TestSelectCommand(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	h := handler.NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	canaryGate := func(namespace string, name string, team string) runtime.Object {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "piggysec.com/v1alpha1",
+			"kind":       "CanaryGate",
+			"metadata":   map[string]any{"name": name, "namespace": namespace, "labels": map[string]any{"team": team}},
+		}}
+	}
+	client := dfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		store.GroupVersionResource: "CanaryGateList",
+	}, canaryGate("team-a", "checkout", "payments"), canaryGate("team-b", "billing", "payments"), canaryGate("team-a", "search", "discovery"))
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	informer := factory.ForResource(store.GroupVersionResource)
+	factory.Start(t.Context().Done())
+	require.True(t, cache.WaitForCacheSync(t.Context().Done(), informer.Informer().HasSynced))
+	mux := http.NewServeMux()
+	mux.Handle("/selector/open", h.OpenSelectedGates(informer))
+	mux.Handle("/selector/close", h.CloseSelectedGates(informer))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	gate := func(namespace string, name string) store.StoreKey {
+		return store.StoreKey{Namespace: namespace, Name: name, Type: service.HookConfirmPromotion}
+	}
+
+	err = createCliApp().Run(context.TODO(), []string{"canary-gate", "select", "close", string(service.HookConfirmPromotion),
+		"--server-url", server.URL, "--selector", "team=payments", "--all-namespaces"})
+	require.NoError(t, err)
+	require.False(t, storage.IsGateOpen(context.TODO(), gate("team-a", "checkout")))
+	require.False(t, storage.IsGateOpen(context.TODO(), gate("team-b", "billing")))
+	require.True(t, storage.IsGateOpen(context.TODO(), gate("team-a", "search")))
+
+	err = createCliApp().Run(context.TODO(), []string{"canary-gate", "select", "open", string(service.HookConfirmPromotion),
+		"--server-url", server.URL, "--selector", "team=payments", "--namespace", "team-b", "--ttl", "30m"})
+	require.NoError(t, err)
+	require.False(t, storage.IsGateOpen(context.TODO(), gate("team-a", "checkout")))
+	require.True(t, storage.IsGateOpen(context.TODO(), gate("team-b", "billing")))
+
+	err = createCliApp().Run(context.TODO(), []string{"canary-gate", "select", "open", "promote",
+		"--server-url", server.URL, "--selector", "team=payments"})
+	require.ErrorContains(t, err, "unknown gate 'promote'")
+}
+
+func TestFreezeCommand(t *testing.T) {
+	memory, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	t.Setenv("CANARY_GATE_NAMESPACE", "canary-gate")
+	storage, err := store.NewFreezeStore(memory, kfake.NewSimpleClientset())
+	require.NoError(t, err)
+	defer storage.Shutdown()
+	h := handler.NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	h.UseFreezer(storage)
+	server := httptest.NewServer(h.Freeze())
+	defer server.Close()
+	key := store.StoreKey{Namespace: "gate-ns", Name: "demo", Type: service.HookConfirmPromotion}
+	storage.GateOpen(context.TODO(), key, "alice")
+
+	require.NoError(t, createCliApp().Run(context.TODO(), []string{"canary-gate", "freeze", "--server-url", server.URL, "--reason", "maintenance"}))
+	freeze, err := storage.GetFreeze(context.TODO())
+	require.NoError(t, err)
+	require.True(t, freeze.Frozen)
+	require.Equal(t, "maintenance", freeze.Reason)
+	require.False(t, storage.IsGateOpen(context.TODO(), key))
+
+	require.NoError(t, createCliApp().Run(context.TODO(), []string{"canary-gate", "unfreeze", "--server-url", server.URL}))
+	require.True(t, storage.IsGateOpen(context.TODO(), key))
+}
+
+func TestOpenMultipleGates(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	h := handler.NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	server := httptest.NewServer(h.OpenGate())
+	defer server.Close()
+	rollout := store.StoreKey{Namespace: "gate-ns", Name: "demo", Type: service.HookConfirmRollout}
+	promotion := store.StoreKey{Namespace: "gate-ns", Name: "demo", Type: service.HookConfirmPromotion}
+	storage.GateClose(t.Context(), rollout, "")
+	storage.GateClose(t.Context(), promotion, "")
+
+	err = createCliApp().Run(context.TODO(), []string{"canary-gate", "open", string(rollout.Type), string(promotion.Type),
+		"--server-url", server.URL, "--namespace", "gate-ns", "--deployment", "demo"})
+	require.NoError(t, err)
+	require.True(t, storage.IsGateOpen(context.TODO(), rollout))
+	require.True(t, storage.IsGateOpen(context.TODO(), promotion))
+
+	err = createCliApp().Run(context.TODO(), []string{"canary-gate", "open", string(rollout.Type), "promote",
+		"--server-url", server.URL, "--namespace", "gate-ns", "--deployment", "demo"})
+	require.ErrorContains(t, err, "unknown gate 'promote'")
+}
+
+func TestOpenWait(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	h := handler.NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	mux := http.NewServeMux()
+	mux.Handle("/open", h.OpenGate())
+	mux.Handle("/status", h.StatusGate())
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer func(interval time.Duration) { waitInterval = interval }(waitInterval)
+	waitInterval = 10 * time.Millisecond
+	canary := store.StoreKey{Namespace: "gate-ns", Name: "demo"}
+	open := func(args ...string) error {
+		return createCliApp().Run(context.TODO(), append([]string{"canary-gate", "open", string(service.HookConfirmPromotion),
+			"--server-url", server.URL, "--namespace", canary.Namespace, "--deployment", canary.Name, "--wait"}, args...))
+	}
+
+	storage.UpdatePhase(t.Context(), canary, string(service.PhaseSucceeded))
+	require.NoError(t, open())
+
+	storage.UpdatePhase(t.Context(), canary, string(service.PhaseFailed))
+	require.ErrorContains(t, open(), "failed")
+
+	storage.UpdatePhase(t.Context(), canary, string(service.PhasePromoting))
+	require.ErrorContains(t, open("--wait-timeout", "50ms"), "timed out")
+	require.NoError(t, open("--wait-phase", string(service.PhasePromoting)))
+
+	require.ErrorContains(t, open("--dry-run"), "--wait cannot be used")
+}
+
+func TestOpenCooldown(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	h := handler.NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	h.RollbackCooldown(time.Hour)
+	mux := http.NewServeMux()
+	mux.Handle("/open", h.OpenGate())
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	canary := store.StoreKey{Namespace: "gate-ns", Name: "demo"}
+	open := func(args ...string) error {
+		return createCliApp().Run(context.TODO(), append([]string{"canary-gate", "open", string(service.HookConfirmPromotion),
+			"--server-url", server.URL, "--namespace", canary.Namespace, "--deployment", canary.Name}, args...))
+	}
+
+	storage.SetRolledBackAt(t.Context(), canary, time.Now().Add(-15*time.Minute))
+	err = open()
+	require.ErrorContains(t, err, "after the rollback")
+	require.ErrorContains(t, err, "--force")
+	require.NoError(t, open("--force"))
+}
+
+func TestExplainSteps(t *testing.T) {
+	steps := explainSteps()
+	for _, gate := range store.GateTypes {
+		if gate == service.HookEvent {
+			continue
+		}
+		e, ok := findExplanation(string(gate))
+		require.Truef(t, ok, "gate [%s] is not explained", gate)
+		require.Contains(t, steps, e.stage)
+		require.Equal(t, e.opened, e.next(store.GATE_OPEN))
+		require.Equal(t, e.closed, e.next(store.GATE_CLOSE))
+	}
+	_, ok := findExplanation("promote")
+	require.False(t, ok)
+}
+
+// newTestGateProxy serves the CanaryGates and the gate API of a cluster whose gates are kept in the store
+func newTestGateProxy(t *testing.T, storage store.Store, names ...string) *gateProxy {
+	h := handler.NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	const podPath = "/api/v1/namespaces/gate-ns/pods/canary-gate-0:8080/proxy"
+	mux := http.NewServeMux()
+	mux.Handle(podPath+"/open", h.OpenGate())
+	mux.Handle(podPath+"/close", h.CloseGate())
+	mux.Handle(podPath+"/status", h.StatusGate())
+	mux.HandleFunc("/apis/piggysec.com/v1alpha1/namespaces/gate-ns/canarygates", func(w http.ResponseWriter, r *http.Request) {
+		var list piggysecv1alpha1.CanaryGateList
+		for _, name := range names {
+			list.Items = append(list.Items, piggysecv1alpha1.CanaryGate{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "gate-ns"}})
+		}
+		_, _ = w.Write(writePayload(&list))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+	return &gateProxy{client: &gateClient{clientset: clientset}, opts: requestOptions{attempts: 1}, path: podPath, user: "alice"}
+}
+
+func TestExportImport(t *testing.T) {
+	source, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	source.GateClose(t.Context(), store.StoreKey{Namespace: "gate-ns", Name: "demo", Type: service.HookConfirmPromotion}, "bob")
+	source.GateOpen(t.Context(), store.StoreKey{Namespace: "gate-ns", Name: "demo", Type: service.HookRollback}, "bob")
+	source.GateClose(t.Context(), store.StoreKey{Namespace: "gate-ns", Name: "web", Type: service.HookConfirmRollout}, "bob")
+	target, err := store.NewMemoryStore()
+	require.NoError(t, err)
+
+	snap, err := exportGates(context.TODO(), newTestGateProxy(t, source, "demo", "web"), "gate-ns", "")
+	require.NoError(t, err)
+	require.Len(t, snap.CanaryGates, 2)
+	require.Equal(t, store.GATE_CLOSE, snap.CanaryGates[0].Gates[service.HookConfirmPromotion])
+	require.Equal(t, store.GATE_OPEN, snap.CanaryGates[0].Gates[service.HookRollback])
+
+	// the snapshot is written to a file and read back
+	path := filepath.Join(t.TempDir(), "gates.json")
+	require.NoError(t, os.WriteFile(path, writePayload(snap), 0o600))
+	snap, err = readSnapshot(path)
+	require.NoError(t, err)
+
+	// only the gates which differ are changed
+	proxy := newTestGateProxy(t, target, "demo", "web")
+	var out bytes.Buffer
+	changed, err := importGates(context.TODO(), proxy, snap, "gate-ns", false, &out)
+	require.NoError(t, err)
+	require.Equal(t, 2, changed)
+	require.Equal(t, "gate-ns/demo confirm-promotion: opened -> closed\n"+
+		"gate-ns/web confirm-rollout: opened -> closed\n", out.String())
+	require.False(t, target.IsGateOpen(context.TODO(), store.StoreKey{Namespace: "gate-ns", Name: "demo", Type: service.HookRollback}))
+
+	// the rollback gate is imported only when it is included
+	out.Reset()
+	target, err = store.NewMemoryStore()
+	require.NoError(t, err)
+	proxy = newTestGateProxy(t, target, "demo", "web")
+	changed, err = importGates(context.TODO(), proxy, snap, "gate-ns", true, &out)
+	require.NoError(t, err)
+	require.Equal(t, 3, changed)
+	require.Equal(t, "gate-ns/demo confirm-promotion: opened -> closed\n"+
+		"gate-ns/demo rollback: closed -> opened\n"+
+		"gate-ns/web confirm-rollout: opened -> closed\n", out.String())
+	for _, name := range []string{"demo", "web"} {
+		for _, gate := range store.GateTypes {
+			key := store.StoreKey{Namespace: "gate-ns", Name: name, Type: gate}
+			require.Equalf(t, source.IsGateOpen(context.TODO(), key), target.IsGateOpen(context.TODO(), key), "gate [%s]", key.String())
+		}
+	}
+	require.Equal(t, "alice", target.GetChangedBy(context.TODO(), store.StoreKey{Namespace: "gate-ns", Name: "web", Type: service.HookConfirmRollout}))
+
+	// importing again changes nothing
+	out.Reset()
+	changed, err = importGates(context.TODO(), proxy, snap, "gate-ns", true, &out)
+	require.NoError(t, err)
+	require.Zero(t, changed)
+	require.Empty(t, out.String())
+}
+
+func TestReadSnapshot(t *testing.T) {
+	write := func(body string) string {
+		path := filepath.Join(t.TempDir(), "gates.json")
+		require.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+		return path
+	}
+	_, err := readSnapshot(write(`{"namespace":"gate-ns","canaryGates":[{"name":"demo","gates":{"rollback":"opened"}}]}`))
+	require.NoError(t, err)
+	_, err = readSnapshot(write(`{"canaryGates":[{"name":"demo","gates":{"promote":"opened"}}]}`))
+	require.ErrorContains(t, err, "unknown gate [promote]")
+	_, err = readSnapshot(write(`{"canaryGates":[{"name":"demo","gates":{"rollback":"open"}}]}`))
+	require.ErrorContains(t, err, "unknown state 'open'")
+	_, err = readSnapshot(write(`{"canaryGates":[{"gates":{}}]}`))
+	require.ErrorContains(t, err, "without name")
+	_, err = readSnapshot(write(`not json`))
+	require.Error(t, err)
+}
+
+func TestNamespaceOf(t *testing.T) {
+	kubeconfig := writeKubeconfig(t, "test-cluster")
+	namespaced := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(namespaced, []byte(strings.Replace(fmt.Sprintf(testKubeconfig, "ns-cluster"), "    cluster: ns-cluster\n", "    cluster: ns-cluster\n    namespace: context-ns\n", 1)), 0o600))
+
+	cases := []struct {
+		name       string
+		args       []string
+		kubeconfig string
+		expected   string
+	}{
+		{"flag", []string{"--namespace", "flag-ns"}, namespaced, "flag-ns"},
+		{"context", nil, namespaced, "context-ns"},
+		{"default", nil, kubeconfig, defaultNamespace},
+	}
+	for _, c := range cases {
+		var namespace string
+		cmd := &cli.Command{
+			Flags: []cli.Flag{&cli.StringFlag{Name: "namespace"}, &cli.StringFlag{Name: "kubeconfig"}},
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				namespace = namespaceOf(cmd, cliDefaults{}, "")
+				return nil
+			},
+		}
+		require.NoError(t, cmd.Run(context.Background(), append([]string{"canary-gate", "--kubeconfig", c.kubeconfig}, c.args...)))
+		require.Equalf(t, c.expected, namespace, "[%s] unexpected namespace", c.name)
+	}
+	// the in-cluster config has no kubeconfig context
+	require.Empty(t, contextNamespace(namespaced, inClusterAlias))
+}
+
+func TestGateName(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	h := handler.NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	server := httptest.NewServer(h.CloseGate())
+	defer server.Close()
+	key := store.StoreKey{Namespace: "gate-ns", Name: "demo-gate", Type: service.HookConfirmPromotion}
+
+	// the gate name is sent instead of the deployment
+	err = createCliApp().Run(context.TODO(), []string{"canary-gate", "close", string(key.Type),
+		"--server-url", server.URL, "--namespace", key.Namespace, "--deployment", "demo", "--gate-name", key.Name})
+	require.NoError(t, err)
+	require.False(t, storage.IsGateOpen(context.TODO(), key))
+	require.True(t, storage.IsGateOpen(context.TODO(), store.StoreKey{Namespace: "gate-ns", Name: "demo", Type: service.HookConfirmPromotion}))
+
+	// the gate name defaults to the deployment
+	err = createCliApp().Run(context.TODO(), []string{"canary-gate", "close", string(key.Type),
+		"--server-url", server.URL, "--namespace", key.Namespace, "--deployment", "demo"})
+	require.NoError(t, err)
+	require.False(t, storage.IsGateOpen(context.TODO(), store.StoreKey{Namespace: "gate-ns", Name: "demo", Type: service.HookConfirmPromotion}))
+}
+
+func TestRenderCanaryGates(t *testing.T) {
+	gates := `apiVersion: piggysec.com/v1alpha1
+kind: CanaryGate
+metadata:
+  name: demo
+  namespace: gate-ns
+spec:
+  confirm-rollout: opened
+  webhookTimeout: not-a-duration
+  target:
+    namespace: demo-ns
+    name: demo
+  flagger:
+    targetRef:
+      apiVersion: apps/v1
+      kind: Deployment
+      name: demo
+    service:
+      port: 8080
+    analysis:
+      interval: 1m
+---
+`
+	var out, warnings bytes.Buffer
+	require.NoError(t, renderCanaryGates(strings.NewReader(gates+gates), &out, &warnings, "http://gate.example:8080/base"))
+	documents := strings.Split(out.String(), "---\n")
+	require.Len(t, documents, 2)
+	require.Contains(t, documents[0], "kind: Canary\n")
+	require.Contains(t, documents[0], "apiVersion: flagger.app/v1beta1\n")
+	require.Contains(t, documents[0], "url: http://gate.example:8080/base/confirm-rollout\n")
+	require.NotContains(t, documents[0], "status:")
+	require.NotContains(t, documents[0], "creationTimestamp")
+	require.Contains(t, warnings.String(), "CanaryGate 'demo'")
+
+	require.ErrorContains(t, renderCanaryGates(strings.NewReader("---\n"), &out, &warnings, ""), "no CanaryGate found")
+	require.ErrorContains(t, renderCanaryGates(strings.NewReader("kind: Canary\n"), &out, &warnings, ""), "'Canary' is not a CanaryGate")
+	require.ErrorContains(t, renderCanaryGates(strings.NewReader("kind: CanaryGate\nmetadata:\n  name: demo\nspec:\n  backend: argo\n"), &out, &warnings, ""), "only the flagger backend")
+
+	path := filepath.Join(t.TempDir(), "canarygate.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(gates), 0o600))
+	require.NoError(t, createCliApp().Run(context.TODO(), []string{"canary-gate", "render", "-f", path}))
+}
+
+func TestReadProgress(t *testing.T) {
+	statuses := func(phase service.Phase, closed ...service.HookType) []handler.CanaryGateStatus {
+		var result []handler.CanaryGateStatus
+		for _, gate := range store.GateTypes {
+			status := store.GATE_OPEN
+			if gate == service.HookRollback || slices.Contains(closed, gate) {
+				status = store.GATE_CLOSE
+			}
+			result = append(result, handler.CanaryGateStatus{Type: gate, Status: status})
+		}
+		return append(result, handler.CanaryGateStatus{Type: service.HookEvent, Status: "New revision detected", Phase: phase})
+	}
+
+	// the closed gate which Flagger checks in the phase is blocking
+	p := readProgress(statuses(service.PhaseWaitingPromotion, service.HookConfirmPromotion, service.HookConfirmRollout))
+	require.Equal(t, service.HookConfirmPromotion, p.blocker)
+	require.Equal(t, "[demo/app] WaitingPromotion | \x1b[31mwaiting on confirm-promotion 🔒\x1b[0m | New revision detected", p.line("demo/app"))
+
+	// a closed gate of another phase does not block
+	p = readProgress(statuses(service.PhaseProgressing, service.HookConfirmPromotion))
+	require.Empty(t, p.blocker)
+	require.Equal(t, "[demo/app] Progressing | checking rollout | New revision detected", p.line("demo/app"))
+
+	// an opened rollback gate rolls back the canary in any phase
+	rollback := statuses(service.PhaseProgressing)
+	for i := range rollback {
+		if rollback[i].Type == service.HookRollback {
+			rollback[i].Status = store.GATE_OPEN
+		}
+	}
+	require.Equal(t, service.HookRollback, readProgress(rollback).blocker)
+
+	require.Equal(t, "[demo/app] Unknown", readProgress(nil).line("demo/app"))
+}
+
+func TestShowProgress(t *testing.T) {
+	phases := []service.Phase{service.PhaseProgressing, service.PhaseWaitingPromotion, service.PhaseSucceeded}
+	var reads int
+	read := func(ctx context.Context) ([]handler.CanaryGateStatus, error) {
+		reads++
+		if reads == 2 {
+			return nil, fmt.Errorf("connection refused")
+		}
+		phase := phases[0]
+		phases = phases[1:]
+		return []handler.CanaryGateStatus{{Type: service.HookEvent, Status: "event", Phase: phase}}, nil
+	}
+	var out bytes.Buffer
+	require.NoError(t, showProgress(t.Context(), &out, "demo/app", read, time.Millisecond))
+	require.Equal(t, 4, reads)
+	require.Contains(t, out.String(), "\r\x1b[K[demo/app] unable to get the status: connection refused")
+	require.True(t, strings.HasSuffix(out.String(), "\r\x1b[K[demo/app] Succeeded | event\n"))
+
+	// a failed canary fails the command
+	read = func(ctx context.Context) ([]handler.CanaryGateStatus, error) {
+		return []handler.CanaryGateStatus{{Type: service.HookEvent, Status: "Canary analysis failed", Phase: service.PhaseFailed}}, nil
+	}
+	err := showProgress(t.Context(), &out, "demo/app", read, time.Millisecond)
+	require.EqualError(t, err, "canary [demo/app] failed: Canary analysis failed")
+}
+
+func TestFollowEvents(t *testing.T) {
+	client := kfake.NewSimpleClientset()
+	watcher := watch.NewFake()
+	client.PrependWatchReactor("events", k8stesting.DefaultWatchReactor(watcher, nil))
+	ctx, cancel := context.WithCancel(t.Context())
+	var out bytes.Buffer
+	done := make(chan error)
+	go func() {
+		done <- followEvents(ctx, zerolog.New(&out), client, "gate-ns", "demo")
+	}()
+	at := metav1.NewTime(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	event := func(name string, eventType string, reason string, message string) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name + "." + reason, Namespace: "gate-ns"},
+			InvolvedObject: corev1.ObjectReference{Kind: "CanaryGate", Name: name, Namespace: "gate-ns"},
+			Type:           eventType,
+			Reason:         reason,
+			Message:        message,
+			LastTimestamp:  at,
+		}
+	}
+	watcher.Add(event("demo", corev1.EventTypeNormal, "Updated", "Gate [gate-ns/demo=confirm-promotion] is set to [opened] by [alice]"))
+	// the events of the other CanaryGates are not printed
+	watcher.Add(event("other", corev1.EventTypeNormal, "Updated", "Gate [gate-ns/other=confirm-promotion] is set to [closed]"))
+	watcher.Add(event("demo", corev1.EventTypeWarning, "ReconcileFailed", "deployment not found"))
+	cancel()
+	watcher.Stop()
+	require.NoError(t, <-done)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	require.JSONEq(t, `{"level":"info","at":"2025-01-02T03:04:05Z","reason":"Updated","status":"opened","message":"Gate [gate-ns/demo=confirm-promotion] is set to [opened] by [alice]"}`, lines[0])
+	require.JSONEq(t, `{"level":"warn","at":"2025-01-02T03:04:05Z","reason":"ReconcileFailed","message":"deployment not found"}`, lines[1])
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/KongZ/canary-gate/handler"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/urfave/cli/v3"
+)
+
+// phaseGates lists the gates which Flagger checks in each phase of the canary, in the order they are checked
+var phaseGates = map[service.Phase][]service.HookType{
+	service.PhaseInitializing:     {service.HookConfirmRollout},
+	service.PhaseInitialized:      {service.HookConfirmRollout},
+	service.PhaseWaiting:          {service.HookConfirmRollout, service.HookPreRollout},
+	service.PhaseProgressing:      {service.HookRollout, service.HookConfirmTrafficIncrease},
+	service.PhaseWaitingPromotion: {service.HookConfirmPromotion},
+	service.PhasePromoting:        {service.HookConfirmFinalize},
+	service.PhaseFinalising:       {service.HookPostRollout},
+}
+
+// progress is the state of a canary which is read from /status
+type progress struct {
+	phase   service.Phase
+	event   string
+	gates   map[service.HookType]string
+	blocker service.HookType
+}
+
+// readProgress reads the phase, the last event and the gates of the canary from the statuses of /status. The blocker
+// is the first closed gate which Flagger checks in the phase, or the rollback gate when it is opened.
+func readProgress(statuses []handler.CanaryGateStatus) progress {
+	p := progress{gates: map[service.HookType]string{}}
+	for _, s := range statuses {
+		if s.Type == service.HookEvent {
+			p.phase, p.event = s.Phase, s.Status
+			continue
+		}
+		p.gates[s.Type] = s.Status
+	}
+	if p.gates[service.HookRollback] == store.GATE_OPEN {
+		p.blocker = service.HookRollback
+		return p
+	}
+	for _, gate := range phaseGates[p.phase] {
+		if p.gates[gate] == store.GATE_CLOSE {
+			p.blocker = gate
+			break
+		}
+	}
+	return p
+}
+
+// line returns the progress as a single line. The blocking gate is highlighted in red.
+func (p progress) line(canary string) string {
+	phase := string(p.phase)
+	if phase == "" {
+		phase = "Unknown"
+	}
+	parts := []string{fmt.Sprintf("[%s] %s", canary, phase)}
+	switch {
+	case p.blocker == service.HookRollback:
+		parts = append(parts, fmt.Sprintf("\x1b[31mrolling back by %s\x1b[0m", p.blocker))
+	case p.blocker != "":
+		parts = append(parts, fmt.Sprintf("\x1b[31mwaiting on %s 🔒\x1b[0m", p.blocker))
+	case len(phaseGates[p.phase]) > 0:
+		parts = append(parts, fmt.Sprintf("checking %s", phaseGates[p.phase][0]))
+	}
+	if p.event != "" {
+		parts = append(parts, p.event)
+	}
+	return strings.Join(parts, " | ")
+}
+
+// watchProgress shows the progress of a canary on a single line, which is redrawn every interval. It returns when the
+// canary is Succeeded, and fails when the canary is Failed.
+// The deployment is the first argument, or the --deployment flag.
+func watchProgress(ctx context.Context, cmd *cli.Command) error {
+	interval := cmd.Duration("interval")
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	defaults, err := loadDefaults(cmd)
+	if err != nil {
+		return err
+	}
+	clusterAlias, err := clusterOf(cmd, defaults)
+	if err != nil {
+		return err
+	}
+	deployment := cmd.Args().First()
+	if deployment == "" {
+		deployment = gateNameOf(cmd, defaults.flag(cmd, "deployment"))
+	}
+	if deployment == "" {
+		return fmt.Errorf("deployment name is required")
+	}
+	namespace := namespaceOf(cmd, defaults, clusterAlias)
+	client, err := newGateClient(cmd, clusterAlias)
+	if err != nil {
+		return err
+	}
+	proxyPath, err := client.servicePath(ctx, namespace, "POST", "/status")
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	payload := &handler.CanaryGatePayload{Type: service.HookAll, Name: deployment, Namespace: namespace}
+	read := func(ctx context.Context) ([]handler.CanaryGateStatus, error) {
+		statusMap, err := requestAndRead(ctx, client, "POST", proxyPath, requestOptionsOf(cmd), payload, map[string][]handler.CanaryGateStatus{})
+		if err != nil {
+			return nil, err
+		}
+		return (*statusMap)[fmt.Sprintf("%s/%s", namespace, deployment)], nil
+	}
+	return showProgress(ctx, os.Stdout, fmt.Sprintf("%s/%s", namespace, deployment), read, interval)
+}
+
+// showProgress redraws the line of the progress until the canary is Succeeded or Failed, or until interrupted
+func showProgress(ctx context.Context, w io.Writer, canary string, read func(context.Context) ([]handler.CanaryGateStatus, error), interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		statuses, err := read(ctx)
+		if err != nil && ctx.Err() == nil {
+			// the error replaces the line until the status is read again
+			_, _ = fmt.Fprintf(w, "\r\x1b[K[%s] unable to get the status: %v", canary, err)
+		}
+		if err == nil {
+			p := readProgress(statuses)
+			_, _ = fmt.Fprintf(w, "\r\x1b[K%s", p.line(canary))
+			switch p.phase {
+			case service.PhaseSucceeded:
+				_, _ = fmt.Fprintln(w)
+				return nil
+			case service.PhaseFailed:
+				_, _ = fmt.Fprintln(w)
+				return fmt.Errorf("canary [%s] failed: %s", canary, p.event)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			_, _ = fmt.Fprintln(w)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	piggysecv1alpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/controller"
+	"github.com/KongZ/canary-gate/handler"
+	"github.com/urfave/cli/v3"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultEndpoint is the webhook endpoint of the canary-gate service installed by the chart in the canary-gate namespace
+const defaultEndpoint = "http://canary-gate.canary-gate.svc:8080"
+
+// render prints the Flagger Canaries which the controller creates for the CanaryGates of the file, without a cluster.
+// The warnings of the settings which the controller ignores are written to stderr.
+func render(ctx context.Context, cmd *cli.Command) error {
+	path := cmd.String("file")
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+		in = file
+	}
+	endpoint := strings.TrimSuffix(cmd.String("endpoint"), "/") + handler.BasePath(cmd.String("base-path"))
+	return renderCanaryGates(in, os.Stdout, os.Stderr, endpoint)
+}
+
+// renderCanaryGates decodes the CanaryGates of the YAML or JSON documents and writes their Flagger Canaries as YAML
+// documents to w, and the warnings to warnings.
+func renderCanaryGates(in io.Reader, w io.Writer, warnings io.Writer, endpoint string) error {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(in, 4096)
+	rendered := 0
+	for {
+		var canaryGate piggysecv1alpha1.CanaryGate
+		if err := decoder.Decode(&canaryGate); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("unable to decode the CanaryGate: %w", err)
+		}
+		if canaryGate.Kind == "" {
+			// an empty document
+			continue
+		}
+		if canaryGate.Kind != "CanaryGate" {
+			return fmt.Errorf("'%s' is not a CanaryGate", canaryGate.Kind)
+		}
+		canaries, messages, err := controller.RenderCanaries(&canaryGate, endpoint, "")
+		if err != nil {
+			return fmt.Errorf("unable to render CanaryGate '%s': %w", canaryGate.Name, err)
+		}
+		for _, message := range messages {
+			_, _ = fmt.Fprintf(warnings, "Warning: CanaryGate '%s': %s\n", canaryGate.Name, message)
+		}
+		for _, canary := range canaries {
+			body, err := canaryYAML(canary)
+			if err != nil {
+				return err
+			}
+			if rendered > 0 {
+				if _, err := fmt.Fprintln(w, "---"); err != nil {
+					return err
+				}
+			}
+			if _, err := w.Write(body); err != nil {
+				return err
+			}
+			rendered++
+		}
+	}
+	if rendered == 0 {
+		return fmt.Errorf("no CanaryGate found")
+	}
+	return nil
+}
+
+// canaryYAML returns the YAML of the resource without its status and the empty creation timestamp
+func canaryYAML(canary any) ([]byte, error) {
+	body, err := json.Marshal(canary)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]any
+	if err := json.Unmarshal(body, &object); err != nil {
+		return nil, err
+	}
+	delete(object, "status")
+	if metadata, ok := object["metadata"].(map[string]any); ok {
+		delete(metadata, "creationTimestamp")
+	}
+	return yaml.Marshal(object)
+}
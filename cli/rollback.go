@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/KongZ/canary-gate/handler"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/urfave/cli/v3"
+)
+
+// rollback opens the rollback gate of the deployment as a manual rollback with the reason of the user.
+// The deployment is the first argument, or the --deployment flag.
+func rollback(ctx context.Context, cmd *cli.Command) error {
+	defaults, err := loadDefaults(cmd)
+	if err != nil {
+		return err
+	}
+	clusterAlias, err := clusterOf(cmd, defaults)
+	if err != nil {
+		return err
+	}
+	deployment := cmd.Args().First()
+	if deployment == "" {
+		deployment = gateNameOf(cmd, defaults.flag(cmd, "deployment"))
+	}
+	if deployment == "" {
+		return fmt.Errorf("deployment name is required")
+	}
+	reason := strings.TrimSpace(cmd.String("reason"))
+	if reason == "" {
+		return fmt.Errorf("reason of the rollback is required")
+	}
+	namespace := namespaceOf(cmd, defaults, clusterAlias)
+	method := "POST"
+	payload := &handler.CanaryGatePayload{
+		Type:      service.HookRollback,
+		Name:      deployment,
+		Namespace: namespace,
+		User:      currentUser(cmd.String("kubeconfig"), clusterAlias),
+		Manual:    true,
+		Reason:    reason,
+	}
+
+	//  Load Kubernetes Configuration
+	client, err := newGateClient(cmd, clusterAlias)
+	if err != nil {
+		return err
+	}
+
+	proxyPath, err := client.servicePath(ctx, namespace, method, "/open")
+	if err != nil {
+		return err
+	}
+	return requestGate(ctx, client, method, proxyPath, requestOptionsOf(cmd), payload)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/KongZ/canary-gate/handler"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/urfave/cli/v3"
+)
+
+// selectGates returns the action which opens or closes the gate of the first argument on every CanaryGate matching
+// the label selector. The server selects the CanaryGates, so the gates are changed in a single request.
+func selectGates(path string) cli.ActionFunc {
+	return func(ctx context.Context, cmd *cli.Command) error {
+		gate := service.HookType(cmd.Args().First())
+		if !slices.Contains(store.GateTypes, gate) {
+			return fmt.Errorf("unknown gate '%s'", gate)
+		}
+		defaults, err := loadDefaults(cmd)
+		if err != nil {
+			return err
+		}
+		clusterAlias, err := clusterOf(cmd, defaults)
+		if err != nil {
+			return err
+		}
+		namespace := namespaceOf(cmd, defaults, clusterAlias)
+		payload := &handler.SelectorPayload{
+			Type:     gate,
+			Selector: cmd.String("selector"),
+			User:     currentUser(cmd.String("kubeconfig"), clusterAlias),
+		}
+		if !cmd.Bool("all-namespaces") {
+			payload.Namespace = namespace
+		}
+		if ttl := cmd.Duration("ttl"); ttl > 0 {
+			payload.TTL = ttl.String()
+		}
+		client, err := newGateClient(cmd, clusterAlias)
+		if err != nil {
+			return err
+		}
+		canaryPath := path
+		if cmd.Bool("force") {
+			canaryPath += "?force=true"
+		}
+		proxyPath, err := client.servicePath(ctx, namespace, "POST", canaryPath)
+		if err != nil {
+			return err
+		}
+		return requestGate(ctx, client, "POST", proxyPath, requestOptionsOf(cmd), payload)
+	}
+}
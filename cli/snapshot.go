@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KongZ/canary-gate/handler"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+// snapshot is the file written by the export command and read by the import command
+type snapshot struct {
+	Namespace   string         `json:"namespace"`
+	ExportedAt  time.Time      `json:"exportedAt"`
+	CanaryGates []gateSnapshot `json:"canaryGates"`
+}
+
+// gateSnapshot holds the state of each gate of a CanaryGate, opened or closed
+type gateSnapshot struct {
+	Name  string                      `json:"name"`
+	Gates map[service.HookType]string `json:"gates"`
+}
+
+// gateProxy reads and changes the gates through the pod proxy of the canary-gate service
+type gateProxy struct {
+	client *gateClient
+	opts   requestOptions
+	// path is the proxy path of the canary-gate pod, which the canary path is appended to
+	path string
+	user string
+}
+
+// newGateProxy finds the canary-gate pod of the namespace
+func newGateProxy(ctx context.Context, cmd *cli.Command, clusterAlias string, namespace string) (*gateProxy, error) {
+	client, err := newGateClient(cmd, clusterAlias)
+	if err != nil {
+		return nil, err
+	}
+	path, err := client.servicePath(ctx, namespace, "POST", "")
+	if err != nil {
+		return nil, err
+	}
+	return &gateProxy{
+		client: client,
+		opts:   requestOptionsOf(cmd),
+		path:   path,
+		user:   currentUser(cmd.String("kubeconfig"), clusterAlias),
+	}, nil
+}
+
+// status returns the state of each gate of the CanaryGate
+func (p *gateProxy) status(ctx context.Context, namespace string, name string) (map[service.HookType]string, error) {
+	payload := &handler.CanaryGatePayload{Type: service.HookAll, Namespace: namespace, Name: name}
+	statusMap, err := requestAndRead(ctx, p.client, "POST", p.path+"/status", p.opts, payload, map[string][]handler.CanaryGateStatus{})
+	if err != nil {
+		return nil, err
+	}
+	gates := map[service.HookType]string{}
+	for _, s := range (*statusMap)[namespace+"/"+name] {
+		if s.Type != service.HookEvent {
+			gates[s.Type] = s.Status
+		}
+	}
+	return gates, nil
+}
+
+// set opens or closes the gate and returns its state after the change. A gate which requires multiple approvals
+// stays closed until the other approvers open it.
+func (p *gateProxy) set(ctx context.Context, namespace string, name string, gate service.HookType, status string) (string, error) {
+	canaryPath := "/close"
+	if status == store.GATE_OPEN {
+		canaryPath = "/open"
+	}
+	payload := &handler.CanaryGatePayload{Type: gate, Namespace: namespace, Name: name, User: p.user}
+	statusMap, err := requestAndRead(ctx, p.client, "POST", p.path+canaryPath, p.opts, payload, map[string][]handler.CanaryGateStatus{})
+	if err != nil {
+		return "", err
+	}
+	for _, s := range (*statusMap)[namespace+"/"+name] {
+		if s.Type == gate {
+			return s.Status, nil
+		}
+	}
+	return "", fmt.Errorf("no status of gate [%s] in the response", gate)
+}
+
+// exportGates reads the gates of the CanaryGates of the namespace which match the label selector
+func exportGates(ctx context.Context, proxy *gateProxy, namespace string, selector string) (*snapshot, error) {
+	clientset, err := proxy.client.cluster()
+	if err != nil {
+		return nil, err
+	}
+	names, err := listCanaryGates(ctx, clientset, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	snap := &snapshot{Namespace: namespace, ExportedAt: time.Now().UTC(), CanaryGates: make([]gateSnapshot, 0, len(names))}
+	for _, name := range names {
+		gates, err := proxy.status(ctx, namespace, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the gates of '%s': %w", name, err)
+		}
+		snap.CanaryGates = append(snap.CanaryGates, gateSnapshot{Name: name, Gates: gates})
+	}
+	return snap, nil
+}
+
+// importGates opens or closes the gates of the namespace which differ from the snapshot, and prints each change.
+// The rollback gate is skipped unless includeRollback is set, since opening it rolls back a running canary.
+// The gates which are already in the state of the snapshot are not changed, so importing twice changes nothing.
+// It returns the number of changed gates.
+func importGates(ctx context.Context, proxy *gateProxy, snap *snapshot, namespace string, includeRollback bool, w io.Writer) (int, error) {
+	changed := 0
+	var failed []string
+	for _, cg := range snap.CanaryGates {
+		current, err := proxy.status(ctx, namespace, cg.Name)
+		if err != nil {
+			log.Error().Err(err).Msgf("Unable to read the gates of [%s]", cg.Name)
+			failed = append(failed, cg.Name)
+			continue
+		}
+		for _, gate := range store.GateTypes {
+			desired, ok := cg.Gates[gate]
+			if !ok || current[gate] == desired {
+				continue
+			}
+			if gate == service.HookRollback && !includeRollback {
+				log.Warn().Msgf("Gate [%s] of [%s] is not imported without --include-rollback", gate, cg.Name)
+				continue
+			}
+			status, err := proxy.set(ctx, namespace, cg.Name, gate, desired)
+			if err != nil {
+				log.Error().Err(err).Msgf("Unable to set gate [%s] of [%s]", gate, cg.Name)
+				failed = append(failed, cg.Name)
+				break
+			}
+			changed++
+			_, _ = fmt.Fprintf(w, "%s/%s %s: %s -> %s\n", namespace, cg.Name, gate, dash(current[gate]), status)
+			if status != desired {
+				log.Warn().Msgf("Gate [%s] of [%s] is %s, it waits for more approvals", gate, cg.Name, status)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return changed, fmt.Errorf("failed to import the gates of %s", strings.Join(failed, ", "))
+	}
+	return changed, nil
+}
+
+// readSnapshot reads and validates the snapshot file
+func readSnapshot(path string) (*snapshot, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(body, &snap); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot '%s': %w", path, err)
+	}
+	for _, cg := range snap.CanaryGates {
+		if cg.Name == "" {
+			return nil, fmt.Errorf("snapshot '%s' has a CanaryGate without name", path)
+		}
+		for gate, status := range cg.Gates {
+			if !slices.Contains(store.GateTypes, gate) {
+				return nil, fmt.Errorf("unknown gate [%s] of '%s' in snapshot '%s'", gate, cg.Name, path)
+			}
+			if status != store.GATE_OPEN && status != store.GATE_CLOSE {
+				return nil, fmt.Errorf("unknown state '%s' of gate [%s] of '%s' in snapshot '%s'", status, gate, cg.Name, path)
+			}
+		}
+	}
+	return &snap, nil
+}
+
+// export writes the gates of the CanaryGates of the namespace to the output file, or to stdout.
+func export(ctx context.Context, cmd *cli.Command) error {
+	defaults, err := loadDefaults(cmd)
+	if err != nil {
+		return err
+	}
+	clusterAlias, err := clusterName(defaults.flag(cmd, "cluster"))
+	if err != nil {
+		return err
+	}
+	namespace := namespaceOf(cmd, defaults, clusterAlias)
+	proxy, err := newGateProxy(ctx, cmd, clusterAlias, namespace)
+	if err != nil {
+		return err
+	}
+	snap, err := exportGates(ctx, proxy, namespace, cmd.String("selector"))
+	if err != nil {
+		return err
+	}
+	body, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	output := cmd.String("output")
+	if output == "" {
+		_, err = fmt.Println(string(body))
+		return err
+	}
+	if err := os.WriteFile(output, append(body, '\n'), 0o600); err != nil {
+		return err
+	}
+	log.Info().Msgf("Exported %d CanaryGates of namespace '%s' to %s", len(snap.CanaryGates), namespace, output)
+	return nil
+}
+
+// importSnapshot restores the gates of the snapshot file, the first argument. The gates are restored in the
+// namespace of the snapshot, unless --namespace is set.
+func importSnapshot(ctx context.Context, cmd *cli.Command) error {
+	path := cmd.Args().First()
+	if path == "" {
+		return fmt.Errorf("snapshot file is required")
+	}
+	snap, err := readSnapshot(path)
+	if err != nil {
+		return err
+	}
+	defaults, err := loadDefaults(cmd)
+	if err != nil {
+		return err
+	}
+	clusterAlias, err := clusterName(defaults.flag(cmd, "cluster"))
+	if err != nil {
+		return err
+	}
+	namespace := defaults.flag(cmd, "namespace")
+	if namespace == "" {
+		namespace = snap.Namespace
+	}
+	if namespace == "" {
+		namespace = namespaceOf(cmd, defaults, clusterAlias)
+	}
+	proxy, err := newGateProxy(ctx, cmd, clusterAlias, namespace)
+	if err != nil {
+		return err
+	}
+	changed, err := importGates(ctx, proxy, snap, namespace, cmd.Bool("include-rollback"), os.Stdout)
+	log.Info().
+		Int("changed", changed).
+		Msgf("Imported %d CanaryGates into namespace '%s'", len(snap.CanaryGates), namespace)
+	return err
+}
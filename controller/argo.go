@@ -0,0 +1,267 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
+)
+
+// The Argo Rollouts resources are unstructured so Argo Rollouts is not a dependency of the controller
+var (
+	rolloutGVK          = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}
+	analysisTemplateGVK = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "AnalysisTemplate"}
+)
+
+const (
+	// argoTemplatePrefix prefixes the names of the AnalysisTemplates which call the gates
+	argoTemplatePrefix = "canary-gate-"
+	// argoInterval is the interval between the gate calls of an analysis
+	argoInterval = "1m"
+)
+
+// argoGates lists the gates which are injected into an Argo Rollout with the phase sent to the gate.
+// pre-rollout, rollout, post-rollout and event have no equivalent step in Argo Rollouts.
+var argoGates = []struct {
+	hook  service.HookType
+	phase service.Phase
+}{
+	{service.HookConfirmRollout, service.PhaseWaiting},
+	{service.HookConfirmTrafficIncrease, service.PhaseProgressing},
+	{service.HookConfirmPromotion, service.PhaseWaitingPromotion},
+	{service.HookConfirmFinalize, service.PhaseFinalising},
+	{service.HookRollback, service.PhaseProgressing},
+}
+
+// argoBackend creates an Argo Rollout with the gates injected as analysis steps.
+// Each gate is an AnalysisTemplate with a web metric which calls the gate endpoint.
+type argoBackend struct {
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+func (b *argoBackend) Name() string {
+	return "Argo"
+}
+
+func (b *argoBackend) Kind() string {
+	return "Rollout"
+}
+
+func (b *argoBackend) Validate(canaryGate *piggysecvalpha1.CanaryGate) error {
+	_, err := validateArgoSpec(canaryGate.Spec.Argo.Raw)
+	return err
+}
+
+func (b *argoBackend) Reconcile(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate, target piggysecvalpha1.Target, gates gateConfig) (controllerutil.OperationResult, error) {
+	argoSpec, err := validateArgoSpec(canaryGate.Spec.Argo.Raw)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	for _, g := range argoGates {
+		if slices.Contains(gates.disabledGates, string(g.hook)) {
+			continue
+		}
+		if err := b.reconcileTemplate(ctx, target.Namespace, g.hook, g.phase, gates); err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+	}
+	if err := injectArgoSteps(argoSpec, target, gates); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	if gates.workloadFromTarget {
+		if err := unstructured.SetNestedField(argoSpec, target.Name, "workloadRef", "name"); err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+	}
+
+	rollout := &unstructured.Unstructured{}
+	rollout.SetGroupVersionKind(rolloutGVK)
+	rollout.SetName(target.Name)
+	rollout.SetNamespace(target.Namespace)
+	return controllerutil.CreateOrUpdate(ctx, b.client, rollout, func() error {
+		rollout.Object["spec"] = runtime.DeepCopyJSONValue(argoSpec)
+		// When CanaryGate is deleted, Rollout will be garbage-collected too
+		return setOwner(canaryGate, rollout, b.scheme)
+	})
+}
+
+// Delete deletes the Rollout of a target. The AnalysisTemplates are shared by the Rollouts of the namespace and kept.
+func (b *argoBackend) Delete(ctx context.Context, target piggysecvalpha1.Target) error {
+	rollout := &unstructured.Unstructured{}
+	rollout.SetGroupVersionKind(rolloutGVK)
+	rollout.SetName(target.Name)
+	rollout.SetNamespace(target.Namespace)
+	return b.client.Delete(ctx, rollout)
+}
+
+// reconcileTemplate creates or updates the AnalysisTemplate of a gate. The Rollout passes the gate metadata as arguments,
+// so a single template in a namespace serves every CanaryGate.
+func (b *argoBackend) reconcileTemplate(ctx context.Context, namespace string, hook service.HookType, phase service.Phase, gates gateConfig) error {
+	metadata := map[string]string{
+		service.MetaGateName:      "{{args.gate-name}}",
+		service.MetaGateNamespace: "{{args.gate-namespace}}",
+	}
+	if secret := gates.metadata[service.MetaGateSecret]; secret != "" {
+		metadata[service.MetaGateSecret] = secret
+	}
+	body, err := json.Marshal(map[string]any{
+		"name":      "{{args.name}}",
+		"namespace": "{{args.namespace}}",
+		"phase":     phase,
+		"metadata":  metadata,
+	})
+	if err != nil {
+		return err
+	}
+	metric := map[string]any{
+		"name":     string(hook),
+		"interval": argoInterval,
+		"provider": map[string]any{
+			"web": map[string]any{
+				"method": "POST",
+				"url":    fmt.Sprintf("%s/%s", gates.endpoint, hook),
+				"headers": []any{
+					map[string]any{"key": "Content-Type", "value": "application/json"},
+					// makes the gate answer with the decision in the body instead of the status code
+					map[string]any{"key": "Accept", "value": "application/json"},
+				},
+				"body":     string(body),
+				"jsonPath": "{$.approved}",
+			},
+		},
+	}
+	if hook == service.HookRollback {
+		// an opened rollback gate fails the background analysis, which aborts the Rollout
+		metric["successCondition"] = "result == false"
+		metric["failureLimit"] = int64(0)
+	} else {
+		// a closed gate is retried until it is opened, like the confirm webhooks of Flagger
+		metric["successCondition"] = "result == true"
+		metric["failureLimit"] = int64(-1)
+		metric["consecutiveSuccessLimit"] = int64(1)
+	}
+
+	template := &unstructured.Unstructured{}
+	template.SetGroupVersionKind(analysisTemplateGVK)
+	template.SetName(argoTemplatePrefix + string(hook))
+	template.SetNamespace(namespace)
+	_, err = controllerutil.CreateOrUpdate(ctx, b.client, template, func() error {
+		template.Object["spec"] = map[string]any{
+			"args": []any{
+				map[string]any{"name": "name"},
+				map[string]any{"name": "namespace"},
+				map[string]any{"name": "gate-name"},
+				map[string]any{"name": "gate-namespace"},
+			},
+			"metrics": []any{metric},
+		}
+		return nil
+	})
+	return err
+}
+
+// injectArgoSteps adds the analysis steps of the gates to the canary strategy of the Rollout spec.
+// confirm-rollout runs before the first step, confirm-traffic-increase before each setWeight step,
+// confirm-promotion and confirm-finalize after the last step and rollback as a background analysis.
+func injectArgoSteps(argoSpec map[string]any, target piggysecvalpha1.Target, gates gateConfig) error {
+	args := []any{
+		map[string]any{"name": "name", "value": target.Name},
+		map[string]any{"name": "namespace", "value": target.Namespace},
+		map[string]any{"name": "gate-name", "value": gates.metadata[service.MetaGateName]},
+		map[string]any{"name": "gate-namespace", "value": gates.metadata[service.MetaGateNamespace]},
+	}
+	enabled := func(hook service.HookType) bool {
+		return !slices.Contains(gates.disabledGates, string(hook))
+	}
+	analysisStep := func(hook service.HookType) any {
+		return map[string]any{
+			"analysis": map[string]any{
+				"templates": []any{map[string]any{"templateName": argoTemplatePrefix + string(hook)}},
+				"args":      args,
+			},
+		}
+	}
+
+	steps, _, err := unstructured.NestedSlice(argoSpec, "strategy", "canary", "steps")
+	if err != nil {
+		return fmt.Errorf("invalid spec.argo.strategy.canary.steps: %w", err)
+	}
+	injected := make([]any, 0, len(steps)*2+3)
+	if enabled(service.HookConfirmRollout) {
+		injected = append(injected, analysisStep(service.HookConfirmRollout))
+	}
+	for _, step := range steps {
+		if s, ok := step.(map[string]any); ok && s["setWeight"] != nil && enabled(service.HookConfirmTrafficIncrease) {
+			injected = append(injected, analysisStep(service.HookConfirmTrafficIncrease))
+		}
+		injected = append(injected, step)
+	}
+	if enabled(service.HookConfirmPromotion) {
+		injected = append(injected, analysisStep(service.HookConfirmPromotion))
+	}
+	if enabled(service.HookConfirmFinalize) {
+		injected = append(injected, analysisStep(service.HookConfirmFinalize))
+	}
+	if err := unstructured.SetNestedSlice(argoSpec, injected, "strategy", "canary", "steps"); err != nil {
+		return err
+	}
+
+	if !enabled(service.HookRollback) {
+		return nil
+	}
+	// the rollback template is added to the background analysis of the user, if any
+	analysis, _, err := unstructured.NestedMap(argoSpec, "strategy", "canary", "analysis")
+	if err != nil {
+		return fmt.Errorf("invalid spec.argo.strategy.canary.analysis: %w", err)
+	}
+	if analysis == nil {
+		analysis = map[string]any{}
+	}
+	templates, _ := analysis["templates"].([]any)
+	analysis["templates"] = append(templates, map[string]any{"templateName": argoTemplatePrefix + string(service.HookRollback)})
+	analysisArgs, _ := analysis["args"].([]any)
+	analysis["args"] = append(analysisArgs, args...)
+	return unstructured.SetNestedMap(argoSpec, analysis, "strategy", "canary", "analysis")
+}
+
+// validateArgoSpec decodes the raw Argo Rollout spec and checks that it uses the canary strategy.
+func validateArgoSpec(raw []byte) (map[string]any, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("spec.argo is required")
+	}
+	// numbers are decoded as int64 like the objects read from the API server, so an unchanged spec is not updated
+	var argoSpec map[string]any
+	if err := utiljson.Unmarshal(raw, &argoSpec); err != nil {
+		return nil, fmt.Errorf("unable to decode spec.argo: %w", err)
+	}
+	if _, found, err := unstructured.NestedMap(argoSpec, "strategy", "canary"); err != nil || !found {
+		return nil, fmt.Errorf("spec.argo.strategy.canary is required")
+	}
+	return argoSpec, nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
+)
+
+const testArgoSpec = `{"workloadRef":{"apiVersion":"apps/v1","kind":"Deployment","name":"demo"},"strategy":{"canary":{"steps":[{"setWeight":20},{"pause":{}},{"setWeight":50}]}}}`
+
+func newTestArgoCanaryGate() *piggysecvalpha1.CanaryGate {
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.Backend = piggysecvalpha1.BackendArgo
+	canaryGate.Spec.Flagger = runtime.RawExtension{}
+	canaryGate.Spec.Argo = runtime.RawExtension{Raw: []byte(testArgoSpec)}
+	return canaryGate
+}
+
+// stepTemplate returns the template of an analysis step, or the type of another step
+func stepTemplate(t *testing.T, step any) string {
+	s := step.(map[string]any)
+	if _, ok := s["setWeight"]; ok {
+		return "setWeight"
+	}
+	if _, ok := s["pause"]; ok {
+		return "pause"
+	}
+	templates, _, err := unstructured.NestedSlice(s, "analysis", "templates")
+	require.NoError(t, err)
+	require.Len(t, templates, 1)
+	return templates[0].(map[string]any)["templateName"].(string)
+}
+
+func TestInjectArgoSteps(t *testing.T) {
+	target := piggysecvalpha1.Target{Name: "demo", Namespace: "gate-ns"}
+	gates := gateConfig{metadata: map[string]string{service.MetaGateName: "demo", service.MetaGateNamespace: "gate-ns"}}
+	argoSpec, err := validateArgoSpec([]byte(testArgoSpec))
+	require.NoError(t, err)
+	require.NoError(t, injectArgoSteps(argoSpec, target, gates))
+
+	steps, _, err := unstructured.NestedSlice(argoSpec, "strategy", "canary", "steps")
+	require.NoError(t, err)
+	var names []string
+	for _, step := range steps {
+		names = append(names, stepTemplate(t, step))
+	}
+	require.Equal(t, []string{
+		"canary-gate-confirm-rollout",
+		"canary-gate-confirm-traffic-increase", "setWeight",
+		"pause",
+		"canary-gate-confirm-traffic-increase", "setWeight",
+		"canary-gate-confirm-promotion",
+		"canary-gate-confirm-finalize",
+	}, names)
+	templates, _, err := unstructured.NestedSlice(argoSpec, "strategy", "canary", "analysis", "templates")
+	require.NoError(t, err)
+	require.Equal(t, []any{map[string]any{"templateName": "canary-gate-rollback"}}, templates)
+
+	// disabled gates are not injected
+	gates.disabledGates = []string{"confirm-traffic-increase", "rollback"}
+	argoSpec, err = validateArgoSpec([]byte(testArgoSpec))
+	require.NoError(t, err)
+	require.NoError(t, injectArgoSteps(argoSpec, target, gates))
+	steps, _, err = unstructured.NestedSlice(argoSpec, "strategy", "canary", "steps")
+	require.NoError(t, err)
+	require.Len(t, steps, 6)
+	_, found, err := unstructured.NestedMap(argoSpec, "strategy", "canary", "analysis")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	_, err = validateArgoSpec([]byte(`{"strategy":{"blueGreen":{}}}`))
+	require.Error(t, err)
+}
+
+func TestReconcileArgo(t *testing.T) {
+	ctx := context.TODO()
+	r := newTestReconciler(t, newTestArgoCanaryGate())
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	rollout := &unstructured.Unstructured{}
+	rollout.SetGroupVersionKind(rolloutGVK)
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "gate-ns"}, rollout))
+	require.Len(t, rollout.GetOwnerReferences(), 1)
+	steps, _, err := unstructured.NestedSlice(rollout.Object, "spec", "strategy", "canary", "steps")
+	require.NoError(t, err)
+	require.Len(t, steps, 8)
+
+	template := &unstructured.Unstructured{}
+	template.SetGroupVersionKind(analysisTemplateGVK)
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Name: "canary-gate-confirm-promotion", Namespace: "gate-ns"}, template))
+	metrics, _, err := unstructured.NestedSlice(template.Object, "spec", "metrics")
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	url, _, err := unstructured.NestedString(metrics[0].(map[string]any), "provider", "web", "url")
+	require.NoError(t, err)
+	require.Equal(t, "/confirm-promotion", url)
+
+	var canaryGate piggysecvalpha1.CanaryGate
+	require.NoError(t, r.Get(ctx, req.NamespacedName, &canaryGate))
+	cond := meta.FindStatusCondition(canaryGate.Status.Conditions, piggysecvalpha1.ConditionReady)
+	require.NotNil(t, cond)
+	require.Equal(t, metav1.ConditionTrue, cond.Status)
+}
+
+func TestReconcileDefaultBackend(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestArgoCanaryGate()
+	canaryGate.Spec.Backend = ""
+	r := newTestReconciler(t, canaryGate)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+
+	// Flagger is the default backend, which requires spec.flagger
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, r.Get(ctx, req.NamespacedName, canaryGate))
+	cond := meta.FindStatusCondition(canaryGate.Status.Conditions, piggysecvalpha1.ConditionReady)
+	require.NotNil(t, cond)
+	require.Equal(t, "InvalidFlaggerSpec", cond.Reason)
+
+	r.Backend = piggysecvalpha1.BackendArgo
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	rollout := &unstructured.Unstructured{}
+	rollout.SetGroupVersionKind(rolloutGVK)
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "gate-ns"}, rollout))
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	flaggerv1beta1 "github.com/fluxcd/flagger/pkg/apis/flagger/v1beta1"
+	"github.com/rs/zerolog/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+)
+
+// gateConfig holds what every backend injects to make the gates call the canary-gate endpoints
+type gateConfig struct {
+	// endpoint is the base URL of the gate endpoints
+	endpoint string
+	// metadata resolves the gate calls of every target to the CanaryGate
+	metadata map[string]string
+	// disabledGates are not injected
+	disabledGates []string
+	// webhookTimeout is the timeout of the injected webhooks
+	webhookTimeout string
+	// webhookRetries is the number of retries of the injected webhooks
+	webhookRetries int
+	// workloadFromTarget makes each resource reference the Deployment of its target, which is selected by labels
+	workloadFromTarget bool
+}
+
+// CanaryBackend reconciles the progressive delivery resource of a target, which calls the gates of the CanaryGate
+type CanaryBackend interface {
+	// Name of the backend used in the events and conditions
+	Name() string
+	// Kind of the resource which is created for each target
+	Kind() string
+	// Validate decodes and checks the backend spec of the CanaryGate
+	Validate(canaryGate *piggysecvalpha1.CanaryGate) error
+	// Reconcile creates or updates the resource of a target with the injected gates
+	Reconcile(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate, target piggysecvalpha1.Target, gates gateConfig) (controllerutil.OperationResult, error)
+	// Delete deletes the resource of a target
+	Delete(ctx context.Context, target piggysecvalpha1.Target) error
+}
+
+// newCanaryBackend returns the backend with the given name
+func newCanaryBackend(name string, c client.Client, scheme *runtime.Scheme) (CanaryBackend, error) {
+	switch name {
+	case "", piggysecvalpha1.BackendFlagger:
+		return &flaggerBackend{client: c, scheme: scheme}, nil
+	case piggysecvalpha1.BackendArgo:
+		return &argoBackend{client: c, scheme: scheme}, nil
+	}
+	return nil, fmt.Errorf("unknown backend [%s], expected %s or %s", name, piggysecvalpha1.BackendFlagger, piggysecvalpha1.BackendArgo)
+}
+
+// setOwner makes the resource garbage-collected with the CanaryGate when it is owned and in the same namespace
+func setOwner(canaryGate *piggysecvalpha1.CanaryGate, obj metav1.Object, scheme *runtime.Scheme) error {
+	if canaryGate.Spec.OwnedCanary && !crossNamespace(canaryGate) {
+		return controllerutil.SetControllerReference(canaryGate, obj, scheme)
+	}
+	return nil
+}
+
+// flaggerBackend creates a Flagger Canary with the gates injected as webhooks
+type flaggerBackend struct {
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+func (b *flaggerBackend) Name() string {
+	return "Flagger"
+}
+
+func (b *flaggerBackend) Kind() string {
+	return "Canary"
+}
+
+func (b *flaggerBackend) Validate(canaryGate *piggysecvalpha1.CanaryGate) error {
+	_, err := validateFlaggerSpec(canaryGate.Spec.Flagger.Raw)
+	return err
+}
+
+func (b *flaggerBackend) Reconcile(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate, target piggysecvalpha1.Target, gates gateConfig) (controllerutil.OperationResult, error) {
+	desired, err := flaggerCanary(canaryGate, target, gates)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	canary := &flaggerv1beta1.Canary{ObjectMeta: desired.ObjectMeta}
+	return controllerutil.CreateOrUpdate(ctx, b.client, canary, func() error {
+		if canary.ResourceVersion != "" {
+			if drifted := driftedWebhooks(canary.Spec.Analysis, injectedWebhooks(gates)); len(drifted) > 0 {
+				log.Warn().Strs("webhooks", drifted).Msgf("Webhooks %v of Canary [%s/%s] were removed or changed, and are restored", drifted, canary.Namespace, canary.Name)
+			}
+		}
+		canary.Spec = *desired.Spec.DeepCopy()
+		// When CanaryGate is deleted, Canary will be garbage-collected too
+		return setOwner(canaryGate, canary, b.scheme)
+	})
+}
+
+// flaggerCanary returns the Flagger Canary of a target, which is the Flagger spec of the CanaryGate with the gates
+// appended to the webhooks of the user. It is created in the namespace of the target.
+func flaggerCanary(canaryGate *piggysecvalpha1.CanaryGate, target piggysecvalpha1.Target, gates gateConfig) (*flaggerv1beta1.Canary, error) {
+	// Deserialize the raw Flagger spec into a Flagger CanarySpec struct
+	// This gives us typed access to the spec while preserving all other fields.
+	flaggerSpec, err := validateFlaggerSpec(canaryGate.Spec.Flagger.Raw)
+	if err != nil {
+		return nil, err
+	}
+	// Ensure the Analysis field is not nil
+	if flaggerSpec.Analysis == nil {
+		flaggerSpec.Analysis = &flaggerv1beta1.CanaryAnalysis{}
+	}
+	if gates.workloadFromTarget {
+		flaggerSpec.TargetRef.Name = target.Name
+	}
+	// Append our controlled webhooks to the webhooks of the user.
+	flaggerSpec.Analysis.Webhooks = mergeWebhooks(flaggerSpec.Analysis.Webhooks, injectedWebhooks(gates))
+
+	// Construct the Canary object
+	return &flaggerv1beta1.Canary{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      target.Name,
+			Namespace: target.Namespace, // Create Canary in the target namespace
+		},
+		Spec: flaggerSpec,
+	}, nil
+}
+
+// driftedWebhooks returns the names of the injected webhooks which are missing from the analysis of an existing Canary,
+// or whose URL is changed, e.g. when the Canary is edited directly.
+func driftedWebhooks(analysis *flaggerv1beta1.CanaryAnalysis, injected []flaggerv1beta1.CanaryWebhook) []string {
+	var drifted []string
+	for _, webhook := range injected {
+		if analysis == nil || !slices.ContainsFunc(analysis.Webhooks, func(w flaggerv1beta1.CanaryWebhook) bool {
+			return w.Name == webhook.Name && w.URL == webhook.URL
+		}) {
+			drifted = append(drifted, webhook.Name)
+		}
+	}
+	return drifted
+}
+
+func (b *flaggerBackend) Delete(ctx context.Context, target piggysecvalpha1.Target) error {
+	canary := &flaggerv1beta1.Canary{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      target.Name,
+			Namespace: target.Namespace,
+		},
+	}
+	return b.client.Delete(ctx, canary)
+}
+
+// validateFlaggerSpec decodes the raw Flagger spec and checks the fields which Flagger requires.
+func validateFlaggerSpec(raw []byte) (flaggerv1beta1.CanarySpec, error) {
+	var flaggerSpec flaggerv1beta1.CanarySpec
+	if len(raw) == 0 {
+		return flaggerSpec, fmt.Errorf("spec.flagger is required")
+	}
+	if err := json.Unmarshal(raw, &flaggerSpec); err != nil {
+		return flaggerSpec, fmt.Errorf("unable to decode spec.flagger: %w", err)
+	}
+	if flaggerSpec.TargetRef.Name == "" || flaggerSpec.TargetRef.Kind == "" {
+		return flaggerSpec, fmt.Errorf("spec.flagger.targetRef requires name and kind")
+	}
+	return flaggerSpec, nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+)
+
+const (
+	// backoffBase is the requeue delay after the first failed reconcile of a CanaryGate
+	backoffBase = 5 * time.Second
+	// backoffMax caps the requeue delay of a CanaryGate which keeps failing
+	backoffMax = 5 * time.Minute
+)
+
+// reconcileBackoff counts the consecutive failed reconciles of each CanaryGate. The zero value is ready to use.
+type reconcileBackoff struct {
+	mu       sync.Mutex
+	failures map[types.NamespacedName]int
+}
+
+// failure records a failed reconcile and returns the number of consecutive failures and the delay before the next one.
+// The delay doubles with each failure from backoffBase up to backoffMax.
+func (b *reconcileBackoff) failure(key types.NamespacedName) (int, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures == nil {
+		b.failures = map[types.NamespacedName]int{}
+	}
+	b.failures[key]++
+	failures := b.failures[key]
+	delay := backoffBase
+	for i := 1; i < failures && delay < backoffMax; i++ {
+		delay *= 2
+	}
+	return failures, min(delay, backoffMax)
+}
+
+// reset forgets the failures of a CanaryGate after a successful reconcile
+func (b *reconcileBackoff) reset(key types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.failures, key)
+}
+
+// setBackoffCondition records in the status whether the CanaryGate is retried with a backoff. A missing condition is not
+// added when the reconcile succeeds, so only the CanaryGates which have failed carry it.
+func (r *CanaryGateReconciler) setBackoffCondition(ctx context.Context, key types.NamespacedName, failures int, delay time.Duration, reconcileErr error) {
+	var canaryGate piggysecvalpha1.CanaryGate
+	if err := r.Get(ctx, key, &canaryGate); err != nil {
+		return
+	}
+	if reconcileErr == nil {
+		if !meta.IsStatusConditionTrue(canaryGate.Status.Conditions, piggysecvalpha1.ConditionBackoff) {
+			return
+		}
+		if err := r.setCondition(ctx, &canaryGate, piggysecvalpha1.ConditionBackoff, metav1.ConditionFalse, "Reconciled", "The last reconcile succeeded"); err != nil {
+			log.Error().Err(err).Msg("Failed to update CanaryGate condition")
+		}
+		return
+	}
+	msg := fmt.Sprintf("Reconcile failed %d times, retrying in %s: %v", failures, delay, reconcileErr)
+	if err := r.setCondition(ctx, &canaryGate, piggysecvalpha1.ConditionBackoff, metav1.ConditionTrue, "ReconcileFailed", msg); err != nil {
+		log.Error().Err(err).Msg("Failed to update CanaryGate condition")
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	flaggerv1beta1 "github.com/fluxcd/flagger/pkg/apis/flagger/v1beta1"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+)
+
+func TestReconcileBackoffDelays(t *testing.T) {
+	var b reconcileBackoff
+	key := types.NamespacedName{Name: "demo", Namespace: "gate-ns"}
+	var delays []time.Duration
+	for range 9 {
+		_, delay := b.failure(key)
+		delays = append(delays, delay)
+	}
+	require.Equal(t, []time.Duration{
+		5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second,
+		160 * time.Second, 5 * time.Minute, 5 * time.Minute, 5 * time.Minute,
+	}, delays)
+
+	// the failures of another CanaryGate are counted apart
+	failures, delay := b.failure(types.NamespacedName{Name: "other", Namespace: "gate-ns"})
+	require.Equal(t, 1, failures)
+	require.Equal(t, backoffBase, delay)
+
+	// a success resets the delay
+	b.reset(key)
+	failures, delay = b.failure(key)
+	require.Equal(t, 1, failures)
+	require.Equal(t, backoffBase, delay)
+}
+
+func TestReconcileBackoff(t *testing.T) {
+	ctx := context.TODO()
+	r := newTestReconciler(t, newTestCanaryGate("gate-ns"))
+	failing := true
+	r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if _, ok := obj.(*flaggerv1beta1.Canary); ok && failing {
+				return errors.New("the server rejected the request")
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+	})
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	condition := func() *metav1.Condition {
+		var canaryGate piggysecvalpha1.CanaryGate
+		require.NoError(t, r.Get(ctx, req.NamespacedName, &canaryGate))
+		return meta.FindStatusCondition(canaryGate.Status.Conditions, piggysecvalpha1.ConditionBackoff)
+	}
+
+	// a successful reconcile does not add the condition
+	failing = false
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Nil(t, condition())
+
+	// the repeated failures back off and are reported in the status
+	require.NoError(t, r.Delete(ctx, &flaggerv1beta1.Canary{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "gate-ns"}}))
+	failing = true
+	result, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Second, result.RequeueAfter)
+	result, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Second, result.RequeueAfter)
+	cond := condition()
+	require.NotNil(t, cond)
+	require.Equal(t, metav1.ConditionTrue, cond.Status)
+	require.Equal(t, "ReconcileFailed", cond.Reason)
+	require.Contains(t, cond.Message, "failed 2 times, retrying in 10s")
+
+	// a success resets the backoff and the condition
+	failing = false
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, metav1.ConditionFalse, condition().Status)
+	require.NoError(t, r.Delete(ctx, &flaggerv1beta1.Canary{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "gate-ns"}}))
+	failing = true
+	result, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Second, result.RequeueAfter)
+}
@@ -17,41 +17,95 @@ package controller
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
+	"slices"
 	"time"
 
 	flaggerv1beta1 "github.com/fluxcd/flagger/pkg/apis/flagger/v1beta1"
 	"github.com/rs/zerolog/log"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 
 	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
 	"github.com/KongZ/canary-gate/service"
 )
 
+// canaryFinalizer deletes the Flagger Canary or Argo Rollout in another namespace, where owner references cannot be used
+const canaryFinalizer = "piggysec.com/canary-cleanup"
+
+const (
+	// DefaultWebhookTimeout is the timeout of the injected webhooks when the CanaryGate does not set webhookTimeout
+	DefaultWebhookTimeout = "5s"
+	// DefaultWebhookRetries is the number of retries of the injected webhooks when the CanaryGate does not set webhookRetries
+	DefaultWebhookRetries = 2
+)
+
 // CanaryGateReconciler reconciles a CanaryGate object
 type CanaryGateReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+	// Backend is used by the CanaryGates which do not set spec.backend. Flagger is used when it is empty.
+	Backend string
+	// WebhookSecret is injected into the webhook metadata so the requests of Flagger pass the signature verification
+	WebhookSecret string
+	// ServiceNamespace is the namespace of the canary-gate Service which the webhook endpoint is resolved from
+	// when CANARY_GATE_ENDPOINT is not set
+	ServiceNamespace string
+	// Reader reads the canary-gate Service. The Client is used when it is nil.
+	Reader client.Reader
+	// BasePath is the path prefix of the server, which is appended to the webhook endpoint
+	BasePath string
+	// DefaultClosed lists the gates which are closed by default in addition to the rollback gate, like the gate store
+	DefaultClosed []string
+	// Gates reads the live gate states which are recorded in the status. The spec is read when it is nil.
+	Gates GateLister
+	// Writer changes the scheduled gates when the gate store is not the CanaryGate. The spec is changed when it is nil.
+	Writer GateWriter
+	// Notifier is notified of the gates which are reset by their TTL or set by the schedule. Nothing is sent when it is nil.
+	Notifier GateNotifier
+	// ResyncInterval requeues each CanaryGate to re-assert the injected gates, e.g. when the webhooks are removed from
+	// a Canary which is not owned and not watched. It is disabled when zero.
+	ResyncInterval time.Duration
+
+	backoff reconcileBackoff
 }
 
 // +kubebuilder:rbac:groups=piggysec.com,resources=canarygates,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=piggysec.com,resources=canarygates/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=piggysec.com,resources=canarygates/finalizers,verbs=update
 // +kubebuilder:rbac:groups=flagger.app,resources=canaries,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=argoproj.io,resources=rollouts;analysistemplates,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch
 // +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//
+// A failed reconcile is retried with a delay which doubles from 5s up to 5m for each consecutive failure of the
+// CanaryGate, and is reset by a successful reconcile.
 func (r *CanaryGateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	result, err := r.reconcile(ctx, req)
+	if err != nil {
+		failures, delay := r.backoff.failure(req.NamespacedName)
+		log.Warn().Err(err).Int("failures", failures).Msgf("Reconcile of CanaryGate [%s] failed, retrying in %s", req.NamespacedName, delay)
+		r.setBackoffCondition(ctx, req.NamespacedName, failures, delay, err)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+	r.backoff.reset(req.NamespacedName)
+	r.setBackoffCondition(ctx, req.NamespacedName, 0, 0, nil)
+	return result, nil
+}
 
+func (r *CanaryGateReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	// Fetch the CanaryGate crd
 	var canaryGate piggysecvalpha1.CanaryGate
 	if err := r.Get(ctx, req.NamespacedName, &canaryGate); err != nil {
@@ -63,118 +117,395 @@ func (r *CanaryGateReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
-	// Deserialize the raw Flagger spec into a Flagger CanarySpec struct
-	// This gives us typed access to the spec while preserving all other fields.
-	var flaggerSpec flaggerv1beta1.CanarySpec
-	if err := json.Unmarshal(canaryGate.Spec.Flagger.Raw, &flaggerSpec); err != nil {
-		log.Error().Err(err).Msg("Failed to unmarshal Flagger spec from CanaryGate")
-		return ctrl.Result{RequeueAfter: time.Minute}, err
+	// Delete the Canary of a deleted CanaryGate which is owned through the finalizer
+	if !canaryGate.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, &canaryGate)
+	}
+	if err := r.ensureFinalizer(ctx, &canaryGate); err != nil {
+		log.Error().Err(err).Msg("Failed to update CanaryGate finalizer")
+		return ctrl.Result{}, err
 	}
 
-	endpoint := os.Getenv("CANARY_GATE_ENDPOINT")
+	// Reset the gates which were opened with a TTL that has already passed
+	nextExpiry, err := r.expireGates(ctx, &canaryGate)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to reset expired gates")
+		return ctrl.Result{}, err
+	}
+
+	// Open or close the scheduled gates when a window starts or ends
+	nextSchedule, err := r.applySchedule(ctx, &canaryGate)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to apply schedule")
+		return ctrl.Result{}, err
+	}
+	requeueAfter := shortestRequeue(nextExpiry, nextSchedule)
+	if r.Gates != nil {
+		requeueAfter = shortestRequeue(requeueAfter, gateStatusInterval)
+	}
+	requeueAfter = shortestRequeue(requeueAfter, r.ResyncInterval)
 
-	// Ensure the Analysis field is not nil
-	if flaggerSpec.Analysis == nil {
-		flaggerSpec.Analysis = &flaggerv1beta1.CanaryAnalysis{}
+	// Report the opened gates whose dependencies are closed
+	if err := r.checkDependencies(ctx, &canaryGate); err != nil {
+		log.Error().Err(err).Msg("Failed to update CanaryGate condition")
+		return ctrl.Result{}, err
 	}
 
-	defaultMetadata := &map[string]string{
-		"gate_name":      canaryGate.Name,
-		"gate_namespace": canaryGate.Namespace,
+	// Record the live gate states
+	if err := r.reconcileGateStatus(ctx, &canaryGate); err != nil {
+		log.Error().Err(err).Msg("Failed to update CanaryGate gate states")
+		return ctrl.Result{}, err
 	}
 
-	// Prepend our controlled webhook.
-	flaggerSpec.Analysis.Webhooks = []flaggerv1beta1.CanaryWebhook{
-		{
-			Name:     string(service.HookConfirmRollout),
-			Type:     flaggerv1beta1.ConfirmRolloutHook,
-			URL:      fmt.Sprintf("%s/confirm-rollout", endpoint),
-			Metadata: defaultMetadata,
-		},
-		{
-			Name:     string(service.HookPreRollout),
-			Type:     flaggerv1beta1.PreRolloutHook,
-			URL:      fmt.Sprintf("%s/pre-rollout", endpoint),
-			Metadata: defaultMetadata,
-		},
-		{
-			Name:     string(service.HookRollout),
-			Type:     flaggerv1beta1.RolloutHook,
-			URL:      fmt.Sprintf("%s/rollout", endpoint),
-			Metadata: defaultMetadata,
-		},
-		{
-			Name:     string(service.HookConfirmTrafficIncrease),
-			Type:     flaggerv1beta1.ConfirmTrafficIncreaseHook,
-			URL:      fmt.Sprintf("%s/confirm-traffic-increase", endpoint),
-			Metadata: defaultMetadata,
-		},
-		{
-			Name:     string(service.HookConfirmPromotion),
-			Type:     flaggerv1beta1.ConfirmPromotionHook,
-			URL:      fmt.Sprintf("%s/confirm-promotion", endpoint),
-			Metadata: defaultMetadata,
-		},
-		{
-			Name:     string(service.HookPostRollout),
-			Type:     flaggerv1beta1.PostRolloutHook,
-			URL:      fmt.Sprintf("%s/post-rollout", endpoint),
-			Metadata: defaultMetadata,
-		},
-		{
-			Name:     string(service.HookRollback),
-			Type:     flaggerv1beta1.RollbackHook,
-			URL:      fmt.Sprintf("%s/rollback", endpoint),
-			Metadata: defaultMetadata,
-		},
-		{
-			Name:     string(service.HookEvent),
-			Type:     flaggerv1beta1.EventHook,
-			URL:      fmt.Sprintf("%s/event", endpoint),
-			Metadata: defaultMetadata,
-		},
+	backend, err := r.backend(&canaryGate)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid backend in CanaryGate")
+		r.Recorder.Event(&canaryGate, corev1.EventTypeWarning, "InvalidBackend", err.Error())
+		return ctrl.Result{RequeueAfter: requeueAfter}, r.setReadyCondition(ctx, &canaryGate, metav1.ConditionFalse, "InvalidBackend", err.Error())
+	}
+	if err := backend.Validate(&canaryGate); err != nil {
+		// The spec must be fixed by the user, which triggers another reconcile
+		reason := fmt.Sprintf("Invalid%sSpec", backend.Name())
+		log.Error().Err(err).Msgf("Invalid %s spec in CanaryGate", backend.Name())
+		r.Recorder.Event(&canaryGate, corev1.EventTypeWarning, reason, err.Error())
+		return ctrl.Result{RequeueAfter: requeueAfter}, r.setReadyCondition(ctx, &canaryGate, metav1.ConditionFalse, reason, err.Error())
+	}
+	targets := canaryGate.Spec.GetTargets()
+	if canaryGate.Spec.TargetSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(canaryGate.Spec.TargetSelector)
+		if err != nil {
+			log.Error().Err(err).Msg("Invalid target selector in CanaryGate")
+			r.Recorder.Event(&canaryGate, corev1.EventTypeWarning, "InvalidTargetSelector", err.Error())
+			return ctrl.Result{RequeueAfter: requeueAfter}, r.setReadyCondition(ctx, &canaryGate, metav1.ConditionFalse, "InvalidTargetSelector", err.Error())
+		}
+		if targets, err = r.reconcileSelectedTargets(ctx, &canaryGate, backend, selector); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	for _, target := range targets {
+		if target.Name == "" || target.Namespace == "" {
+			err := fmt.Errorf("spec.target or spec.targets requires name and namespace")
+			log.Error().Err(err).Msg("Invalid target in CanaryGate")
+			r.Recorder.Event(&canaryGate, corev1.EventTypeWarning, "InvalidTarget", err.Error())
+			return ctrl.Result{RequeueAfter: requeueAfter}, r.setReadyCondition(ctx, &canaryGate, metav1.ConditionFalse, "InvalidTarget", err.Error())
+		}
+	}
+
+	endpoint, err := r.webhookEndpoint(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to resolve the webhook endpoint")
+		r.Recorder.Event(&canaryGate, corev1.EventTypeWarning, "EndpointNotFound", err.Error())
+		if condErr := r.setReadyCondition(ctx, &canaryGate, metav1.ConditionFalse, "EndpointNotFound", err.Error()); condErr != nil {
+			log.Error().Err(condErr).Msg("Failed to update CanaryGate condition")
+		}
+		return ctrl.Result{}, err
+	}
+
+	gates, warnings := newGateConfig(&canaryGate, endpoint, r.WebhookSecret)
+	for _, warning := range warnings {
+		log.Warn().Msg(warning.message)
+		r.Recorder.Event(&canaryGate, corev1.EventTypeWarning, warning.reason, warning.message)
+	}
+
+	for _, target := range targets {
+		if err := r.reconcileTarget(ctx, &canaryGate, backend, target, gates); err != nil {
+			if condErr := r.setReadyCondition(ctx, &canaryGate, metav1.ConditionFalse, "ReconcileFailed", err.Error()); condErr != nil {
+				log.Error().Err(condErr).Msg("Failed to update CanaryGate condition")
+			}
+			return ctrl.Result{}, err
+		}
+	}
+
+	msg := fmt.Sprintf("%d %s resources are reconciled", len(targets), backend.Kind())
+	if err := r.setReadyCondition(ctx, &canaryGate, metav1.ConditionTrue, "Reconciled", msg); err != nil {
+		log.Error().Err(err).Msg("Failed to update CanaryGate condition")
+		return ctrl.Result{}, err
 	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// gateWarning is a setting of the CanaryGate which is ignored, and is reported as a warning event
+type gateWarning struct {
+	reason  string
+	message string
+}
 
-	// Construct the Canary object
-	canary := &flaggerv1beta1.Canary{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      canaryGate.Spec.Target.Name,
-			Namespace: canaryGate.Spec.Target.Namespace, // Create Canary in the target namespace
+// newGateConfig returns the gates which are injected for the CanaryGate with the endpoint and the secret of the
+// controller, and warns of the invalid settings which are replaced by the defaults.
+func newGateConfig(canaryGate *piggysecvalpha1.CanaryGate, endpoint string, secret string) (gateConfig, []gateWarning) {
+	var warnings []gateWarning
+	// The gate metadata makes the gates of every target resolve to this CanaryGate
+	gates := gateConfig{
+		endpoint: endpoint,
+		metadata: map[string]string{
+			service.MetaGateName:      canaryGate.Name,
+			service.MetaGateNamespace: canaryGate.Namespace,
 		},
-		Spec: flaggerSpec, // Assign the modified spec
+		disabledGates:      canaryGate.Spec.DisabledGates,
+		webhookTimeout:     DefaultWebhookTimeout,
+		webhookRetries:     DefaultWebhookRetries,
+		workloadFromTarget: canaryGate.Spec.TargetSelector != nil,
+	}
+	if timeout := canaryGate.Spec.WebhookTimeout; timeout != "" {
+		if d, err := time.ParseDuration(timeout); err != nil || d <= 0 {
+			warnings = append(warnings, gateWarning{"InvalidWebhookTimeout",
+				fmt.Sprintf("Invalid webhookTimeout [%s] is ignored, %s is used", timeout, DefaultWebhookTimeout)})
+		} else {
+			gates.webhookTimeout = timeout
+		}
+	}
+	if retries := canaryGate.Spec.WebhookRetries; retries != nil {
+		if *retries < 0 {
+			warnings = append(warnings, gateWarning{"InvalidWebhookRetries",
+				fmt.Sprintf("Invalid webhookRetries [%d] is ignored, %d is used", *retries, DefaultWebhookRetries)})
+		} else {
+			gates.webhookRetries = *retries
+		}
+	}
+	if secret != "" {
+		gates.metadata[service.MetaGateSecret] = secret
+	}
+	warnings = append(warnings, addWebhookMetadata(gates.metadata, canaryGate)...)
+	for _, gate := range canaryGate.Spec.DisabledGates {
+		if !isInjectedHook(gate) {
+			warnings = append(warnings, gateWarning{"UnknownGate", fmt.Sprintf("Unknown gate [%s] in disabledGates is ignored", gate)})
+		}
+	}
+	for _, gate := range canaryGate.Spec.RequireApproval {
+		if !isGate(gate) {
+			warnings = append(warnings, gateWarning{"UnknownGate", fmt.Sprintf("Unknown gate [%s] in requireApproval is ignored", gate)})
+		}
+	}
+	return gates, warnings
+}
+
+// injectedHooks lists the webhooks which the controller injects into the Flagger analysis
+var injectedHooks = []struct {
+	hook        service.HookType
+	webhookType flaggerv1beta1.HookType
+}{
+	{service.HookConfirmRollout, flaggerv1beta1.ConfirmRolloutHook},
+	{service.HookPreRollout, flaggerv1beta1.PreRolloutHook},
+	{service.HookRollout, flaggerv1beta1.RolloutHook},
+	{service.HookConfirmTrafficIncrease, flaggerv1beta1.ConfirmTrafficIncreaseHook},
+	{service.HookConfirmPromotion, flaggerv1beta1.ConfirmPromotionHook},
+	// Flagger has no finalize hook, the promotion waits for every confirm-promotion hook
+	{service.HookConfirmFinalize, flaggerv1beta1.ConfirmPromotionHook},
+	{service.HookPostRollout, flaggerv1beta1.PostRolloutHook},
+	{service.HookRollback, flaggerv1beta1.RollbackHook},
+	{service.HookEvent, flaggerv1beta1.EventHook},
+}
+
+// injectedWebhooks creates the webhooks of all gates except the disabled ones
+func injectedWebhooks(gates gateConfig) []flaggerv1beta1.CanaryWebhook {
+	webhooks := make([]flaggerv1beta1.CanaryWebhook, 0, len(injectedHooks))
+	for _, h := range injectedHooks {
+		if slices.Contains(gates.disabledGates, string(h.hook)) {
+			continue
+		}
+		webhooks = append(webhooks, flaggerv1beta1.CanaryWebhook{
+			Name:     string(h.hook),
+			Type:     h.webhookType,
+			URL:      fmt.Sprintf("%s/%s", gates.endpoint, h.hook),
+			Timeout:  gates.webhookTimeout,
+			Retries:  gates.webhookRetries,
+			Metadata: &gates.metadata,
+		})
 	}
+	return webhooks
+}
 
-	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, canary, func() error {
-		canary.Spec = flaggerSpec
-		return nil
-		// Return SetControllerReference for makeing reference to Canary then when CanaryGate is deleted, Canary will be deleted too
-		// return controllerutil.SetControllerReference(&canaryGate, canary, r.Scheme)
-	})
+// mergeWebhooks keeps the webhooks of the user, e.g. a load test, and appends the injected webhooks. A webhook of the
+// user with the name of an injected webhook is replaced by the injected one.
+func mergeWebhooks(userWebhooks []flaggerv1beta1.CanaryWebhook, injected []flaggerv1beta1.CanaryWebhook) []flaggerv1beta1.CanaryWebhook {
+	webhooks := make([]flaggerv1beta1.CanaryWebhook, 0, len(userWebhooks)+len(injected))
+	for _, webhook := range userWebhooks {
+		if slices.ContainsFunc(injected, func(w flaggerv1beta1.CanaryWebhook) bool { return w.Name == webhook.Name }) {
+			log.Warn().Msgf("Webhook [%s] of the Flagger spec is replaced by the canary gate webhook with the same name", webhook.Name)
+			continue
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return append(webhooks, injected...)
+}
 
-	log.Trace().
-		Str("namespace", canaryGate.Spec.Target.Namespace).
-		Str("name", canaryGate.Spec.Target.Name).
-		Msg("Successfully injected custom webhook into Canary spec")
+// isInjectedHook checks whether the gate is one of the injected webhooks
+func isInjectedHook(gate string) bool {
+	for _, h := range injectedHooks {
+		if string(h.hook) == gate {
+			return true
+		}
+	}
+	return false
+}
 
+// backend returns the backend of the CanaryGate, or the default backend of the controller when the CanaryGate does not set one
+func (r *CanaryGateReconciler) backend(canaryGate *piggysecvalpha1.CanaryGate) (CanaryBackend, error) {
+	name := canaryGate.Spec.Backend
+	if name == "" {
+		name = r.Backend
+	}
+	return newCanaryBackend(name, r.Client, r.Scheme)
+}
+
+// reconcileTarget creates or updates the resource of a target with the injected gates.
+func (r *CanaryGateReconciler) reconcileTarget(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate, backend CanaryBackend, target piggysecvalpha1.Target, gates gateConfig) error {
+	result, err := backend.Reconcile(ctx, canaryGate, target, gates)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create or update Canary resource")
-		r.Recorder.Event(&canaryGate, corev1.EventTypeWarning, "ReconcileFailed", err.Error())
-		return ctrl.Result{}, err
+		log.Error().Err(err).Msgf("Failed to create or update %s resource", backend.Kind())
+		r.Recorder.Event(canaryGate, corev1.EventTypeWarning, "ReconcileFailed", err.Error())
+		return err
 	}
 
+	log.Trace().
+		Str("namespace", target.Namespace).
+		Str("name", target.Name).
+		Msgf("Successfully injected gates into %s spec", backend.Kind())
+
 	if result != controllerutil.OperationResultNone {
-		msg := fmt.Sprintf("Canary resource %s successfully", result)
+		msg := fmt.Sprintf("%s resource %s/%s %s successfully", backend.Kind(), target.Namespace, target.Name, result)
 		log.Info().Str("operation", string(result)).Msg(msg)
-		r.Recorder.Event(&canaryGate, corev1.EventTypeNormal, "CanaryReconciled", msg)
+		r.Recorder.Event(canaryGate, corev1.EventTypeNormal, "CanaryReconciled", msg)
+	}
+	return nil
+}
+
+// setReadyCondition records the Ready condition in the CanaryGate status.
+func (r *CanaryGateReconciler) setReadyCondition(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate, status metav1.ConditionStatus, reason, message string) error {
+	return r.setCondition(ctx, canaryGate, piggysecvalpha1.ConditionReady, status, reason, message)
+}
+
+// setCondition records a condition in the CanaryGate status. The object is only updated when the condition changes.
+func (r *CanaryGateReconciler) setCondition(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate, conditionType string, status metav1.ConditionStatus, reason, message string) error {
+	changed := meta.SetStatusCondition(&canaryGate.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: canaryGate.Generation,
+	})
+	if !changed {
+		return nil
+	}
+	return r.Update(ctx, canaryGate)
+}
+
+// setClosedAt records in the status the time when the gate is closed, like the gate store does, and removes it when
+// the gate is opened
+func (r *CanaryGateReconciler) setClosedAt(canaryGate *piggysecvalpha1.CanaryGate, gate string, now time.Time) {
+	if r.isGateOpened(canaryGate, gate) {
+		delete(canaryGate.Status.ClosedAt, gate)
+		return
+	}
+	if canaryGate.Status.ClosedAt == nil {
+		canaryGate.Status.ClosedAt = map[string]string{}
+	}
+	canaryGate.Status.ClosedAt[gate] = now.UTC().Format(time.RFC3339)
+}
+
+// expireGates resets the gates which were opened with a TTL back to their default state once the TTL has passed.
+// Only the canarygate store records the expiry in the status; the other stores reset their gates themselves.
+// It returns the duration until the next gate expires, or zero if there is no pending expiry.
+func (r *CanaryGateReconciler) expireGates(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate) (time.Duration, error) {
+	now := time.Now()
+	var next time.Duration
+	var expired []string
+	for gate, val := range canaryGate.Status.Expiry {
+		expiry, err := time.Parse(time.RFC3339, val)
+		if err != nil || !now.Before(expiry) {
+			expired = append(expired, gate)
+			continue
+		}
+		if d := expiry.Sub(now); next == 0 || d < next {
+			next = d
+		}
+	}
+	if len(expired) == 0 {
+		return next, nil
+	}
+	for _, gate := range expired {
+		// an empty value makes the store fall back to the default state of the gate
+		canaryGate.Spec.SetGate(gate, "")
+		delete(canaryGate.Status.Expiry, gate)
+		r.setClosedAt(canaryGate, gate, now)
+	}
+	if err := r.Update(ctx, canaryGate); err != nil {
+		return 0, err
+	}
+	for _, gate := range expired {
+		msg := fmt.Sprintf("Gate [%s/%s=%s] is expired and reset to its default state", canaryGate.Namespace, canaryGate.Name, gate)
+		log.Info().Msg(msg)
+		r.Recorder.Event(canaryGate, corev1.EventTypeNormal, "GateExpired", msg)
+		if r.Notifier != nil {
+			r.Notifier.NotifyAutoChange(canaryGate.Namespace, canaryGate.Name, service.HookType(gate), r.isGateOpened(canaryGate, gate), "after its TTL")
+		}
+	}
+	return next, nil
+}
+
+// crossNamespace returns true when any Canary is created in another namespace than the CanaryGate.
+// A target selector matches the Deployments of any namespace.
+func crossNamespace(canaryGate *piggysecvalpha1.CanaryGate) bool {
+	if canaryGate.Spec.TargetSelector != nil {
+		return true
 	}
+	for _, target := range canaryGate.Spec.GetTargets() {
+		if target.Namespace != canaryGate.Namespace {
+			return true
+		}
+	}
+	return false
+}
 
-	return ctrl.Result{}, nil
+// ensureFinalizer adds the finalizer to an owned CanaryGate whose Canary is in another namespace, and removes it otherwise.
+func (r *CanaryGateReconciler) ensureFinalizer(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate) error {
+	var changed bool
+	if canaryGate.Spec.OwnedCanary && crossNamespace(canaryGate) {
+		changed = controllerutil.AddFinalizer(canaryGate, canaryFinalizer)
+	} else {
+		changed = controllerutil.RemoveFinalizer(canaryGate, canaryFinalizer)
+	}
+	if !changed {
+		return nil
+	}
+	return r.Update(ctx, canaryGate)
+}
+
+// finalize deletes the Canaries of the CanaryGate and then removes the finalizer so the CanaryGate can be deleted.
+func (r *CanaryGateReconciler) finalize(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate) error {
+	if !controllerutil.ContainsFinalizer(canaryGate, canaryFinalizer) {
+		return nil
+	}
+	backend, err := r.backend(canaryGate)
+	if err != nil {
+		// nothing was created for an unknown backend
+		log.Warn().Err(err).Msg("Skipped cleanup of CanaryGate with an invalid backend")
+		controllerutil.RemoveFinalizer(canaryGate, canaryFinalizer)
+		return r.Update(ctx, canaryGate)
+	}
+	for _, target := range ownedTargets(canaryGate) {
+		if err := backend.Delete(ctx, target); err != nil && !apierrors.IsNotFound(err) {
+			log.Error().Err(err).Msgf("Failed to delete %s resource", backend.Kind())
+			r.Recorder.Event(canaryGate, corev1.EventTypeWarning, "CleanupFailed", err.Error())
+			return err
+		}
+		msg := fmt.Sprintf("%s resource %s/%s deleted", backend.Kind(), target.Namespace, target.Name)
+		log.Info().Msg(msg)
+		r.Recorder.Event(canaryGate, corev1.EventTypeNormal, "CanaryDeleted", msg)
+	}
+	controllerutil.RemoveFinalizer(canaryGate, canaryFinalizer)
+	return r.Update(ctx, canaryGate)
 }
 
 // SetupWithManager sets up the controller with the Manager.
+// Rollouts are not watched, so the Argo Rollouts CRDs are only required when the argo backend is used.
 func (r *CanaryGateReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&piggysecvalpha1.CanaryGate{}). // Watch for CanaryGate resources
-		Owns(&flaggerv1beta1.Canary{}).     // Also watch for Canaries owned by a CanaryGate
-		Complete(r)
+		// Watch the labels of the Deployments for the target selectors. Only the metadata is cached.
+		Watches(&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(r.canaryGatesOfDeployment), builder.OnlyMetadata)
+	if r.Backend != piggysecvalpha1.BackendArgo {
+		b = b.Owns(&flaggerv1beta1.Canary{}) // Also watch for Canaries owned by a CanaryGate
+	}
+	return b.Complete(r)
 }
@@ -0,0 +1,504 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	flaggerv1beta1 "github.com/fluxcd/flagger/pkg/apis/flagger/v1beta1"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
+)
+
+func newTestReconciler(t *testing.T, objs ...*piggysecvalpha1.CanaryGate) *CanaryGateReconciler {
+	scheme := runtime.NewScheme()
+	require.NoError(t, piggysecvalpha1.AddToScheme(scheme))
+	require.NoError(t, flaggerv1beta1.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, appsv1.AddToScheme(scheme))
+	// the Argo Rollouts resources are unstructured
+	for _, gvk := range []schema.GroupVersionKind{rolloutGVK, analysisTemplateGVK} {
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+	}
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for _, obj := range objs {
+		builder = builder.WithObjects(obj)
+	}
+	return &CanaryGateReconciler{
+		Client:   builder.Build(),
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+	}
+}
+
+func newTestCanaryGate(targetNamespace string) *piggysecvalpha1.CanaryGate {
+	return &piggysecvalpha1.CanaryGate{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "gate-ns"},
+		Spec: piggysecvalpha1.CanaryGateSpec{
+			Target:      piggysecvalpha1.Target{Name: "demo", Namespace: targetNamespace},
+			OwnedCanary: true,
+			Flagger:     runtime.RawExtension{Raw: []byte(`{"targetRef":{"apiVersion":"apps/v1","kind":"Deployment","name":"demo"}}`)},
+		},
+	}
+}
+
+func TestReconcileOwnerReference(t *testing.T) {
+	ctx := context.TODO()
+	r := newTestReconciler(t, newTestCanaryGate("gate-ns"))
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	var canary flaggerv1beta1.Canary
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "gate-ns"}, &canary))
+	require.Len(t, canary.OwnerReferences, 1)
+	require.Equal(t, "CanaryGate", canary.OwnerReferences[0].Kind)
+
+	var canaryGate piggysecvalpha1.CanaryGate
+	require.NoError(t, r.Get(ctx, req.NamespacedName, &canaryGate))
+	require.False(t, controllerutil.ContainsFinalizer(&canaryGate, canaryFinalizer), "same namespace should not use finalizer")
+}
+
+func TestReconcileFinalizer(t *testing.T) {
+	ctx := context.TODO()
+	r := newTestReconciler(t, newTestCanaryGate("target-ns"))
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	canaryKey := types.NamespacedName{Name: "demo", Namespace: "target-ns"}
+	var canary flaggerv1beta1.Canary
+	require.NoError(t, r.Get(ctx, canaryKey, &canary))
+	require.Empty(t, canary.OwnerReferences, "owner references cannot span namespaces")
+
+	var canaryGate piggysecvalpha1.CanaryGate
+	require.NoError(t, r.Get(ctx, req.NamespacedName, &canaryGate))
+	require.True(t, controllerutil.ContainsFinalizer(&canaryGate, canaryFinalizer))
+
+	// deleting the CanaryGate deletes the Canary through the finalizer
+	require.NoError(t, r.Delete(ctx, &canaryGate))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.True(t, apierrors.IsNotFound(r.Get(ctx, canaryKey, &canary)), "canary should be deleted")
+	require.True(t, apierrors.IsNotFound(r.Get(ctx, req.NamespacedName, &canaryGate)), "canarygate should be deleted")
+}
+
+func TestReconcileFinalizerCanaryNotFound(t *testing.T) {
+	ctx := context.TODO()
+	r := newTestReconciler(t, newTestCanaryGate("target-ns"))
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	// the Canary was already deleted by the user
+	canary := &flaggerv1beta1.Canary{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "target-ns"}}
+	require.NoError(t, r.Delete(ctx, canary))
+
+	var canaryGate piggysecvalpha1.CanaryGate
+	require.NoError(t, r.Get(ctx, req.NamespacedName, &canaryGate))
+	require.NoError(t, r.Delete(ctx, &canaryGate))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.True(t, apierrors.IsNotFound(r.Get(ctx, req.NamespacedName, &canaryGate)), "finalizer should be cleared")
+}
+
+func TestReconcileNotOwned(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("target-ns")
+	canaryGate.Spec.OwnedCanary = false
+	r := newTestReconciler(t, canaryGate)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	require.NoError(t, r.Get(ctx, req.NamespacedName, canaryGate))
+	require.False(t, controllerutil.ContainsFinalizer(canaryGate, canaryFinalizer), "finalizer is opt-in")
+	require.NoError(t, r.Delete(ctx, canaryGate))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	var canary flaggerv1beta1.Canary
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "target-ns"}, &canary), "canary should be kept")
+}
+
+func TestReconcileReadyCondition(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.Flagger = runtime.RawExtension{Raw: []byte(`{"service":{"port":80}}`)}
+	r := newTestReconciler(t, canaryGate)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	// missing targetRef is reported in the status
+	require.NoError(t, r.Get(ctx, req.NamespacedName, canaryGate))
+	cond := meta.FindStatusCondition(canaryGate.Status.Conditions, piggysecvalpha1.ConditionReady)
+	require.NotNil(t, cond)
+	require.Equal(t, metav1.ConditionFalse, cond.Status)
+	require.Equal(t, "InvalidFlaggerSpec", cond.Reason)
+	require.Contains(t, cond.Message, "targetRef")
+	var canary flaggerv1beta1.Canary
+	require.True(t, apierrors.IsNotFound(r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "gate-ns"}, &canary)))
+
+	// fixing the spec makes the CanaryGate ready
+	canaryGate.Spec.Flagger = newTestCanaryGate("gate-ns").Spec.Flagger
+	require.NoError(t, r.Update(ctx, canaryGate))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, r.Get(ctx, req.NamespacedName, canaryGate))
+	cond = meta.FindStatusCondition(canaryGate.Status.Conditions, piggysecvalpha1.ConditionReady)
+	require.NotNil(t, cond)
+	require.Equal(t, metav1.ConditionTrue, cond.Status)
+}
+
+func TestReconcileDependenciesCondition(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.ConfirmRollout = gateClosed
+	canaryGate.Spec.ConfirmPromotion = gateOpened
+	r := newTestReconciler(t, canaryGate)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	// confirm-promotion depends on confirm-rollout through the default chain
+	require.NoError(t, r.Get(ctx, req.NamespacedName, canaryGate))
+	cond := meta.FindStatusCondition(canaryGate.Status.Conditions, piggysecvalpha1.ConditionDependencies)
+	require.NotNil(t, cond)
+	require.Equal(t, metav1.ConditionFalse, cond.Status)
+	require.Equal(t, "DependenciesClosed", cond.Reason)
+	require.Contains(t, cond.Message, "[confirm-promotion] is opened before [confirm-rollout]")
+
+	// the dependencies of a gate can be removed
+	canaryGate.Spec.Dependencies = map[string][]string{"confirm-promotion": {}}
+	require.NoError(t, r.Update(ctx, canaryGate))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, r.Get(ctx, req.NamespacedName, canaryGate))
+	cond = meta.FindStatusCondition(canaryGate.Status.Conditions, piggysecvalpha1.ConditionDependencies)
+	require.Equal(t, metav1.ConditionTrue, cond.Status)
+
+	// a cycle is reported
+	canaryGate.Spec.Dependencies = map[string][]string{"confirm-rollout": {"confirm-promotion"}}
+	require.NoError(t, r.Update(ctx, canaryGate))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, r.Get(ctx, req.NamespacedName, canaryGate))
+	cond = meta.FindStatusCondition(canaryGate.Status.Conditions, piggysecvalpha1.ConditionDependencies)
+	require.Equal(t, metav1.ConditionFalse, cond.Status)
+	require.Equal(t, "InvalidDependencies", cond.Reason)
+}
+
+func TestReconcileMultipleTargets(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.Targets = []piggysecvalpha1.Target{
+		{Name: "demo-a", Namespace: "gate-ns"},
+		{Name: "demo-b", Namespace: "gate-ns"},
+	}
+	r := newTestReconciler(t, canaryGate)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	for _, name := range []string{"demo-a", "demo-b"} {
+		var canary flaggerv1beta1.Canary
+		require.NoError(t, r.Get(ctx, types.NamespacedName{Name: name, Namespace: "gate-ns"}, &canary))
+		require.Len(t, canary.Spec.Analysis.Webhooks, 9)
+		for _, webhook := range canary.Spec.Analysis.Webhooks {
+			require.Equal(t, "demo", (*webhook.Metadata)[service.MetaGateName])
+			require.Equal(t, "gate-ns", (*webhook.Metadata)[service.MetaGateNamespace])
+		}
+	}
+	// targets take precedence over target
+	var canary flaggerv1beta1.Canary
+	require.True(t, apierrors.IsNotFound(r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "gate-ns"}, &canary)))
+}
+
+func TestReconcileDisabledGates(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.DisabledGates = []string{"rollout", "pre-rollout", "event", "unknown"}
+	r := newTestReconciler(t, canaryGate)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	var canary flaggerv1beta1.Canary
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "gate-ns"}, &canary))
+	var names []string
+	for _, webhook := range canary.Spec.Analysis.Webhooks {
+		names = append(names, webhook.Name)
+	}
+	require.Equal(t, []string{"confirm-rollout", "confirm-traffic-increase", "confirm-promotion", "confirm-finalize", "post-rollout", "rollback"}, names)
+
+	var events []string
+	for len(r.Recorder.(*record.FakeRecorder).Events) > 0 {
+		events = append(events, <-r.Recorder.(*record.FakeRecorder).Events)
+	}
+	require.Contains(t, events, "Warning UnknownGate Unknown gate [unknown] in disabledGates is ignored")
+}
+
+func TestReconcileUserWebhooks(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.DisabledGates = []string{"pre-rollout"}
+	canaryGate.Spec.Flagger = runtime.RawExtension{Raw: []byte(`{
+		"targetRef":{"apiVersion":"apps/v1","kind":"Deployment","name":"demo"},
+		"analysis":{"webhooks":[
+			{"name":"load-test","type":"rollout","url":"http://flagger-loadtester.test/"},
+			{"name":"confirm-promotion","type":"confirm-promotion","url":"http://example.com/approve"},
+			{"name":"pre-rollout","type":"pre-rollout","url":"http://example.com/smoke"}
+		]}
+	}`)}
+	r := newTestReconciler(t, canaryGate)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	var canary flaggerv1beta1.Canary
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "gate-ns"}, &canary))
+	webhooks := map[string]flaggerv1beta1.CanaryWebhook{}
+	var names []string
+	for _, webhook := range canary.Spec.Analysis.Webhooks {
+		webhooks[webhook.Name] = webhook
+		names = append(names, webhook.Name)
+	}
+	// the webhooks of the user come first, a webhook of a disabled gate is kept
+	require.Equal(t, []string{"load-test", "pre-rollout", "confirm-rollout", "rollout", "confirm-traffic-increase", "confirm-promotion", "confirm-finalize", "post-rollout", "rollback", "event"}, names)
+	require.Equal(t, "http://flagger-loadtester.test/", webhooks["load-test"].URL)
+	require.Equal(t, "http://example.com/smoke", webhooks["pre-rollout"].URL)
+	// the colliding webhook is replaced
+	require.NotEqual(t, "http://example.com/approve", webhooks["confirm-promotion"].URL)
+
+	// the reconciliation is stable
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "gate-ns"}, &canary))
+	require.Len(t, canary.Spec.Analysis.Webhooks, len(names))
+}
+
+func TestReconcileResync(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.OwnedCanary = false
+	canaryGate.Spec.Flagger = runtime.RawExtension{Raw: []byte(`{
+		"targetRef":{"apiVersion":"apps/v1","kind":"Deployment","name":"demo"},
+		"analysis":{"webhooks":[{"name":"load-test","type":"rollout","url":"http://flagger-loadtester.test/"}]}
+	}`)}
+	r := newTestReconciler(t, canaryGate)
+	r.ResyncInterval = 10 * time.Minute
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	result, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Minute, result.RequeueAfter)
+
+	var canary flaggerv1beta1.Canary
+	key := types.NamespacedName{Name: "demo", Namespace: "gate-ns"}
+	require.NoError(t, r.Get(ctx, key, &canary))
+	webhooks := canary.Spec.Analysis.Webhooks
+	require.Empty(t, driftedWebhooks(canary.Spec.Analysis, webhooks[1:]))
+
+	// the webhooks are removed from the Canary directly, which leaves the webhook of the user
+	canary.Spec.Analysis.Webhooks = webhooks[:1]
+	require.NoError(t, r.Update(ctx, &canary))
+	var injected []string
+	for _, webhook := range webhooks[1:] {
+		injected = append(injected, webhook.Name)
+	}
+	require.Equal(t, injected, driftedWebhooks(canary.Spec.Analysis, webhooks[1:]))
+
+	// the next reconcile restores them
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, r.Get(ctx, key, &canary))
+	require.Equal(t, webhooks, canary.Spec.Analysis.Webhooks)
+}
+
+func TestReconcileWebhookTimeout(t *testing.T) {
+	ctx := context.TODO()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	retries := 0
+	tests := []struct {
+		name            string
+		timeout         string
+		retries         *int
+		expectedTimeout string
+		expectedRetries int
+	}{
+		{"defaults", "", nil, DefaultWebhookTimeout, DefaultWebhookRetries},
+		{"configured", "30s", &retries, "30s", 0},
+		{"invalid timeout", "soon", nil, DefaultWebhookTimeout, DefaultWebhookRetries},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canaryGate := newTestCanaryGate("gate-ns")
+			canaryGate.Spec.WebhookTimeout = tt.timeout
+			canaryGate.Spec.WebhookRetries = tt.retries
+			canaryGate.Spec.Flagger = runtime.RawExtension{Raw: []byte(`{
+				"targetRef":{"apiVersion":"apps/v1","kind":"Deployment","name":"demo"},
+				"analysis":{"webhooks":[{"name":"load-test","type":"rollout","url":"http://flagger-loadtester.test/"}]}
+			}`)}
+			r := newTestReconciler(t, canaryGate)
+			_, err := r.Reconcile(ctx, req)
+			require.NoError(t, err)
+
+			var canary flaggerv1beta1.Canary
+			require.NoError(t, r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "gate-ns"}, &canary))
+			for _, webhook := range canary.Spec.Analysis.Webhooks {
+				if webhook.Name == "load-test" {
+					// the webhooks of the user are not changed
+					require.Empty(t, webhook.Timeout)
+					continue
+				}
+				require.Equal(t, tt.expectedTimeout, webhook.Timeout, webhook.Name)
+				require.Equal(t, tt.expectedRetries, webhook.Retries, webhook.Name)
+			}
+		})
+	}
+}
+
+func TestReconcileWebhookMetadata(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Labels = map[string]string{"team": "payments"}
+	canaryGate.Spec.WebhookMetadata = map[string]string{
+		service.MetaCluster:  "prod",
+		"team":               "{{ .Labels.team }}",
+		"owner":              "{{ .Annotations.owner }}",
+		"gate":               "{{ .Namespace }}/{{ .Name }}",
+		service.MetaGateName: "other",
+		service.MetaName:     "other",
+		"broken":             "{{ .Labels.team",
+	}
+	r := newTestReconciler(t, canaryGate)
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}})
+	require.NoError(t, err)
+
+	var canary flaggerv1beta1.Canary
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "gate-ns"}, &canary))
+	require.NotEmpty(t, canary.Spec.Analysis.Webhooks)
+	for _, webhook := range canary.Spec.Analysis.Webhooks {
+		// the reserved keys keep the gate metadata, and a missing annotation is empty
+		require.Equal(t, map[string]string{
+			service.MetaGateName:      "demo",
+			service.MetaGateNamespace: "gate-ns",
+			service.MetaCluster:       "prod",
+			"team":                    "payments",
+			"owner":                   "",
+			"gate":                    "gate-ns/demo",
+		}, *webhook.Metadata, webhook.Name)
+	}
+	events := r.Recorder.(*record.FakeRecorder).Events
+	var warnings []string
+	for len(events) > 0 {
+		warnings = append(warnings, <-events)
+	}
+	require.Contains(t, warnings, "Warning ReservedMetadata Reserved key [gate_name] in webhookMetadata is ignored")
+	require.Contains(t, warnings, "Warning ReservedMetadata Reserved key [name] in webhookMetadata is ignored")
+	require.True(t, slices.ContainsFunc(warnings, func(w string) bool {
+		return strings.HasPrefix(w, "Warning InvalidMetadata Invalid template of [broken]")
+	}))
+}
+
+// testGateLister answers the gates of the gate store, or the error
+type testGateLister struct {
+	gates map[service.HookType]bool
+	err   error
+}
+
+func (l *testGateLister) List(ctx context.Context, namespace string, name string) (map[service.HookType]bool, error) {
+	return l.gates, l.err
+}
+
+func TestReconcileGateStatus(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.ConfirmPromotion = gateClosed
+	r := newTestReconciler(t, canaryGate)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	get := func() piggysecvalpha1.CanaryGate {
+		var cg piggysecvalpha1.CanaryGate
+		require.NoError(t, r.Get(ctx, req.NamespacedName, &cg))
+		return cg
+	}
+
+	// without a gate store, the gates are read from the spec
+	result, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Zero(t, result.RequeueAfter)
+	cg := get()
+	require.Equal(t, gateClosed, cg.Status.Status)
+	require.Equal(t, map[string]string{
+		"confirm-rollout":          gateOpened,
+		"pre-rollout":              gateOpened,
+		"rollout":                  gateOpened,
+		"confirm-traffic-increase": gateOpened,
+		"confirm-promotion":        gateClosed,
+		"confirm-finalize":         gateOpened,
+		"post-rollout":             gateOpened,
+		"rollback":                 gateClosed,
+	}, cg.Status.Gates)
+
+	// the gates of the store override the spec, and are read again periodically
+	lister := &testGateLister{gates: map[service.HookType]bool{service.HookConfirmPromotion: true, service.HookRollback: false}}
+	r.Gates = lister
+	result, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, gateStatusInterval, result.RequeueAfter)
+	cg = get()
+	require.Equal(t, gateOpened, cg.Status.Status)
+	require.Equal(t, gateOpened, cg.Status.Gates["confirm-promotion"])
+
+	// the CanaryGate is not updated when no state changes
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, cg.ResourceVersion, get().ResourceVersion)
+
+	// an opened rollback gate holds the canary
+	lister.gates[service.HookRollback] = true
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	cg = get()
+	require.Equal(t, gateClosed, cg.Status.Status)
+	require.Equal(t, gateOpened, cg.Status.Gates["rollback"])
+
+	// the spec is read when the store fails
+	lister.err = apierrors.NewServiceUnavailable("store is down")
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, gateClosed, get().Status.Gates["confirm-promotion"])
+}
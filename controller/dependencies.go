@@ -0,0 +1,93 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
+)
+
+// isGate checks whether the name is a gate which can be opened or closed
+func isGate(name string) bool {
+	return name != string(service.HookEvent) && isInjectedHook(name)
+}
+
+// isGateOpened returns the state of a gate in the spec. A gate which is not set has its default state.
+func (r *CanaryGateReconciler) isGateOpened(canaryGate *piggysecvalpha1.CanaryGate, gate string) bool {
+	switch canaryGate.Spec.GetGate(gate) {
+	case gateOpened:
+		return true
+	case gateClosed:
+		return false
+	}
+	return gate != string(service.HookRollback) && !slices.Contains(r.DefaultClosed, gate) && canaryGate.Spec.Approvals[gate] <= 1 &&
+		!canaryGate.Spec.RequiresApproval(gate)
+}
+
+// validateDependencies checks that spec.dependencies only names known gates and has no cycle
+func validateDependencies(canaryGate *piggysecvalpha1.CanaryGate) error {
+	for _, gate := range slices.Sorted(maps.Keys(canaryGate.Spec.Dependencies)) {
+		if !isGate(gate) {
+			return fmt.Errorf("unknown gate [%s] in spec.dependencies", gate)
+		}
+		for _, dep := range canaryGate.Spec.Dependencies[gate] {
+			if !isGate(dep) {
+				return fmt.Errorf("unknown gate [%s] in spec.dependencies of [%s]", dep, gate)
+			}
+		}
+		if slices.Contains(canaryGate.Spec.GetDependencies(gate), gate) {
+			return fmt.Errorf("gate [%s] depends on itself in spec.dependencies", gate)
+		}
+	}
+	return nil
+}
+
+// checkDependencies records in the DependenciesSatisfied condition whether every gate which is explicitly opened has
+// its dependencies opened. The gate API refuses to open a gate before its dependencies, so a violation means a gate was
+// closed after the gates which depend on it were opened, or the spec was edited directly.
+func (r *CanaryGateReconciler) checkDependencies(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate) error {
+	if err := validateDependencies(canaryGate); err != nil {
+		return r.setCondition(ctx, canaryGate, piggysecvalpha1.ConditionDependencies, metav1.ConditionFalse, "InvalidDependencies", err.Error())
+	}
+	var violations []string
+	for _, h := range injectedHooks {
+		gate := string(h.hook)
+		if !isGate(gate) || canaryGate.Spec.GetGate(gate) != gateOpened {
+			continue
+		}
+		var closed []string
+		for _, dep := range canaryGate.Spec.GetDependencies(gate) {
+			if !r.isGateOpened(canaryGate, dep) {
+				closed = append(closed, dep)
+			}
+		}
+		if len(closed) > 0 {
+			violations = append(violations, fmt.Sprintf("[%s] is opened before [%s]", gate, strings.Join(closed, ", ")))
+		}
+	}
+	if len(violations) > 0 {
+		return r.setCondition(ctx, canaryGate, piggysecvalpha1.ConditionDependencies, metav1.ConditionFalse, "DependenciesClosed", strings.Join(violations, "; "))
+	}
+	return r.setCondition(ctx, canaryGate, piggysecvalpha1.ConditionDependencies, metav1.ConditionTrue, "DependenciesOpened", "Every opened gate has its dependencies opened")
+}
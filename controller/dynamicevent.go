@@ -23,6 +23,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
 )
 
@@ -35,9 +36,18 @@ type DynamicEventSink struct {
 	Client dynamic.Interface
 }
 
-// Update implements record.EventSink.
+// Update sends an updated event to the API server using the dynamic client.
+// The event broadcaster calls it when a repeated event is aggregated into an existing one.
 func (s *DynamicEventSink) Update(event *corev1.Event) (*corev1.Event, error) {
-	panic("unimplemented")
+	unstructuredEvent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert event to unstructured: %w", err)
+	}
+	updatedUnstructured, err := s.Client.Resource(eventGvr).Namespace(event.Namespace).Update(context.Background(), toUnstructured(unstructuredEvent), metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update event with dynamic client: %w", err)
+	}
+	return toEvent(updatedUnstructured)
 }
 
 // Create sends an event to the API server using the dynamic client.
@@ -49,22 +59,35 @@ func (s *DynamicEventSink) Create(event *corev1.Event) (*corev1.Event, error) {
 	}
 
 	// Use the dynamic client to create the resource.
-	createdUnstructured, err := s.Client.Resource(eventGvr).Namespace(event.Namespace).Create(context.Background(), &unstructured.Unstructured{Object: unstructuredEvent}, metav1.CreateOptions{})
+	createdUnstructured, err := s.Client.Resource(eventGvr).Namespace(event.Namespace).Create(context.Background(), toUnstructured(unstructuredEvent), metav1.CreateOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create event with dynamic client: %w", err)
 	}
+	return toEvent(createdUnstructured)
+}
 
-	// Convert the unstructured result back into a typed Event.
-	var createdEvent corev1.Event
-	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(createdUnstructured.Object, &createdEvent); err != nil {
-		return nil, fmt.Errorf("failed to convert created unstructured object to event: %w", err)
+// Patch applies the patch of a repeated event, e.g. the increased count and the last timestamp, as a JSON merge patch.
+func (s *DynamicEventSink) Patch(event *corev1.Event, patch []byte) (*corev1.Event, error) {
+	patchedUnstructured, err := s.Client.Resource(eventGvr).Namespace(event.Namespace).Patch(context.Background(), event.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch event with dynamic client: %w", err)
 	}
+	return toEvent(patchedUnstructured)
+}
 
-	return &createdEvent, nil
+// toUnstructured wraps the converted event with its kind, which the events recorded by the broadcaster do not set
+// and the API server requires.
+func toUnstructured(obj map[string]any) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: obj}
+	u.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Event"))
+	return u
 }
 
-// Patch is required by the EventSink interface. For this example, we won't implement it.
-func (s *DynamicEventSink) Patch(event *corev1.Event, patch []byte) (*corev1.Event, error) {
-	// A real implementation would use the dynamic client's Patch method.
-	return event, nil
+// toEvent converts the unstructured result back into a typed Event.
+func toEvent(obj *unstructured.Unstructured) (*corev1.Event, error) {
+	var event corev1.Event
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &event); err != nil {
+		return nil, fmt.Errorf("failed to convert unstructured object to event: %w", err)
+	}
+	return &event, nil
 }
@@ -0,0 +1,85 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func newTestEventSink(t *testing.T) *DynamicEventSink {
+	// an empty scheme keeps the events unstructured like the API server returns them
+	client := dfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		eventGvr: "EventList",
+	})
+	return &DynamicEventSink{Client: client}
+}
+
+func TestDynamicEventSink(t *testing.T) {
+	sink := newTestEventSink(t)
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo.1", Namespace: "gate-ns"},
+		Reason:     "Updated",
+		Message:    "Gate is opened",
+		Count:      1,
+	}
+	created, err := sink.Create(event)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), created.Count)
+
+	created.Count = 2
+	updated, err := sink.Update(created)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), updated.Count)
+
+	patched, err := sink.Patch(updated, []byte(`{"count":3,"message":"Gate is closed"}`))
+	require.NoError(t, err)
+	require.Equal(t, int32(3), patched.Count)
+	require.Equal(t, "Gate is closed", patched.Message)
+	require.Equal(t, "Updated", patched.Reason)
+}
+
+func TestDynamicEventSinkRepeatedEvents(t *testing.T) {
+	sink := newTestEventSink(t)
+	broadcaster := record.NewBroadcaster()
+	defer broadcaster.Shutdown()
+	broadcaster.StartRecordingToSink(sink)
+	recorder := broadcaster.NewRecorder(runtime.NewScheme(), corev1.EventSource{Component: "canarygate"})
+	ref := &corev1.ObjectReference{Kind: "CanaryGate", Name: "demo", Namespace: "gate-ns"}
+
+	// repeated events are aggregated into one event with an increased count
+	for range 3 {
+		recorder.Event(ref, corev1.EventTypeNormal, "Updated", "Gate is opened")
+	}
+	require.Eventually(t, func() bool {
+		list, err := sink.Client.Resource(eventGvr).Namespace("gate-ns").List(context.Background(), metav1.ListOptions{})
+		if err != nil || len(list.Items) != 1 {
+			return false
+		}
+		count, _, _ := unstructured.NestedInt64(list.Items[0].Object, "count")
+		return count == 3
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// serviceLabel selects the Service of canary-gate which receives the webhooks
+	serviceLabel = "app"
+	serviceName  = "canary-gate"
+	// servicePortName is the port of the Service which serves the gates
+	servicePortName = "http"
+)
+
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list
+
+// webhookEndpoint returns the base URL of the gate endpoints with the base path. CANARY_GATE_ENDPOINT is used when
+// it is set, otherwise the URL is built from the canary-gate Service in ServiceNamespace, so it follows a renamed Service.
+func (r *CanaryGateReconciler) webhookEndpoint(ctx context.Context) (string, error) {
+	endpoint, err := r.serviceEndpoint(ctx)
+	if err != nil || endpoint == "" {
+		return endpoint, err
+	}
+	return strings.TrimSuffix(endpoint, "/") + r.BasePath, nil
+}
+
+// serviceEndpoint returns CANARY_GATE_ENDPOINT, or the URL of the canary-gate Service
+func (r *CanaryGateReconciler) serviceEndpoint(ctx context.Context) (string, error) {
+	if endpoint := os.Getenv("CANARY_GATE_ENDPOINT"); endpoint != "" || r.ServiceNamespace == "" {
+		return endpoint, nil
+	}
+	reader := r.Reader
+	if reader == nil {
+		reader = r.Client
+	}
+	var services corev1.ServiceList
+	if err := reader.List(ctx, &services, client.InNamespace(r.ServiceNamespace), client.MatchingLabels{serviceLabel: serviceName}); err != nil {
+		return "", fmt.Errorf("unable to list services in namespace [%s]: %w", r.ServiceNamespace, err)
+	}
+	if len(services.Items) == 0 {
+		return "", fmt.Errorf("no service with label [%s=%s] in namespace [%s]", serviceLabel, serviceName, r.ServiceNamespace)
+	}
+	svc := services.Items[0]
+	if len(svc.Spec.Ports) == 0 {
+		return "", fmt.Errorf("service [%s/%s] has no ports", svc.Namespace, svc.Name)
+	}
+	// the http port, or the first port when none is named http
+	port := svc.Spec.Ports[0].Port
+	for _, p := range svc.Spec.Ports {
+		if p.Name == servicePortName {
+			port = p.Port
+			break
+		}
+	}
+	return fmt.Sprintf("http://%s.%s.svc:%d", svc.Name, svc.Namespace, port), nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flaggerv1beta1 "github.com/fluxcd/flagger/pkg/apis/flagger/v1beta1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestWebhookEndpoint(t *testing.T) {
+	ctx := context.TODO()
+	t.Setenv("CANARY_GATE_ENDPOINT", "")
+	r := newTestReconciler(t, newTestCanaryGate("gate-ns"))
+	r.ServiceNamespace = "canary-gate"
+
+	// the Service is required when CANARY_GATE_ENDPOINT is not set
+	_, err := r.webhookEndpoint(ctx)
+	require.Error(t, err)
+
+	require.NoError(t, r.Create(ctx, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "gate", Namespace: "canary-gate", Labels: map[string]string{"app": "canary-gate"}},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+			{Name: "metrics", Port: 9090},
+			{Name: "http", Port: 8080},
+		}},
+	}))
+	endpoint, err := r.webhookEndpoint(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "http://gate.canary-gate.svc:8080", endpoint)
+
+	// the webhooks of the Canary call the Service
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	var canary flaggerv1beta1.Canary
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "gate-ns"}, &canary))
+	require.Equal(t, "http://gate.canary-gate.svc:8080/confirm-rollout", canary.Spec.Analysis.Webhooks[0].URL)
+
+	// CANARY_GATE_ENDPOINT overrides the Service
+	t.Setenv("CANARY_GATE_ENDPOINT", "http://canary-gate.example.com")
+	endpoint, err = r.webhookEndpoint(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "http://canary-gate.example.com", endpoint)
+
+	// the base path is appended to the endpoint
+	r.BasePath = "/canary-gate"
+	t.Setenv("CANARY_GATE_ENDPOINT", "http://example.com/")
+	endpoint, err = r.webhookEndpoint(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "http://example.com/canary-gate", endpoint)
+}
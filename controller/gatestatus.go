@@ -0,0 +1,87 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
+)
+
+// GateLister reads the live states of the gates of a CanaryGate, keyed by gate type. The gate store implements it.
+type GateLister interface {
+	List(ctx context.Context, namespace string, name string) (map[service.HookType]bool, error)
+}
+
+// GateWriter changes the gates in a gate store other than the CanaryGate, which Flagger reads instead of the spec.
+type GateWriter interface {
+	SetGate(ctx context.Context, namespace string, name string, gate service.HookType, open bool, user string)
+}
+
+// GateNotifier sends a message when a gate is changed automatically by its TTL or its schedule. The reason tells what
+// changed the gate.
+type GateNotifier interface {
+	NotifyAutoChange(namespace string, name string, gate service.HookType, open bool, reason string)
+}
+
+// gateStatusInterval is the interval of the reconciles which refresh the gate states in the status, since the changes
+// of a gate store other than the CanaryGate do not trigger a reconcile
+const gateStatusInterval = time.Minute
+
+// reconcileGateStatus records the live state of each gate in status.gates, and in status.status whether every gate
+// lets the canary progress. The gates are read from the gate store, or from the spec when no store is set or the
+// store cannot be read. The CanaryGate is updated only when a state changes.
+func (r *CanaryGateReconciler) reconcileGateStatus(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate) error {
+	var live map[service.HookType]bool
+	if r.Gates != nil {
+		var err error
+		if live, err = r.Gates.List(ctx, canaryGate.Namespace, canaryGate.Name); err != nil {
+			log.Error().Err(err).Msgf("Unable to read the gates of %s/%s from the store", canaryGate.Namespace, canaryGate.Name)
+			live = nil
+		}
+	}
+	gates := map[string]string{}
+	status := gateOpened
+	for _, h := range injectedHooks {
+		gate := string(h.hook)
+		if !isGate(gate) {
+			continue
+		}
+		opened, ok := live[h.hook]
+		if !ok {
+			opened = r.isGateOpened(canaryGate, gate)
+		}
+		gates[gate] = gateClosed
+		if opened {
+			gates[gate] = gateOpened
+		}
+		// an opened rollback gate holds the canary like a closed gate
+		if opened == (h.hook == service.HookRollback) {
+			status = gateClosed
+		}
+	}
+	if maps.Equal(gates, canaryGate.Status.Gates) && canaryGate.Status.Status == status {
+		return nil
+	}
+	canaryGate.Status.Gates = gates
+	canaryGate.Status.Status = status
+	return r.Update(ctx, canaryGate)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
+)
+
+// reservedMetadata are the keys of the metadata which are set by the controller, Flagger or the handler, and cannot be
+// set by the webhookMetadata of a CanaryGate
+var reservedMetadata = []string{
+	service.MetaName,
+	service.MetaNamespace,
+	service.MetaPhase,
+	service.MetaUser,
+	service.MetaReason,
+	service.MetaGateName,
+	service.MetaGateNamespace,
+	service.MetaGateSecret,
+	service.MetaGateState,
+	service.MetaAuto,
+	// the message of the event which Flagger adds to the event webhook
+	"eventMessage",
+}
+
+// metadataData is the data of the templates of the webhookMetadata
+type metadataData struct {
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// addWebhookMetadata adds the webhookMetadata of the CanaryGate to the metadata of the injected webhooks. The values are
+// executed as templates of the CanaryGate. The reserved keys and the invalid templates are ignored with a warning.
+func addWebhookMetadata(metadata map[string]string, canaryGate *piggysecvalpha1.CanaryGate) []gateWarning {
+	var warnings []gateWarning
+	data := metadataData{
+		Name:        canaryGate.Name,
+		Namespace:   canaryGate.Namespace,
+		Labels:      canaryGate.Labels,
+		Annotations: canaryGate.Annotations,
+	}
+	for _, key := range slices.Sorted(maps.Keys(canaryGate.Spec.WebhookMetadata)) {
+		if slices.Contains(reservedMetadata, key) {
+			warnings = append(warnings, gateWarning{"ReservedMetadata", fmt.Sprintf("Reserved key [%s] in webhookMetadata is ignored", key)})
+			continue
+		}
+		value, err := executeMetadata(key, canaryGate.Spec.WebhookMetadata[key], data)
+		if err != nil {
+			warnings = append(warnings, gateWarning{"InvalidMetadata", fmt.Sprintf("Invalid template of [%s] in webhookMetadata is ignored: %v", key, err)})
+			continue
+		}
+		metadata[key] = value
+	}
+	return warnings
+}
+
+// executeMetadata executes the template of a value of the webhookMetadata. A missing label or annotation is empty.
+func executeMetadata(key string, text string, data metadataData) (string, error) {
+	tmpl, err := template.New(key).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var value strings.Builder
+	if err := tmpl.Execute(&value, data); err != nil {
+		return "", err
+	}
+	return value.String(), nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"fmt"
+
+	flaggerv1beta1 "github.com/fluxcd/flagger/pkg/apis/flagger/v1beta1"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+)
+
+// RenderCanaries returns the Flagger Canaries which the reconciler creates for the targets of the CanaryGate, with the
+// gates calling the endpoint, and the warnings of the settings which are ignored. It runs without a cluster, so the
+// CanaryGates which select their targets by labels and the other backends are rejected.
+func RenderCanaries(canaryGate *piggysecvalpha1.CanaryGate, endpoint string, secret string) ([]*flaggerv1beta1.Canary, []string, error) {
+	if backend := canaryGate.Spec.Backend; backend != "" && backend != piggysecvalpha1.BackendFlagger {
+		return nil, nil, fmt.Errorf("only the %s backend can be rendered, the CanaryGate uses %s", piggysecvalpha1.BackendFlagger, backend)
+	}
+	if canaryGate.Spec.TargetSelector != nil {
+		return nil, nil, fmt.Errorf("spec.targetSelector requires a cluster to select the targets")
+	}
+	targets := canaryGate.Spec.GetTargets()
+	for _, target := range targets {
+		if target.Name == "" || target.Namespace == "" {
+			return nil, nil, fmt.Errorf("spec.target or spec.targets requires name and namespace")
+		}
+	}
+	gates, gateWarnings := newGateConfig(canaryGate, endpoint, secret)
+	warnings := make([]string, len(gateWarnings))
+	for i, warning := range gateWarnings {
+		warnings[i] = warning.message
+	}
+	canaries := make([]*flaggerv1beta1.Canary, 0, len(targets))
+	for _, target := range targets {
+		canary, err := flaggerCanary(canaryGate, target, gates)
+		if err != nil {
+			return nil, nil, err
+		}
+		canary.TypeMeta.APIVersion = flaggerv1beta1.SchemeGroupVersion.String()
+		canary.TypeMeta.Kind = "Canary"
+		canaries = append(canaries, canary)
+	}
+	return canaries, warnings, nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flaggerv1beta1 "github.com/fluxcd/flagger/pkg/apis/flagger/v1beta1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
+)
+
+func TestRenderCanaries(t *testing.T) {
+	ctx := context.TODO()
+	t.Setenv("CANARY_GATE_ENDPOINT", "http://canary-gate.canary-gate.svc:8080")
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.DisabledGates = []string{"pre-rollout", "promote"}
+	canaryGate.Spec.WebhookTimeout = "forever"
+	canaryGate.Spec.RequireApproval = []string{"confirm-promotion", "event"}
+	canaryGate.Spec.Flagger = runtime.RawExtension{Raw: []byte(`{
+		"targetRef":{"apiVersion":"apps/v1","kind":"Deployment","name":"demo"},
+		"analysis":{"interval":"1m","webhooks":[{"name":"load-test","type":"rollout","url":"http://flagger-loadtester.test/"}]}
+	}`)}
+
+	// the rendered Canary is the Canary of the reconciler
+	r := newTestReconciler(t, canaryGate.DeepCopy())
+	r.WebhookSecret = "secret"
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}})
+	require.NoError(t, err)
+	var reconciled flaggerv1beta1.Canary
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Name: "demo", Namespace: "gate-ns"}, &reconciled))
+
+	canaries, warnings, err := RenderCanaries(canaryGate, "http://canary-gate.canary-gate.svc:8080", "secret")
+	require.NoError(t, err)
+	require.Len(t, canaries, 1)
+	require.Equal(t, reconciled.Spec, canaries[0].Spec)
+	require.Equal(t, metav1.TypeMeta{APIVersion: "flagger.app/v1beta1", Kind: "Canary"}, canaries[0].TypeMeta)
+	require.Equal(t, "demo", canaries[0].Name)
+	require.Equal(t, "gate-ns", canaries[0].Namespace)
+	require.Equal(t, []string{
+		"Invalid webhookTimeout [forever] is ignored, 5s is used",
+		"Unknown gate [promote] in disabledGates is ignored",
+		"Unknown gate [event] in requireApproval is ignored",
+	}, warnings)
+
+	// a Canary for each target
+	canaryGate.Spec.Targets = []piggysecvalpha1.Target{{Name: "demo", Namespace: "team-a"}, {Name: "demo", Namespace: "team-b"}}
+	canaries, _, err = RenderCanaries(canaryGate, "http://example.com", "")
+	require.NoError(t, err)
+	require.Len(t, canaries, 2)
+	require.Equal(t, "team-b", canaries[1].Namespace)
+	require.Equal(t, "http://example.com/confirm-rollout", canaries[1].Spec.Analysis.Webhooks[1].URL)
+	require.NotContains(t, *canaries[1].Spec.Analysis.Webhooks[1].Metadata, service.MetaGateSecret)
+}
+
+func TestRenderCanariesInvalid(t *testing.T) {
+	cases := map[string]func(canaryGate *piggysecvalpha1.CanaryGate){
+		"argo backend": func(canaryGate *piggysecvalpha1.CanaryGate) {
+			canaryGate.Spec.Backend = piggysecvalpha1.BackendArgo
+		},
+		"target selector": func(canaryGate *piggysecvalpha1.CanaryGate) {
+			canaryGate.Spec.TargetSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}
+		},
+		"target without namespace": func(canaryGate *piggysecvalpha1.CanaryGate) {
+			canaryGate.Spec.Target.Namespace = ""
+		},
+		"flagger without target": func(canaryGate *piggysecvalpha1.CanaryGate) {
+			canaryGate.Spec.Flagger = runtime.RawExtension{Raw: []byte(`{"service":{"port":80}}`)}
+		},
+	}
+	for name, invalidate := range cases {
+		canaryGate := newTestCanaryGate("gate-ns")
+		invalidate(canaryGate)
+		_, _, err := RenderCanaries(canaryGate, "http://example.com", "")
+		require.Errorf(t, err, "[%s]", name)
+	}
+}
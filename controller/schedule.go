@@ -0,0 +1,251 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
+)
+
+// gate values of the CanaryGate spec
+const (
+	gateOpened = "opened"
+	gateClosed = "closed"
+)
+
+// scheduleUser is recorded as the user who changed a gate of the gate store by schedule
+const scheduleUser = "schedule"
+
+// weekdays maps the day names of a schedule window
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// window is a parsed schedule window
+type window struct {
+	days  [7]bool
+	start time.Duration
+	end   time.Duration
+}
+
+// scheduleState is the state of a gate at a point in time
+type scheduleState struct {
+	// open reports whether the time is within a window of the gate
+	open bool
+	// last is the latest window boundary before or at the time
+	last time.Time
+	// next is the first window boundary after the time
+	next time.Time
+}
+
+// parseDays parses "Mon-Fri" or "Mon,Wed,Fri". An empty string means every day.
+func parseDays(days string) ([7]bool, error) {
+	var result [7]bool
+	if strings.TrimSpace(days) == "" {
+		for i := range result {
+			result[i] = true
+		}
+		return result, nil
+	}
+	for _, part := range strings.Split(days, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		first, ok := weekdays[strings.ToLower(strings.TrimSpace(from))]
+		if !ok {
+			return result, fmt.Errorf("invalid day [%s]", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[strings.ToLower(strings.TrimSpace(to))]; !ok {
+				return result, fmt.Errorf("invalid day [%s]", to)
+			}
+		}
+		// a range may wrap around the week, e.g. Fri-Mon
+		for d := first; ; d = (d + 1) % 7 {
+			result[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// parseClock parses the time of a day in HH:MM
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time [%s], expected HH:MM", clock)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseWindow validates and parses a schedule window
+func parseWindow(w piggysecvalpha1.ScheduleWindow) (window, error) {
+	var result window
+	var err error
+	if !isInjectedHook(w.Gate) || w.Gate == string(service.HookEvent) {
+		return result, fmt.Errorf("unknown gate [%s]", w.Gate)
+	}
+	if result.days, err = parseDays(w.Days); err != nil {
+		return result, err
+	}
+	if result.start, err = parseClock(w.Start); err != nil {
+		return result, err
+	}
+	if result.end, err = parseClock(w.End); err != nil {
+		return result, err
+	}
+	if result.start == result.end {
+		return result, fmt.Errorf("window of gate [%s] starts and ends at the same time", w.Gate)
+	}
+	return result, nil
+}
+
+// evaluateSchedule returns the state of each scheduled gate at the given time
+func evaluateSchedule(schedule *piggysecvalpha1.Schedule, now time.Time) (map[string]scheduleState, error) {
+	loc := time.UTC
+	if schedule.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(schedule.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone [%s]: %w", schedule.Timezone, err)
+		}
+	}
+	now = now.In(loc)
+	states := map[string]scheduleState{}
+	for _, w := range schedule.Windows {
+		parsed, err := parseWindow(w)
+		if err != nil {
+			return nil, err
+		}
+		state := states[w.Gate]
+		// a week and a day back covers the latest boundary of a window which occurs once a week
+		for d := -8; d <= 7; d++ {
+			day := time.Date(now.Year(), now.Month(), now.Day()+d, 0, 0, 0, 0, loc)
+			if !parsed.days[day.Weekday()] {
+				continue
+			}
+			start := day.Add(parsed.start)
+			end := day.Add(parsed.end)
+			if parsed.end < parsed.start {
+				end = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc).Add(parsed.end)
+			}
+			if !now.Before(start) && now.Before(end) {
+				state.open = true
+			}
+			for _, boundary := range []time.Time{start, end} {
+				if !boundary.After(now) && boundary.After(state.last) {
+					state.last = boundary
+				}
+				if boundary.After(now) && (state.next.IsZero() || boundary.Before(state.next)) {
+					state.next = boundary
+				}
+			}
+		}
+		states[w.Gate] = state
+	}
+	return states, nil
+}
+
+// applySchedule opens or closes the scheduled gates once per window boundary.
+// Manual changes between two boundaries are kept until the next boundary.
+// The gates are changed in the gate store when it is not the CanaryGate, since Flagger reads the store.
+// It returns the duration until the next boundary.
+func (r *CanaryGateReconciler) applySchedule(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate) (time.Duration, error) {
+	if canaryGate.Spec.Schedule == nil || len(canaryGate.Spec.Schedule.Windows) == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	states, err := evaluateSchedule(canaryGate.Spec.Schedule, now)
+	if err != nil {
+		// The schedule must be fixed by the user, which triggers another reconcile
+		log.Error().Err(err).Msg("Invalid schedule in CanaryGate")
+		r.Recorder.Event(canaryGate, corev1.EventTypeWarning, "InvalidSchedule", err.Error())
+		return 0, nil
+	}
+	var next time.Duration
+	var applied []string
+	for gate, state := range states {
+		if d := state.next.Sub(now); !state.next.IsZero() && (next == 0 || d < next) {
+			next = d
+		}
+		boundary := state.last.UTC().Format(time.RFC3339)
+		if canaryGate.Status.ScheduledAt[gate] == boundary {
+			continue
+		}
+		status := gateClosed
+		if state.open {
+			status = gateOpened
+		}
+		if r.Writer != nil {
+			r.Writer.SetGate(ctx, canaryGate.Namespace, canaryGate.Name, service.HookType(gate), state.open, scheduleUser)
+		} else {
+			canaryGate.Spec.SetGate(gate, status)
+			// the schedule replaces a pending TTL of the gate
+			delete(canaryGate.Status.Expiry, gate)
+			r.setClosedAt(canaryGate, gate, now)
+		}
+		if canaryGate.Status.ScheduledAt == nil {
+			canaryGate.Status.ScheduledAt = map[string]string{}
+		}
+		canaryGate.Status.ScheduledAt[gate] = boundary
+		applied = append(applied, gate)
+	}
+	if len(applied) == 0 {
+		return next, nil
+	}
+	if err := r.Update(ctx, canaryGate); err != nil {
+		return 0, err
+	}
+	for _, gate := range applied {
+		status := gateClosed
+		if states[gate].open {
+			status = gateOpened
+		}
+		msg := fmt.Sprintf("Gate [%s/%s=%s] is set to [%s] by schedule. Manual changes are kept until the next window boundary at %s",
+			canaryGate.Namespace, canaryGate.Name, gate, status, states[gate].next.Format(time.RFC3339))
+		log.Info().Msg(msg)
+		r.Recorder.Event(canaryGate, corev1.EventTypeNormal, "GateScheduled", msg)
+		if r.Notifier != nil {
+			r.Notifier.NotifyAutoChange(canaryGate.Namespace, canaryGate.Name, service.HookType(gate), states[gate].open, "by the schedule")
+		}
+	}
+	return next, nil
+}
+
+// shortestRequeue returns the shortest positive duration, or zero when none is positive
+func shortestRequeue(durations ...time.Duration) time.Duration {
+	var result time.Duration
+	for _, d := range durations {
+		if d > 0 && (result == 0 || d < result) {
+			result = d
+		}
+	}
+	return result
+}
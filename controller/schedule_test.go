@@ -0,0 +1,194 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
+)
+
+func TestParseDays(t *testing.T) {
+	days, err := parseDays("Mon-Fri")
+	require.NoError(t, err)
+	require.Equal(t, [7]bool{false, true, true, true, true, true, false}, days)
+
+	days, err = parseDays("fri-mon, Wed")
+	require.NoError(t, err)
+	require.Equal(t, [7]bool{true, true, false, true, false, true, true}, days)
+
+	days, err = parseDays("")
+	require.NoError(t, err)
+	require.Equal(t, [7]bool{true, true, true, true, true, true, true}, days)
+
+	_, err = parseDays("Monday")
+	require.Error(t, err)
+}
+
+func TestEvaluateSchedule(t *testing.T) {
+	schedule := &piggysecvalpha1.Schedule{
+		Timezone: "Asia/Bangkok",
+		Windows: []piggysecvalpha1.ScheduleWindow{
+			{Gate: "confirm-promotion", Days: "Mon-Fri", Start: "09:00", End: "17:00"},
+			{Gate: "confirm-rollout", Days: "Sat", Start: "22:00", End: "02:00"},
+		},
+	}
+	loc, err := time.LoadLocation("Asia/Bangkok")
+	require.NoError(t, err)
+
+	// Wednesday within the window
+	now := time.Date(2025, time.July, 2, 10, 0, 0, 0, loc)
+	states, err := evaluateSchedule(schedule, now)
+	require.NoError(t, err)
+	require.True(t, states["confirm-promotion"].open)
+	require.Equal(t, time.Date(2025, time.July, 2, 9, 0, 0, 0, loc), states["confirm-promotion"].last)
+	require.Equal(t, time.Date(2025, time.July, 2, 17, 0, 0, 0, loc), states["confirm-promotion"].next)
+	require.False(t, states["confirm-rollout"].open)
+
+	// Friday after the window, the next window starts on Monday
+	now = time.Date(2025, time.July, 4, 18, 0, 0, 0, loc)
+	states, err = evaluateSchedule(schedule, now)
+	require.NoError(t, err)
+	require.False(t, states["confirm-promotion"].open)
+	require.Equal(t, time.Date(2025, time.July, 4, 17, 0, 0, 0, loc), states["confirm-promotion"].last)
+	require.Equal(t, time.Date(2025, time.July, 7, 9, 0, 0, 0, loc), states["confirm-promotion"].next)
+
+	// a window which ends on the next day
+	now = time.Date(2025, time.July, 6, 1, 0, 0, 0, loc)
+	states, err = evaluateSchedule(schedule, now)
+	require.NoError(t, err)
+	require.True(t, states["confirm-rollout"].open)
+	require.Equal(t, time.Date(2025, time.July, 6, 2, 0, 0, 0, loc), states["confirm-rollout"].next)
+
+	// the time is evaluated in the timezone of the schedule
+	states, err = evaluateSchedule(schedule, time.Date(2025, time.July, 2, 3, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.True(t, states["confirm-promotion"].open)
+
+	_, err = evaluateSchedule(&piggysecvalpha1.Schedule{Timezone: "Mars/Base"}, now)
+	require.Error(t, err)
+	_, err = evaluateSchedule(&piggysecvalpha1.Schedule{Windows: []piggysecvalpha1.ScheduleWindow{{Gate: "unknown", Start: "09:00", End: "17:00"}}}, now)
+	require.Error(t, err)
+}
+
+func TestReconcileSchedule(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	// a window which covers the whole day keeps the gate open now
+	canaryGate.Spec.Schedule = &piggysecvalpha1.Schedule{
+		Windows: []piggysecvalpha1.ScheduleWindow{{Gate: "confirm-promotion", Start: "00:00", End: "23:59"}},
+	}
+	now := time.Now().UTC()
+	if now.Hour() == 23 && now.Minute() == 59 {
+		canaryGate.Spec.Schedule.Windows[0].End = "23:58"
+	}
+	r := newTestReconciler(t, canaryGate)
+	notifier := &recordingNotifier{}
+	r.Notifier = notifier
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	result, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Greater(t, result.RequeueAfter, time.Duration(0))
+	require.Equal(t, []string{"gate-ns/demo=confirm-promotion opened by the schedule"}, notifier.changes)
+
+	var updated piggysecvalpha1.CanaryGate
+	require.NoError(t, r.Get(ctx, req.NamespacedName, &updated))
+	require.Equal(t, gateOpened, updated.Spec.ConfirmPromotion)
+	require.NotEmpty(t, updated.Status.ScheduledAt["confirm-promotion"])
+
+	// a manual change is kept until the next window boundary
+	updated.Spec.ConfirmPromotion = gateClosed
+	require.NoError(t, r.Update(ctx, &updated))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, r.Get(ctx, req.NamespacedName, &updated))
+	require.Equal(t, gateClosed, updated.Spec.ConfirmPromotion)
+	require.Len(t, notifier.changes, 1, "a manual change is not notified")
+}
+
+func TestReconcileExpiredGate(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.Rollback = gateOpened
+	canaryGate.Status.Expiry = map[string]string{"rollback": time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)}
+	r := newTestReconciler(t, canaryGate)
+	notifier := &recordingNotifier{}
+	r.Notifier = notifier
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	// the gate is reset to its default state and the reset is notified
+	var updated piggysecvalpha1.CanaryGate
+	require.NoError(t, r.Get(ctx, req.NamespacedName, &updated))
+	require.Empty(t, updated.Spec.Rollback)
+	require.Equal(t, []string{"gate-ns/demo=rollback closed after its TTL"}, notifier.changes)
+}
+
+// recordingWriter records the gates which are changed in the gate store
+type recordingWriter struct {
+	gates map[service.HookType]bool
+}
+
+func (w *recordingWriter) SetGate(ctx context.Context, namespace string, name string, gate service.HookType, open bool, user string) {
+	w.gates[gate] = open
+}
+
+// recordingNotifier records the gates which are changed automatically
+type recordingNotifier struct {
+	changes []string
+}
+
+func (n *recordingNotifier) NotifyAutoChange(namespace string, name string, gate service.HookType, open bool, reason string) {
+	status := gateClosed
+	if open {
+		status = gateOpened
+	}
+	n.changes = append(n.changes, fmt.Sprintf("%s/%s=%s %s %s", namespace, name, gate, status, reason))
+}
+
+func TestReconcileScheduleGateStore(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.Schedule = &piggysecvalpha1.Schedule{
+		Windows: []piggysecvalpha1.ScheduleWindow{{Gate: "confirm-promotion", Start: "00:00", End: "23:59"}},
+	}
+	now := time.Now().UTC()
+	if now.Hour() == 23 && now.Minute() == 59 {
+		canaryGate.Spec.Schedule.Windows[0].End = "23:58"
+	}
+	r := newTestReconciler(t, canaryGate)
+	writer := &recordingWriter{gates: map[service.HookType]bool{}}
+	r.Writer = writer
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	// the gate is changed in the gate store which Flagger reads, not in the spec
+	require.Equal(t, map[service.HookType]bool{service.HookConfirmPromotion: true}, writer.gates)
+	var updated piggysecvalpha1.CanaryGate
+	require.NoError(t, r.Get(ctx, req.NamespacedName, &updated))
+	require.Empty(t, updated.Spec.ConfirmPromotion)
+	require.NotEmpty(t, updated.Status.ScheduledAt["confirm-promotion"])
+}
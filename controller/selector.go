@@ -0,0 +1,117 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+)
+
+// selectTargets returns the Deployments of all namespaces which match the selector, sorted by namespace and name.
+// Only the metadata of the Deployments is read.
+func (r *CanaryGateReconciler) selectTargets(ctx context.Context, selector labels.Selector) ([]piggysecvalpha1.Target, error) {
+	var deployments metav1.PartialObjectMetadataList
+	deployments.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("DeploymentList"))
+	if err := r.List(ctx, &deployments, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	targets := make([]piggysecvalpha1.Target, 0, len(deployments.Items))
+	for _, d := range deployments.Items {
+		targets = append(targets, piggysecvalpha1.Target{Name: d.Name, Namespace: d.Namespace})
+	}
+	slices.SortFunc(targets, func(a, b piggysecvalpha1.Target) int {
+		if c := strings.Compare(a.Namespace, b.Namespace); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return targets, nil
+}
+
+// reconcileSelectedTargets deletes the resources of the targets which no longer match the selector of the CanaryGate,
+// and records the matching targets in the status. It returns the matching targets.
+func (r *CanaryGateReconciler) reconcileSelectedTargets(ctx context.Context, canaryGate *piggysecvalpha1.CanaryGate, backend CanaryBackend, selector labels.Selector) ([]piggysecvalpha1.Target, error) {
+	targets, err := r.selectTargets(ctx, selector)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list the Deployments of the target selector")
+		return nil, err
+	}
+	for _, target := range canaryGate.Status.SelectedTargets {
+		if slices.Contains(targets, target) {
+			continue
+		}
+		if err := backend.Delete(ctx, target); err != nil && !apierrors.IsNotFound(err) {
+			log.Error().Err(err).Msgf("Failed to delete %s resource", backend.Kind())
+			r.Recorder.Event(canaryGate, corev1.EventTypeWarning, "CleanupFailed", err.Error())
+			return nil, err
+		}
+		msg := fmt.Sprintf("%s resource %s/%s deleted since the target no longer matches the selector", backend.Kind(), target.Namespace, target.Name)
+		log.Info().Msg(msg)
+		r.Recorder.Event(canaryGate, corev1.EventTypeNormal, "CanaryDeleted", msg)
+	}
+	if slices.Equal(targets, canaryGate.Status.SelectedTargets) {
+		return targets, nil
+	}
+	canaryGate.Status.SelectedTargets = targets
+	return targets, r.Update(ctx, canaryGate)
+}
+
+// ownedTargets returns the targets whose resources are created by the CanaryGate
+func ownedTargets(canaryGate *piggysecvalpha1.CanaryGate) []piggysecvalpha1.Target {
+	if canaryGate.Spec.TargetSelector != nil {
+		return canaryGate.Status.SelectedTargets
+	}
+	return canaryGate.Spec.GetTargets()
+}
+
+// canaryGatesOfDeployment maps a Deployment to the CanaryGates whose selector matches it, or which selected it before
+// its labels changed
+func (r *CanaryGateReconciler) canaryGatesOfDeployment(ctx context.Context, obj client.Object) []reconcile.Request {
+	var canaryGates piggysecvalpha1.CanaryGateList
+	if err := r.List(ctx, &canaryGates); err != nil {
+		log.Error().Err(err).Msg("Failed to list CanaryGates")
+		return nil
+	}
+	target := piggysecvalpha1.Target{Name: obj.GetName(), Namespace: obj.GetNamespace()}
+	var requests []reconcile.Request
+	for _, canaryGate := range canaryGates.Items {
+		if canaryGate.Spec.TargetSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(canaryGate.Spec.TargetSelector)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(labels.Set(obj.GetLabels())) || slices.Contains(canaryGate.Status.SelectedTargets, target) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: canaryGate.Name, Namespace: canaryGate.Namespace}})
+		}
+	}
+	return requests
+}
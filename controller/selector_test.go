@@ -0,0 +1,100 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	flaggerv1beta1 "github.com/fluxcd/flagger/pkg/apis/flagger/v1beta1"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	piggysecvalpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+)
+
+func newTestDeployment(namespace, name string, labels map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+}
+
+func TestReconcileTargetSelector(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.TargetSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "web"}}
+	r := newTestReconciler(t, canaryGate)
+	web := map[string]string{"tier": "web"}
+	require.NoError(t, r.Create(ctx, newTestDeployment("ns-a", "web-1", web)))
+	require.NoError(t, r.Create(ctx, newTestDeployment("ns-b", "web-2", web)))
+	require.NoError(t, r.Create(ctx, newTestDeployment("ns-a", "worker", map[string]string{"tier": "worker"})))
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	// each matching Deployment gets a Canary which targets it
+	for _, target := range []types.NamespacedName{{Namespace: "ns-a", Name: "web-1"}, {Namespace: "ns-b", Name: "web-2"}} {
+		var canary flaggerv1beta1.Canary
+		require.NoError(t, r.Get(ctx, target, &canary))
+		require.Equal(t, target.Name, canary.Spec.TargetRef.Name)
+		require.NotEmpty(t, canary.Spec.Analysis.Webhooks)
+	}
+	var canary flaggerv1beta1.Canary
+	require.True(t, apierrors.IsNotFound(r.Get(ctx, types.NamespacedName{Namespace: "ns-a", Name: "worker"}, &canary)))
+
+	var updated piggysecvalpha1.CanaryGate
+	require.NoError(t, r.Get(ctx, req.NamespacedName, &updated))
+	require.Equal(t, []piggysecvalpha1.Target{{Name: "web-1", Namespace: "ns-a"}, {Name: "web-2", Namespace: "ns-b"}}, updated.Status.SelectedTargets)
+	require.True(t, controllerutil.ContainsFinalizer(&updated, canaryFinalizer), "selected targets may be in any namespace")
+
+	// a Deployment whose labels no longer match is still mapped to the CanaryGate, which deletes its Canary
+	var deployment appsv1.Deployment
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Namespace: "ns-b", Name: "web-2"}, &deployment))
+	deployment.Labels = map[string]string{"tier": "batch"}
+	require.NoError(t, r.Update(ctx, &deployment))
+	require.Equal(t, []ctrl.Request{req}, r.canaryGatesOfDeployment(ctx, &deployment))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.True(t, apierrors.IsNotFound(r.Get(ctx, types.NamespacedName{Namespace: "ns-b", Name: "web-2"}, &canary)))
+	require.NoError(t, r.Get(ctx, types.NamespacedName{Namespace: "ns-a", Name: "web-1"}, &canary))
+	require.NoError(t, r.Get(ctx, req.NamespacedName, &updated))
+	require.Equal(t, []piggysecvalpha1.Target{{Name: "web-1", Namespace: "ns-a"}}, updated.Status.SelectedTargets)
+	require.Empty(t, r.canaryGatesOfDeployment(ctx, &deployment))
+
+	// a new matching Deployment is mapped to the CanaryGate
+	require.Equal(t, []ctrl.Request{req}, r.canaryGatesOfDeployment(ctx, newTestDeployment("ns-c", "web-3", web)))
+}
+
+func TestReconcileInvalidTargetSelector(t *testing.T) {
+	ctx := context.TODO()
+	canaryGate := newTestCanaryGate("gate-ns")
+	canaryGate.Spec.TargetSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: "Near"}}}
+	r := newTestReconciler(t, canaryGate)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "gate-ns"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	var updated piggysecvalpha1.CanaryGate
+	require.NoError(t, r.Get(ctx, req.NamespacedName, &updated))
+	condition := meta.FindStatusCondition(updated.Status.Conditions, piggysecvalpha1.ConditionReady)
+	require.NotNil(t, condition)
+	require.Equal(t, metav1.ConditionFalse, condition.Status)
+	require.Equal(t, "InvalidTargetSelector", condition.Reason)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// maxLoggedBody is the number of bytes of a body which the access log prints at trace level
+const maxLoggedBody = 4096
+
+// AccessLog logs the method, path, status code and duration of each request at debug level, and the request and
+// response bodies at trace level. The requests to the excluded paths, e.g. /metrics, are not logged.
+func AccessLog(exclude []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !logEnabled(zerolog.DebugLevel) || slices.Contains(exclude, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		bodies := logEnabled(zerolog.TraceLevel)
+		var requestBody []byte
+		if bodies && r.Body != nil {
+			var err error
+			if requestBody, err = io.ReadAll(r.Body); err != nil {
+				log.Error().Msgf("Unable to read the request body %v", err)
+			}
+			r.Body = io.NopCloser(bytes.NewReader(requestBody))
+		}
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, body: bodies}
+		next.ServeHTTP(sw, r)
+		event := log.Debug()
+		if bodies {
+			event = log.Trace().
+				Str("request", truncateBody(requestBody)).
+				Str("response", truncateBody(sw.written.Bytes()))
+		}
+		event.Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("status", sw.statusCode()).
+			Dur("duration", time.Since(start)).
+			Msgf("%s %s %d", r.Method, r.URL.Path, sw.statusCode())
+	})
+}
+
+// statusWriter records the status code of the response, and its body when body is set
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	body    bool
+	written bytes.Buffer
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.body && w.written.Len() < maxLoggedBody {
+		w.written.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// statusCode returns the status code of the response, which is 200 when the handler did not write one
+func (w *statusWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// logEnabled reports whether the logs of the level are written
+func logEnabled(level zerolog.Level) bool {
+	return zerolog.GlobalLevel() <= level && log.Logger.GetLevel() <= level
+}
+
+// truncateBody returns the body for the log, cut at maxLoggedBody bytes
+func truncateBody(body []byte) string {
+	if len(body) > maxLoggedBody {
+		return string(body[:maxLoggedBody]) + "..."
+	}
+	return string(body)
+}
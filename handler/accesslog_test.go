@@ -0,0 +1,103 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func TestAccessLog(t *testing.T) {
+	var output bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&output).Level(zerolog.DebugLevel)
+	defer func() { log.Logger = logger }()
+
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	storage.GateClose(t.Context(), store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}, "")
+	mux := http.NewServeMux()
+	mux.Handle(confirmPromotionPath, handler.ConfirmPromotion())
+	mux.Handle("/healthz", (&ServerHandler{}).Healthz())
+	logged := AccessLog([]string{"/healthz"}, mux)
+
+	// the 403 of a closed gate is logged
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns"})
+	w := httptest.NewRecorder()
+	logged.ServeHTTP(w, httptest.NewRequest(http.MethodPost, confirmPromotionPath, bytes.NewBuffer(payload)))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// the excluded paths are not logged
+	w = httptest.NewRecorder()
+	logged.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var accessLogs []map[string]any
+	scanner := bufio.NewScanner(&output)
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		if line["method"] != nil {
+			accessLogs = append(accessLogs, line)
+		}
+	}
+	require.Len(t, accessLogs, 1)
+	require.Equal(t, "debug", accessLogs[0]["level"])
+	require.Equal(t, http.MethodPost, accessLogs[0]["method"])
+	require.Equal(t, confirmPromotionPath, accessLogs[0]["path"])
+	require.Equal(t, float64(http.StatusForbidden), accessLogs[0]["status"])
+	require.Contains(t, accessLogs[0], "duration")
+	require.NotContains(t, accessLogs[0], "request")
+}
+
+func TestAccessLogBodies(t *testing.T) {
+	var output bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&output).Level(zerolog.TraceLevel)
+	defer func() { log.Logger = logger }()
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	defer zerolog.SetGlobalLevel(level)
+
+	logged := AccessLog(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		writeBytes(w, []byte("Approved"), http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	logged.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/event", bytes.NewBufferString(`{"name":"test-canary"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// the bodies are logged at trace level, and the handler still reads the request body
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(output.Bytes()), &line))
+	require.Equal(t, "trace", line["level"])
+	require.Equal(t, `{"name":"test-canary"}`, line["request"])
+	require.Equal(t, "Approved", line["response"])
+}
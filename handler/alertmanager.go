@@ -0,0 +1,162 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog/log"
+)
+
+// AlertmanagerUser is the user recorded with the gate changes made by the Alertmanager receiver
+const AlertmanagerUser = "alertmanager"
+
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// AlertmanagerPayload holds the webhook notification sent by Alertmanager
+type AlertmanagerPayload struct {
+	// Status of the group, firing or resolved
+	Status string `json:"status"`
+	// Receiver which sent the notification
+	Receiver string `json:"receiver"`
+	// Alerts of the group
+	Alerts []Alert `json:"alerts"`
+}
+
+// Alert is an alert of the Alertmanager notification
+type Alert struct {
+	// Status of the alert, firing or resolved
+	Status string `json:"status"`
+	// Labels of the alert
+	Labels map[string]string `json:"labels"`
+	// Annotations of the alert
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Fingerprint identifies the alert
+	Fingerprint string `json:"fingerprint"`
+}
+
+// AlertMapping maps the labels of an alert to the gates it closes
+type AlertMapping struct {
+	// NamespaceLabel is the label which holds the namespace of the CanaryGate
+	NamespaceLabel string
+	// NameLabel is the label which holds the name of the CanaryGate
+	NameLabel string
+	// Gates are closed while the alert is firing
+	Gates []service.HookType
+}
+
+// DefaultAlertMapping closes the promotion and the traffic increase of the deployment in the labels of the alert
+var DefaultAlertMapping = AlertMapping{
+	NamespaceLabel: "namespace",
+	NameLabel:      "deployment",
+	Gates:          []service.HookType{service.HookConfirmPromotion, service.HookConfirmTrafficIncrease},
+}
+
+// alertTracker keeps the firing alerts of each gate, so a gate is reopened when the last of its alerts is resolved
+type alertTracker struct {
+	mu     sync.Mutex
+	firing map[store.StoreKey]map[string]bool
+}
+
+// fire records the alert and reports whether it was not firing yet
+func (t *alertTracker) fire(key store.StoreKey, fingerprint string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.firing[key] == nil {
+		t.firing[key] = map[string]bool{}
+	}
+	if t.firing[key][fingerprint] {
+		return false
+	}
+	t.firing[key][fingerprint] = true
+	return true
+}
+
+// resolve removes the alert and reports whether no alert of the gate is firing anymore
+func (t *alertTracker) resolve(key store.StoreKey, fingerprint string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.firing[key], fingerprint)
+	if len(t.firing[key]) > 0 {
+		return false
+	}
+	delete(t.firing, key)
+	return true
+}
+
+// AlertmanagerReceiver receives the webhook notifications of Alertmanager. The gates of the mapping are closed when an
+// alert starts firing and reopened when the last firing alert of the gate is resolved. A gate which is already closed
+// is left closed, and a gate which was changed by a user while the alert was firing is not changed again, so a manual
+// override wins over the alerts.
+func (h *FlaggerHandler) AlertmanagerReceiver(mapping AlertMapping) http.Handler {
+	tracker := &alertTracker{firing: map[store.StoreKey]map[string]bool{}}
+	return traced("/alerts", func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		if payload, err := readPayload(r, w, AlertmanagerPayload{}); err == nil {
+			for _, alert := range payload.Alerts {
+				deployment, err := store.NewStoreKey(alert.Labels[mapping.NamespaceLabel], alert.Labels[mapping.NameLabel], "")
+				if err != nil {
+					log.Debug().Msgf("Ignoring alert [%s] without valid [%s] and [%s] labels %v", alert.Labels["alertname"], mapping.NamespaceLabel, mapping.NameLabel, err)
+					continue
+				}
+				for _, gate := range mapping.Gates {
+					key := store.StoreKey{Namespace: deployment.Namespace, Name: deployment.Name, Type: gate}
+					switch alert.Status {
+					case alertFiring:
+						if tracker.fire(key, alert.Fingerprint) {
+							h.closeOnAlert(r.Context(), key, alert)
+						}
+					case alertResolved:
+						if tracker.resolve(key, alert.Fingerprint) {
+							h.reopenOnResolve(r.Context(), key, alert)
+						}
+					}
+				}
+			}
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+}
+
+// closeOnAlert closes the gate when it is opened
+func (h *FlaggerHandler) closeOnAlert(ctx context.Context, key store.StoreKey, alert Alert) {
+	if !h.store.IsGateOpen(ctx, key) {
+		log.Info().Msgf("Gate [%s] is already closed when alert [%s] fires", key.String(), alert.Labels["alertname"])
+		return
+	}
+	log.Info().Msgf("Closing gate [%s] since alert [%s] is firing", key.String(), alert.Labels["alertname"])
+	h.store.GateClose(ctx, key, AlertmanagerUser)
+	h.recordChange(ctx, key, false, AlertmanagerUser, fmt.Sprintf("alert %s is firing", alert.Labels["alertname"]))
+}
+
+// reopenOnResolve opens the gate when it was closed by an alert and nobody changed it since
+func (h *FlaggerHandler) reopenOnResolve(ctx context.Context, key store.StoreKey, alert Alert) {
+	if h.store.IsGateOpen(ctx, key) || h.store.GetChangedBy(ctx, key) != AlertmanagerUser {
+		log.Info().Msgf("Gate [%s] is not reopened when alert [%s] is resolved since it was not closed by an alert", key.String(), alert.Labels["alertname"])
+		return
+	}
+	log.Info().Msgf("Opening gate [%s] since alert [%s] is resolved", key.String(), alert.Labels["alertname"])
+	h.store.GateOpen(ctx, key, AlertmanagerUser)
+	h.recordChange(ctx, key, true, AlertmanagerUser, fmt.Sprintf("alert %s is resolved", alert.Labels["alertname"]))
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func TestAlertmanagerReceiver(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	receiver := handler.AlertmanagerReceiver(DefaultAlertMapping)
+	promotion := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	traffic := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmTrafficIncrease}
+	rollout := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmRollout}
+
+	send := func(status string, fingerprint string) {
+		payload := &AlertmanagerPayload{Status: status, Alerts: []Alert{{
+			Status:      status,
+			Fingerprint: fingerprint,
+			Labels:      map[string]string{"alertname": "HighErrorRate", "namespace": "canary-ns", "deployment": "test-canary"},
+		}}}
+		w := httptest.NewRecorder()
+		receiver.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/alerts", bytes.NewBuffer(buildPayload(payload))))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// a firing alert closes the mapped gates only
+	send(alertFiring, "a1")
+	require.False(t, storage.IsGateOpen(t.Context(), promotion))
+	require.False(t, storage.IsGateOpen(t.Context(), traffic))
+	require.True(t, storage.IsGateOpen(t.Context(), rollout))
+	require.Equal(t, AlertmanagerUser, storage.GetChangedBy(t.Context(), promotion))
+
+	// the gates are reopened when the last alert is resolved
+	send(alertFiring, "a2")
+	send(alertResolved, "a1")
+	require.False(t, storage.IsGateOpen(t.Context(), promotion))
+	send(alertResolved, "a2")
+	require.True(t, storage.IsGateOpen(t.Context(), promotion))
+	require.True(t, storage.IsGateOpen(t.Context(), traffic))
+
+	// a gate opened by a user while the alert fires is not closed by the repeated notification
+	send(alertFiring, "a3")
+	storage.GateOpen(t.Context(), promotion, "alice")
+	send(alertFiring, "a3")
+	require.True(t, storage.IsGateOpen(t.Context(), promotion))
+
+	// a gate closed by a user is not reopened when the alert is resolved
+	storage.GateClose(t.Context(), traffic, "bob")
+	send(alertResolved, "a3")
+	require.False(t, storage.IsGateOpen(t.Context(), traffic))
+	require.True(t, storage.IsGateOpen(t.Context(), promotion))
+
+	// alerts without the labels are ignored
+	w := httptest.NewRecorder()
+	payload := &AlertmanagerPayload{Status: alertFiring, Alerts: []Alert{{Status: alertFiring, Labels: map[string]string{"alertname": "NodeDown"}}}}
+	receiver.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/alerts", bytes.NewBuffer(buildPayload(payload))))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// a custom mapping reads other labels and closes other gates
+	custom := handler.AlertmanagerReceiver(AlertMapping{NamespaceLabel: "ns", NameLabel: "app", Gates: []service.HookType{service.HookConfirmRollout}})
+	payload = &AlertmanagerPayload{Status: alertFiring, Alerts: []Alert{{Status: alertFiring, Fingerprint: "b1", Labels: map[string]string{"ns": "canary-ns", "app": "test-canary"}}}}
+	w = httptest.NewRecorder()
+	custom.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/alerts", bytes.NewBuffer(buildPayload(payload))))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.False(t, storage.IsGateOpen(t.Context(), rollout))
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// AuditFormatJSON writes an audit event as a JSON object on a line
+	AuditFormatJSON = "json"
+	// AuditFormatLogfmt writes an audit event as key=value pairs on a line
+	AuditFormatLogfmt = "logfmt"
+)
+
+const (
+	// auditChange is the action of a gate which is opened, closed or reset
+	auditChange = "change"
+	// auditDecision is the action of a webhook which is answered
+	auditDecision = "decision"
+	// auditFreeze is the action of the confirm gates which are frozen or unfrozen
+	auditFreeze = "freeze"
+)
+
+// AuditEvent is a line of the audit log
+type AuditEvent struct {
+	// Time of the event
+	Time time.Time `json:"time"`
+	// Action is change, decision or freeze
+	Action string `json:"action"`
+	// Key of the gate, namespace/name=type, or empty for a freeze
+	Key string `json:"key,omitempty"`
+	// Status of the gate after a change, opened or closed
+	Status string `json:"status,omitempty"`
+	// Decision of a webhook, approved or rejected
+	Decision string `json:"decision,omitempty"`
+	// User who changed the gate, or empty for the automatic changes and the webhooks
+	User string `json:"user,omitempty"`
+	// Reason of the event
+	Reason string `json:"reason,omitempty"`
+	// RequestID of the request which caused the event
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// AuditLogger appends a line for every gate change and webhook decision to a stream, independently of the store and
+// of the log level. A nil AuditLogger writes nothing.
+type AuditLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	format string
+}
+
+// NewAuditLogger writes the audit log to the destination, which is stdout, stderr or the path of a file which is
+// appended, in the json or logfmt format
+func NewAuditLogger(destination string, format string) (*AuditLogger, error) {
+	if format == "" {
+		format = AuditFormatJSON
+	}
+	if format != AuditFormatJSON && format != AuditFormatLogfmt {
+		return nil, fmt.Errorf("unknown audit log format [%s], expected %s or %s", format, AuditFormatJSON, AuditFormatLogfmt)
+	}
+	switch destination {
+	case "", "-", "stdout":
+		return &AuditLogger{w: os.Stdout, format: format}, nil
+	case "stderr":
+		return &AuditLogger{w: os.Stderr, format: format}, nil
+	}
+	file, err := os.OpenFile(destination, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the audit log: %w", err)
+	}
+	return &AuditLogger{w: file, closer: file, format: format}, nil
+}
+
+// Log writes the event on a line. An event which cannot be written is logged.
+func (a *AuditLogger) Log(event AuditEvent) {
+	if a == nil {
+		return
+	}
+	line, err := a.encode(event)
+	if err != nil {
+		log.Error().Msgf("Unable to encode the audit event %v", err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(line); err != nil {
+		log.Error().Msgf("Unable to write the audit log %v", err)
+	}
+}
+
+// Close closes the file of the audit log
+func (a *AuditLogger) Close() error {
+	if a == nil || a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// encode returns the line of the event, with its newline
+func (a *AuditLogger) encode(event AuditEvent) ([]byte, error) {
+	if a.format == AuditFormatJSON {
+		line, err := json.Marshal(event)
+		return append(line, '\n'), err
+	}
+	var line strings.Builder
+	pairs := [][2]string{
+		{"time", event.Time.Format(time.RFC3339Nano)},
+		{"action", event.Action},
+		{"key", event.Key},
+		{"status", event.Status},
+		{"decision", event.Decision},
+		{"user", event.User},
+		{"reason", event.Reason},
+		{"requestId", event.RequestID},
+	}
+	for _, pair := range pairs {
+		if pair[1] == "" {
+			continue
+		}
+		if line.Len() > 0 {
+			line.WriteByte(' ')
+		}
+		value := pair[1]
+		if strings.ContainsFunc(value, func(r rune) bool { return r <= ' ' || r == '=' || r == '"' || r == '\\' }) {
+			value = strconv.Quote(value)
+		}
+		line.WriteString(pair[0] + "=" + value)
+	}
+	line.WriteByte('\n')
+	return []byte(line.String()), nil
+}
+
+// UseAuditLogger writes every gate change and webhook decision to the audit logger. A nil logger disables the audit log.
+func (h *FlaggerHandler) UseAuditLogger(audit *AuditLogger) {
+	h.audit = audit
+}
+
+// recordChange records a gate which is opened, closed or reset by a user in the metrics and the audit log
+func (h *FlaggerHandler) recordChange(ctx context.Context, key store.StoreKey, open bool, user string, reason string) {
+	recordGate(key, open)
+	h.recordClosedAt(ctx, key, open)
+	h.audit.Log(AuditEvent{
+		Time:      time.Now().UTC(),
+		Action:    auditChange,
+		Key:       key.String(),
+		Status:    store.GateStatus(open),
+		User:      user,
+		Reason:    reason,
+		RequestID: requestID(ctx),
+	})
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// auditEvents reads the JSON lines of the audit log
+func auditEvents(t *testing.T, log []byte) []AuditEvent {
+	var events []AuditEvent
+	scanner := bufio.NewScanner(bytes.NewReader(log))
+	for scanner.Scan() {
+		var event AuditEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event), scanner.Text())
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestAuditLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := NewAuditLogger(path, "")
+	require.NoError(t, err)
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	audit.Log(AuditEvent{Time: at, Action: auditChange, Key: "canary-ns/test-canary=confirm-promotion", Status: store.GATE_OPEN, User: "alice"})
+	audit.Log(AuditEvent{Time: at, Action: auditDecision, Key: "canary-ns/test-canary=confirm-promotion", Decision: store.DecisionApproved, RequestID: "abc"})
+	require.NoError(t, audit.Close())
+
+	// the file is appended
+	audit, err = NewAuditLogger(path, AuditFormatJSON)
+	require.NoError(t, err)
+	audit.Log(AuditEvent{Time: at, Action: auditFreeze, Status: "frozen", User: "bob"})
+	require.NoError(t, audit.Close())
+	written, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `{"time":"2025-01-02T03:04:05Z","action":"change","key":"canary-ns/test-canary=confirm-promotion","status":"opened","user":"alice"}
+{"time":"2025-01-02T03:04:05Z","action":"decision","key":"canary-ns/test-canary=confirm-promotion","decision":"approved","requestId":"abc"}
+{"time":"2025-01-02T03:04:05Z","action":"freeze","status":"frozen","user":"bob"}
+`, string(written))
+
+	var buf bytes.Buffer
+	audit = &AuditLogger{w: &buf, format: AuditFormatLogfmt}
+	audit.Log(AuditEvent{Time: at, Action: auditChange, Key: "canary-ns/test-canary=rollback", Status: store.GATE_OPEN, User: "alice", Reason: `error "rate"`})
+	require.Equal(t, `time=2025-01-02T03:04:05Z action=change key="canary-ns/test-canary=rollback" status=opened user=alice reason="error \"rate\""`+"\n", buf.String())
+
+	_, err = NewAuditLogger(path, "yaml")
+	require.ErrorContains(t, err, "unknown audit log format [yaml]")
+	// a nil logger writes nothing
+	var disabled *AuditLogger
+	disabled.Log(AuditEvent{Action: auditChange})
+	require.NoError(t, disabled.Close())
+}
+
+func TestAuditHandler(t *testing.T) {
+	memory, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	t.Setenv("CANARY_GATE_NAMESPACE", "canary-gate")
+	storage, err := store.NewFreezeStore(memory, fake.NewSimpleClientset())
+	require.NoError(t, err)
+	defer storage.Shutdown()
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	handler.UseFreezer(storage)
+	var buf bytes.Buffer
+	handler.UseAuditLogger(&AuditLogger{w: &buf, format: AuditFormatJSON})
+	gate := &CanaryGatePayload{Type: service.HookConfirmPromotion, Namespace: "canary-ns", Name: "test-canary", User: "alice"}
+	serve := func(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+		r.Header.Set(RequestIDHeader, "request-"+strings.TrimPrefix(r.URL.Path, "/"))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, serve(handler.OpenGate(), post("/open", gate)).Code)
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: service.PhaseWaitingPromotion})
+	require.Equal(t, http.StatusOK, serve(handler.ConfirmPromotion(), httptest.NewRequest(http.MethodPost, confirmPromotionPath, bytes.NewBuffer(payload))).Code)
+	require.Equal(t, http.StatusOK, serve(handler.CloseGate(), post("/close", gate)).Code)
+	require.Equal(t, http.StatusOK, serve(handler.Freeze(), post("/freeze", &FreezePayload{Frozen: true, User: "bob", Reason: "holidays"})).Code)
+	// the reads are not audited
+	require.Equal(t, http.StatusOK, serve(handler.StatusGate(), post("/status", gate)).Code)
+	handler.NotifyAutoChange(gate.key(service.HookConfirmRollout), true, "after its TTL of 30m0s")
+
+	// one line per event
+	events := auditEvents(t, buf.Bytes())
+	require.Len(t, events, 5)
+	key := "canary-ns/test-canary=confirm-promotion"
+	require.Equal(t, AuditEvent{Action: auditChange, Key: key, Status: store.GATE_OPEN, User: "alice", RequestID: "request-open"}, withoutTime(events[0]))
+	require.Equal(t, auditDecision, events[1].Action)
+	require.Equal(t, store.DecisionApproved, events[1].Decision)
+	require.Equal(t, "request-confirm-promotion", events[1].RequestID)
+	require.Contains(t, events[1].Reason, "by user alice")
+	require.Equal(t, AuditEvent{Action: auditChange, Key: key, Status: store.GATE_CLOSE, User: "alice", RequestID: "request-close"}, withoutTime(events[2]))
+	require.Equal(t, AuditEvent{Action: auditFreeze, Status: "frozen", User: "bob", Reason: "holidays", RequestID: "request-freeze"}, withoutTime(events[3]))
+	require.Equal(t, AuditEvent{Action: auditChange, Key: "canary-ns/test-canary=confirm-rollout", Status: store.GATE_OPEN, Reason: "auto-opened after its TTL of 30m0s"}, withoutTime(events[4]))
+	for _, event := range events {
+		require.False(t, event.Time.IsZero())
+	}
+}
+
+// withoutTime returns the event without its time
+func withoutTime(event AuditEvent) AuditEvent {
+	event.Time = time.Time{}
+	return event
+}
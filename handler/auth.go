@@ -0,0 +1,135 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/KongZ/canary-gate/service"
+	"github.com/rs/zerolog/log"
+)
+
+// TokenHeader holds the API token for the clients which cannot use the Authorization header.
+// The Kubernetes API server removes the Authorization header from the requests which it proxies to the pods.
+const TokenHeader = "X-Canary-Gate-Token"
+
+// SignatureHeader holds the HMAC-SHA256 of the request body, e.g. "sha256=<hex>"
+const SignatureHeader = "X-Signature"
+
+// ResponseSignatureHeader holds the HMAC-SHA256 of the response body of a webhook, e.g. "sha256=<hex>"
+const ResponseSignatureHeader = "X-Canary-Gate-Signature"
+
+// Sign returns the value of the signature header for the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature rejects the webhook requests which are not signed with the secret.
+// Flagger cannot sign its requests, so a request without the signature header is accepted
+// when its metadata carries the secret which the controller injects into the Canary webhooks.
+func VerifySignature(secret string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if !validSignature(secret, r.Header.Get(SignatureHeader), body) {
+			log.Warn().Msgf("Rejected unsigned request to %s from %s", r.URL.Path, r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SignResponse signs the response body of the webhooks with the secret in the X-Canary-Gate-Signature header,
+// so a client which knows the secret can detect a forged decision. The response is buffered to sign it.
+func SignResponse(secret string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &signingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		w.Header().Set(ResponseSignatureHeader, Sign(secret, sw.body.Bytes()))
+		w.WriteHeader(sw.status)
+		if _, err := w.Write(sw.body.Bytes()); err != nil {
+			log.Error().Msgf("Error while writing body %v", err)
+		}
+	})
+}
+
+// signingWriter buffers the status and the body of a response until it is signed
+type signingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *signingWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+}
+
+func (w *signingWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(b)
+}
+
+// validSignature checks the signature header, or the metadata secret when the header is missing
+func validSignature(secret string, signature string, body []byte) bool {
+	if signature != "" {
+		if !strings.HasPrefix(signature, "sha256=") {
+			signature = "sha256=" + signature
+		}
+		return hmac.Equal([]byte(signature), []byte(Sign(secret, body)))
+	}
+	var payload CanaryWebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return false
+	}
+	token := payload.Metadata[service.MetaGateSecret]
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// RequireToken rejects the requests which do not carry the token in the Authorization bearer or the X-Canary-Gate-Token header
+func RequireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := r.Header.Get(TokenHeader)
+		if given == "" {
+			given, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if given == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			log.Warn().Msgf("Rejected unauthorized request to %s from %s", r.URL.Path, r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
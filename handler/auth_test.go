@@ -0,0 +1,133 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+const testWebhookSecret = "webhook-secret"
+
+func TestVerifySignature(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	verified := VerifySignature(testWebhookSecret, handler.ConfirmRollout())
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns"})
+
+	cases := []struct {
+		name      string
+		body      []byte
+		signature string
+		expected  int
+	}{
+		{"valid signature", payload, Sign(testWebhookSecret, payload), http.StatusOK},
+		{"signature without prefix", payload, Sign(testWebhookSecret, payload)[len("sha256="):], http.StatusOK},
+		{"invalid signature", payload, Sign("another-secret", payload), http.StatusUnauthorized},
+		{"missing signature", payload, "", http.StatusUnauthorized},
+		{"secret in metadata", buildPayload(&CanaryWebhookPayload{
+			Name:      "test-canary",
+			Namespace: "canary-ns",
+			Metadata:  map[string]string{service.MetaGateSecret: testWebhookSecret},
+		}), "", http.StatusOK},
+		{"wrong secret in metadata", buildPayload(&CanaryWebhookPayload{
+			Name:      "test-canary",
+			Namespace: "canary-ns",
+			Metadata:  map[string]string{service.MetaGateSecret: "another-secret"},
+		}), "", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, confirmRolloutPath, bytes.NewBuffer(c.body))
+		if c.signature != "" {
+			req.Header.Set(SignatureHeader, c.signature)
+		}
+		w := httptest.NewRecorder()
+		verified.ServeHTTP(w, req)
+		require.Equalf(t, c.expected, w.Code, "[%s] unexpected status", c.name)
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	protected := RequireToken("api-token", handler.StatusGate())
+
+	cases := []struct {
+		name     string
+		header   string
+		value    string
+		expected int
+	}{
+		{"bearer token", "Authorization", "Bearer api-token", http.StatusOK},
+		{"token header", TokenHeader, "api-token", http.StatusOK},
+		{"wrong token", "Authorization", "Bearer another-token", http.StatusUnauthorized},
+		{"basic auth", "Authorization", "Basic api-token", http.StatusUnauthorized},
+		{"missing token", "", "", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/status", bytes.NewBuffer(buildGatePayload(service.HookConfirmRollout)))
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, req)
+		require.Equalf(t, c.expected, w.Code, "[%s] unexpected status", c.name)
+	}
+}
+
+func TestSignResponse(t *testing.T) {
+	cases := []struct {
+		name      string
+		body      string
+		status    int
+		signature string
+	}{
+		{"decision", `{"approved":true,"gate":"confirm-promotion","reason":"gate opened by default"}`, http.StatusOK, "sha256=c3ef4f6174036daea77f506d11aa8f256c241d0677bf86e8502b97f61b9f1e99"},
+		{"approved", "Approved", http.StatusOK, "sha256=7f9a5718c879fdf777360a2248c08592563cd1044736b88250328cd39e39b12b"},
+		{"halted", "Approved", http.StatusForbidden, "sha256=7f9a5718c879fdf777360a2248c08592563cd1044736b88250328cd39e39b12b"},
+	}
+	for _, c := range cases {
+		signed := SignResponse("response-secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeBytes(w, []byte(c.body), c.status)
+		}))
+		w := httptest.NewRecorder()
+		signed.ServeHTTP(w, httptest.NewRequest(http.MethodPost, confirmRolloutPath, nil))
+		require.Equalf(t, c.status, w.Code, "[%s] unexpected status", c.name)
+		require.Equalf(t, c.body, w.Body.String(), "[%s] unexpected body", c.name)
+		require.Equalf(t, c.signature, w.Header().Get(ResponseSignatureHeader), "[%s] unexpected signature", c.name)
+	}
+}
+
+func TestSignResponseWebhook(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	signed := SignResponse("response-secret", handler.ConfirmRollout())
+	req := httptest.NewRequest(http.MethodPost, confirmRolloutPath, bytes.NewBuffer(buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns"})))
+	w := httptest.NewRecorder()
+	signed.ServeHTTP(w, req)
+	require.Equal(t, Sign("response-secret", w.Body.Bytes()), w.Header().Get(ResponseSignatureHeader))
+}
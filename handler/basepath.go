@@ -0,0 +1,42 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// BasePath normalizes the path prefix of the server, e.g. "canary-gate/" is "/canary-gate". The root is empty.
+func BasePath(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// Mount serves the handler under the base path, for a server behind a sub-path ingress. The base path is stripped
+// from the requests, so the handler keeps its routes, and the requests outside of the base path are answered 404.
+// An empty base path serves the handler at the root.
+func Mount(basePath string, next http.Handler) http.Handler {
+	if basePath == "" {
+		return next
+	}
+	mux := http.NewServeMux()
+	mux.Handle(basePath+"/", http.StripPrefix(basePath, next))
+	return mux
+}
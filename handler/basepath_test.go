@@ -0,0 +1,59 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func TestBasePath(t *testing.T) {
+	for path, expected := range map[string]string{"": "", "/": "", "canary-gate": "/canary-gate", "/canary-gate/": "/canary-gate", "/a/b": "/a/b"} {
+		require.Equalf(t, expected, BasePath(path), "base path of '%s'", path)
+	}
+}
+
+func TestMount(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	mux := http.NewServeMux()
+	mux.Handle("/confirm-rollout", handler.ConfirmRollout())
+	mux.Handle("/version", (&ServerHandler{}).Version())
+	server := Mount(BasePath("/canary-gate/"), mux)
+
+	request := func(method string, path string, body []byte) int {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+		return w.Code
+	}
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns"})
+	require.Equal(t, http.StatusOK, request(http.MethodPost, "/canary-gate/confirm-rollout", payload))
+	require.Equal(t, http.StatusOK, request(http.MethodGet, "/canary-gate/version", nil))
+	// the routes are only served under the base path
+	require.Equal(t, http.StatusNotFound, request(http.MethodPost, "/confirm-rollout", payload))
+	require.Equal(t, http.StatusNotFound, request(http.MethodGet, "/canary-gate-other/version", nil))
+
+	// the root serves the routes as they are
+	require.Same(t, mux, Mount(BasePath("/"), mux))
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog/log"
+)
+
+// cooldownGates lists the gates which are not opened during the cooldown after a rollback
+var cooldownGates = []service.HookType{
+	service.HookConfirmRollout,
+	service.HookConfirmTrafficIncrease,
+	service.HookConfirmPromotion,
+	service.HookConfirmFinalize,
+}
+
+// CooldownConflict explains why a confirm gate is not opened shortly after a rollback
+type CooldownConflict struct {
+	// Gate which is requested to open
+	Gate service.HookType `json:"gate"`
+	// RolledBackAt is the time when the canary was last rolled back
+	RolledBackAt time.Time `json:"rolledBackAt"`
+	// Remaining is the remaining duration of the cooldown, e.g. 4m30s
+	Remaining string `json:"remaining"`
+	// Reason explains the conflict
+	Reason string `json:"reason"`
+}
+
+// RollbackCooldown rejects the opening of the confirm gates of a deployment for the duration after its canary is
+// rolled back, so a gate is not reopened right after a rollback. A cooldown of 0 disables it.
+func (h *FlaggerHandler) RollbackCooldown(cooldown time.Duration) {
+	h.cooldown = cooldown
+}
+
+// recordRollback records the time of the rollback of the canary, which starts the cooldown of its confirm gates
+func (h *FlaggerHandler) recordRollback(ctx context.Context, canary *CanaryWebhookPayload) {
+	key := gateKey(canary, "")
+	h.store.SetRolledBackAt(ctx, key, time.Now().UTC())
+	if h.cooldown > 0 {
+		log.Info().Msgf("Canary [%s] is rolled back, the confirm gates cannot be opened for %s", h.createKey(key.Namespace, key.Name), h.cooldown)
+	}
+}
+
+// cooldownConflict returns the conflict and the remaining cooldown of a confirm gate which is opened during the
+// cooldown, or nil
+func (h *FlaggerHandler) cooldownConflict(ctx context.Context, key store.StoreKey) (*CooldownConflict, time.Duration) {
+	if h.cooldown <= 0 || !slices.Contains(cooldownGates, key.Type) {
+		return nil, 0
+	}
+	rolledBackAt := h.store.GetRolledBackAt(ctx, store.StoreKey{Namespace: key.Namespace, Name: key.Name})
+	if rolledBackAt.IsZero() {
+		return nil, 0
+	}
+	remaining := time.Until(rolledBackAt.Add(h.cooldown)).Round(time.Second)
+	if remaining <= 0 {
+		return nil, 0
+	}
+	return &CooldownConflict{
+		Gate:         key.Type,
+		RolledBackAt: rolledBackAt,
+		Remaining:    remaining.String(),
+		Reason: fmt.Sprintf("Gate [%s] cannot be opened for %s after the rollback at %s", key.String(), remaining,
+			rolledBackAt.UTC().Format(time.RFC3339)),
+	}, remaining
+}
+
+// inCooldown answers 409 Conflict with the cooldown conflict when the gate is opened during the cooldown and is not
+// forced, and returns true
+func (h *FlaggerHandler) inCooldown(ctx context.Context, w http.ResponseWriter, key store.StoreKey, force bool) bool {
+	if force {
+		return false
+	}
+	conflict, remaining := h.cooldownConflict(ctx, key)
+	if conflict == nil {
+		return false
+	}
+	log.Info().Msg(conflict.Reason)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+	writePayload(w, conflict, http.StatusConflict)
+	return true
+}
+
+// isForced reads the force query parameter, which opens a confirm gate during the cooldown
+func isForced(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("force")
+	if value == "" {
+		return false, nil
+	}
+	force, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("force must be true or false")
+	}
+	return force, nil
+}
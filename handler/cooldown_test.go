@@ -0,0 +1,116 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func TestRollbackCooldown(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	handler.RollbackCooldown(10 * time.Minute)
+	canary := &CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: service.PhaseProgressing}
+	deployment := store.StoreKey{Namespace: canary.Namespace, Name: canary.Name}
+	open := func(target string, payload *CanaryGatePayload) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.OpenGate().ServeHTTP(w, post(target, payload))
+		return w
+	}
+	promotion := &CanaryGatePayload{Type: service.HookConfirmPromotion, Namespace: canary.Namespace, Name: canary.Name}
+
+	// no rollback, no cooldown
+	require.Equal(t, http.StatusOK, open("/open", promotion).Code)
+
+	// Flagger rolls the canary back when it fails
+	handler.Event().ServeHTTP(httptest.NewRecorder(), post(eventPath, canary))
+	require.True(t, storage.GetRolledBackAt(t.Context(), deployment).IsZero())
+	canary.Phase = service.PhaseFailed
+	handler.Event().ServeHTTP(httptest.NewRecorder(), post(eventPath, canary))
+	rolledBackAt := storage.GetRolledBackAt(t.Context(), deployment)
+	require.False(t, rolledBackAt.IsZero())
+
+	w := open("/open", promotion)
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.NotEmpty(t, w.Header().Get("Retry-After"))
+	var conflict CooldownConflict
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &conflict))
+	require.Equal(t, service.HookConfirmPromotion, conflict.Gate)
+	require.True(t, rolledBackAt.Equal(conflict.RolledBackAt))
+	remaining, err := time.ParseDuration(conflict.Remaining)
+	require.NoError(t, err)
+	require.InDelta(t, 10*time.Minute, remaining, float64(time.Second))
+	require.Contains(t, conflict.Reason, "canary-ns/test-canary=confirm-promotion")
+
+	// the gates opened together and the dry runs are rejected too
+	require.Equal(t, http.StatusConflict, open("/open", &CanaryGatePayload{Namespace: canary.Namespace, Name: canary.Name,
+		Types: []service.HookType{service.HookPreRollout, service.HookConfirmPromotion}}).Code)
+	require.Equal(t, http.StatusConflict, open("/open?dryRun=true", promotion).Code)
+	require.True(t, storage.IsGateOpen(t.Context(), promotion.key(service.HookConfirmPromotion)))
+
+	// the gates which are not confirm gates are not in the cooldown
+	require.Equal(t, http.StatusOK, open("/open", &CanaryGatePayload{Type: service.HookPostRollout, Namespace: canary.Namespace, Name: canary.Name}).Code)
+
+	// the cooldown is not applied to the closes
+	w = httptest.NewRecorder()
+	handler.CloseGate().ServeHTTP(w, post("/close", promotion))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.Equal(t, http.StatusBadRequest, open("/open?force=maybe", promotion).Code)
+	require.Equal(t, http.StatusOK, open("/open?force=true", promotion).Code)
+	require.True(t, storage.IsGateOpen(t.Context(), promotion.key(service.HookConfirmPromotion)))
+
+	// the cooldown elapses
+	storage.SetRolledBackAt(t.Context(), deployment, time.Now().Add(-11*time.Minute))
+	require.Equal(t, http.StatusOK, open("/open", promotion).Code)
+
+	// the cooldown is disabled
+	storage.SetRolledBackAt(t.Context(), deployment, time.Now())
+	handler.RollbackCooldown(0)
+	require.Equal(t, http.StatusOK, open("/open", promotion).Code)
+}
+
+func TestRollbackGateCooldown(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	handler.RollbackCooldown(time.Hour)
+	canary := &CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns"}
+	deployment := store.StoreKey{Namespace: canary.Namespace, Name: canary.Name}
+
+	// the closed rollback gate does not roll the canary back
+	handler.Rollback().ServeHTTP(httptest.NewRecorder(), post(rollbackPath, canary))
+	require.True(t, storage.GetRolledBackAt(t.Context(), deployment).IsZero())
+
+	storage.GateOpen(t.Context(), store.StoreKey{Namespace: canary.Namespace, Name: canary.Name, Type: service.HookRollback}, "")
+	handler.Rollback().ServeHTTP(httptest.NewRecorder(), post(rollbackPath, canary))
+	require.False(t, storage.GetRolledBackAt(t.Context(), deployment).IsZero())
+
+	w := httptest.NewRecorder()
+	handler.OpenGate().ServeHTTP(w, post("/open", &CanaryGatePayload{Type: service.HookConfirmRollout, Namespace: canary.Namespace, Name: canary.Name}))
+	require.Equal(t, http.StatusConflict, w.Code)
+}
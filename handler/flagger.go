@@ -20,9 +20,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"maps"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/KongZ/canary-gate/noti"
 	"github.com/KongZ/canary-gate/service"
@@ -62,6 +64,30 @@ type CanaryGatePayload struct {
 
 	// Namespace where canarygate crd is created
 	Namespace string `json:"namespace"`
+
+	// Optional duration (e.g. 30m) after which an opened gate reverts to its default state
+	TTL string `json:"ttl,omitempty"`
+
+	// Optional user who opens or closes the gate
+	User string `json:"user,omitempty"`
+
+	// Optional maximum number of changes returned by the history request
+	Limit int `json:"limit,omitempty"`
+
+	// Manual marks the opening of the rollback gate as a manual rollback, which requires a reason
+	Manual bool `json:"manual,omitempty"`
+
+	// Reason of a manual rollback
+	Reason string `json:"reason,omitempty"`
+
+	// Optional list of gates which are opened or closed together, instead of the gate of the type
+	Types []service.HookType `json:"types,omitempty"`
+}
+
+// key returns the store key of the gate of the given type of the deployment, or of the deployment when the type is
+// empty. The payload is normalized by validate.
+func (p *CanaryGatePayload) key(t service.HookType) store.StoreKey {
+	return store.StoreKey{Namespace: p.Namespace, Name: p.Name, Type: t}
 }
 
 // CanaryGatePayload holds the open/close gate request
@@ -74,32 +100,109 @@ type CanaryGateStatus struct {
 	Namespace string `json:"namespace"`
 	// Gate status
 	Status string `json:"status"`
+	// User who last opened or closed the gate
+	ChangedBy string `json:"changedBy,omitempty"`
+	// Number of users who approved a gate which requires multiple approvals
+	Approvals int `json:"approvals,omitempty"`
+	// Number of approvals which opens a gate which requires multiple approvals
+	RequiredApprovals int `json:"requiredApprovals,omitempty"`
+	// DryRun is true when the status is the would-be result of a dry-run request, and the gate is not changed
+	DryRun bool `json:"dryRun,omitempty"`
+	// Phase of the canary in the last webhook, which is set on the event
+	Phase service.Phase `json:"phase,omitempty"`
+	// LastDecision is the last answer of the webhook of the gate, approved or rejected
+	LastDecision string `json:"lastDecision,omitempty"`
+	// LastDecisionAt is the time (RFC3339) of the last answer of the webhook of the gate
+	LastDecisionAt string `json:"lastDecisionAt,omitempty"`
+	// Frozen is true when the confirm gate is closed by the freeze of the gates, regardless of its own state
+	Frozen bool `json:"frozen,omitempty"`
+}
+
+// WebhookDecision holds the decision of a gate in the body of the webhook response
+type WebhookDecision struct {
+	// Approved is true when the gate is opened
+	Approved bool `json:"approved"`
+	// Gate is the type of the gate
+	Gate service.HookType `json:"gate"`
+	// Reason explains the decision with the last change of the gate
+	Reason string `json:"reason,omitempty"`
+}
+
+// PhasesResponse holds the number of the active canaries in each phase
+type PhasesResponse struct {
+	// Phases maps a phase to the number of the canaries in it
+	Phases map[service.Phase]int `json:"phases"`
+	// Total is the number of the active canaries
+	Total int `json:"total"`
+}
+
+// DependencyConflict explains why a gate is not opened before its dependencies
+type DependencyConflict struct {
+	// Gate which is requested to open
+	Gate service.HookType `json:"gate"`
+	// Closed lists the dependencies of the gate which are not opened
+	Closed []service.HookType `json:"closed"`
+	// Reason explains the conflict
+	Reason string `json:"reason"`
 }
 
 type FlaggerHandler struct {
 	cmd   *cli.Command
 	noti  noti.Client
 	store store.Store
+	// events suppresses the repeated logs of the events, or nil to log every event
+	events *eventSampler
+	// metadata is the allow-list of the Flagger metadata which is notified, or nil to notify all of them
+	metadata map[string]bool
+	// cooldown is the duration after a rollback during which the confirm gates are not opened, or 0
+	cooldown time.Duration
+	// freezer reads the freeze of the confirm gates, or nil when the gates cannot be frozen
+	freezer store.Freezer
+	// audit writes the gate changes and the webhook decisions, or nil
+	audit *AuditLogger
 }
 
 const FLAGGER_METADATA_EVENT_MESSAGE = "eventMessage"
 
 // StoreKey get store key name
+//
+// Deprecated: use store.NewStoreKey, which validates the namespace and name.
 func StoreKey(canary *CanaryWebhookPayload, hook service.HookType) string {
 	return fmt.Sprintf("%s:%s:%s", canary.Namespace, canary.Name, hook)
 }
 
+// gateKey returns the store key of the CanaryGate which injected the webhook.
+// Canaries without the gate metadata use their own name and namespace.
+func gateKey(canary *CanaryWebhookPayload, hook service.HookType) store.StoreKey {
+	key := store.StoreKey{Namespace: canary.Namespace, Name: canary.Name, Type: hook}
+	if name := canary.Metadata[service.MetaGateName]; name != "" {
+		key.Name = name
+		if namespace := canary.Metadata[service.MetaGateNamespace]; namespace != "" {
+			key.Namespace = namespace
+		}
+	}
+	return key
+}
+
 // ConfirmRollout hooks are executed before scaling up the canary deployment and can be used for manual approval. The rollout is paused until the  returns a successful HTTP status code.
 func (h *FlaggerHandler) ConfirmRollout() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if canary, err := readPayload(r, w, CanaryWebhookPayload{}); err == nil {
-			h.logEvent(service.HookConfirmRollout, canary)
+	return traced("/confirm-rollout", func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		if canary, err := readPayload(r, w, CanaryWebhookPayload{}); err == nil && validPayload(w, canary) {
+			h.logEvent(r.Context(), service.HookConfirmRollout, canary)
 			if h.noti != nil {
-				if _, err := h.noti.SendMessages("Please confirm rollout action", service.HookConfirmRollout, createMeta(*canary)); err != nil {
+				meta := h.createMeta(*canary)
+				meta[service.MetaGateState] = store.GateStatus(h.store.IsGateOpen(r.Context(), gateKey(canary, service.HookConfirmRollout)))
+				messages, err := h.noti.SendMessages("Please confirm rollout action", service.HookConfirmRollout, meta)
+				if err != nil {
 					log.Error().Msgf("Error while sending message %v", err)
 				}
+				// some notifiers may have sent the message even if others failed
+				if len(messages) > 0 && h.store != nil {
+					h.store.SaveMessages(r.Context(), gateKey(canary, ""), messages)
+				}
 			}
-			h.responseWebhook(w, canary, service.HookConfirmRollout)
+			h.responseWebhook(w, r, canary, service.HookConfirmRollout)
 		}
 	})
 }
@@ -124,6 +227,12 @@ func (h *FlaggerHandler) ConfirmPromotion() http.Handler {
 	return h.createGateHandler(service.HookConfirmPromotion)
 }
 
+// ConfirmFinalize hooks are called with the confirm-promotion hooks, since Flagger has no finalize hook. The canary is
+// not promoted and finalized until the hooks return HTTP 200, so the finalization can be confirmed apart from the promotion.
+func (h *FlaggerHandler) ConfirmFinalize() http.Handler {
+	return h.createGateHandler(service.HookConfirmFinalize)
+}
+
 // PostRollout hooks are executed after the canary has been promoted or rolled back. If a post rollout  fails the error is logged.
 func (h *FlaggerHandler) PostRollout() http.Handler {
 	return h.createGateHandler(service.HookPostRollout)
@@ -131,7 +240,22 @@ func (h *FlaggerHandler) PostRollout() http.Handler {
 
 // Rollback hooks are executed while a canary deployment is in either Progressing or Waiting status. This provides the ability to rollback during analysis or while waiting for a confirmation. If a rollback  returns a successful HTTP status code, Flagger will stop the analysis and mark the canary release as failed.
 func (h *FlaggerHandler) Rollback() http.Handler {
-	return h.createGateHandler(service.HookRollback)
+	return traced("/rollback", func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		if canary, err := readPayload(r, w, CanaryWebhookPayload{}); err == nil && validPayload(w, canary) {
+			h.logEvent(r.Context(), service.HookRollback, canary)
+			if h.store.IsGateOpen(r.Context(), gateKey(canary, service.HookRollback)) {
+				h.recordRollback(r.Context(), canary)
+				if h.noti != nil {
+					text := fmt.Sprintf("Canary [%s] is rolled back by the rollback gate", h.createWebhookKey(canary))
+					if _, err := h.noti.SendMessages(text, service.HookRollback, h.createMeta(*canary)); err != nil {
+						log.Error().Msgf("Error while sending message %v", err)
+					}
+				}
+			}
+			h.responseWebhook(w, r, canary, service.HookRollback)
+		}
+	})
 }
 
 func NewHandler(cmd *cli.Command, noti noti.Client, store store.Store) FlaggerHandler {
@@ -143,75 +267,705 @@ func NewHandler(cmd *cli.Command, noti noti.Client, store store.Store) FlaggerHa
 	return handler
 }
 
+// SampleEvents logs an event when its phase or checksum changes, and then once in every repeats of the same event.
+// The suppressed repeats are logged at debug level. An every of 0 logs every event.
+func (h *FlaggerHandler) SampleEvents(every int) {
+	if every <= 0 {
+		h.events = nil
+		return
+	}
+	h.events = newEventSampler(every)
+}
+
+// AllowMetadata notifies only the listed keys of the Flagger metadata. The name, namespace and cluster of the canary
+// and the CanaryGate, which the buttons of the messages act on, are always notified and the other keys are dropped.
+// No keys notify all of the metadata.
+func (h *FlaggerHandler) AllowMetadata(keys []string) {
+	if len(keys) == 0 {
+		h.metadata = nil
+		return
+	}
+	h.metadata = map[string]bool{
+		service.MetaName:          true,
+		service.MetaNamespace:     true,
+		service.MetaCluster:       true,
+		service.MetaGateName:      true,
+		service.MetaGateNamespace: true,
+	}
+	for _, k := range keys {
+		h.metadata[k] = true
+	}
+}
+
 // Event hooks are executed every time Flagger emits a Kubernetes event. When configured, every action that Flagger takes during a canary deployment will be sent as JSON via an HTTP POST request
 func (h *FlaggerHandler) Event() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if canary, err := readPayload(r, w, CanaryWebhookPayload{}); err == nil {
-			h.logEvent(service.HookEvent, canary)
-			// h.noti.SendMessages()
+	return traced("/event", func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		if canary, err := readPayload(r, w, CanaryWebhookPayload{}); err == nil && validPayload(w, canary) {
+			h.logEvent(r.Context(), service.HookEvent, canary)
+			w.WriteHeader(http.StatusOK)
 		}
-		w.WriteHeader(http.StatusOK)
 	})
 }
 
-// OpenGate set gate open
+// OpenGate set gate open. With the ifCurrent query parameter, the gate is opened only if it is in that state.
+// A gate whose dependencies are not opened is not opened and answers 409 Conflict.
+// A confirm gate is not opened during the cooldown after a rollback and answers 409 Conflict, unless the force query
+// parameter is set.
+// A manual rollback opens the rollback gate and requires a reason.
+// With the dryRun query parameter, the request is validated and answers the would-be status without changing the gate.
+// The gates listed in types are opened together, see setGates.
 func (h *FlaggerHandler) OpenGate() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if gate, err := readPayload(r, w, CanaryGatePayload{}); err == nil {
-			h.store.GateOpen(store.StoreKey{Namespace: gate.Namespace, Name: gate.Name, Type: gate.Type})
-			h.responseAPI(w, gate, store.GATE_OPEN)
+	return traced("/open", func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		if gate, err := readPayload(r, w, CanaryGatePayload{}); err == nil && validPayload(w, gate) {
+			if len(gate.Types) > 0 {
+				h.setGates(r, w, gate, true)
+				return
+			}
+			if !gate.requireSingleGate(w) {
+				return
+			}
+			key := gate.key(gate.Type)
+			traceGate(r.Context(), key)
+			dryRun, err := isDryRun(r)
+			if err != nil {
+				badRequest(w, err)
+				return
+			}
+			if gate.Manual {
+				h.manualRollback(r.Context(), w, gate, key, dryRun)
+				return
+			}
+			closed, err := h.closedDependencies(r.Context(), key)
+			if err != nil {
+				log.Error().Msgf("Unable to list gates of %s %v", h.createKey(gate.Namespace, gate.Name), err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if len(closed) > 0 {
+				reason := dependencyReason(key, closed)
+				log.Info().Msg(reason)
+				writePayload(w, &DependencyConflict{Gate: key.Type, Closed: closed, Reason: reason}, http.StatusConflict)
+				return
+			}
+			force, err := isForced(r)
+			if err != nil {
+				badRequest(w, err)
+				return
+			}
+			if h.inCooldown(r.Context(), w, key, force) {
+				return
+			}
+			if ifCurrent := r.URL.Query().Get("ifCurrent"); ifCurrent != "" {
+				if gate.TTL != "" {
+					badRequest(w, fmt.Errorf("ttl cannot be used with ifCurrent"))
+					return
+				}
+				if approval := h.store.GetApproval(r.Context(), key); approval.Required > 1 {
+					badRequest(w, fmt.Errorf("gate [%s] requires %d approvals and cannot be used with ifCurrent", key.String(), approval.Required))
+					return
+				}
+				if dryRun {
+					h.dryRunGate(r.Context(), w, gate, ifCurrent, true)
+					return
+				}
+				h.setGateIfCurrent(r.Context(), w, gate, ifCurrent, true)
+				return
+			}
+			var ttl time.Duration
+			if gate.TTL != "" {
+				ttl, err = time.ParseDuration(gate.TTL)
+				if err == nil && ttl <= 0 {
+					err = fmt.Errorf("ttl must be positive")
+				}
+				if err != nil {
+					badRequest(w, err)
+					return
+				}
+			}
+			if dryRun {
+				h.dryRunGate(r.Context(), w, gate, "", true)
+				return
+			}
+			approval, err := h.approveGate(r.Context(), key, ttl, gate.User)
+			if err != nil {
+				badRequest(w, err)
+				return
+			}
+			if !approval.Approved() {
+				h.responseAPI(w, gate, store.GATE_CLOSE, approval)
+				return
+			}
+			gate.User = approval.ChangedBy()
+			h.responseAPI(w, gate, store.GATE_OPEN, approval)
 		}
 	})
 }
 
-// CloseGate set gate close
+// CloseGate set gate close. With the ifCurrent query parameter, the gate is closed only if it is in that state.
+// With the dryRun query parameter, the request is validated and answers the would-be status without changing the gate.
+// The gates listed in types are closed together, see setGates.
 func (h *FlaggerHandler) CloseGate() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if gate, err := readPayload(r, w, CanaryGatePayload{}); err == nil {
-			h.store.GateClose(store.StoreKey{Namespace: gate.Namespace, Name: gate.Name, Type: gate.Type})
-			h.responseAPI(w, gate, store.GATE_CLOSE)
+	return traced("/close", func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		if gate, err := readPayload(r, w, CanaryGatePayload{}); err == nil && validPayload(w, gate) {
+			if len(gate.Types) > 0 {
+				h.setGates(r, w, gate, false)
+				return
+			}
+			if !gate.requireSingleGate(w) {
+				return
+			}
+			key := gate.key(gate.Type)
+			traceGate(r.Context(), key)
+			dryRun, err := isDryRun(r)
+			if err != nil {
+				badRequest(w, err)
+				return
+			}
+			ifCurrent := r.URL.Query().Get("ifCurrent")
+			if dryRun {
+				h.dryRunGate(r.Context(), w, gate, ifCurrent, false)
+				return
+			}
+			if ifCurrent != "" {
+				h.setGateIfCurrent(r.Context(), w, gate, ifCurrent, false)
+				return
+			}
+			h.store.GateClose(r.Context(), key, gate.User)
+			h.recordChange(r.Context(), key, false, gate.User, "")
+			h.responseAPI(w, gate, store.GATE_CLOSE, store.Approval{})
+		}
+	})
+}
+
+// ResetGate removes the stored state of the gate, so it follows its default state again, and answers the
+// resulting state.
+func (h *FlaggerHandler) ResetGate() http.Handler {
+	return traced("/reset", func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		if gate, err := readPayload(r, w, CanaryGatePayload{}); err == nil && validPayload(w, gate) && gate.requireSingleGate(w) {
+			key := gate.key(gate.Type)
+			traceGate(r.Context(), key)
+			h.store.GateReset(r.Context(), key, gate.User)
+			open := h.store.IsGateOpen(r.Context(), key)
+			h.recordChange(r.Context(), key, open, gate.User, "reset")
+			log.Info().Msgf("Gate [%s] is reset to [%s]", key.String(), store.GateStatus(open))
+			h.responseAPI(w, gate, store.GateStatus(open), store.Approval{})
 		}
 	})
 }
 
-// StatusGate get gate status
+// StatusGate get gate status. The gate is read from the JSON body of a POST, or the query parameters of a GET.
 func (h *FlaggerHandler) StatusGate() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if gate, err := readPayload(r, w, CanaryGatePayload{}); err == nil {
+	return traced("/status", func(w http.ResponseWriter, r *http.Request) {
+		if gate, err := readStatusPayload(r, w); err == nil {
 			var gateTypes []service.HookType
 			if gate.Type == service.HookAll {
-				gateTypes = []service.HookType{
-					service.HookConfirmRollout,
-					service.HookPreRollout,
-					service.HookRollout,
-					service.HookConfirmTrafficIncrease,
-					service.HookConfirmPromotion,
-					service.HookPostRollout,
-					service.HookRollback,
-				}
+				gateTypes = store.GateTypes
+			} else if len(gate.Types) > 0 {
+				gateTypes = gate.Types
 			} else {
 				gateTypes = []service.HookType{gate.Type}
 			}
+			gates, err := h.store.List(r.Context(), gate.Namespace, gate.Name)
+			if err != nil {
+				log.Error().Msgf("Unable to list gates of %s %v", h.createKey(gate.Namespace, gate.Name), err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
 			gateResponseMap := make(map[string][]CanaryGateStatus)
+			frozen := h.currentFreeze(r.Context()).Frozen
 			for _, gt := range gateTypes {
-				status := store.GateStatus(h.store.IsGateOpen(store.StoreKey{Namespace: gate.Namespace, Name: gate.Name, Type: gt}))
+				status := store.GateStatus(gates[gt])
 				log.Debug().Msgf("%s %s=%s", h.createKey(gate.Namespace, gate.Name), gt, status)
-				h.createResponse(gateResponseMap, gate.Namespace, gate.Name, gt, status)
+				key := gate.key(gt)
+				changedBy := h.store.GetChangedBy(r.Context(), key)
+				h.createResponse(gateResponseMap, gate.Namespace, gate.Name, gt, status, changedBy, h.store.GetApproval(r.Context(), key))
+				if decision := h.store.GetDecision(r.Context(), key); !decision.IsZero() {
+					statuses := gateResponseMap[h.createKey(gate.Namespace, gate.Name)]
+					statuses[len(statuses)-1].LastDecision = decision.String()
+					statuses[len(statuses)-1].LastDecisionAt = decision.Time.UTC().Format(time.RFC3339)
+				}
+				if frozen && slices.Contains(store.FreezeGates, gt) {
+					statuses := gateResponseMap[h.createKey(gate.Namespace, gate.Name)]
+					statuses[len(statuses)-1].Frozen = true
+				}
 			}
-			// Get last event for the gate
-			event := h.store.GetLastEvent(r.Context(), store.StoreKey{Namespace: gate.Namespace, Name: gate.Name})
-			h.createResponse(gateResponseMap, gate.Namespace, gate.Name, service.HookEvent, event)
+			// Get last event and phase for the gate
+			eventKey := gate.key("")
+			event := h.store.GetLastEvent(r.Context(), eventKey)
+			h.createResponse(gateResponseMap, gate.Namespace, gate.Name, service.HookEvent, event, "", store.Approval{})
+			statuses := gateResponseMap[h.createKey(gate.Namespace, gate.Name)]
+			statuses[len(statuses)-1].Phase = service.Phase(h.store.GetPhase(r.Context(), eventKey))
 			// return the response
 			writePayload(w, &gateResponseMap, http.StatusOK)
 		}
 	})
 }
 
-func (h *FlaggerHandler) createGateHandler(hookType service.HookType) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if canary, err := readPayload(r, w, CanaryWebhookPayload{}); err == nil {
-			h.logEvent(hookType, canary)
-			h.responseWebhook(w, canary, hookType)
+// Phases answers the number of the active canaries in each phase, which is counted from the phases of the webhooks
+// since the start. The canaries which succeeded, failed or are terminated are not counted.
+func (h *FlaggerHandler) Phases() http.Handler {
+	return traced("/phases", func(w http.ResponseWriter, r *http.Request) {
+		response := &PhasesResponse{Phases: canaryPhases.counts()}
+		for _, count := range response.Phases {
+			response.Total += count
+		}
+		writePayload(w, response, http.StatusOK)
+	})
+}
+
+// readStatusPayload reads the status request from the body of a POST, or from the namespace, name and gate query
+// parameters of a GET. The gate of a GET defaults to all.
+func readStatusPayload(r *http.Request, w http.ResponseWriter) (*CanaryGatePayload, error) {
+	if r.Method != http.MethodGet {
+		gate, err := readPayload(r, w, CanaryGatePayload{})
+		if err == nil && !validPayload(w, gate) {
+			err = errInvalidPayload
+		}
+		return gate, err
+	}
+	query := r.URL.Query()
+	gate := &CanaryGatePayload{
+		Type:      service.HookType(query.Get("gate")),
+		Name:      query.Get("name"),
+		Namespace: query.Get("namespace"),
+	}
+	if gate.Type == "" {
+		gate.Type = service.HookAll
+	}
+	if !validPayload(w, gate) {
+		return gate, errInvalidPayload
+	}
+	return gate, nil
+}
+
+// History get the last gate changes, the oldest first
+func (h *FlaggerHandler) History() http.Handler {
+	return traced("/history", func(w http.ResponseWriter, r *http.Request) {
+		if gate, err := readPayload(r, w, CanaryGatePayload{}); err == nil && validPayload(w, gate) {
+			history := []store.HistoryEntry{}
+			for _, entry := range h.store.GetHistory(r.Context(), gate.key("")) {
+				if gate.Type == "" || gate.Type == service.HookAll || gate.Type == entry.Type {
+					history = append(history, entry)
+				}
+			}
+			if gate.Limit > 0 && len(history) > gate.Limit {
+				history = history[len(history)-gate.Limit:]
+			}
+			writePayload(w, &history, http.StatusOK)
+		}
+	})
+}
+
+// setGateIfCurrent sets the gate to desired only if its current state is ifCurrent.
+// It answers with 409 Conflict and the current state when the gate is not in that state.
+func (h *FlaggerHandler) setGateIfCurrent(ctx context.Context, w http.ResponseWriter, gate *CanaryGatePayload, ifCurrent string, desired bool) {
+	if ifCurrent != store.GATE_OPEN && ifCurrent != store.GATE_CLOSE {
+		badRequest(w, fmt.Errorf("ifCurrent must be %s or %s", store.GATE_OPEN, store.GATE_CLOSE))
+		return
+	}
+	key := gate.key(gate.Type)
+	swapped, err := h.store.CompareAndSet(ctx, key, store.GateBoolStatus(ifCurrent), desired)
+	if err != nil {
+		log.Error().Msgf("Unable to set gate [%s] %v", key.String(), err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// the conditional change does not record the user
+	gate.User = ""
+	if !swapped {
+		log.Info().Msgf("Gate [%s] is not [%s], it is left unchanged", key.String(), ifCurrent)
+		gateResponseMap := make(map[string][]CanaryGateStatus)
+		h.createResponse(gateResponseMap, gate.Namespace, gate.Name, gate.Type, store.GateStatus(h.store.IsGateOpen(ctx, key)), "", store.Approval{})
+		writePayload(w, &gateResponseMap, http.StatusConflict)
+		return
+	}
+	h.recordChange(ctx, key, desired, gate.User, "")
+	h.responseAPI(w, gate, store.GateStatus(desired), store.Approval{})
+}
+
+// setGates opens or closes the gates listed in types together and answers the status of each gate. Every gate is
+// validated before any gate is changed, so a rejected request changes none of them. The dependencies of a gate
+// which is opened with them are not required to be opened before. With the ifCurrent query parameter, the gates are
+// changed with compare-and-set, and the changed gates are set back when one of them is not in that state.
+func (h *FlaggerHandler) setGates(r *http.Request, w http.ResponseWriter, gate *CanaryGatePayload, desired bool) {
+	ctx := r.Context()
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	if gate.Manual {
+		badRequest(w, fmt.Errorf("manual rollback cannot be used with types"))
+		return
+	}
+	ifCurrent := r.URL.Query().Get("ifCurrent")
+	if ifCurrent != "" && ifCurrent != store.GATE_OPEN && ifCurrent != store.GATE_CLOSE {
+		badRequest(w, fmt.Errorf("ifCurrent must be %s or %s", store.GATE_OPEN, store.GATE_CLOSE))
+		return
+	}
+	force, err := isForced(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	var ttl time.Duration
+	if desired && gate.TTL != "" {
+		if ifCurrent != "" {
+			badRequest(w, fmt.Errorf("ttl cannot be used with ifCurrent"))
+			return
+		}
+		ttl, err = time.ParseDuration(gate.TTL)
+		if err == nil && ttl <= 0 {
+			err = fmt.Errorf("ttl must be positive")
+		}
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+	}
+	keys := make([]store.StoreKey, len(gate.Types))
+	for i, t := range gate.Types {
+		key := gate.key(t)
+		traceGate(ctx, key)
+		keys[i] = key
+		if !desired {
+			continue
+		}
+		if approval := h.store.GetApproval(ctx, key); approval.Required > 1 {
+			badRequest(w, fmt.Errorf("gate [%s] requires %d approvals and cannot be opened with other gates", key.String(), approval.Required))
+			return
+		}
+		closed, err := h.closedDependencies(ctx, key)
+		if err != nil {
+			log.Error().Msgf("Unable to list gates of %s %v", h.createKey(gate.Namespace, gate.Name), err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		closed = slices.DeleteFunc(closed, func(dep service.HookType) bool { return slices.Contains(gate.Types, dep) })
+		if len(closed) > 0 {
+			reason := dependencyReason(key, closed)
+			log.Info().Msg(reason)
+			writePayload(w, &DependencyConflict{Gate: key.Type, Closed: closed, Reason: reason}, http.StatusConflict)
+			return
+		}
+		if h.inCooldown(ctx, w, key, force) {
+			return
+		}
+	}
+	if ifCurrent != "" {
+		// the conditional change does not record the user
+		gate.User = ""
+	}
+	if dryRun {
+		h.dryRunGates(ctx, w, gate, keys, ifCurrent, desired)
+		return
+	}
+	if ifCurrent != "" {
+		h.compareAndSetGates(ctx, w, gate, keys, store.GateBoolStatus(ifCurrent), desired)
+		return
+	}
+	for _, key := range keys {
+		switch {
+		case !desired:
+			h.store.GateClose(ctx, key, gate.User)
+		case ttl > 0:
+			h.store.OpenGateWithTTL(ctx, key, ttl, gate.User)
+		default:
+			h.store.GateOpen(ctx, key, gate.User)
+		}
+		h.recordChange(ctx, key, desired, gate.User, "")
+	}
+	log.Info().Msgf("Gates %v of [%s] are [%s]", gate.Types, h.createKey(gate.Namespace, gate.Name), store.GateStatus(desired))
+	writePayload(w, h.gatesResponse(gate, keys, func(store.StoreKey) string { return store.GateStatus(desired) }), http.StatusOK)
+}
+
+// compareAndSetGates sets each gate to desired only if it is expected. When a gate is not expected, the gates which
+// are already changed are set back and it answers 409 Conflict with the current state of the gates.
+func (h *FlaggerHandler) compareAndSetGates(ctx context.Context, w http.ResponseWriter, gate *CanaryGatePayload, keys []store.StoreKey, expected, desired bool) {
+	var changed []store.StoreKey
+	for _, key := range keys {
+		swapped, err := h.store.CompareAndSet(ctx, key, expected, desired)
+		if err == nil && swapped {
+			changed = append(changed, key)
+			continue
+		}
+		// the changed gates are set back even when the request is cancelled
+		for _, c := range changed {
+			if _, err := h.store.CompareAndSet(context.WithoutCancel(ctx), c, desired, expected); err != nil {
+				log.Error().Msgf("Unable to set back gate [%s] %v", c.String(), err)
+			}
+		}
+		if err != nil {
+			log.Error().Msgf("Unable to set gate [%s] %v", key.String(), err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		log.Info().Msgf("Gate [%s] is not [%s], the gates are left unchanged", key.String(), store.GateStatus(expected))
+		current := func(k store.StoreKey) string { return store.GateStatus(h.store.IsGateOpen(ctx, k)) }
+		writePayload(w, h.gatesResponse(gate, keys, current), http.StatusConflict)
+		return
+	}
+	for _, key := range keys {
+		h.recordChange(ctx, key, desired, gate.User, "")
+	}
+	writePayload(w, h.gatesResponse(gate, keys, func(store.StoreKey) string { return store.GateStatus(desired) }), http.StatusOK)
+}
+
+// dryRunGates answers with the status which the gates would have after the request, without changing the gates.
+// It answers 404 Not Found when a gate does not exist, and 409 Conflict when a gate is not in the ifCurrent state.
+func (h *FlaggerHandler) dryRunGates(ctx context.Context, w http.ResponseWriter, gate *CanaryGatePayload, keys []store.StoreKey, ifCurrent string, desired bool) {
+	code := http.StatusOK
+	for _, key := range keys {
+		exists, err := h.store.Exists(ctx, key)
+		if err != nil {
+			log.Error().Msgf("Unable to read gate [%s] %v", key.String(), err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			log.Info().Msgf("Gate [%s] is not found", key.String())
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if ifCurrent != "" && h.store.IsGateOpen(ctx, key) != store.GateBoolStatus(ifCurrent) {
+			code = http.StatusConflict
+		}
+	}
+	status := func(store.StoreKey) string { return store.GateStatus(desired) }
+	if code == http.StatusConflict {
+		status = func(k store.StoreKey) string { return store.GateStatus(h.store.IsGateOpen(ctx, k)) }
+	}
+	gateResponseMap := h.gatesResponse(gate, keys, status)
+	for _, statuses := range *gateResponseMap {
+		for i := range statuses {
+			statuses[i].DryRun = true
+		}
+	}
+	writePayload(w, gateResponseMap, code)
+}
+
+// gatesResponse creates the response of the gates with the status of each gate
+func (h *FlaggerHandler) gatesResponse(gate *CanaryGatePayload, keys []store.StoreKey, status func(store.StoreKey) string) *map[string][]CanaryGateStatus {
+	gateResponseMap := make(map[string][]CanaryGateStatus)
+	for _, key := range keys {
+		h.createResponse(gateResponseMap, gate.Namespace, gate.Name, key.Type, status(key), gate.User, store.Approval{})
+	}
+	return &gateResponseMap
+}
+
+// isDryRun reads the dryRun query parameter
+func isDryRun(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("dryRun")
+	if value == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("dryRun must be true or false")
+	}
+	return dryRun, nil
+}
+
+// dryRunGate answers with the status which the gate would have after the request, without changing the gate.
+// It answers 404 Not Found when the gate does not exist, and 409 Conflict when the gate is not in the ifCurrent state.
+func (h *FlaggerHandler) dryRunGate(ctx context.Context, w http.ResponseWriter, gate *CanaryGatePayload, ifCurrent string, desired bool) {
+	key := gate.key(gate.Type)
+	if gate.Namespace == "" || gate.Name == "" || !slices.Contains(store.GateTypes, gate.Type) {
+		badRequest(w, fmt.Errorf("invalid gate [%s]", key.String()))
+		return
+	}
+	exists, err := h.store.Exists(ctx, key)
+	if err != nil {
+		log.Error().Msgf("Unable to read gate [%s] %v", key.String(), err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		log.Info().Msgf("Gate [%s] is not found", key.String())
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	status, code := store.GateStatus(desired), http.StatusOK
+	var approval store.Approval
+	if ifCurrent != "" {
+		if ifCurrent != store.GATE_OPEN && ifCurrent != store.GATE_CLOSE {
+			badRequest(w, fmt.Errorf("ifCurrent must be %s or %s", store.GATE_OPEN, store.GATE_CLOSE))
+			return
+		}
+		// the conditional change does not record the user
+		gate.User = ""
+		if current := h.store.IsGateOpen(ctx, key); current != store.GateBoolStatus(ifCurrent) {
+			status, code = store.GateStatus(current), http.StatusConflict
+		}
+	} else if desired && !gate.Manual {
+		if approval = h.store.GetApproval(ctx, key); approval.Required > 1 {
+			if gate.User == "" {
+				badRequest(w, fmt.Errorf("gate [%s] requires %d approvals, user is required", key.String(), approval.Required))
+				return
+			}
+			if !slices.Contains(approval.Approvers, gate.User) {
+				approval.Approvers = append(approval.Approvers, gate.User)
+			}
+			if !approval.Approved() {
+				status = store.GATE_CLOSE
+			} else {
+				gate.User = approval.ChangedBy()
+			}
+		}
+	}
+	gateResponseMap := make(map[string][]CanaryGateStatus)
+	h.createResponse(gateResponseMap, gate.Namespace, gate.Name, gate.Type, status, gate.User, approval)
+	for _, statuses := range gateResponseMap {
+		for i := range statuses {
+			statuses[i].DryRun = true
+		}
+	}
+	writePayload(w, &gateResponseMap, code)
+}
+
+// closedDependencies returns the dependencies of the gate which are not opened
+func (h *FlaggerHandler) closedDependencies(ctx context.Context, key store.StoreKey) ([]service.HookType, error) {
+	deps := h.store.GetDependencies(ctx, key)
+	if len(deps) == 0 {
+		return nil, nil
+	}
+	gates, err := h.store.List(ctx, key.Namespace, key.Name)
+	if err != nil {
+		return nil, err
+	}
+	var closed []service.HookType
+	for _, dep := range deps {
+		// unknown gates are reported by the controller
+		if opened, ok := gates[dep]; ok && !opened {
+			closed = append(closed, dep)
+		}
+	}
+	return closed, nil
+}
+
+// dependencyReason explains that the gate cannot be opened before the closed dependencies
+func dependencyReason(key store.StoreKey, closed []service.HookType) string {
+	names := make([]string, len(closed))
+	for i, dep := range closed {
+		names[i] = string(dep)
+	}
+	return fmt.Sprintf("Gate [%s] cannot be opened before [%s] are opened", key.String(), strings.Join(names, ", "))
+}
+
+// approveGate records the user as an approver and opens the gate once the required approvals are reached.
+// A positive ttl opens the gate with a TTL.
+func (h *FlaggerHandler) approveGate(ctx context.Context, key store.StoreKey, ttl time.Duration, user string) (store.Approval, error) {
+	approval, err := h.store.Approve(ctx, key, user)
+	if err != nil {
+		return approval, err
+	}
+	if !approval.Approved() {
+		log.Info().Msgf("Gate [%s] is approved by [%s], %d of %d approvals", key.String(), user, len(approval.Approvers), approval.Required)
+		return approval, nil
+	}
+	if ttl > 0 {
+		h.store.OpenGateWithTTL(ctx, key, ttl, approval.ChangedBy())
+	} else {
+		h.store.GateOpen(ctx, key, approval.ChangedBy())
+	}
+	h.recordChange(ctx, key, true, approval.ChangedBy(), "")
+	return approval, nil
+}
+
+// manualRollback opens the rollback gate with the reason of the user and sends the reason to the notifier
+func (h *FlaggerHandler) manualRollback(ctx context.Context, w http.ResponseWriter, gate *CanaryGatePayload, key store.StoreKey, dryRun bool) {
+	gate.Reason = strings.TrimSpace(gate.Reason)
+	if key.Type != service.HookRollback {
+		badRequest(w, fmt.Errorf("manual rollback cannot open gate [%s]", key.String()))
+		return
+	}
+	if gate.Reason == "" {
+		badRequest(w, fmt.Errorf("manual rollback of [%s] requires a reason", h.createKey(gate.Namespace, gate.Name)))
+		return
+	}
+	if approval := h.store.GetApproval(ctx, key); approval.Required > 1 {
+		badRequest(w, fmt.Errorf("gate [%s] requires %d approvals and cannot be rolled back manually", key.String(), approval.Required))
+		return
+	}
+	if dryRun {
+		h.dryRunGate(ctx, w, gate, "", true)
+		return
+	}
+	h.store.RollbackGate(ctx, key, gate.User, gate.Reason)
+	h.recordChange(ctx, key, true, gate.User, gate.Reason)
+	log.Info().Msgf("Canary [%s] is rolled back manually by [%s]: %s", h.createKey(gate.Namespace, gate.Name), gate.User, gate.Reason)
+	if h.noti != nil {
+		text := fmt.Sprintf("Canary [%s] is rolled back manually\nReason: %s", h.createKey(gate.Namespace, gate.Name), gate.Reason)
+		meta := map[string]string{
+			service.MetaName:      gate.Name,
+			service.MetaNamespace: gate.Namespace,
+			service.MetaReason:    gate.Reason,
+		}
+		if gate.User != "" {
+			meta[service.MetaUser] = gate.User
+		}
+		if _, err := h.noti.SendMessages(text, service.HookRollback, meta); err != nil {
+			log.Error().Msgf("Error while sending message %v", err)
+		}
+	}
+	h.responseAPI(w, gate, store.GATE_OPEN, store.Approval{})
+}
+
+// NotifyAutoChange sends a message when a gate is opened or closed automatically by its TTL or its schedule, with
+// the auto metadata, so it is not mistaken for a change by a user. The reason tells what changed the gate, e.g.
+// "after the TTL of 30m0s".
+func (h *FlaggerHandler) NotifyAutoChange(key store.StoreKey, open bool, reason string) {
+	h.audit.Log(AuditEvent{Time: time.Now().UTC(), Action: auditChange, Key: key.String(), Status: store.GateStatus(open), Reason: "auto-" + store.GateStatus(open) + " " + reason})
+	if h.noti == nil {
+		return
+	}
+	status := store.GateStatus(open)
+	text := fmt.Sprintf("Gate [%s] is auto-%s %s", key.String(), status, reason)
+	meta := map[string]string{
+		service.MetaName:      key.Name,
+		service.MetaNamespace: key.Namespace,
+		service.MetaGateState: status,
+		service.MetaAuto:      "true",
+	}
+	if _, err := h.noti.SendMessages(text, key.Type, meta); err != nil {
+		log.Error().Msgf("Error while sending message %v", err)
+	}
+}
+
+// consumeGate closes the gate after its webhook has used the approval, when the gate requires an approval for each use.
+// The webhook is still approved when the gate cannot be closed.
+func (h *FlaggerHandler) consumeGate(ctx context.Context, key store.StoreKey) {
+	consumed, err := h.store.ConsumeGate(ctx, key)
+	if err != nil {
+		requestLog(ctx).Error().Msgf("Unable to close gate [%s] after its approval was used %v", key.String(), err)
+		return
+	}
+	if consumed {
+		h.recordClosedAt(ctx, key, false)
+		h.NotifyAutoChange(key, false, "after its approval was used")
+	}
+}
+
+// recordClosedAt records the state of the gate in the canary_gate_closed_seconds metric. The time when the gate was
+// closed is read from the store, so the elapsed time is kept across restarts.
+func (h *FlaggerHandler) recordClosedAt(ctx context.Context, key store.StoreKey, open bool) {
+	var closedAt time.Time
+	if !open {
+		closedAt = h.store.GetClosedAt(ctx, key)
+	}
+	gateClosedSeconds.set(key, open, closedAt)
+}
+
+func (h *FlaggerHandler) createGateHandler(hookType service.HookType) http.Handler {
+	return traced("/"+string(hookType), func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		if canary, err := readPayload(r, w, CanaryWebhookPayload{}); err == nil && validPayload(w, canary) {
+			h.logEvent(r.Context(), hookType, canary)
+			h.responseWebhook(w, r, canary, hookType)
 		}
 	})
 }
@@ -224,38 +978,114 @@ func (h *FlaggerHandler) createKey(namespace string, name string) string {
 	return fmt.Sprintf("%s/%s", namespace, name)
 }
 
-func (h *FlaggerHandler) createResponse(result map[string][]CanaryGateStatus, namespace string, name string, t service.HookType, status string) {
+func (h *FlaggerHandler) createResponse(result map[string][]CanaryGateStatus, namespace string, name string, t service.HookType, status string, changedBy string, approval store.Approval) {
 	key := h.createKey(namespace, name)
 	gateStatus := CanaryGateStatus{
 		Type:      t,
 		Name:      name,
 		Namespace: namespace,
 		Status:    status,
+		ChangedBy: changedBy,
+	}
+	if approval.Required > 1 {
+		gateStatus.Approvals = len(approval.Approvers)
+		gateStatus.RequiredApprovals = approval.Required
 	}
 	result[key] = append(result[key], gateStatus)
 }
 
-func (h *FlaggerHandler) responseAPI(w http.ResponseWriter, gate *CanaryGatePayload, status string) {
+func (h *FlaggerHandler) responseAPI(w http.ResponseWriter, gate *CanaryGatePayload, status string, approval store.Approval) {
 	gateResponseMap := make(map[string][]CanaryGateStatus)
-	h.createResponse(gateResponseMap, gate.Namespace, gate.Name, gate.Type, status)
+	h.createResponse(gateResponseMap, gate.Namespace, gate.Name, gate.Type, status, gate.User, approval)
 	writePayload(w, &gateResponseMap, http.StatusOK)
 }
 
-func (h *FlaggerHandler) responseWebhook(w http.ResponseWriter, canary *CanaryWebhookPayload, hookType service.HookType) {
-	approved := h.store.IsGateOpen(store.StoreKey{Namespace: canary.Namespace, Name: canary.Name, Type: hookType})
+// responseWebhook answers with the status code, which Flagger uses as the decision, and the decision as JSON in the body.
+// Requests which accept JSON, e.g. the web metrics of Argo Rollouts, always get 200 and read the decision from the body.
+// The format=text query parameter answers with the plain text body of the previous versions.
+// A store which cannot be read is answered with 503, so Flagger retries the webhook instead of deciding on the default
+// state of the gate.
+func (h *FlaggerHandler) responseWebhook(w http.ResponseWriter, r *http.Request, canary *CanaryWebhookPayload, hookType service.HookType) {
+	key := gateKey(canary, hookType)
+	approved, err := h.store.GateState(r.Context(), key)
+	if err != nil {
+		canaryFields(requestLog(r.Context()).Error(), canary, hookType).Err(err).Msgf("%s:%s of [%s] is not answered, the store is unavailable", canary.Namespace, canary.Name, hookType)
+		w.Header().Set("Retry-After", syncRetryAfter)
+		http.Error(w, "store is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	recordDecision(key, approved)
+	traceDecision(r.Context(), key, approved)
+	h.store.SetDecision(r.Context(), key, store.Decision{Approved: approved, Time: time.Now()})
+	// the gates changed by the controller or before a restart are seen through the webhooks
+	if gateClosedSeconds.changed(key, approved) {
+		h.recordClosedAt(r.Context(), key, approved)
+	}
+	// the reason is read before the gate is closed by the approval which is used
+	reason := h.decisionReason(r.Context(), key, approved)
+	h.audit.Log(AuditEvent{
+		Time:      time.Now().UTC(),
+		Action:    auditDecision,
+		Key:       key.String(),
+		Decision:  store.Decision{Approved: approved}.String(),
+		Reason:    reason,
+		RequestID: requestID(r.Context()),
+	})
+	if approved {
+		h.consumeGate(r.Context(), key)
+	}
+	logger := requestLog(r.Context())
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		canaryFields(logger.Info(), canary, hookType).Bool("approved", approved).Msgf("%s:%s of [%s] is answered with approved=%t", canary.Namespace, canary.Name, hookType, approved)
+		writePayload(w, &WebhookDecision{Approved: approved, Gate: hookType, Reason: reason}, http.StatusOK)
+		return
+	}
+	status, text := http.StatusForbidden, "Forbidden"
 	if approved {
-		log.Info().Msgf("%s:%s of [%s] is approved", canary.Namespace, canary.Name, hookType)
-		writeBytes(w, []byte("Approved"), http.StatusOK)
+		status, text = http.StatusOK, "Approved"
+		canaryFields(logger.Info(), canary, hookType).Bool("approved", approved).Msgf("%s:%s of [%s] is approved", canary.Namespace, canary.Name, hookType)
 	} else {
-		log.Info().Msgf("%s:%s of [%s] is rejected", canary.Namespace, canary.Name, hookType)
-		writeBytes(w, []byte("Forbidden"), http.StatusForbidden)
+		canaryFields(logger.Info(), canary, hookType).Bool("approved", approved).Msgf("%s:%s of [%s] is rejected", canary.Namespace, canary.Name, hookType)
+	}
+	if r.URL.Query().Get("format") == "text" {
+		writeBytes(w, []byte(text), status)
+		return
+	}
+	writePayload(w, &WebhookDecision{Approved: approved, Gate: hookType, Reason: reason}, status)
+}
+
+// decisionReason explains the decision with the freeze of the gates, or the last change of the gate in the history
+func (h *FlaggerHandler) decisionReason(ctx context.Context, key store.StoreKey, approved bool) string {
+	if !approved && slices.Contains(store.FreezeGates, key.Type) {
+		if freeze := h.currentFreeze(ctx); freeze.Frozen {
+			return freezeReason(freeze)
+		}
+	}
+	status := store.GateStatus(approved)
+	history := h.store.GetHistory(ctx, key)
+	for i := len(history) - 1; i >= 0; i-- {
+		entry := history[i]
+		if entry.Type != key.Type {
+			continue
+		}
+		if entry.Status != status {
+			// the last change has expired
+			break
+		}
+		if entry.User == "" {
+			return fmt.Sprintf("gate %s at %s", status, entry.Time.Format(time.RFC3339))
+		}
+		return fmt.Sprintf("gate %s by user %s at %s", status, entry.User, entry.Time.Format(time.RFC3339))
 	}
+	return fmt.Sprintf("gate %s by default", status)
 }
 
-func (h *FlaggerHandler) logEvent(hook service.HookType, canary *CanaryWebhookPayload) {
+// logEvent logs the webhook request. When the phase of the canary changes, it updates the sent messages and notifies the new phase.
+// The log line carries the request ID of the context and the canary as fields.
+func (h *FlaggerHandler) logEvent(ctx context.Context, hook service.HookType, canary *CanaryWebhookPayload) {
 	var metadataBuilder strings.Builder
 	for k, v := range canary.Metadata {
-		if k != FLAGGER_METADATA_EVENT_MESSAGE {
+		if k != FLAGGER_METADATA_EVENT_MESSAGE && k != service.MetaGateSecret {
 			if metadataBuilder.Len() > 0 {
 				metadataBuilder.WriteString(", ")
 			}
@@ -267,21 +1097,92 @@ func (h *FlaggerHandler) logEvent(hook service.HookType, canary *CanaryWebhookPa
 	if strings.Contains(message, "Promotion completed!") {
 		canary.Phase = service.PhaseSucceeded
 	}
-	log.Info().Msgf("Received [%s][phase=%s][id=%s] %s %s meta=[%s]", hook, canary.Phase, canary.Checksum, h.createWebhookKey(canary), message, metadataBuilder.String())
-	if h.store != nil {
-		stor, ok := h.store.(*store.CanaryGateStore)
-		if ok {
-			stor.UpdateEvent(context.Background(), store.StoreKey{Namespace: canary.Namespace, Name: canary.Name}, string(canary.Phase), message)
+	event := requestLog(ctx).Info()
+	if h.events != nil {
+		// the suppressed repeats are still logged in debug mode
+		if logged, suppressed := h.events.sample(canary, hook); !logged {
+			event = requestLog(ctx).Debug()
+		} else if suppressed > 0 {
+			event = event.Int("suppressed", suppressed)
 		}
 	}
+	canaryFields(event, canary, hook).
+		Str("meta", metadataBuilder.String()).
+		Msgf("Received [%s] %s %s", hook, h.createWebhookKey(canary), message)
+	if h.store != nil {
+		h.store.UpdateEvent(context.Background(), gateKey(canary, ""), string(canary.Phase), message)
+	}
+	if canary.Phase != "" {
+		canaryPhases.observe(gateKey(canary, ""), canary.Phase)
+	}
+	// Flagger sends the phase on every analysis interval, so only the changes are notified
+	if h.store == nil || canary.Phase == "" {
+		return
+	}
+	if last := h.store.UpdatePhase(context.Background(), gateKey(canary, ""), string(canary.Phase)); last == string(canary.Phase) {
+		return
+	}
+	// Flagger rolls the canary back when it fails
+	if canary.Phase == service.PhaseFailed {
+		h.recordRollback(context.Background(), canary)
+	}
+	h.updateMessages(canary, message)
+	h.notifyPhase(canary, message)
+}
+
+// notifiedPhases lists the phases which are notified when the canary enters them
+var notifiedPhases = []service.Phase{
+	service.PhaseProgressing,
+	service.PhasePromoting,
+	service.PhaseFailed,
+	service.PhaseSucceeded,
 }
 
-func createMeta(canary CanaryWebhookPayload) map[string]string {
+// notifyPhase sends a message when the canary enters a notified phase
+func (h *FlaggerHandler) notifyPhase(canary *CanaryWebhookPayload, message string) {
+	if h.noti == nil || !slices.Contains(notifiedPhases, canary.Phase) {
+		return
+	}
+	text := fmt.Sprintf("Canary [%s] is %s", h.createWebhookKey(canary), canary.Phase)
+	if message != "" {
+		text = fmt.Sprintf("%s: %s", text, message)
+	}
+	if _, err := h.noti.SendMessages(text, service.HookEvent, h.createMeta(*canary)); err != nil {
+		log.Error().Msgf("Error while sending message %v", err)
+	}
+}
+
+// updateMessages updates the notification messages of the canary when its phase changes
+func (h *FlaggerHandler) updateMessages(canary *CanaryWebhookPayload, message string) {
+	if h.noti == nil {
+		return
+	}
+	key := gateKey(canary, "")
+	messages := h.store.GetMessages(context.Background(), key)
+	if len(messages) == 0 {
+		return
+	}
+	text := fmt.Sprintf("Canary [%s] is %s", h.createWebhookKey(canary), canary.Phase)
+	if err := h.noti.UpdateMessages(messages, text, message); err != nil {
+		log.Error().Msgf("Error while updating message %v", err)
+	}
+}
+
+// createMeta returns the metadata of the notification of the canary, which has the Flagger metadata in the allow-list.
+func (h *FlaggerHandler) createMeta(canary CanaryWebhookPayload) map[string]string {
 	m := map[string]string{
 		"name":      canary.Name,
 		"namespace": canary.Namespace,
 	}
-	maps.Copy(m, canary.Metadata)
+	if canary.Phase != "" {
+		m[service.MetaPhase] = string(canary.Phase)
+	}
+	for k, v := range canary.Metadata {
+		if h.metadata == nil || h.metadata[k] {
+			m[k] = v
+		}
+	}
+	delete(m, service.MetaGateSecret)
 	return m
 }
 
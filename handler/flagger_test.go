@@ -17,11 +17,14 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
@@ -32,6 +35,8 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/require"
 	"github.com/urfave/cli/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	dfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
@@ -43,6 +48,7 @@ const (
 	rolloutPath                = "/rollout"
 	confirmTrafficIncreasePath = "/confirm-traffic-increase"
 	confirmPromotionPath       = "/confirm-promotion"
+	confirmFinalizePath        = "/confirm-finalize"
 	postRolloutPath            = "/post-rollout"
 	rollbackPath               = "/rollback"
 	eventPath                  = "/event"
@@ -65,13 +71,19 @@ func buildGatePayload(t service.HookType) []byte {
 	return buildPayload(payload)
 }
 
-func buildResponsePayloadStatus(t *testing.T, key store.StoreKey, status string, payload map[string][]CanaryGateStatus) []byte {
+func buildResponsePayloadStatus(t *testing.T, key store.StoreKey, status string, payload map[string][]CanaryGateStatus, decision store.Decision) []byte {
 	for k := range payload {
-		payload[k] = append(payload[k], CanaryGateStatus{
+		gates := slices.Clone(payload[k])
+		// the last answer of the webhook of the gate
+		gates[0].LastDecision = decision.String()
+		gates[0].LastDecisionAt = decision.Time.UTC().Format(time.RFC3339)
+		payload[k] = append(gates, CanaryGateStatus{
 			Type:      service.HookEvent,
 			Namespace: key.Namespace,
 			Name:      key.Name,
 			Status:    fmt.Sprintf("Gate [%s] is set to [%s]", key.String(), status),
+			// the phase of the webhook which was sent before
+			Phase: service.PhasePromoting,
 		})
 	}
 	r, err := json.Marshal(payload)
@@ -197,6 +209,9 @@ func testGate(t *testing.T, gateName string, storeName string) {
 	case confirmPromotionPath:
 		handlerFunc = handler.ConfirmPromotion()
 		sKey.Type = service.HookConfirmPromotion
+	case confirmFinalizePath:
+		handlerFunc = handler.ConfirmFinalize()
+		sKey.Type = service.HookConfirmFinalize
 	case postRolloutPath:
 		handlerFunc = handler.PostRollout()
 		sKey.Type = service.HookPostRollout
@@ -220,10 +235,12 @@ func testGate(t *testing.T, gateName string, storeName string) {
 	flaggerPayload, gatePayload, gateOpenResponse, gateCloseResponse = createTestCase(sKey.Type, webhookPayload)
 	httpTest(t, handlerFunc, gateName, flaggerPayload, expectedStatus[0], nil)
 	httpTest(t, handler.CloseGate(), "/close", gatePayload, http.StatusOK, buildResponsePayload(t, gateCloseResponse))
-	httpTest(t, handler.StatusGate(), "/status", gatePayload, http.StatusOK, buildResponsePayloadStatus(t, sKey, store.GATE_CLOSE, gateCloseResponse))
+	approved := store.Decision{Approved: true, Time: storage.GetDecision(t.Context(), sKey).Time}
+	httpTest(t, handler.StatusGate(), "/status", gatePayload, http.StatusOK, buildResponsePayloadStatus(t, sKey, store.GATE_CLOSE, gateCloseResponse, approved))
 	httpTest(t, handlerFunc, gateName, flaggerPayload, expectedStatus[1], nil)
 	httpTest(t, handler.OpenGate(), "/open", gatePayload, http.StatusOK, buildResponsePayload(t, gateOpenResponse))
-	httpTest(t, handler.StatusGate(), "/status", gatePayload, http.StatusOK, buildResponsePayloadStatus(t, sKey, store.GATE_OPEN, gateOpenResponse))
+	rejected := store.Decision{Approved: false, Time: storage.GetDecision(t.Context(), sKey).Time}
+	httpTest(t, handler.StatusGate(), "/status", gatePayload, http.StatusOK, buildResponsePayloadStatus(t, sKey, store.GATE_OPEN, gateOpenResponse, rejected))
 	httpTest(t, handlerFunc, gateName, flaggerPayload, expectedStatus[2], nil)
 }
 
@@ -263,6 +280,12 @@ func TestConfirmPromotionHandler(t *testing.T) {
 	testGate(t, confirmPromotionPath, "canarygate")
 }
 
+func TestConfirmFinalizeHandler(t *testing.T) {
+	testGate(t, confirmFinalizePath, "memory")
+	testGate(t, confirmFinalizePath, "configmap")
+	testGate(t, confirmFinalizePath, "canarygate")
+}
+
 func TestPostRolloutHandler(t *testing.T) {
 	testGate(t, postRolloutPath, "memory")
 	testGate(t, postRolloutPath, "configmap")
@@ -275,9 +298,715 @@ func TestPostEventHandler(t *testing.T) {
 	testGate(t, eventPath, "canarygate")
 }
 
+func TestGateKey(t *testing.T) {
+	canary := &CanaryWebhookPayload{Name: "demo-a", Namespace: "target-ns"}
+	require.Equal(t, store.StoreKey{Namespace: "target-ns", Name: "demo-a", Type: service.HookRollout}, gateKey(canary, service.HookRollout))
+	canary.Metadata = map[string]string{service.MetaGateName: "demo", service.MetaGateNamespace: "gate-ns"}
+	require.Equal(t, store.StoreKey{Namespace: "gate-ns", Name: "demo", Type: service.HookRollout}, gateKey(canary, service.HookRollout))
+}
+
+func TestHistoryHandler(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	storage.GateClose(t.Context(), key, "alice")
+	storage.GateOpen(t.Context(), key, "bob")
+	storage.GateOpen(t.Context(), store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback}, "")
+
+	history := func(payload *CanaryGatePayload) []store.HistoryEntry {
+		req := httptest.NewRequest(http.MethodPost, "/history", bytes.NewBuffer(buildPayload(payload)))
+		w := httptest.NewRecorder()
+		handler.History().ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var entries []store.HistoryEntry
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+		return entries
+	}
+	entries := history(&CanaryGatePayload{Type: service.HookAll, Namespace: "canary-ns", Name: "test-canary"})
+	require.Len(t, entries, 3)
+	require.Equal(t, "alice", entries[0].User)
+	require.Equal(t, store.GATE_CLOSE, entries[0].Status)
+	require.Equal(t, service.HookRollback, entries[2].Type)
+
+	// filter by gate and limit to the last changes
+	entries = history(&CanaryGatePayload{Type: service.HookConfirmPromotion, Namespace: "canary-ns", Name: "test-canary", Limit: 1})
+	require.Len(t, entries, 1)
+	require.Equal(t, "bob", entries[0].User)
+	require.Equal(t, store.GATE_OPEN, entries[0].Status)
+
+	// an invalid payload is rejected
+	httpTest(t, handler.History(), "/history", buildPayload(&CanaryGatePayload{Type: "promote", Namespace: "canary-ns", Name: "test-canary"}), http.StatusBadRequest, nil)
+	httpTest(t, handler.History(), "/history", buildPayload(&CanaryGatePayload{Type: service.HookAll, Namespace: "canary-ns"}), http.StatusBadRequest, nil)
+}
+
+func TestWebhookDecisionJSON(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: service.PhaseWaitingPromotion})
+
+	decision := func() WebhookDecision {
+		req := httptest.NewRequest(http.MethodPost, confirmPromotionPath, bytes.NewBuffer(payload))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ConfirmPromotion().ServeHTTP(w, req)
+		// a closed gate is not an error for the web metrics of Argo Rollouts
+		require.Equal(t, http.StatusOK, w.Code)
+		var result WebhookDecision
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result
+	}
+	storage.GateClose(t.Context(), key, "")
+	require.False(t, decision().Approved)
+	storage.GateOpen(t.Context(), key, "")
+	require.True(t, decision().Approved)
+}
+
+func TestWebhookDecisionFormats(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: service.PhaseWaitingPromotion})
+
+	request := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ConfirmPromotion().ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(payload)))
+		return w
+	}
+	decision := func(w *httptest.ResponseRecorder) WebhookDecision {
+		var result WebhookDecision
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result
+	}
+
+	// the default state is explained as default
+	w := request(confirmPromotionPath)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, WebhookDecision{Approved: true, Gate: service.HookConfirmPromotion, Reason: "gate opened by default"}, decision(w))
+
+	storage.GateClose(t.Context(), key, "alice")
+	w = request(confirmPromotionPath)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	result := decision(w)
+	require.False(t, result.Approved)
+	require.Equal(t, service.HookConfirmPromotion, result.Gate)
+	require.Contains(t, result.Reason, "gate closed by user alice at ")
+
+	// the plain text body of the previous versions
+	w = request(confirmPromotionPath + "?format=text")
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Equal(t, "Forbidden", w.Body.String())
+	storage.GateOpen(t.Context(), key, "")
+	w = request(confirmPromotionPath + "?format=text")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "Approved", w.Body.String())
+	w = request(confirmPromotionPath)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, decision(w).Reason, "gate opened at ")
+}
+
+func TestGateIfCurrent(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	payload := buildPayload(&CanaryGatePayload{Type: key.Type, Namespace: key.Namespace, Name: key.Name})
+
+	request := func(h http.Handler, path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(payload)))
+		return w.Code
+	}
+	require.Equal(t, http.StatusBadRequest, request(handler.CloseGate(), "/close?ifCurrent=maybe"))
+	// the gate is opened by default, so it is not opened again
+	require.Equal(t, http.StatusConflict, request(handler.OpenGate(), "/open?ifCurrent=closed"))
+	require.Equal(t, http.StatusOK, request(handler.CloseGate(), "/close?ifCurrent=opened"))
+	require.False(t, storage.IsGateOpen(context.TODO(), key))
+	require.Equal(t, http.StatusConflict, request(handler.CloseGate(), "/close?ifCurrent=opened"))
+	require.Equal(t, http.StatusOK, request(handler.OpenGate(), "/open?ifCurrent=closed"))
+	require.True(t, storage.IsGateOpen(context.TODO(), key))
+}
+
+func TestEventNotification(t *testing.T) {
+	var received []noti.PagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event noti.PagerDutyEvent
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received = append(received, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewPagerDutyClient(noti.PagerDutyOption{RoutingKey: "key", URL: server.URL}), storage)
+
+	event := func(phase service.Phase, message string) {
+		payload := &CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: phase, Metadata: map[string]string{FLAGGER_METADATA_EVENT_MESSAGE: message}}
+		httpTest(t, handler.Event(), eventPath, buildPayload(payload), http.StatusOK, nil)
+	}
+	event(service.PhaseProgressing, "Advance test-canary.canary-ns canary weight 10")
+	event(service.PhaseFailed, "Canary failed! Scaling down test-canary.canary-ns")
+	// the same phase is sent once
+	event(service.PhaseFailed, "Rolling back test-canary.canary-ns failed checks threshold reached 2")
+	require.Len(t, received, 1)
+	require.Equal(t, "trigger", received[0].EventAction)
+	require.Equal(t, "canary-ns/test-canary", received[0].DedupKey)
+
+	event(service.PhaseProgressing, "New revision detected! Scaling up test-canary.canary-ns")
+	event(service.PhaseProgressing, "Promotion completed! Scaling down test-canary.canary-ns")
+	require.Len(t, received, 2)
+	require.Equal(t, "resolve", received[1].EventAction)
+}
+
+func TestEventMessageTracingStore(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	// the store is wrapped when tracing is enabled
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), store.NewTracingStore(storage))
+	payload := &CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: service.PhaseProgressing, Metadata: map[string]string{FLAGGER_METADATA_EVENT_MESSAGE: "Advance test-canary.canary-ns canary weight 10"}}
+	httpTest(t, handler.Event(), eventPath, buildPayload(payload), http.StatusOK, nil)
+	require.Equal(t, "Advance test-canary.canary-ns canary weight 10", storage.GetLastEvent(context.TODO(), store.StoreKey{Namespace: "canary-ns", Name: "test-canary"}))
+}
+
+// countingNoti records the phases of the sent messages
+type countingNoti struct {
+	noti.QuietNoti
+	phases []string
+}
+
+func (c *countingNoti) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
+	c.phases = append(c.phases, meta[service.MetaPhase])
+	return map[string]string{}, nil
+}
+
+func TestEventPhaseTransitions(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	counter := &countingNoti{}
+	handler := NewHandler(&cli.Command{}, counter, storage)
+	event := func(phase service.Phase) {
+		payload := &CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: phase}
+		httpTest(t, handler.Event(), eventPath, buildPayload(payload), http.StatusOK, nil)
+	}
+	for _, phase := range []service.Phase{
+		service.PhaseInitialized,
+		service.PhaseProgressing, service.PhaseProgressing, service.PhaseProgressing,
+		service.PhaseWaitingPromotion,
+		service.PhasePromoting, service.PhasePromoting,
+		service.PhaseFinalising,
+		service.PhaseSucceeded, service.PhaseSucceeded,
+	} {
+		event(phase)
+	}
+	// one message per transition into a notified phase
+	require.Equal(t, []string{"Progressing", "Promoting", "Succeeded"}, counter.phases)
+
+	// the quiet notifier keeps the events silent
+	quiet := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	payload := &CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: service.PhaseFailed}
+	httpTest(t, quiet.Event(), eventPath, buildPayload(payload), http.StatusOK, nil)
+	require.Len(t, counter.phases, 3)
+}
+
 // mux.Handle("/event", handler.Event())
 // mux.Handle("/open", handler.OpenGate())
 // mux.Handle("/close", handler.CloseGate())
 // mux.Handle("/status", handler.StatusGate())
 // mux.Handle("/metrics", promhttp.Handler())
 // mux.Handle("/version", serverHandler.Version())
+
+func TestOpenGateApprovals(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, piggysecv1alpha1.AddToScheme(scheme))
+	f := dfake.NewSimpleDynamicClient(scheme)
+	_, err := f.Resource(store.GroupVersionResource).Namespace("canary-ns").Create(context.TODO(), &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": piggysecv1alpha1.GroupVersion.String(),
+		"kind":       "CanaryGate",
+		"metadata":   map[string]any{"name": "test-canary", "namespace": "canary-ns"},
+		"spec":       map[string]any{"approvals": map[string]any{string(service.HookConfirmPromotion): int64(2)}},
+	}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	storage, err := store.NewCanaryGateStore(f)
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+
+	request := func(h http.Handler, user string) CanaryGateStatus {
+		payload := buildPayload(&CanaryGatePayload{Type: key.Type, Namespace: key.Namespace, Name: key.Name, User: user})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/open", bytes.NewBuffer(payload)))
+		require.Equal(t, http.StatusOK, w.Code)
+		var result map[string][]CanaryGateStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		require.NotEmpty(t, result["canary-ns/test-canary"])
+		return result["canary-ns/test-canary"][0]
+	}
+	status := request(handler.OpenGate(), "alice")
+	require.Equal(t, store.GATE_CLOSE, status.Status)
+	require.Equal(t, 1, status.Approvals)
+	require.Equal(t, 2, status.RequiredApprovals)
+	require.False(t, storage.IsGateOpen(context.TODO(), key))
+
+	status = request(handler.StatusGate(), "")
+	require.Equal(t, store.GATE_CLOSE, status.Status)
+	require.Equal(t, 1, status.Approvals)
+	require.Equal(t, 2, status.RequiredApprovals)
+
+	status = request(handler.OpenGate(), "bob")
+	require.Equal(t, store.GATE_OPEN, status.Status)
+	require.Equal(t, "alice, bob", status.ChangedBy)
+	require.True(t, storage.IsGateOpen(context.TODO(), key))
+}
+
+func TestWebhookRequireApproval(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, piggysecv1alpha1.AddToScheme(scheme))
+	f := dfake.NewSimpleDynamicClient(scheme)
+	_, err := f.Resource(store.GroupVersionResource).Namespace("canary-ns").Create(context.TODO(), &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": piggysecv1alpha1.GroupVersion.String(),
+		"kind":       "CanaryGate",
+		"metadata":   map[string]any{"name": "test-canary", "namespace": "canary-ns"},
+		"spec":       map[string]any{"requireApproval": []any{string(service.HookConfirmPromotion)}},
+	}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	storage, err := store.NewCanaryGateStore(f)
+	require.NoError(t, err)
+	messages := &messageNoti{}
+	handler := NewHandler(&cli.Command{}, messages, storage)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: service.PhaseWaitingPromotion})
+
+	request := func() (int, WebhookDecision) {
+		w := httptest.NewRecorder()
+		handler.ConfirmPromotion().ServeHTTP(w, httptest.NewRequest(http.MethodPost, confirmPromotionPath, bytes.NewBuffer(payload)))
+		var result WebhookDecision
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return w.Code, result
+	}
+	// the gate is closed until it is approved
+	code, _ := request()
+	require.Equal(t, http.StatusForbidden, code)
+
+	// the approval is used by a single webhook, and the gate is closed again
+	storage.GateOpen(t.Context(), key, "alice")
+	code, decision := request()
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, decision.Reason, "by user alice")
+	require.False(t, storage.IsGateOpen(context.TODO(), key))
+	require.Equal(t, []string{"Gate [canary-ns/test-canary=confirm-promotion] is auto-closed after its approval was used"}, messages.texts)
+	require.Equal(t, "true", messages.metas[0][service.MetaAuto])
+	code, _ = request()
+	require.Equal(t, http.StatusForbidden, code)
+}
+
+// unavailableStore fails to read the gates, like a store whose backend is down
+type unavailableStore struct {
+	store.Store
+}
+
+func (s *unavailableStore) GateState(ctx context.Context, key store.StoreKey) (bool, error) {
+	return s.Store.IsGateOpen(ctx, key), &store.UnavailableError{Key: key, Err: errors.New("connection refused")}
+}
+
+func TestWebhookStoreUnavailable(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: service.PhaseWaitingPromotion})
+	request := func(handler FlaggerHandler) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ConfirmPromotion().ServeHTTP(w, httptest.NewRequest(http.MethodPost, confirmPromotionPath, bytes.NewBuffer(payload)))
+		return w
+	}
+
+	// a closed gate is rejected
+	storage.GateClose(t.Context(), key, "")
+	require.Equal(t, http.StatusForbidden, request(NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)).Code)
+
+	// a store which is down is retried by Flagger, and the gate is not approved by its default state
+	storage.GateReset(t.Context(), key, "")
+	rejected := storage.GetDecision(t.Context(), key)
+	w := request(NewHandler(&cli.Command{}, noti.NewQuietNoti(), &unavailableStore{Store: storage}))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, syncRetryAfter, w.Header().Get("Retry-After"))
+	require.Equal(t, "store is unavailable\n", w.Body.String())
+	require.Equal(t, rejected, storage.GetDecision(t.Context(), key))
+}
+
+func TestWebhookLastDecision(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	webhook := func() {
+		payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: service.PhaseWaitingPromotion})
+		handler.ConfirmPromotion().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, confirmPromotionPath, bytes.NewBuffer(payload)))
+	}
+	status := func() CanaryGateStatus {
+		payload := buildPayload(&CanaryGatePayload{Type: service.HookConfirmPromotion, Namespace: "canary-ns", Name: "test-canary"})
+		w := httptest.NewRecorder()
+		handler.StatusGate().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/status", bytes.NewBuffer(payload)))
+		var result map[string][]CanaryGateStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result["canary-ns/test-canary"][0]
+	}
+	// no webhook is answered yet
+	require.Empty(t, status().LastDecision)
+
+	storage.GateClose(t.Context(), key, "")
+	webhook()
+	require.False(t, storage.GetDecision(t.Context(), key).Approved)
+	gate := status()
+	require.Equal(t, store.DecisionRejected, gate.LastDecision)
+	_, err = time.Parse(time.RFC3339, gate.LastDecisionAt)
+	require.NoError(t, err)
+
+	storage.GateOpen(t.Context(), key, "alice")
+	webhook()
+	require.Equal(t, store.DecisionApproved, status().LastDecision)
+}
+
+func TestOpenGateDependencies(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	rollout := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmRollout}
+	promotion := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	storage.GateClose(t.Context(), rollout, "")
+	storage.GateClose(t.Context(), promotion, "")
+
+	request := func(key store.StoreKey) *httptest.ResponseRecorder {
+		payload := buildPayload(&CanaryGatePayload{Type: key.Type, Namespace: key.Namespace, Name: key.Name})
+		w := httptest.NewRecorder()
+		handler.OpenGate().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/open", bytes.NewBuffer(payload)))
+		return w
+	}
+	w := request(promotion)
+	require.Equal(t, http.StatusConflict, w.Code)
+	var conflict DependencyConflict
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &conflict))
+	require.Equal(t, service.HookConfirmPromotion, conflict.Gate)
+	require.Equal(t, []service.HookType{service.HookConfirmRollout}, conflict.Closed)
+	require.Contains(t, conflict.Reason, "cannot be opened before [confirm-rollout]")
+	require.False(t, storage.IsGateOpen(context.TODO(), promotion))
+
+	require.Equal(t, http.StatusOK, request(rollout).Code)
+	require.Equal(t, http.StatusOK, request(promotion).Code)
+	require.True(t, storage.IsGateOpen(context.TODO(), promotion))
+}
+
+// messageNoti records the text and the metadata of the sent messages
+type messageNoti struct {
+	noti.QuietNoti
+	texts []string
+	metas []map[string]string
+}
+
+func (m *messageNoti) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
+	m.texts = append(m.texts, text)
+	m.metas = append(m.metas, meta)
+	return map[string]string{}, nil
+}
+
+func TestManualRollback(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	messages := &messageNoti{}
+	handler := NewHandler(&cli.Command{}, messages, storage)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback}
+
+	request := func(gate CanaryGatePayload) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.OpenGate().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/open", bytes.NewBuffer(buildPayload(&gate))))
+		return w
+	}
+	// a manual rollback requires a reason and the rollback gate
+	require.Equal(t, http.StatusBadRequest, request(CanaryGatePayload{Type: key.Type, Namespace: key.Namespace, Name: key.Name, Manual: true, Reason: "  "}).Code)
+	require.Equal(t, http.StatusBadRequest, request(CanaryGatePayload{Type: service.HookConfirmPromotion, Namespace: key.Namespace, Name: key.Name, Manual: true, Reason: "broken"}).Code)
+	require.False(t, storage.IsGateOpen(context.TODO(), key))
+	require.Empty(t, messages.texts)
+
+	w := request(CanaryGatePayload{Type: key.Type, Namespace: key.Namespace, Name: key.Name, User: "alice", Manual: true, Reason: "error rate is increasing"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, storage.IsGateOpen(context.TODO(), key))
+
+	entries := storage.GetHistory(context.TODO(), key)
+	require.Len(t, entries, 1)
+	require.Equal(t, "alice", entries[0].User)
+	require.Equal(t, "error rate is increasing", entries[0].Reason)
+	require.Contains(t, storage.GetLastEvent(context.TODO(), key), "error rate is increasing")
+
+	require.Len(t, messages.texts, 1)
+	require.Contains(t, messages.texts[0], "Reason: error rate is increasing")
+	require.Equal(t, "error rate is increasing", messages.metas[0][service.MetaReason])
+	require.Equal(t, "alice", messages.metas[0][service.MetaUser])
+}
+
+func TestNotifyAutoChange(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	messages := &messageNoti{}
+	handler := NewHandler(&cli.Command{}, messages, storage)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+
+	// a manual close is not an automatic change
+	gate := CanaryGatePayload{Type: key.Type, Namespace: key.Namespace, Name: key.Name, User: "alice"}
+	w := httptest.NewRecorder()
+	handler.CloseGate().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/close", bytes.NewBuffer(buildPayload(&gate))))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, messages.texts)
+
+	handler.NotifyAutoChange(key, false, "after its TTL of 30m0s")
+	require.Equal(t, []string{"Gate [canary-ns/test-canary=confirm-promotion] is auto-closed after its TTL of 30m0s"}, messages.texts)
+	require.Equal(t, map[string]string{
+		service.MetaName:      "test-canary",
+		service.MetaNamespace: "canary-ns",
+		service.MetaGateState: store.GATE_CLOSE,
+		service.MetaAuto:      "true",
+	}, messages.metas[0])
+}
+
+func TestAllowMetadata(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	messages := &messageNoti{}
+	handler := NewHandler(&cli.Command{}, messages, storage)
+	payload := &CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Metadata: map[string]string{
+		service.MetaCluster:       "prod",
+		service.MetaGateSecret:    "secret",
+		service.MetaGateName:      "test-canary",
+		service.MetaGateNamespace: "canary-ns",
+		"team":                    "payments",
+		"internal_token":          "abc",
+	}}
+
+	// all of the metadata but the secret is notified by default
+	httpTest(t, handler.ConfirmRollout(), confirmRolloutPath, buildPayload(payload), http.StatusOK, nil)
+	require.Equal(t, "abc", messages.metas[0]["internal_token"])
+	require.NotContains(t, messages.metas[0], service.MetaGateSecret)
+
+	handler.AllowMetadata([]string{"team"})
+	httpTest(t, handler.ConfirmRollout(), confirmRolloutPath, buildPayload(payload), http.StatusOK, nil)
+	require.Equal(t, map[string]string{
+		service.MetaName:          "test-canary",
+		service.MetaNamespace:     "canary-ns",
+		service.MetaCluster:       "prod",
+		service.MetaGateName:      "test-canary",
+		service.MetaGateNamespace: "canary-ns",
+		service.MetaGateState:     store.GATE_OPEN,
+		"team":                    "payments",
+	}, messages.metas[1])
+}
+
+func TestResetGate(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	reset := func(gate CanaryGatePayload) (*httptest.ResponseRecorder, CanaryGateStatus) {
+		w := httptest.NewRecorder()
+		handler.ResetGate().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/reset", bytes.NewBuffer(buildPayload(&gate))))
+		var result map[string][]CanaryGateStatus
+		if json.Unmarshal(w.Body.Bytes(), &result) != nil || len(result["canary-ns/test-canary"]) == 0 {
+			return w, CanaryGateStatus{}
+		}
+		return w, result["canary-ns/test-canary"][0]
+	}
+	promotion := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	rollback := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback}
+	storage.GateClose(t.Context(), promotion, "alice")
+	storage.GateOpen(t.Context(), rollback, "alice")
+
+	// the gates answer their default states
+	w, status := reset(CanaryGatePayload{Type: promotion.Type, Namespace: promotion.Namespace, Name: promotion.Name, User: "bob"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, store.GATE_OPEN, status.Status)
+	require.True(t, storage.IsGateOpen(context.TODO(), promotion))
+	w, status = reset(CanaryGatePayload{Type: rollback.Type, Namespace: rollback.Namespace, Name: rollback.Name, User: "bob"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, store.GATE_CLOSE, status.Status)
+	require.False(t, storage.IsGateOpen(context.TODO(), rollback))
+	require.Equal(t, "bob", storage.GetHistory(context.TODO(), rollback)[3].User)
+
+	// a single gate is reset at a time
+	w, _ = reset(CanaryGatePayload{Type: service.HookAll, Namespace: promotion.Namespace, Name: promotion.Name})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDryRun(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, piggysecv1alpha1.AddToScheme(scheme))
+	f := dfake.NewSimpleDynamicClient(scheme)
+	_, err := f.Resource(store.GroupVersionResource).Namespace("canary-ns").Create(context.TODO(), &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": piggysecv1alpha1.GroupVersion.String(),
+		"kind":       "CanaryGate",
+		"metadata":   map[string]any{"name": "test-canary", "namespace": "canary-ns"},
+		"spec":       map[string]any{"approvals": map[string]any{string(service.HookConfirmPromotion): int64(2)}},
+	}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	storage, err := store.NewCanaryGateStore(f)
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	rollout := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmRollout}
+	promotion := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+
+	request := func(h http.Handler, target string, gate CanaryGatePayload) (*httptest.ResponseRecorder, CanaryGateStatus) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, bytes.NewBuffer(buildPayload(&gate))))
+		var result map[string][]CanaryGateStatus
+		if json.Unmarshal(w.Body.Bytes(), &result) != nil || len(result["canary-ns/test-canary"]) == 0 {
+			return w, CanaryGateStatus{}
+		}
+		return w, result["canary-ns/test-canary"][0]
+	}
+	gate := func(key store.StoreKey, user string) CanaryGatePayload {
+		return CanaryGatePayload{Type: key.Type, Namespace: key.Namespace, Name: key.Name, User: user}
+	}
+
+	// the would-be status is answered and the gate is not changed
+	w, status := request(handler.CloseGate(), "/close?dryRun=true", gate(rollout, "alice"))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, status.DryRun)
+	require.Equal(t, store.GATE_CLOSE, status.Status)
+	require.True(t, storage.IsGateOpen(context.TODO(), rollout))
+	require.Empty(t, storage.GetHistory(context.TODO(), rollout))
+
+	// a gate which requires approvals reports the would-be approvals
+	w, status = request(handler.OpenGate(), "/open?dryRun=true", gate(promotion, "alice"))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, status.DryRun)
+	require.Equal(t, store.GATE_CLOSE, status.Status)
+	require.Equal(t, 1, status.Approvals)
+	require.Empty(t, storage.GetApproval(context.TODO(), promotion).Approvers)
+
+	// the conditional change reports the conflict
+	w, status = request(handler.CloseGate(), "/close?dryRun=true&ifCurrent=closed", gate(rollout, ""))
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.True(t, status.DryRun)
+	require.Equal(t, store.GATE_OPEN, status.Status)
+
+	// a missing CanaryGate, an unknown gate and an invalid dryRun are rejected
+	w, _ = request(handler.OpenGate(), "/open?dryRun=true", gate(store.StoreKey{Namespace: "canary-ns", Name: "typo", Type: service.HookConfirmRollout}, ""))
+	require.Equal(t, http.StatusNotFound, w.Code)
+	w, _ = request(handler.CloseGate(), "/close?dryRun=true", gate(store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: "promote"}, ""))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w, _ = request(handler.CloseGate(), "/close?dryRun=maybe", gate(rollout, ""))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	exists, err := storage.Exists(context.TODO(), store.StoreKey{Namespace: "canary-ns", Name: "typo"})
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// dryRun=false changes the gate
+	w, status = request(handler.CloseGate(), "/close?dryRun=false", gate(rollout, "alice"))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.False(t, status.DryRun)
+	require.False(t, storage.IsGateOpen(context.TODO(), rollout))
+}
+
+func TestStatusGateMethods(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	storage.GateClose(t.Context(), store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}, "alice")
+
+	status := func(req *http.Request) (int, []CanaryGateStatus) {
+		w := httptest.NewRecorder()
+		handler.StatusGate().ServeHTTP(w, req)
+		var result map[string][]CanaryGateStatus
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result["canary-ns/test-canary"]
+	}
+
+	// POST reads the body
+	payload := buildPayload(&CanaryGatePayload{Type: service.HookConfirmPromotion, Namespace: "canary-ns", Name: "test-canary"})
+	code, posted := status(httptest.NewRequest(http.MethodPost, "/status", bytes.NewBuffer(payload)))
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, store.GATE_CLOSE, posted[0].Status)
+	require.Equal(t, "alice", posted[0].ChangedBy)
+
+	// GET reads the query parameters and answers the same
+	code, got := status(httptest.NewRequest(http.MethodGet, "/status?namespace=canary-ns&name=test-canary&gate=confirm-promotion", nil))
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, posted, got)
+
+	// the gate defaults to all
+	code, got = status(httptest.NewRequest(http.MethodGet, "/status?namespace=canary-ns&name=test-canary", nil))
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, got, len(store.GateTypes)+1)
+
+	code, _ = status(httptest.NewRequest(http.MethodGet, "/status?namespace=canary-ns", nil))
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = status(httptest.NewRequest(http.MethodGet, "/status?namespace=canary-ns&name=test-canary&gate=promote", nil))
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestMultipleGates(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	rollout := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmRollout}
+	promotion := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	storage.GateClose(t.Context(), rollout, "")
+	storage.GateClose(t.Context(), promotion, "")
+	types := []service.HookType{service.HookConfirmRollout, service.HookConfirmPromotion}
+
+	request := func(h http.Handler, path string, payload *CanaryGatePayload) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(buildPayload(payload))))
+		return w
+	}
+	statuses := func(w *httptest.ResponseRecorder) map[service.HookType]string {
+		var response map[string][]CanaryGateStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		result := map[service.HookType]string{}
+		for _, s := range response["canary-ns/test-canary"] {
+			result[s.Type] = s.Status
+		}
+		return result
+	}
+
+	// the promotion alone cannot be opened before the rollout, but they can be opened together
+	w := request(handler.OpenGate(), "/open", &CanaryGatePayload{Types: []service.HookType{service.HookConfirmPromotion}, Namespace: "canary-ns", Name: "test-canary"})
+	require.Equal(t, http.StatusConflict, w.Code)
+	w = request(handler.OpenGate(), "/open", &CanaryGatePayload{Types: types, Namespace: "canary-ns", Name: "test-canary", User: "alice"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, map[service.HookType]string{service.HookConfirmRollout: store.GATE_OPEN, service.HookConfirmPromotion: store.GATE_OPEN}, statuses(w))
+	require.True(t, storage.IsGateOpen(context.TODO(), rollout))
+	require.True(t, storage.IsGateOpen(context.TODO(), promotion))
+	require.Equal(t, "alice", storage.GetChangedBy(context.TODO(), promotion))
+
+	// the status answers the listed gates and the last event
+	w = request(handler.StatusGate(), "/status", &CanaryGatePayload{Types: types, Namespace: "canary-ns", Name: "test-canary"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, statuses(w), 3)
+
+	// none of the gates is closed when one of them is not in the ifCurrent state
+	storage.GateClose(t.Context(), promotion, "")
+	w = request(handler.CloseGate(), "/close?ifCurrent=opened", &CanaryGatePayload{Types: types, Namespace: "canary-ns", Name: "test-canary"})
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Equal(t, map[service.HookType]string{service.HookConfirmRollout: store.GATE_OPEN, service.HookConfirmPromotion: store.GATE_CLOSE}, statuses(w))
+	require.True(t, storage.IsGateOpen(context.TODO(), rollout))
+
+	// the dry run does not change the gates
+	w = request(handler.CloseGate(), "/close?dryRun=true", &CanaryGatePayload{Types: types, Namespace: "canary-ns", Name: "test-canary"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, storage.IsGateOpen(context.TODO(), rollout))
+
+	w = request(handler.CloseGate(), "/close", &CanaryGatePayload{Types: types, Namespace: "canary-ns", Name: "test-canary"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, map[service.HookType]string{service.HookConfirmRollout: store.GATE_CLOSE, service.HookConfirmPromotion: store.GATE_CLOSE}, statuses(w))
+	require.False(t, storage.IsGateOpen(context.TODO(), rollout))
+
+	// invalid lists of gates
+	cases := []*CanaryGatePayload{
+		{Type: service.HookConfirmRollout, Types: types, Namespace: "canary-ns", Name: "test-canary"},
+		{Types: []service.HookType{service.HookConfirmRollout, "unknown"}, Namespace: "canary-ns", Name: "test-canary"},
+		{Types: []service.HookType{service.HookConfirmRollout, service.HookConfirmRollout}, Namespace: "canary-ns", Name: "test-canary"},
+	}
+	for _, c := range cases {
+		require.Equal(t, http.StatusBadRequest, request(handler.OpenGate(), "/open", c).Code)
+	}
+	require.Equal(t, http.StatusBadRequest, request(handler.ResetGate(), "/reset", &CanaryGatePayload{Types: types, Namespace: "canary-ns", Name: "test-canary"}).Code)
+}
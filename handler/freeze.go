@@ -0,0 +1,112 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog/log"
+)
+
+// FreezePayload holds the freeze request
+type FreezePayload struct {
+	// Frozen closes the confirm gates of every canary when true, and gives them their own state again when false
+	Frozen bool `json:"frozen"`
+	// Optional user who freezes or unfreezes the gates
+	User string `json:"user,omitempty"`
+	// Optional reason of the freeze
+	Reason string `json:"reason,omitempty"`
+}
+
+// UseFreezer reads and changes the freeze of the confirm gates with the freezer, which is usually the store.FreezeStore
+// of the handler. Without a freezer, the gates cannot be frozen.
+func (h *FlaggerHandler) UseFreezer(freezer store.Freezer) {
+	h.freezer = freezer
+}
+
+// Freeze answers the freeze of the confirm gates on a GET, and freezes or unfreezes the confirm gates of every canary
+// on a POST. The gates keep their state while frozen, so they have it again once unfrozen.
+func (h *FlaggerHandler) Freeze() http.Handler {
+	return traced("/freeze", func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		if h.freezer == nil {
+			http.Error(w, "freeze is not enabled", http.StatusNotFound)
+			return
+		}
+		if r.Method != http.MethodGet {
+			payload, err := readPayload(r, w, FreezePayload{})
+			if err != nil {
+				return
+			}
+			freeze := store.Freeze{Frozen: payload.Frozen, User: payload.User, Reason: payload.Reason, Time: time.Now().UTC()}
+			if err := h.freezer.SetFreeze(r.Context(), freeze); err != nil {
+				log.Error().Msgf("Unable to change the freeze of the gates %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			h.audit.Log(AuditEvent{Time: freeze.Time, Action: auditFreeze, Status: freezeStatus(freeze), User: freeze.User, Reason: freeze.Reason, RequestID: requestID(r.Context())})
+			if freeze.Frozen {
+				log.Info().Str("user", freeze.User).Msgf("The confirm gates are frozen: %s", freeze.Reason)
+			} else {
+				log.Info().Str("user", freeze.User).Msg("The confirm gates are unfrozen")
+			}
+		}
+		freeze, err := h.freezer.GetFreeze(r.Context())
+		if err != nil {
+			log.Error().Msgf("Unable to read the freeze of the gates %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writePayload(w, &freeze, http.StatusOK)
+	})
+}
+
+// currentFreeze returns the freeze of the confirm gates, which is not frozen without a freezer or when it cannot be read
+func (h *FlaggerHandler) currentFreeze(ctx context.Context) store.Freeze {
+	if h.freezer == nil {
+		return store.Freeze{}
+	}
+	freeze, err := h.freezer.GetFreeze(ctx)
+	if err != nil {
+		return store.Freeze{}
+	}
+	return freeze
+}
+
+// freezeReason explains a gate which is closed by the freeze
+func freezeReason(freeze store.Freeze) string {
+	reason := "gates are frozen"
+	if freeze.User != "" {
+		reason += " by user " + freeze.User
+	}
+	reason += " at " + freeze.Time.Format(time.RFC3339)
+	if freeze.Reason != "" {
+		reason = fmt.Sprintf("%s: %s", reason, freeze.Reason)
+	}
+	return reason
+}
+
+// freezeStatus returns frozen or unfrozen
+func freezeStatus(freeze store.Freeze) string {
+	if freeze.Frozen {
+		return "frozen"
+	}
+	return "unfrozen"
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFreeze(t *testing.T) {
+	memory, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	t.Setenv("CANARY_GATE_NAMESPACE", "canary-gate")
+	storage, err := store.NewFreezeStore(memory, fake.NewSimpleClientset())
+	require.NoError(t, err)
+	defer storage.Shutdown()
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	handler.UseFreezer(storage)
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: service.PhaseWaitingPromotion})
+	promotion := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	storage.GateOpen(t.Context(), promotion, "alice")
+
+	webhook := func() (int, WebhookDecision) {
+		w := httptest.NewRecorder()
+		handler.ConfirmPromotion().ServeHTTP(w, httptest.NewRequest(http.MethodPost, confirmPromotionPath, bytes.NewBuffer(payload)))
+		var decision WebhookDecision
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &decision))
+		return w.Code, decision
+	}
+	freeze := func(r *http.Request) store.Freeze {
+		w := httptest.NewRecorder()
+		handler.Freeze().ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		var freeze store.Freeze
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &freeze))
+		return freeze
+	}
+	status := func() map[service.HookType]CanaryGateStatus {
+		w := httptest.NewRecorder()
+		handler.StatusGate().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status?namespace=canary-ns&name=test-canary", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var statusMap map[string][]CanaryGateStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &statusMap))
+		statuses := map[service.HookType]CanaryGateStatus{}
+		for _, s := range statusMap["canary-ns/test-canary"] {
+			statuses[s.Type] = s
+		}
+		return statuses
+	}
+
+	require.False(t, freeze(httptest.NewRequest(http.MethodGet, "/freeze", nil)).Frozen)
+	code, _ := webhook()
+	require.Equal(t, http.StatusOK, code)
+	storage.GateOpen(t.Context(), promotion, "alice")
+
+	// the freeze closes the opened confirm gate
+	frozen := freeze(post("/freeze", &FreezePayload{Frozen: true, User: "bob", Reason: "holidays"}))
+	require.True(t, frozen.Frozen)
+	require.Equal(t, "bob", frozen.User)
+	require.False(t, frozen.Time.IsZero())
+	require.Equal(t, frozen, freeze(httptest.NewRequest(http.MethodGet, "/freeze", nil)))
+	code, decision := webhook()
+	require.Equal(t, http.StatusForbidden, code)
+	require.False(t, decision.Approved)
+	require.Contains(t, decision.Reason, "gates are frozen by user bob")
+	require.Contains(t, decision.Reason, "holidays")
+
+	// the status shows the frozen confirm gates
+	statuses := status()
+	require.Equal(t, store.GATE_CLOSE, statuses[service.HookConfirmPromotion].Status)
+	require.True(t, statuses[service.HookConfirmPromotion].Frozen)
+	require.True(t, statuses[service.HookConfirmRollout].Frozen)
+	require.False(t, statuses[service.HookRollback].Frozen)
+
+	// the gate is opened again once unfrozen
+	require.False(t, freeze(post("/freeze", &FreezePayload{User: "bob"})).Frozen)
+	require.False(t, status()[service.HookConfirmPromotion].Frozen)
+	code, decision = webhook()
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, decision.Reason, "by user alice")
+}
+
+func TestFreezeNotEnabled(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	w := httptest.NewRecorder()
+	handler.Freeze().ServeHTTP(w, post("/freeze", &FreezePayload{Frozen: true}))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	decisionApproved = "approved"
+	decisionRejected = "rejected"
+)
+
+var (
+	// decisionsTotal counts the webhook responses sent back to Flagger
+	decisionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "canary_gate_decisions_total",
+		Help: "Total number of gate decisions returned to Flagger webhooks",
+	}, []string{"gate", "namespace", "name", "decision"})
+
+	// openRequestsTotal counts the /open calls. Labeled by gate type only to keep the cardinality low
+	openRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "canary_gate_open_requests_total",
+		Help: "Total number of requests to open a gate",
+	}, []string{"gate"})
+
+	// closeRequestsTotal counts the /close calls. Labeled by gate type only to keep the cardinality low
+	closeRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "canary_gate_close_requests_total",
+		Help: "Total number of requests to close a gate",
+	}, []string{"gate"})
+
+	// gateOpen is 1 when the gate was last opened and 0 when it was last closed
+	gateOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "canary_gate_open",
+		Help: "Whether the gate is open (1) or closed (0)",
+	}, []string{"gate", "namespace", "name"})
+
+	// gateClosedSeconds reports the time elapsed since the gates were closed
+	gateClosedSeconds = newClosedCollector()
+
+	// activeCanaries is the number of the canaries in each phase which are not finished
+	activeCanaries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "canary_gate_canaries",
+		Help: "Number of active canaries in each phase",
+	}, []string{"phase"})
+
+	// canaryPhases holds the phase of each active canary seen by the handler
+	canaryPhases = newPhaseTracker()
+)
+
+func init() {
+	prometheus.MustRegister(gateClosedSeconds)
+}
+
+// closedCollector computes the elapsed time of the closed gates on every scrape
+type closedCollector struct {
+	desc *prometheus.Desc
+	mu   sync.Mutex
+	// gates holds the state of the gates seen by the handler
+	gates map[store.StoreKey]closedState
+}
+
+// closedState is the last seen state of a gate with the time when it was closed
+type closedState struct {
+	open     bool
+	closedAt time.Time
+}
+
+func newClosedCollector() *closedCollector {
+	return &closedCollector{
+		desc: prometheus.NewDesc("canary_gate_closed_seconds",
+			"Seconds since the gate was last closed, 0 when it is open",
+			[]string{"gate", "namespace", "name"}, nil),
+		gates: map[store.StoreKey]closedState{},
+	}
+}
+
+func (c *closedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *closedCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for key, state := range c.gates {
+		seconds := 0.0
+		if !state.open && !state.closedAt.IsZero() {
+			seconds = now.Sub(state.closedAt).Seconds()
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, seconds, string(key.Type), key.Namespace, key.Name)
+	}
+}
+
+// set records the state of the gate. closedAt is the time recorded by the store when the gate was closed.
+func (c *closedCollector) set(key store.StoreKey, open bool, closedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gates[key] = closedState{open: open, closedAt: closedAt}
+}
+
+// changed returns true when the gate is not seen yet or its state differs from the recorded one
+func (c *closedCollector) changed(key store.StoreKey, open bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.gates[key]
+	return !ok || state.open != open
+}
+
+// storeCollector reads the state of every gate of the deployments in the store on every scrape. It is not registered
+// in the default registry, since a scrape lists all of the deployments in the store.
+type storeCollector struct {
+	ctx   context.Context
+	store store.Store
+	desc  *prometheus.Desc
+}
+
+func newStoreCollector(ctx context.Context, stor store.Store) *storeCollector {
+	return &storeCollector{
+		ctx:   ctx,
+		store: stor,
+		desc: prometheus.NewDesc("canary_gate_open",
+			"Whether the gate is open (1) or closed (0)",
+			[]string{"namespace", "name", "gate"}, nil),
+	}
+}
+
+func (c *storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *storeCollector) Collect(ch chan<- prometheus.Metric) {
+	keys, err := c.store.Deployments(c.ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for _, key := range keys {
+		gates, err := c.store.List(c.ctx, key.Namespace, key.Name)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(c.desc, err)
+			return
+		}
+		for gate, open := range gates {
+			value := 0.0
+			if open {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, value, key.Namespace, key.Name, string(gate))
+		}
+	}
+}
+
+// GateMetrics answers the state of every gate of the deployments in the store in the Prometheus text format, so the
+// gates which were not changed since the start are exported too. It answers 500 when the store cannot be read.
+func (h *FlaggerHandler) GateMetrics() http.Handler {
+	return traced("/metrics/gates", func(w http.ResponseWriter, r *http.Request) {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(newStoreCollector(r.Context(), h.store))
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorHandling: promhttp.HTTPErrorOnError}).ServeHTTP(w, r)
+	})
+}
+
+// phaseTracker holds the last phase of each active canary and counts the canaries in each phase
+type phaseTracker struct {
+	mu     sync.Mutex
+	phases map[store.StoreKey]service.Phase
+}
+
+func newPhaseTracker() *phaseTracker {
+	return &phaseTracker{phases: map[store.StoreKey]service.Phase{}}
+}
+
+// observe moves the canary from its previous phase to the phase. A canary in a finished phase is removed.
+func (p *phaseTracker) observe(key store.StoreKey, phase service.Phase) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	previous, ok := p.phases[key]
+	if ok && previous == phase {
+		return
+	}
+	if ok {
+		activeCanaries.WithLabelValues(string(previous)).Dec()
+		delete(p.phases, key)
+	}
+	if finishedPhase(phase) {
+		return
+	}
+	p.phases[key] = phase
+	activeCanaries.WithLabelValues(string(phase)).Inc()
+}
+
+// counts returns the number of the active canaries in each phase
+func (p *phaseTracker) counts() map[service.Phase]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	counts := map[service.Phase]int{}
+	for _, phase := range p.phases {
+		counts[phase]++
+	}
+	return counts
+}
+
+// finishedPhase reports whether the canary analysis is over in the phase
+func finishedPhase(phase service.Phase) bool {
+	return phase == service.PhaseSucceeded || phase == service.PhaseFailed || phase == service.PhaseTerminated
+}
+
+// recordDecision records a webhook decision of the gate
+func recordDecision(key store.StoreKey, approved bool) {
+	decision := decisionRejected
+	if approved {
+		decision = decisionApproved
+	}
+	decisionsTotal.WithLabelValues(string(key.Type), key.Namespace, key.Name, decision).Inc()
+}
+
+// recordGate records an open or close request of the gate
+func recordGate(key store.StoreKey, open bool) {
+	if open {
+		openRequestsTotal.WithLabelValues(string(key.Type)).Inc()
+		gateOpen.WithLabelValues(string(key.Type), key.Namespace, key.Name).Set(1)
+	} else {
+		closeRequestsTotal.WithLabelValues(string(key.Type)).Inc()
+		gateOpen.WithLabelValues(string(key.Type), key.Namespace, key.Name).Set(0)
+	}
+}
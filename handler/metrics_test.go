@@ -0,0 +1,174 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func TestMetrics(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	webhookPayload := &CanaryWebhookPayload{
+		Name:      "metrics-canary",
+		Namespace: "metrics-ns",
+		Phase:     service.PhasePromoting,
+	}
+	gatePayload := buildPayload(&CanaryGatePayload{
+		Type:      service.HookConfirmPromotion,
+		Name:      webhookPayload.Name,
+		Namespace: webhookPayload.Namespace,
+	})
+	gate := string(service.HookConfirmPromotion)
+	decisions := testutil.CollectAndCount(decisionsTotal)
+	opens := testutil.ToFloat64(openRequestsTotal.WithLabelValues(gate))
+	closes := testutil.ToFloat64(closeRequestsTotal.WithLabelValues(gate))
+
+	httpTest(t, handler.ConfirmPromotion(), confirmPromotionPath, buildPayload(webhookPayload), http.StatusOK, nil)
+	require.Equal(t, float64(1), testutil.ToFloat64(decisionsTotal.WithLabelValues(gate, "metrics-ns", "metrics-canary", decisionApproved)))
+
+	httpTest(t, handler.CloseGate(), "/close", gatePayload, http.StatusOK, nil)
+	require.Equal(t, closes+1, testutil.ToFloat64(closeRequestsTotal.WithLabelValues(gate)))
+	require.Equal(t, float64(0), testutil.ToFloat64(gateOpen.WithLabelValues(gate, "metrics-ns", "metrics-canary")))
+
+	httpTest(t, handler.ConfirmPromotion(), confirmPromotionPath, buildPayload(webhookPayload), http.StatusForbidden, nil)
+	require.Equal(t, float64(1), testutil.ToFloat64(decisionsTotal.WithLabelValues(gate, "metrics-ns", "metrics-canary", decisionRejected)))
+	require.Equal(t, decisions+2, testutil.CollectAndCount(decisionsTotal))
+
+	httpTest(t, handler.OpenGate(), "/open", gatePayload, http.StatusOK, nil)
+	require.Equal(t, opens+1, testutil.ToFloat64(openRequestsTotal.WithLabelValues(gate)))
+	require.Equal(t, float64(1), testutil.ToFloat64(gateOpen.WithLabelValues(gate, "metrics-ns", "metrics-canary")))
+}
+
+func TestClosedSeconds(t *testing.T) {
+	collector := newClosedCollector()
+	key := store.StoreKey{Namespace: "metrics-ns", Name: "metrics-canary", Type: service.HookConfirmPromotion}
+	collector.set(key, false, time.Now().Add(-time.Minute))
+	require.GreaterOrEqual(t, testutil.ToFloat64(collector), float64(60))
+	collector.set(key, true, time.Time{})
+	require.Equal(t, float64(0), testutil.ToFloat64(collector))
+
+	// the handler records the time when the store closed the gate
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	key.Name = "closed-canary"
+	gatePayload := buildPayload(&CanaryGatePayload{Type: key.Type, Name: key.Name, Namespace: key.Namespace})
+	httpTest(t, handler.CloseGate(), "/close", gatePayload, http.StatusOK, nil)
+	closedAt := storage.GetClosedAt(context.TODO(), key)
+	require.False(t, closedAt.IsZero())
+	require.Equal(t, closedState{open: false, closedAt: closedAt}, gateClosedSeconds.gates[key])
+
+	httpTest(t, handler.OpenGate(), "/open", gatePayload, http.StatusOK, nil)
+	require.True(t, storage.GetClosedAt(context.TODO(), key).IsZero())
+	require.Equal(t, closedState{open: true}, gateClosedSeconds.gates[key])
+
+	// a gate closed without the handler is seen through the webhooks
+	storage.GateClose(t.Context(), key, "")
+	webhookPayload := &CanaryWebhookPayload{Name: key.Name, Namespace: key.Namespace, Phase: service.PhasePromoting}
+	httpTest(t, handler.ConfirmPromotion(), confirmPromotionPath, buildPayload(webhookPayload), http.StatusForbidden, nil)
+	require.False(t, gateClosedSeconds.gates[key].open)
+	require.False(t, gateClosedSeconds.gates[key].closedAt.IsZero())
+}
+
+func TestActiveCanaries(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	event := func(name string, phase service.Phase) {
+		payload := buildPayload(&CanaryWebhookPayload{Name: name, Namespace: "phases-ns", Phase: phase})
+		httpTest(t, handler.Event(), "/event", payload, http.StatusOK, nil)
+	}
+	phases := func() PhasesResponse {
+		w := httptest.NewRecorder()
+		handler.Phases().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/phases", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var response PhasesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	gauge := func(phase service.Phase) float64 {
+		return testutil.ToFloat64(activeCanaries.WithLabelValues(string(phase)))
+	}
+	before := phases()
+	progressing, waiting := gauge(service.PhaseProgressing), gauge(service.PhaseWaitingPromotion)
+
+	event("first-canary", service.PhaseProgressing)
+	event("second-canary", service.PhaseProgressing)
+	event("second-canary", service.PhaseProgressing)
+	require.Equal(t, progressing+2, gauge(service.PhaseProgressing))
+	require.Equal(t, before.Phases[service.PhaseProgressing]+2, phases().Phases[service.PhaseProgressing])
+
+	// the previous phase is decremented on a transition
+	event("second-canary", service.PhaseWaitingPromotion)
+	require.Equal(t, progressing+1, gauge(service.PhaseProgressing))
+	require.Equal(t, waiting+1, gauge(service.PhaseWaitingPromotion))
+	require.Equal(t, before.Total+2, phases().Total)
+
+	// the finished canaries are removed
+	event("first-canary", service.PhaseSucceeded)
+	event("second-canary", service.PhaseFailed)
+	require.Equal(t, progressing, gauge(service.PhaseProgressing))
+	require.Equal(t, waiting, gauge(service.PhaseWaitingPromotion))
+	require.Equal(t, float64(0), gauge(service.PhaseSucceeded))
+	require.Equal(t, before.Total, phases().Total)
+}
+
+// failingStore fails to list the deployments
+type failingStore struct {
+	store.Store
+}
+
+func (s failingStore) Deployments(ctx context.Context) ([]store.StoreKey, error) {
+	return nil, errors.New("store is unreachable")
+}
+
+func TestGateMetrics(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	storage.GateClose(t.Context(), store.StoreKey{Namespace: "canary-ns", Name: "demo", Type: service.HookConfirmPromotion}, "")
+
+	w := httptest.NewRecorder()
+	handler.GateMetrics().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics/gates", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	require.Contains(t, body, "# HELP canary_gate_open Whether the gate is open (1) or closed (0)\n# TYPE canary_gate_open gauge\n")
+	require.Contains(t, body, `canary_gate_open{gate="confirm-promotion",name="demo",namespace="canary-ns"} 0`+"\n")
+	require.Contains(t, body, `canary_gate_open{gate="confirm-rollout",name="demo",namespace="canary-ns"} 1`+"\n")
+	require.Contains(t, body, `canary_gate_open{gate="rollback",name="demo",namespace="canary-ns"} 0`+"\n")
+	require.Equal(t, len(store.GateTypes)+2, strings.Count(body, "\n"))
+
+	failing := NewHandler(&cli.Command{}, noti.NewQuietNoti(), failingStore{storage})
+	w = httptest.NewRecorder()
+	failing.GateMetrics().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics/gates", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+// GateLimiter limits the rate of the changes of each gate with a token bucket, so a misbehaving client cannot flood
+// the store and the Kubernetes events. The opening and closing of a gate share its bucket.
+type GateLimiter struct {
+	limit rate.Limit
+	burst int
+	// idle is the time a bucket takes to refill. A bucket which is idle for longer is full, so it is evicted
+	// without changing the limit, and the keys sent by the clients cannot grow the map without bound.
+	idle      time.Duration
+	mu        sync.Mutex
+	limiters  map[store.StoreKey]*gateBucket
+	lastSweep time.Time
+}
+
+// gateBucket is the token bucket of a gate and the last time it was used
+type gateBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewGateLimiter creates a limiter which allows perSecond changes of a gate with bursts of burst changes
+func NewGateLimiter(perSecond float64, burst int) *GateLimiter {
+	burst = max(burst, 1)
+	return &GateLimiter{
+		limit:     rate.Limit(perSecond),
+		burst:     burst,
+		idle:      time.Duration(float64(burst) / perSecond * float64(time.Second)),
+		limiters:  map[store.StoreKey]*gateBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow reports whether a change of the gate is allowed now and takes a token from its bucket
+func (l *GateLimiter) Allow(key store.StoreKey) bool {
+	now := time.Now()
+	l.mu.Lock()
+	if now.Sub(l.lastSweep) >= l.idle {
+		l.sweep(now)
+	}
+	bucket, ok := l.limiters[key]
+	if !ok {
+		bucket = &gateBucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[key] = bucket
+	}
+	bucket.lastSeen = now
+	l.mu.Unlock()
+	return bucket.limiter.AllowN(now, 1)
+}
+
+// sweep evicts the buckets which are idle for longer than their refill time. The caller must hold the lock.
+func (l *GateLimiter) sweep(now time.Time) {
+	for key, bucket := range l.limiters {
+		if now.Sub(bucket.lastSeen) >= l.idle {
+			delete(l.limiters, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Limit rejects the requests with 429 Too Many Requests when the gate in the body exceeds its rate.
+// A body which cannot be decoded is passed on, so the handler answers it with 400 Bad Request.
+func (l *GateLimiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var gate CanaryGatePayload
+		if err := json.Unmarshal(body, &gate); err == nil {
+			key := gate.key(gate.Type)
+			if !l.Allow(key) {
+				log.Warn().Msgf("Rejected request to %s from %s. Gate [%s] is changed too often", r.URL.Path, r.RemoteAddr, key.String())
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(1/float64(l.limit)))))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func TestGateLimiter(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	// a very low rate, so no token is added while the test runs
+	limiter := NewGateLimiter(0.001, 3)
+	openGate := limiter.Limit(handler.OpenGate())
+	closeGate := limiter.Limit(handler.CloseGate())
+	request := func(h http.Handler, gate CanaryGatePayload) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(buildPayload(&gate))))
+		return w
+	}
+	promotion := CanaryGatePayload{Type: service.HookConfirmPromotion, Name: "test-canary", Namespace: "canary-ns"}
+
+	// opening and closing a gate share its burst
+	require.Equal(t, http.StatusOK, request(closeGate, promotion).Code)
+	require.Equal(t, http.StatusOK, request(openGate, promotion).Code)
+	require.Equal(t, http.StatusOK, request(closeGate, promotion).Code)
+	w := request(openGate, promotion)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.NotEmpty(t, w.Header().Get("Retry-After"))
+	// the rejected request does not change the gate
+	require.False(t, storage.IsGateOpen(t.Context(), store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}))
+
+	// the other gates have their own bucket
+	rollout := CanaryGatePayload{Type: service.HookConfirmRollout, Name: "test-canary", Namespace: "canary-ns"}
+	require.Equal(t, http.StatusOK, request(closeGate, rollout).Code)
+
+	// an invalid body is answered by the handler
+	w = httptest.NewRecorder()
+	openGate.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/open", bytes.NewReader([]byte("{"))))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGateLimiterEviction(t *testing.T) {
+	// a bucket of 2 tokens refills in 2ms
+	limiter := NewGateLimiter(1000, 2)
+	for i := range 100 {
+		require.True(t, limiter.Allow(store.StoreKey{Namespace: "canary-ns", Name: fmt.Sprintf("canary-%d", i), Type: service.HookConfirmPromotion}))
+	}
+	require.Len(t, limiter.limiters, 100)
+
+	// the idle buckets are full, so they are evicted
+	time.Sleep(5 * time.Millisecond)
+	require.True(t, limiter.Allow(store.StoreKey{Namespace: "canary-ns", Name: "canary-0", Type: service.HookConfirmPromotion}))
+	require.Len(t, limiter.limiters, 1)
+}
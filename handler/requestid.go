@@ -0,0 +1,79 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/KongZ/canary-gate/service"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// RequestIDHeader is the header which carries the ID of a webhook request. The ID of the request is used when it is
+// set, otherwise an ID is generated. The ID is returned in the same header of the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits the length of the ID read from the request
+const maxRequestIDLength = 128
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// withRequestID adds the request ID and a logger with it to the context of the request
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		id = newRequestID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	logger := log.With().Str("requestId", id).Logger()
+	return r.WithContext(context.WithValue(logger.WithContext(r.Context()), requestIDKey{}, id))
+}
+
+// requestID returns the request ID of the context, or empty when the context has none
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestLog returns the logger of the request, or the global logger when the context has none
+func requestLog(ctx context.Context) *zerolog.Logger {
+	if logger := zerolog.Ctx(ctx); logger.GetLevel() != zerolog.Disabled {
+		return logger
+	}
+	return &log.Logger
+}
+
+// canaryFields adds the canary of the webhook to the log line, so every decision of a rollout can be found by its
+// checksum
+func canaryFields(e *zerolog.Event, canary *CanaryWebhookPayload, hook service.HookType) *zerolog.Event {
+	return e.Str("gate", string(hook)).
+		Str("namespace", canary.Namespace).
+		Str("name", canary.Name).
+		Str("phase", string(canary.Phase)).
+		Str("checksum", canary.Checksum)
+}
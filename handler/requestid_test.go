@@ -0,0 +1,75 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func TestWebhookRequestID(t *testing.T) {
+	var output bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&output)
+	defer func() { log.Logger = logger }()
+
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: "Progressing", Checksum: "abc123"})
+
+	// the ID of the request is used in the logs and the response
+	req := httptest.NewRequest(http.MethodPost, "/confirm-promotion", bytes.NewBuffer(payload))
+	req.Header.Set(RequestIDHeader, "rollout-42")
+	w := httptest.NewRecorder()
+	handler.ConfirmPromotion().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "rollout-42", w.Header().Get(RequestIDHeader))
+
+	lines := 0
+	scanner := bufio.NewScanner(&output)
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		if line["requestId"] == nil {
+			continue
+		}
+		lines++
+		require.Equal(t, "rollout-42", line["requestId"])
+		require.Equal(t, "abc123", line["checksum"])
+		require.Equal(t, "Progressing", line["phase"])
+		require.Equal(t, "confirm-promotion", line["gate"])
+		require.NotEmpty(t, line["message"])
+	}
+	// the received webhook and the decision
+	require.Equal(t, 2, lines)
+
+	// an ID is generated when the request has none
+	w = httptest.NewRecorder()
+	handler.ConfirmPromotion().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/confirm-promotion", bytes.NewBuffer(payload)))
+	require.Len(t, w.Header().Get(RequestIDHeader), 16)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"sync"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+// eventSampler suppresses the repeated logs of the Flagger events. Flagger calls every webhook on each analysis
+// interval, so a long analysis repeats the same event of a canary many times. An event is logged when its phase or
+// checksum changes, and then once in every repeats of the same event.
+type eventSampler struct {
+	every int
+	mu    sync.Mutex
+	last  map[sampledKey]*sampledEvent
+}
+
+// sampledKey is the webhook of a canary
+type sampledKey struct {
+	namespace string
+	name      string
+	hook      service.HookType
+}
+
+// sampledEvent is the last event of a webhook and the number of times it is suppressed since it was logged
+type sampledEvent struct {
+	phase      service.Phase
+	checksum   string
+	suppressed int
+}
+
+// newEventSampler creates a sampler which logs every Nth repeat of an event
+func newEventSampler(every int) *eventSampler {
+	return &eventSampler{every: every, last: map[sampledKey]*sampledEvent{}}
+}
+
+// sample reports whether the event is logged, and the number of repeats which were suppressed before it
+func (s *eventSampler) sample(canary *CanaryWebhookPayload, hook service.HookType) (bool, int) {
+	key := sampledKey{namespace: canary.Namespace, name: canary.Name, hook: hook}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.last[key]
+	if !ok || last.phase != canary.Phase || last.checksum != canary.Checksum {
+		s.last[key] = &sampledEvent{phase: canary.Phase, checksum: canary.Checksum}
+		return true, 0
+	}
+	last.suppressed++
+	if last.suppressed < s.every {
+		return false, 0
+	}
+	suppressed := last.suppressed - 1
+	last.suppressed = 0
+	return true, suppressed
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func TestEventSampler(t *testing.T) {
+	sampler := newEventSampler(3)
+	canary := &CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: service.PhaseProgressing, Checksum: "abc123"}
+
+	cases := []struct {
+		name       string
+		hook       service.HookType
+		phase      service.Phase
+		logged     bool
+		suppressed int
+	}{
+		{"first event", service.HookRollout, service.PhaseProgressing, true, 0},
+		{"first repeat", service.HookRollout, service.PhaseProgressing, false, 0},
+		{"second repeat", service.HookRollout, service.PhaseProgressing, false, 0},
+		{"third repeat", service.HookRollout, service.PhaseProgressing, true, 2},
+		{"another webhook", service.HookConfirmPromotion, service.PhaseProgressing, true, 0},
+		{"fourth repeat", service.HookRollout, service.PhaseProgressing, false, 0},
+		{"phase change", service.HookRollout, service.PhaseSucceeded, true, 0},
+	}
+	for _, c := range cases {
+		canary.Phase = c.phase
+		logged, suppressed := sampler.sample(canary, c.hook)
+		require.Equalf(t, c.logged, logged, "[%s] unexpected logged", c.name)
+		require.Equalf(t, c.suppressed, suppressed, "[%s] unexpected suppressed", c.name)
+	}
+
+	// a new checksum is a new rollout
+	canary.Checksum = "def456"
+	logged, _ := sampler.sample(canary, service.HookRollout)
+	require.True(t, logged)
+}
+
+func TestSampleEvents(t *testing.T) {
+	var output bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&output).Level(zerolog.InfoLevel)
+	defer func() { log.Logger = logger }()
+
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	handler.SampleEvents(10)
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Phase: service.PhaseProgressing, Checksum: "abc123"})
+	for range 5 {
+		w := httptest.NewRecorder()
+		handler.Event().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/event", bytes.NewBuffer(payload)))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// the duplicate consecutive events are suppressed
+	received := 0
+	scanner := bufio.NewScanner(&output)
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		if line["gate"] == string(service.HookEvent) {
+			received++
+		}
+	}
+	require.Equal(t, 1, received)
+}
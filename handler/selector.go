@@ -0,0 +1,164 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+)
+
+// SelectorPayload holds the request which opens or closes a gate of every CanaryGate matching the label selector
+type SelectorPayload struct {
+	// Gate which is opened or closed
+	Type service.HookType `json:"type"`
+
+	// Namespace of the CanaryGates, or empty for all namespaces
+	Namespace string `json:"namespace,omitempty"`
+
+	// Label selector of the CanaryGates, e.g. team=payments
+	Selector string `json:"selector"`
+
+	// Optional duration (e.g. 30m) after which an opened gate reverts to its default state
+	TTL string `json:"ttl,omitempty"`
+
+	// Optional user who opens or closes the gates
+	User string `json:"user,omitempty"`
+}
+
+// validate requires a known gate type and a valid label selector. The type is normalized like store.NewStoreKey.
+func (p *SelectorPayload) validate() []FieldError {
+	p.Type = store.NormalizeGate(p.Type)
+	fields := requireFields(map[string]string{"selector": p.Selector, "type": string(p.Type)})
+	if p.Type != "" && !slices.Contains(store.GateTypes, p.Type) {
+		fields = append(fields, FieldError{Field: "type", Reason: fmt.Sprintf("unknown gate [%s]", p.Type)})
+	}
+	if strings.TrimSpace(p.Selector) != "" {
+		if _, err := labels.Parse(p.Selector); err != nil {
+			fields = append(fields, FieldError{Field: "selector", Reason: err.Error()})
+		}
+	}
+	return fields
+}
+
+// OpenSelectedGates opens the gate of every CanaryGate which matches the label selector, see setSelectedGates.
+func (h *FlaggerHandler) OpenSelectedGates(canaryGates informers.GenericInformer) http.Handler {
+	return traced("/selector/open", func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		h.setSelectedGates(w, r, canaryGates, true)
+	})
+}
+
+// CloseSelectedGates closes the gate of every CanaryGate which matches the label selector, e.g. to hold the
+// promotions of a team during a release freeze, see setSelectedGates.
+func (h *FlaggerHandler) CloseSelectedGates(canaryGates informers.GenericInformer) http.Handler {
+	return traced("/selector/close", func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		h.setSelectedGates(w, r, canaryGates, false)
+	})
+}
+
+// setSelectedGates changes the gate of the CanaryGates which the informer lists with the label selector, and answers
+// the new status of the gate of each deployment. A gate whose dependencies are closed or which is in the cooldown after
+// a rollback is not opened, and a gate which requires multiple approvers is approved by the user, like /open. It answers 503 until the informer is synced.
+func (h *FlaggerHandler) setSelectedGates(w http.ResponseWriter, r *http.Request, canaryGates informers.GenericInformer, desired bool) {
+	payload, err := readPayload(r, w, SelectorPayload{})
+	if err != nil || !validPayload(w, payload) {
+		return
+	}
+	var ttl time.Duration
+	if desired && payload.TTL != "" {
+		ttl, err = time.ParseDuration(payload.TTL)
+		if err == nil && ttl <= 0 {
+			err = fmt.Errorf("ttl must be positive")
+		}
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+	}
+	force, err := isForced(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	if !canaryGates.Informer().HasSynced() {
+		w.Header().Set("Retry-After", syncRetryAfter)
+		http.Error(w, "canarygates are not synced", http.StatusServiceUnavailable)
+		return
+	}
+	selector, _ := labels.Parse(payload.Selector)
+	var objects []runtime.Object
+	if payload.Namespace == "" {
+		objects, err = canaryGates.Lister().List(selector)
+	} else {
+		objects, err = canaryGates.Lister().ByNamespace(payload.Namespace).List(selector)
+	}
+	if err != nil {
+		log.Error().Msgf("Unable to list canarygates with selector [%s] %v", payload.Selector, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	gateResponseMap := make(map[string][]CanaryGateStatus)
+	for _, object := range objects {
+		gate, err := meta.Accessor(object)
+		if err != nil {
+			continue
+		}
+		key := store.StoreKey{Namespace: gate.GetNamespace(), Name: gate.GetName(), Type: payload.Type}
+		traceGate(r.Context(), key)
+		status, approval := h.setSelectedGate(r, key, payload.User, ttl, desired, force)
+		h.createResponse(gateResponseMap, key.Namespace, key.Name, key.Type, status, h.store.GetChangedBy(r.Context(), key), approval)
+	}
+	log.Info().Msgf("Gate [%s] of %d canarygates with selector [%s] is set to [%s]", payload.Type, len(gateResponseMap), payload.Selector, store.GateStatus(desired))
+	writePayload(w, &gateResponseMap, http.StatusOK)
+}
+
+// setSelectedGate changes the gate of a selected CanaryGate and returns its new status. A confirm gate is not opened
+// during the cooldown after a rollback unless it is forced.
+func (h *FlaggerHandler) setSelectedGate(r *http.Request, key store.StoreKey, user string, ttl time.Duration, desired bool, force bool) (string, store.Approval) {
+	ctx := r.Context()
+	if !desired {
+		h.store.GateClose(ctx, key, user)
+		h.recordChange(ctx, key, false, user, "")
+		return store.GATE_CLOSE, store.Approval{}
+	}
+	closed, err := h.closedDependencies(ctx, key)
+	if err == nil && len(closed) > 0 {
+		err = fmt.Errorf("%s", dependencyReason(key, closed))
+	}
+	if conflict, _ := h.cooldownConflict(ctx, key); err == nil && conflict != nil && !force {
+		err = fmt.Errorf("%s", conflict.Reason)
+	}
+	var approval store.Approval
+	if err == nil {
+		approval, err = h.approveGate(ctx, key, ttl, user)
+	}
+	if err != nil {
+		log.Warn().Msgf("Gate [%s] is not opened: %v", key.String(), err)
+	}
+	return store.GateStatus(h.store.IsGateOpen(ctx, key)), approval
+}
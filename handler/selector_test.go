@@ -0,0 +1,113 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newTestCanaryGate returns a CanaryGate with the labels
+func newTestCanaryGate(namespace string, name string, labels map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "piggysec.com/v1alpha1",
+		"kind":       "CanaryGate",
+		"metadata":   map[string]any{"name": name, "namespace": namespace, "labels": labels},
+	}}
+}
+
+// newTestInformer returns the synced informer of the CanaryGates
+func newTestInformer(t *testing.T, objects ...runtime.Object) informers.GenericInformer {
+	client := dfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		store.GroupVersionResource: "CanaryGateList",
+	}, objects...)
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	informer := factory.ForResource(store.GroupVersionResource)
+	factory.Start(t.Context().Done())
+	require.True(t, cache.WaitForCacheSync(t.Context().Done(), informer.Informer().HasSynced))
+	return informer
+}
+
+func TestSelectedGates(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	canaryGates := newTestInformer(t,
+		newTestCanaryGate("team-a", "checkout", map[string]any{"team": "payments"}),
+		newTestCanaryGate("team-b", "billing", map[string]any{"team": "payments"}),
+		newTestCanaryGate("team-a", "search", map[string]any{"team": "discovery"}),
+	)
+	request := func(h http.Handler, payload SelectorPayload) (int, map[string][]CanaryGateStatus) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/selector", bytes.NewBuffer(buildPayload(&payload))))
+		response := map[string][]CanaryGateStatus{}
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		}
+		return w.Code, response
+	}
+	gate := func(namespace string, name string) store.StoreKey {
+		return store.StoreKey{Namespace: namespace, Name: name, Type: service.HookConfirmPromotion}
+	}
+
+	// the promotions of the team are frozen in every namespace
+	code, response := request(handler.CloseSelectedGates(canaryGates), SelectorPayload{Type: service.HookConfirmPromotion, Selector: "team=payments", User: "alice"})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string][]CanaryGateStatus{
+		"team-a/checkout": {{Type: service.HookConfirmPromotion, Name: "checkout", Namespace: "team-a", Status: store.GATE_CLOSE, ChangedBy: "alice"}},
+		"team-b/billing":  {{Type: service.HookConfirmPromotion, Name: "billing", Namespace: "team-b", Status: store.GATE_CLOSE, ChangedBy: "alice"}},
+	}, response)
+	require.False(t, storage.IsGateOpen(t.Context(), gate("team-a", "checkout")))
+	require.False(t, storage.IsGateOpen(t.Context(), gate("team-b", "billing")))
+	require.True(t, storage.IsGateOpen(t.Context(), gate("team-a", "search")))
+
+	// the namespace narrows the selection
+	code, response = request(handler.OpenSelectedGates(canaryGates), SelectorPayload{Type: service.HookConfirmPromotion, Namespace: "team-a", Selector: "team=payments"})
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, response, 1)
+	require.Equal(t, store.GATE_OPEN, response["team-a/checkout"][0].Status)
+	require.True(t, storage.IsGateOpen(t.Context(), gate("team-a", "checkout")))
+	require.False(t, storage.IsGateOpen(t.Context(), gate("team-b", "billing")))
+
+	// no CanaryGate matches
+	code, response = request(handler.CloseSelectedGates(canaryGates), SelectorPayload{Type: service.HookConfirmPromotion, Selector: "team=unknown"})
+	require.Equal(t, http.StatusOK, code)
+	require.Empty(t, response)
+
+	// the selector and a single known gate are required
+	code, _ = request(handler.CloseSelectedGates(canaryGates), SelectorPayload{Type: service.HookConfirmPromotion})
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = request(handler.CloseSelectedGates(canaryGates), SelectorPayload{Type: service.HookAll, Selector: "team=payments"})
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = request(handler.CloseSelectedGates(canaryGates), SelectorPayload{Type: service.HookConfirmPromotion, Selector: "team in ("})
+	require.Equal(t, http.StatusBadRequest, code)
+}
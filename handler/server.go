@@ -1,29 +1,55 @@
 package handler
 
 import (
+	_ "embed"
 	"encoding/json"
 	"net/http"
 
+	"github.com/KongZ/canary-gate/store"
 	"github.com/rs/zerolog/log"
 )
 
-const version = "0.1.3"
+// Build information of the server, set through -ldflags "-X github.com/KongZ/canary-gate/handler.Version=..."
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
 
 // ServerVersion holds the server version information
 type ServerVersion struct {
 	// Version string
 	Version string `json:"version"`
+	// Commit SHA of the build
+	Commit string `json:"commit"`
+	// BuildDate of the binary
+	BuildDate string `json:"buildDate"`
 }
 
 type ServerHandler struct {
 }
 
+// openAPI is the OpenAPI document of the HTTP API, which is maintained by hand along with the payloads
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// OpenAPI handles the /openapi.json endpoint, returning the OpenAPI document of the HTTP API.
+func (h *ServerHandler) OpenAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(openAPI); err != nil {
+			log.Error().Msgf("Error while writing response: %v", err)
+		}
+	})
+}
+
 // Version handles the /version endpoint, returning the version of the canary-gate server.
 func (h *ServerHandler) Version() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		body, err := json.Marshal(&ServerVersion{Version: version})
+		body, err := json.Marshal(&ServerVersion{Version: Version, Commit: Commit, BuildDate: BuildDate})
 		if err != nil {
 			log.Error().Msgf("Error while marshaling version: %v", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -36,3 +62,24 @@ func (h *ServerHandler) Version() http.Handler {
 		}
 	})
 }
+
+// Healthz handles the /healthz endpoint of the server port, which reports that the server is alive.
+func (h *ServerHandler) Healthz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("ok"))
+	})
+}
+
+// Readyz handles the /readyz endpoint of the server port, which fails with 503 when the store backend is unreachable.
+func (h *ServerHandler) Readyz(stor store.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := stor.Health(r.Context()); err != nil {
+			log.Warn().Msgf("Store is not ready: %v", err)
+			http.Error(w, "store is not ready: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("ok"))
+	})
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/KongZ/canary-gate/store"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionHandler(t *testing.T) {
+	Version, Commit, BuildDate = "v1.2.3", "abc1234", "2025-01-02T03:04:05Z"
+	defer func() { Version, Commit, BuildDate = "dev", "", "" }()
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	w := httptest.NewRecorder()
+	(&ServerHandler{}).Version().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.JSONEq(t, `{"version":"v1.2.3","commit":"abc1234","buildDate":"2025-01-02T03:04:05Z"}`, w.Body.String())
+}
+
+// unhealthyStore is a store whose backend is unreachable
+type unhealthyStore struct {
+	store.Store
+}
+
+func (s *unhealthyStore) Health(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestHealthHandlers(t *testing.T) {
+	stor, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	h := &ServerHandler{}
+
+	w := httptest.NewRecorder()
+	h.Healthz().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "ok", w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.Readyz(stor).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// the server is alive but not ready when the store is unreachable
+	w = httptest.NewRecorder()
+	h.Readyz(&unhealthyStore{Store: stor}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Contains(t, w.Body.String(), "connection refused")
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&ServerHandler{}).OpenAPI().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	doc, err := openapi3.NewLoader().LoadFromData(w.Body.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.TODO()))
+	for _, path := range []string{"/open", "/close", "/reset", "/selector/open", "/selector/close", "/status", "/history", "/phases", "/freeze", "/version", "/event",
+		"/confirm-rollout", "/pre-rollout", "/rollout", "/confirm-traffic-increase", "/confirm-promotion", "/confirm-finalize", "/post-rollout", "/rollback"} {
+		require.NotNilf(t, doc.Paths.Find(path), "path %s", path)
+	}
+
+	// the schemas have the fields of the payloads
+	for name, payload := range map[string]any{
+		"CanaryGatePayload":    CanaryGatePayload{},
+		"SelectorPayload":      SelectorPayload{},
+		"CanaryWebhookPayload": CanaryWebhookPayload{},
+		"CanaryGateStatus":     CanaryGateStatus{},
+		"WebhookDecision":      WebhookDecision{},
+		"DependencyConflict":   DependencyConflict{},
+		"CooldownConflict":     CooldownConflict{},
+		"InvalidPayload":       InvalidPayload{},
+		"FieldError":           FieldError{},
+		"HistoryEntry":         store.HistoryEntry{},
+		"PhasesResponse":       PhasesResponse{},
+		"FreezePayload":        FreezePayload{},
+		"Freeze":               store.Freeze{},
+		"ServerVersion":        ServerVersion{},
+	} {
+		schema := doc.Components.Schemas[name]
+		require.NotNilf(t, schema, "schema %s", name)
+		var fields []string
+		typ := reflect.TypeOf(payload)
+		for i := range typ.NumField() {
+			field, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			fields = append(fields, field)
+		}
+		var properties []string
+		for property := range schema.Value.Properties {
+			properties = append(properties, property)
+		}
+		require.ElementsMatchf(t, fields, properties, "properties of schema %s", name)
+		for _, required := range schema.Value.Required {
+			require.Truef(t, slices.Contains(fields, required), "required %s of schema %s", required, name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog/log"
+)
+
+// GracefulShutdown rejects the new requests of the servers with 503, waits until their requests in flight complete or
+// the timeout passes, and only then shuts down the store. A webhook in flight is answered from the store, instead of
+// being rejected by a closed store and rolling back the canary during a rolling update of canary-gate.
+func GracefulShutdown(timeout time.Duration, synced *StoreSync, stor store.Store, servers ...*http.Server) error {
+	synced.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// the servers are drained together, so the timeout is shared
+	errs := make([]error, len(servers)+1)
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				log.Error().Msgf("Server %s Shutdown: %v", server.Addr, err)
+				errs[i] = err
+			}
+		}()
+	}
+	wg.Wait()
+	if err := stor.Shutdown(); err != nil {
+		log.Error().Msgf("Store Shutdown: %v", err)
+		errs[len(servers)] = err
+	}
+	return errors.Join(errs...)
+}
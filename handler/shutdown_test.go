@@ -0,0 +1,97 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+// closingStore is a store which closes every gate once it is shut down
+type closingStore struct {
+	store.Store
+	shutdown atomic.Bool
+}
+
+func (s *closingStore) GateState(ctx context.Context, key store.StoreKey) (bool, error) {
+	if s.shutdown.Load() {
+		return false, &store.UnavailableError{Key: key, Err: errors.New("store is shut down")}
+	}
+	return s.Store.GateState(ctx, key)
+}
+
+func (s *closingStore) Shutdown() error {
+	s.shutdown.Store(true)
+	return s.Store.Shutdown()
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	memory, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	stor := &closingStore{Store: memory}
+	synced := NewStoreSync(t.Context(), stor)
+	require.Eventually(t, synced.Synced, time.Second, 5*time.Millisecond)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), stor)
+	started, release := make(chan struct{}), make(chan struct{})
+	promotion := synced.Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		handler.ConfirmPromotion().ServeHTTP(w, r)
+	}))
+	server := httptest.NewServer(promotion)
+	defer server.Close()
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns"})
+
+	// a webhook is in flight when the shutdown begins
+	code := make(chan int, 1)
+	go func() {
+		resp, err := http.Post(server.URL+confirmPromotionPath, "application/json", bytes.NewBuffer(payload))
+		if err != nil {
+			code <- 0
+			return
+		}
+		_ = resp.Body.Close()
+		code <- resp.StatusCode
+	}()
+	<-started
+	done := make(chan error, 1)
+	go func() { done <- GracefulShutdown(time.Second, synced, stor, server.Config) }()
+	require.Eventually(t, synced.closing.Load, time.Second, 5*time.Millisecond)
+
+	// the new requests are rejected with 503 instead of 403, and the store is not shut down until the webhook completes
+	w := httptest.NewRecorder()
+	synced.Require(handler.ConfirmPromotion()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, confirmPromotionPath, bytes.NewBuffer(payload)))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, syncRetryAfter, w.Header().Get("Retry-After"))
+	require.False(t, stor.shutdown.Load())
+
+	// the webhook in flight is approved from the store
+	close(release)
+	require.Equal(t, http.StatusOK, <-code)
+	require.NoError(t, <-done)
+	require.True(t, stor.shutdown.Load())
+}
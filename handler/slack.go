@@ -0,0 +1,165 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog/log"
+	"github.com/slack-go/slack"
+)
+
+// SlackInteraction handles the Approve and Halt button callbacks of the Slack messages.
+// Approve opens the gate of the message and Halt closes it. The request must be signed with the Slack signing secret.
+func (h *FlaggerHandler) SlackInteraction(signingSecret string) http.Handler {
+	return traced("/slack/actions", func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		verifier, err := slack.NewSecretsVerifier(r.Header, signingSecret)
+		if err != nil {
+			log.Error().Msgf("Invalid slack request %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, err := io.ReadAll(io.TeeReader(r.Body, &verifier))
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		if err := verifier.Ensure(); err != nil {
+			log.Error().Msgf("Unable to verify slack request signature %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		var callback slack.InteractionCallback
+		if err := json.Unmarshal([]byte(form.Get("payload")), &callback); err != nil {
+			badRequest(w, err)
+			return
+		}
+		if callback.Type != slack.InteractionTypeBlockActions && callback.Type != slack.InteractionTypeInteractionMessage {
+			log.Debug().Msgf("Ignoring slack interaction [%s]", callback.Type)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		for _, action := range callback.ActionCallback.BlockActions {
+			h.handleSlackAction(r, &callback, service.HookType(action.BlockID), action.Value)
+		}
+		for _, action := range callback.ActionCallback.AttachmentActions {
+			h.handleSlackAction(r, &callback, service.HookConfirmPromotion, action.Value)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// handleSlackAction applies a single button action to the store and updates the original message.
+func (h *FlaggerHandler) handleSlackAction(r *http.Request, callback *slack.InteractionCallback, hookType service.HookType, value string) {
+	action, _, namespace, name, err := noti.ParseSlackAction(value)
+	if err != nil {
+		log.Error().Msgf("Unable to handle slack action %v", err)
+		return
+	}
+	if hookType == "" {
+		// messages sent before the gate type was carried in the block ID
+		hookType = service.HookConfirmPromotion
+	}
+	key, err := store.NewStoreKey(namespace, name, hookType)
+	if err != nil {
+		log.Error().Msgf("Unable to handle slack action %v", err)
+		return
+	}
+	status := store.GATE_CLOSE
+	msg := &slack.WebhookMessage{ReplaceOriginal: true}
+	if action == noti.SlackActionApprove {
+		closed, err := h.closedDependencies(r.Context(), key)
+		if err != nil {
+			log.Error().Msgf("Unable to list gates of [%s] %v", key.String(), err)
+			return
+		}
+		if len(closed) > 0 {
+			// only the user who clicked sees why the gate is not opened
+			reason := dependencyReason(key, closed)
+			log.Info().Msg(reason)
+			if callback.ResponseURL != "" {
+				reply := &slack.WebhookMessage{Text: reason, ResponseType: slack.ResponseTypeEphemeral}
+				if err := slack.PostWebhookContext(r.Context(), callback.ResponseURL, reply); err != nil {
+					log.Error().Msgf("Error while updating slack message %v", err)
+				}
+			}
+			return
+		}
+		approval, err := h.approveGate(r.Context(), key, 0, callback.User.Name)
+		if err != nil {
+			log.Error().Msgf("Unable to approve gate [%s] %v", key.String(), err)
+			return
+		}
+		if approval.Approved() {
+			status = store.GATE_OPEN
+			msg.Text = fmt.Sprintf("Gate [%s] is set to [%s] by <@%s>", key.String(), status, callback.User.ID)
+			if approval.Required > 1 {
+				msg.Text = fmt.Sprintf("Gate [%s] is set to [%s] by %s", key.String(), status, approval.ChangedBy())
+			}
+		} else {
+			// keep the buttons for the other approvers
+			msg.ReplaceOriginal = false
+			msg.ResponseType = slack.ResponseTypeInChannel
+			msg.Text = fmt.Sprintf("Gate [%s] is approved by <@%s>, %d of %d approvals", key.String(), callback.User.ID, len(approval.Approvers), approval.Required)
+		}
+	} else {
+		h.store.GateClose(r.Context(), key, callback.User.Name)
+		h.recordChange(r.Context(), key, false, callback.User.Name, "")
+		msg.Text = fmt.Sprintf("Gate [%s] is set to [%s] by <@%s>", key.String(), status, callback.User.ID)
+	}
+	log.Info().Msgf("Gate [%s] is set to [%s] by slack user [%s]", key.String(), status, callback.User.Name)
+	if callback.ResponseURL != "" {
+		if err := slack.PostWebhookContext(r.Context(), callback.ResponseURL, msg); err != nil {
+			log.Error().Msgf("Error while updating slack message %v", err)
+		}
+	}
+	if msg.ReplaceOriginal {
+		h.updateDecidedMessages(r.Context(), key, status, action, callback.User.ID)
+	}
+}
+
+// updateDecidedMessages updates the sent messages of the canary with the decision of the gate, which removes their buttons
+func (h *FlaggerHandler) updateDecidedMessages(ctx context.Context, key store.StoreKey, status string, action string, userID string) {
+	if h.noti == nil {
+		return
+	}
+	messages := h.store.GetMessages(ctx, store.StoreKey{Namespace: key.Namespace, Name: key.Name})
+	if len(messages) == 0 {
+		return
+	}
+	decision := "Approved"
+	if action == noti.SlackActionHalt {
+		decision = "Halted"
+	}
+	text := fmt.Sprintf("Gate [%s] is %s", key.String(), status)
+	if err := h.noti.UpdateMessages(messages, text, fmt.Sprintf("%s by <@%s>", decision, userID)); err != nil {
+		log.Error().Msgf("Error while updating message %v", err)
+	}
+}
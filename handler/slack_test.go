@@ -0,0 +1,139 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+const testSlackSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+func slackRequest(secret string, action string, hook service.HookType) *http.Request {
+	return slackTargetRequest(secret, action, hook, "canary-ns", "test-canary")
+}
+
+// slackTargetRequest clicks the button of the message of the gate of the namespace and name
+func slackTargetRequest(secret string, action string, hook service.HookType, namespace string, name string) *http.Request {
+	payload := fmt.Sprintf(`{"type":"block_actions","user":{"id":"U123","name":"kongz"},"actions":[{"action_id":"%s","block_id":"%s","value":"%s:k8s-cluster:%s:%s"}]}`, action, hook, action, namespace, name)
+	body := url.Values{"payload": {payload}}.Encode()
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":" + body))
+	req := httptest.NewRequest(http.MethodPost, "/slack/actions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestSlackInteraction(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+
+	// halt closes the gate
+	w := httptest.NewRecorder()
+	handler.SlackInteraction(testSlackSecret).ServeHTTP(w, slackRequest(testSlackSecret, noti.SlackActionHalt, service.HookConfirmPromotion))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.False(t, storage.IsGateOpen(context.TODO(), key))
+
+	// approve opens the gate
+	w = httptest.NewRecorder()
+	handler.SlackInteraction(testSlackSecret).ServeHTTP(w, slackRequest(testSlackSecret, noti.SlackActionApprove, service.HookConfirmPromotion))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, storage.IsGateOpen(context.TODO(), key))
+
+	// a request signed with another secret is rejected
+	w = httptest.NewRecorder()
+	handler.SlackInteraction(testSlackSecret).ServeHTTP(w, slackRequest("another-secret", noti.SlackActionHalt, service.HookConfirmPromotion))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.True(t, storage.IsGateOpen(context.TODO(), key))
+}
+
+// updatingNoti records the updates of the sent messages
+type updatingNoti struct {
+	noti.QuietNoti
+	texts    []string
+	contexts []string
+}
+
+func (u *updatingNoti) UpdateMessages(slackMessages map[string]string, text, context string) error {
+	u.texts = append(u.texts, text)
+	u.contexts = append(u.contexts, context)
+	return nil
+}
+
+func TestSlackInteractionUpdatesMessages(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	updates := &updatingNoti{}
+	handler := NewHandler(&cli.Command{}, updates, storage)
+	storage.SaveMessages(context.TODO(), store.StoreKey{Namespace: "canary-ns", Name: "test-canary"}, map[string]string{"C123": "1700000000.000100"})
+
+	w := httptest.NewRecorder()
+	handler.SlackInteraction(testSlackSecret).ServeHTTP(w, slackRequest(testSlackSecret, noti.SlackActionApprove, service.HookConfirmRollout))
+	require.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	handler.SlackInteraction(testSlackSecret).ServeHTTP(w, slackRequest(testSlackSecret, noti.SlackActionHalt, service.HookConfirmRollout))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, []string{"Gate [canary-ns/test-canary=confirm-rollout] is opened", "Gate [canary-ns/test-canary=confirm-rollout] is closed"}, updates.texts)
+	require.Equal(t, []string{"Approved by <@U123>", "Halted by <@U123>"}, updates.contexts)
+}
+
+func TestSlackInteractionMultipleTargets(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	// the CanaryGate demo of gate-ns injects the webhooks into the canaries of its targets
+	canary := &CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns", Metadata: map[string]string{
+		service.MetaGateName:      "demo",
+		service.MetaGateNamespace: "gate-ns",
+	}}
+	gate := store.StoreKey{Namespace: "gate-ns", Name: "demo", Type: service.HookConfirmPromotion}
+	target := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+
+	// the message of the canary carries the CanaryGate, so halt closes the gate which the webhook reads
+	w := httptest.NewRecorder()
+	handler.SlackInteraction(testSlackSecret).ServeHTTP(w, slackTargetRequest(testSlackSecret, noti.SlackActionHalt, service.HookConfirmPromotion, "gate-ns", "demo"))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.False(t, storage.IsGateOpen(t.Context(), gate))
+	require.True(t, storage.IsGateOpen(t.Context(), target), "the canary should not get a gate of its own")
+	httpTest(t, handler.ConfirmPromotion(), confirmPromotionPath, buildPayload(canary), http.StatusForbidden, nil)
+
+	w = httptest.NewRecorder()
+	handler.SlackInteraction(testSlackSecret).ServeHTTP(w, slackTargetRequest(testSlackSecret, noti.SlackActionApprove, service.HookConfirmPromotion, "gate-ns", "demo"))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, storage.IsGateOpen(t.Context(), gate))
+	httpTest(t, handler.ConfirmPromotion(), confirmPromotionPath, buildPayload(canary), http.StatusOK, nil)
+}
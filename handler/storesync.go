@@ -0,0 +1,79 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog/log"
+)
+
+// syncRetryAfter is the Retry-After in seconds of the requests which are rejected before the store is synced
+const syncRetryAfter = "1"
+
+// StoreSync tracks the initial sync of the store, so the requests are not answered from a cache which is not
+// synced yet, and the shutdown of the server, so the requests are not answered from a store which is shut down.
+type StoreSync struct {
+	synced  atomic.Bool
+	closing atomic.Bool
+}
+
+// NewStoreSync waits for the sync of the store in the background until it succeeds or the context is done
+func NewStoreSync(ctx context.Context, stor store.Store) *StoreSync {
+	s := &StoreSync{}
+	go func() {
+		if err := stor.WaitForSync(ctx); err != nil {
+			log.Warn().Msgf("Store is not synced: %v", err)
+			return
+		}
+		log.Debug().Msg("Store is synced")
+		s.synced.Store(true)
+	}()
+	return s
+}
+
+// Synced reports whether the store has finished its initial sync
+func (s *StoreSync) Synced() bool {
+	return s.synced.Load()
+}
+
+// Close marks the beginning of the shutdown. The requests which arrive after it are rejected.
+func (s *StoreSync) Close() {
+	s.closing.Store(true)
+}
+
+// Require answers 503 Service Unavailable until the store is synced, and once the shutdown has begun. Flagger retries
+// a webhook which fails, so a gate is not rejected from a cache which does not have it yet or from a closed store.
+func (s *StoreSync) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.closing.Load() {
+			log.Debug().Msgf("Rejected request to %s from %s. Server is shutting down", r.URL.Path, r.RemoteAddr)
+			w.Header().Set("Retry-After", syncRetryAfter)
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		if !s.Synced() {
+			log.Debug().Msgf("Rejected request to %s from %s. Store is not synced", r.URL.Path, r.RemoteAddr)
+			w.Header().Set("Retry-After", syncRetryAfter)
+			http.Error(w, "store is not synced", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
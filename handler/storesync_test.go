@@ -0,0 +1,89 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+// unsyncedStore is a store whose cache is synced when the channel is closed
+type unsyncedStore struct {
+	store.Store
+	synced chan struct{}
+}
+
+func (s *unsyncedStore) WaitForSync(ctx context.Context) error {
+	select {
+	case <-s.synced:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestStoreSync(t *testing.T) {
+	memory, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	memory.GateClose(t.Context(), store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}, "")
+	stor := &unsyncedStore{Store: memory, synced: make(chan struct{})}
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), stor)
+	synced := NewStoreSync(t.Context(), stor)
+	promotion := synced.Require(handler.ConfirmPromotion())
+	readyz := synced.Require((&ServerHandler{}).Readyz(stor))
+	payload := buildPayload(&CanaryWebhookPayload{Name: "test-canary", Namespace: "canary-ns"})
+
+	// the webhook and the readiness fail with 503 until the store is synced
+	w := httptest.NewRecorder()
+	promotion.ServeHTTP(w, httptest.NewRequest(http.MethodPost, confirmPromotionPath, bytes.NewBuffer(payload)))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, syncRetryAfter, w.Header().Get("Retry-After"))
+	w = httptest.NewRecorder()
+	readyz.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.False(t, synced.Synced())
+
+	// the gate is read once the store is synced
+	close(stor.synced)
+	require.Eventually(t, synced.Synced, time.Second, 5*time.Millisecond)
+	w = httptest.NewRecorder()
+	promotion.ServeHTTP(w, httptest.NewRequest(http.MethodPost, confirmPromotionPath, bytes.NewBuffer(payload)))
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = httptest.NewRecorder()
+	readyz.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestStoreSyncCancelled(t *testing.T) {
+	memory, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	stor := &unsyncedStore{Store: memory, synced: make(chan struct{})}
+	ctx, cancel := context.WithCancel(t.Context())
+	synced := NewStoreSync(ctx, stor)
+	cancel()
+	// a store which is never synced keeps rejecting the requests
+	require.Never(t, synced.Synced, 50*time.Millisecond, 5*time.Millisecond)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/KongZ/canary-gate/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the requests. It is a no-op until a tracer provider is set.
+var tracer = otel.Tracer("github.com/KongZ/canary-gate/handler")
+
+// traced starts a server span for the request. The span continues the trace context of the request headers,
+// e.g. the traceparent header of a traced Flagger.
+func traced(name string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		next(w, r.WithContext(ctx))
+	})
+}
+
+// traceGate records the gate of the request in the span of the context
+func traceGate(ctx context.Context, key store.StoreKey) {
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("canary_gate.gate", string(key.Type)),
+		attribute.String("canary_gate.namespace", key.Namespace),
+		attribute.String("canary_gate.name", key.Name),
+	)
+}
+
+// traceDecision records the gate and the webhook decision in the span of the context
+func traceDecision(ctx context.Context, key store.StoreKey, approved bool) {
+	decision := decisionRejected
+	if approved {
+		decision = decisionApproved
+	}
+	traceGate(ctx, key)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("canary_gate.decision", decision))
+}
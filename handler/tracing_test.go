@@ -0,0 +1,72 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), store.NewTracingStore(storage))
+	payload := buildPayload(&CanaryWebhookPayload{Name: "traced-canary", Namespace: "canary-ns", Phase: service.PhasePromoting})
+	req := httptest.NewRequest(http.MethodPost, confirmPromotionPath, bytes.NewBuffer(payload))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ConfirmPromotion().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	spans := recorder.Ended()
+	var server, read sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		switch span.Name() {
+		case "/confirm-promotion":
+			server = span
+		case "store.GateState":
+			read = span
+		}
+	}
+	require.NotNil(t, server)
+	require.NotNil(t, read)
+	// the span continues the trace of the request and the store read is its child
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	require.Equal(t, server.SpanContext().SpanID(), read.Parent().SpanID())
+	require.Contains(t, server.Attributes(), attribute.String("canary_gate.gate", "confirm-promotion"))
+	require.Contains(t, server.Attributes(), attribute.String("canary_gate.namespace", "canary-ns"))
+	require.Contains(t, server.Attributes(), attribute.String("canary_gate.decision", decisionApproved))
+	require.Contains(t, read.Attributes(), attribute.Bool("canary_gate.open", true))
+}
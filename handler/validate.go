@@ -0,0 +1,149 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/rs/zerolog/log"
+)
+
+// InvalidPayload is the body of the 400 Bad Request answered to a payload with missing or invalid fields
+type InvalidPayload struct {
+	// Error summarizes the invalid fields
+	Error string `json:"error"`
+	// Fields lists the invalid fields
+	Fields []FieldError `json:"fields"`
+}
+
+// FieldError explains why a field of the payload is invalid
+type FieldError struct {
+	// Field is the JSON name of the field
+	Field string `json:"field"`
+	// Reason explains why the field is invalid
+	Reason string `json:"reason"`
+}
+
+// validator is implemented by the payloads which have required fields. validPayload rejects the payloads whose
+// validate returns any field error.
+type validator interface {
+	validate() []FieldError
+}
+
+// validate requires the name and namespace of the canary, which Flagger always sends
+func (p *CanaryWebhookPayload) validate() []FieldError {
+	fields := requireFields(map[string]string{"name": p.Name, "namespace": p.Namespace})
+	return append(fields, keyFields(&p.Namespace, &p.Name)...)
+}
+
+// validate requires the name, namespace and a known gate type, or all. The type is not required when the payload
+// lists the known gates in types instead. The namespace, name and types are normalized like store.NewStoreKey.
+func (p *CanaryGatePayload) validate() []FieldError {
+	required := map[string]string{"name": p.Name, "namespace": p.Namespace}
+	if len(p.Types) == 0 {
+		required["type"] = string(p.Type)
+	}
+	fields := requireFields(required)
+	fields = append(fields, keyFields(&p.Namespace, &p.Name)...)
+	p.Type = store.NormalizeGate(p.Type)
+	for i, t := range p.Types {
+		p.Types[i] = store.NormalizeGate(t)
+	}
+	if p.Type != "" && p.Type != service.HookAll && !slices.Contains(store.GateTypes, p.Type) {
+		fields = append(fields, FieldError{Field: "type", Reason: fmt.Sprintf("unknown gate [%s]", p.Type)})
+	}
+	if len(p.Types) > 0 && p.Type != "" {
+		fields = append(fields, FieldError{Field: "types", Reason: "cannot be used with type"})
+	}
+	for i, t := range p.Types {
+		if !slices.Contains(store.GateTypes, t) {
+			fields = append(fields, FieldError{Field: "types", Reason: fmt.Sprintf("unknown gate [%s]", t)})
+		} else if slices.Contains(p.Types[:i], t) {
+			fields = append(fields, FieldError{Field: "types", Reason: fmt.Sprintf("duplicate gate [%s]", t)})
+		}
+	}
+	return fields
+}
+
+// requireSingleGate rejects the all type and the types of the requests which change a single gate
+func (p *CanaryGatePayload) requireSingleGate(w http.ResponseWriter) bool {
+	if p.Type != service.HookAll && len(p.Types) == 0 {
+		return true
+	}
+	field := "type"
+	if len(p.Types) > 0 {
+		field = "types"
+	}
+	invalidPayload(w, []FieldError{{Field: field, Reason: "a single gate is required"}})
+	return false
+}
+
+// keyFields returns the error of the namespace or the name which is not valid in a store key, and normalizes them
+// otherwise. The empty fields are left to requireFields.
+func keyFields(namespace *string, name *string) []FieldError {
+	if strings.TrimSpace(*namespace) == "" || strings.TrimSpace(*name) == "" {
+		return nil
+	}
+	key, err := store.NewStoreKey(*namespace, *name, "")
+	if keyErr := (*store.KeyError)(nil); errors.As(err, &keyErr) {
+		return []FieldError{{Field: keyErr.Field, Reason: keyErr.Reason}}
+	}
+	*namespace, *name = key.Namespace, key.Name
+	return nil
+}
+
+// requireFields returns an error for each empty field, sorted by field name
+func requireFields(values map[string]string) []FieldError {
+	var fields []FieldError
+	for field, value := range values {
+		if strings.TrimSpace(value) == "" {
+			fields = append(fields, FieldError{Field: field, Reason: "required"})
+		}
+	}
+	slices.SortFunc(fields, func(a, b FieldError) int { return strings.Compare(a.Field, b.Field) })
+	return fields
+}
+
+// invalidPayload answers 400 Bad Request with the invalid fields
+func invalidPayload(w http.ResponseWriter, fields []FieldError) {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Field
+	}
+	payload := &InvalidPayload{Error: "invalid fields: " + strings.Join(names, ", "), Fields: fields}
+	log.Error().Msgf("Invalid request payload %s", payload.Error)
+	w.Header().Set("Content-Type", "application/json")
+	writePayload(w, payload, http.StatusBadRequest)
+}
+
+// errInvalidPayload is returned by the readers of the payloads which have answered 400 Bad Request with the invalid fields
+var errInvalidPayload = errors.New("invalid payload")
+
+// validPayload answers 400 Bad Request with the invalid fields of the payload and returns false, or returns true
+func validPayload(w http.ResponseWriter, payload validator) bool {
+	fields := payload.validate()
+	if len(fields) == 0 {
+		return true
+	}
+	invalidPayload(w, fields)
+	return false
+}
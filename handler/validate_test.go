@@ -0,0 +1,111 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/KongZ/canary-gate/store"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func TestInvalidPayload(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	malformed := func(namespace string, name string) []FieldError {
+		var keyErr *store.KeyError
+		_, err := store.NewStoreKey(namespace, name, "")
+		require.ErrorAs(t, err, &keyErr)
+		return []FieldError{{Field: keyErr.Field, Reason: keyErr.Reason}}
+	}
+
+	cases := []struct {
+		name    string
+		handler http.Handler
+		req     *http.Request
+		fields  []FieldError
+	}{
+		{"open without name", handler.OpenGate(), post("/open", &CanaryGatePayload{Type: key.Type, Namespace: key.Namespace}),
+			[]FieldError{{Field: "name", Reason: "required"}}},
+		{"open without namespace", handler.OpenGate(), post("/open", &CanaryGatePayload{Type: key.Type, Name: key.Name}),
+			[]FieldError{{Field: "namespace", Reason: "required"}}},
+		{"open without type", handler.OpenGate(), post("/open", &CanaryGatePayload{Namespace: key.Namespace, Name: key.Name}),
+			[]FieldError{{Field: "type", Reason: "required"}}},
+		{"open all gates", handler.OpenGate(), post("/open", &CanaryGatePayload{Type: service.HookAll, Namespace: key.Namespace, Name: key.Name}),
+			[]FieldError{{Field: "type", Reason: "a single gate is required"}}},
+		{"close empty", handler.CloseGate(), post("/close", &CanaryGatePayload{}),
+			[]FieldError{{Field: "name", Reason: "required"}, {Field: "namespace", Reason: "required"}, {Field: "type", Reason: "required"}}},
+		{"close unknown gate", handler.CloseGate(), post("/close", &CanaryGatePayload{Type: "promote", Namespace: key.Namespace, Name: key.Name}),
+			[]FieldError{{Field: "type", Reason: "unknown gate [promote]"}}},
+		{"close malformed namespace", handler.CloseGate(), post("/close", &CanaryGatePayload{Type: key.Type, Namespace: "canary:ns", Name: key.Name}),
+			malformed("canary:ns", key.Name)},
+		{"open malformed name", handler.OpenGate(), post("/open", &CanaryGatePayload{Type: key.Type, Namespace: key.Namespace, Name: "Test Canary"}),
+			malformed(key.Namespace, "Test Canary")},
+		{"webhook malformed name", handler.ConfirmPromotion(), post(confirmPromotionPath, &CanaryWebhookPayload{Namespace: key.Namespace, Name: "test/canary"}),
+			malformed(key.Namespace, "test/canary")},
+		{"status without name", handler.StatusGate(), post("/status", &CanaryGatePayload{Type: service.HookAll, Namespace: key.Namespace}),
+			[]FieldError{{Field: "name", Reason: "required"}}},
+		{"status query without namespace", handler.StatusGate(), httptest.NewRequest(http.MethodGet, "/status?name=test-canary", nil),
+			[]FieldError{{Field: "namespace", Reason: "required"}}},
+		{"webhook without name", handler.ConfirmPromotion(), post(confirmPromotionPath, &CanaryWebhookPayload{Namespace: key.Namespace}),
+			[]FieldError{{Field: "name", Reason: "required"}}},
+		{"webhook without namespace", handler.Rollback(), post(rollbackPath, &CanaryWebhookPayload{Name: key.Name}),
+			[]FieldError{{Field: "namespace", Reason: "required"}}},
+		{"event empty", handler.Event(), post(eventPath, &CanaryWebhookPayload{}),
+			[]FieldError{{Field: "name", Reason: "required"}, {Field: "namespace", Reason: "required"}}},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		c.handler.ServeHTTP(w, c.req)
+		require.Equalf(t, http.StatusBadRequest, w.Code, "[%s] status code", c.name)
+		require.Equalf(t, "application/json", w.Header().Get("Content-Type"), "[%s] content type", c.name)
+		var body InvalidPayload
+		require.NoErrorf(t, json.Unmarshal(w.Body.Bytes(), &body), "[%s] body", c.name)
+		require.Equalf(t, c.fields, body.Fields, "[%s] fields", c.name)
+		require.NotEmptyf(t, body.Error, "[%s] error", c.name)
+	}
+
+	// no gate is changed by an invalid request
+	require.Empty(t, storage.GetHistory(t.Context(), store.StoreKey{Namespace: key.Namespace, Name: key.Name}))
+}
+
+func TestNormalizedPayload(t *testing.T) {
+	storage, err := store.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(&cli.Command{}, noti.NewQuietNoti(), storage)
+	key := store.StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+
+	w := httptest.NewRecorder()
+	handler.CloseGate().ServeHTTP(w, post("/close", &CanaryGatePayload{Type: " Confirm-Promotion ", Namespace: " canary-ns", Name: "test-canary "}))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.False(t, storage.IsGateOpen(t.Context(), key))
+	var body map[string][]CanaryGateStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, key.Type, body["canary-ns/test-canary"][0].Type)
+}
+
+func post[I any](target string, payload *I) *http.Request {
+	return httptest.NewRequest(http.MethodPost, target, bytes.NewBuffer(buildPayload(payload)))
+}
@@ -28,9 +28,13 @@ import (
 
 	"github.com/KongZ/canary-gate/handler"
 	"github.com/KongZ/canary-gate/noti"
+	"github.com/KongZ/canary-gate/service"
 	"github.com/KongZ/canary-gate/store"
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/klog"
 
@@ -49,20 +53,69 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 const (
 	defaultAddress           = ":8080"
 	defaultControllerAddress = ":8081"
 	defaultMetricsAddress    = ":9090"
+	defaultTLSAddress        = ":8443"
 
 	flagVerbose           = "verbose"
 	flagListenAddress     = "listen-address"
+	flagBasePath          = "base-path"
 	flagControllerAddress = "controller-address"
 	flagMetricsAddress    = "metrics-address"
 	flagSlackToken        = "slack-token"
 	flagSlackChannel      = "slack-channel"
+	flagSlackSecret       = "slack-signing-secret"
+	flagTeamsWebhookURL   = "teams-webhook-url"
+	flagTeamsActionURL    = "teams-action-url"
+	flagDiscordWebhookURL = "discord-webhook-url"
+	flagGoogleChatURL     = "google-chat-webhook-url"
+	flagWebhookURL        = "webhook-url"
+	flagWebhookHeader     = "webhook-header"
+	flagWebhookSecret     = "webhook-secret"
+	flagResponseSecret    = "response-secret"
+	flagPagerDutyKey      = "pagerduty-routing-key"
+	flagSNSTopicARN       = "sns-topic-arn"
+	flagSNSRegion         = "sns-region"
+	flagNotifier          = "notifier"
+	flagAPIToken          = "api-token"
 	flagKubernetesClient  = "kubernetes-client"
+	flagBackend           = "backend"
+	flagGateRateLimit     = "gate-rate-limit"
+	flagGateRateBurst     = "gate-rate-burst"
+	flagEventLogSampling  = "event-log-sampling"
+	flagAccessLogExclude  = "access-log-exclude"
+	flagAuditLog          = "audit-log"
+	flagAuditLogFormat    = "audit-log-format"
+	flagAlertNamespace    = "alert-namespace-label"
+	flagAlertName         = "alert-deployment-label"
+	flagAlertGates        = "alert-gates"
+	flagDefaultClosed     = "default-closed-gates"
+	flagResyncInterval    = "resync-interval"
+	flagRollbackCooldown  = "rollback-cooldown"
+	flagShutdownTimeout   = "shutdown-timeout"
+	flagNotifyWindow      = "notification-window"
+	flagNotifyMetadata    = "notification-metadata"
+	flagDisableGateMetric = "disable-gate-metrics"
+	flagTLSAddress        = "tls-listen-address"
+	flagTLSCert           = "tls-cert"
+	flagTLSKey            = "tls-key"
+	flagTLSClientCA       = "tls-client-ca"
+
+	// leader election of the controller
+	flagDisableLeaderElection   = "disable-leader-election"
+	flagLeaderElectionID        = "leader-election-id"
+	flagLeaderElectionNamespace = "leader-election-namespace"
+	flagLeaseDuration           = "leader-election-lease-duration"
+	flagRenewDeadline           = "leader-election-renew-deadline"
+	flagRetryPeriod             = "leader-election-retry-period"
 )
 
 var (
@@ -97,6 +150,32 @@ func main() {
 				Value:   defaultAddress,
 				Sources: cli.EnvVars("LISTEN_ADDRESS"),
 			},
+			&cli.StringFlag{
+				Name:    flagBasePath,
+				Usage:   "Set the path prefix of the server and the webhook URLs, e.g. /canary-gate behind a sub-path ingress",
+				Sources: cli.EnvVars("CANARY_GATE_BASE_PATH"),
+			},
+			&cli.StringFlag{
+				Name:    flagTLSAddress,
+				Usage:   fmt.Sprintf("Set TLS server port, which is started when the certificate is set. Default is %s", defaultTLSAddress),
+				Value:   defaultTLSAddress,
+				Sources: cli.EnvVars("TLS_LISTEN_ADDRESS"),
+			},
+			&cli.StringFlag{
+				Name:    flagTLSCert,
+				Usage:   "Set the certificate file of the TLS server",
+				Sources: cli.EnvVars("CANARY_GATE_TLS_CERT"),
+			},
+			&cli.StringFlag{
+				Name:    flagTLSKey,
+				Usage:   "Set the key file of the TLS server",
+				Sources: cli.EnvVars("CANARY_GATE_TLS_KEY"),
+			},
+			&cli.StringFlag{
+				Name:    flagTLSClientCA,
+				Usage:   "Set the CA file which signs the client certificates required by the TLS server",
+				Sources: cli.EnvVars("CANARY_GATE_TLS_CLIENT_CA"),
+			},
 			&cli.StringFlag{
 				Name:    flagControllerAddress,
 				Usage:   fmt.Sprintf("Set controller port. Default is %s", defaultControllerAddress),
@@ -123,6 +202,219 @@ func main() {
 				Sources: cli.EnvVars("SLACK_CHANNEL"),
 				Hidden:  true, // Slack integration is not completely implemented yet
 			},
+			&cli.StringFlag{
+				Name:    flagSlackSecret,
+				Usage:   "Set Slack Signing Secret to verify the interactive button callbacks",
+				Value:   "",
+				Sources: cli.EnvVars("SLACK_SIGNING_SECRET"),
+				Hidden:  true, // Slack integration is not completely implemented yet
+			},
+			&cli.StringFlag{
+				Name:    flagTeamsWebhookURL,
+				Usage:   "Set Microsoft Teams incoming webhook URL",
+				Value:   "",
+				Sources: cli.EnvVars("TEAMS_WEBHOOK_URL"),
+			},
+			&cli.StringFlag{
+				Name:    flagTeamsActionURL,
+				Usage:   "Set URL of the page which the Teams Approve and Halt buttons of the confirm gates open",
+				Value:   "",
+				Sources: cli.EnvVars("TEAMS_ACTION_URL"),
+			},
+			&cli.StringFlag{
+				Name:    flagDiscordWebhookURL,
+				Usage:   "Set Discord channel webhook URL",
+				Value:   "",
+				Sources: cli.EnvVars("DISCORD_WEBHOOK_URL"),
+			},
+			&cli.StringFlag{
+				Name:    flagGoogleChatURL,
+				Usage:   "Set Google Chat space incoming webhook URL",
+				Value:   "",
+				Sources: cli.EnvVars("GOOGLE_CHAT_WEBHOOK_URL"),
+			},
+			&cli.StringFlag{
+				Name:    flagWebhookURL,
+				Usage:   "Set URL which receives the notifications as JSON",
+				Value:   "",
+				Sources: cli.EnvVars("WEBHOOK_URL"),
+			},
+			&cli.StringFlag{
+				Name:    flagPagerDutyKey,
+				Usage:   "Set PagerDuty routing key which triggers an alert when a canary is rolled back or failed",
+				Value:   "",
+				Sources: cli.EnvVars("PAGERDUTY_ROUTING_KEY"),
+			},
+			&cli.StringFlag{
+				Name:    flagSNSTopicARN,
+				Usage:   "Set Amazon SNS topic ARN which receives the notifications as JSON",
+				Value:   "",
+				Sources: cli.EnvVars("SNS_TOPIC_ARN"),
+			},
+			&cli.StringFlag{
+				Name:    flagSNSRegion,
+				Usage:   "Set region of the Amazon SNS topic. The region of the topic ARN is used when it is empty",
+				Value:   "",
+				Sources: cli.EnvVars("SNS_REGION"),
+			},
+			&cli.StringSliceFlag{
+				Name:    flagNotifier,
+				Usage:   "Set comma-separated notifier URLs, whose scheme selects the notifier, e.g. slack://<token>@<channel>,webhook+https://example.com/hook",
+				Sources: cli.EnvVars("CANARY_GATE_NOTIFIER"),
+			},
+			&cli.StringFlag{
+				Name:    flagWebhookSecret,
+				Usage:   "Set secret to verify the Flagger webhook requests. Unverified requests are rejected",
+				Value:   "",
+				Sources: cli.EnvVars("CANARY_GATE_WEBHOOK_SECRET"),
+			},
+			&cli.StringFlag{
+				Name:    flagResponseSecret,
+				Usage:   "Set secret to sign the responses of the Flagger webhooks in the X-Canary-Gate-Signature header",
+				Value:   "",
+				Sources: cli.EnvVars("CANARY_GATE_RESPONSE_SECRET"),
+			},
+			&cli.StringFlag{
+				Name:    flagAPIToken,
+				Usage:   "Set token which is required to open, close and get status of the gates",
+				Value:   "",
+				Sources: cli.EnvVars("CANARY_GATE_API_TOKEN"),
+			},
+			&cli.BoolFlag{
+				Name:    flagDisableLeaderElection,
+				Usage:   "Disable the leader election of the controller, e.g. to run a single replica locally. Only one replica must run without it",
+				Sources: cli.EnvVars("CANARY_GATE_DISABLE_LEADER_ELECTION"),
+			},
+			&cli.StringFlag{
+				Name:    flagLeaderElectionID,
+				Usage:   "Set name of the lease which holds the leader election of the controller",
+				Value:   "9f9b5a17.piggysec.com",
+				Sources: cli.EnvVars("CANARY_GATE_LEADER_ELECTION_ID"),
+			},
+			&cli.StringFlag{
+				Name:    flagLeaderElectionNamespace,
+				Usage:   "Set namespace of the lease of the leader election. Defaults to the namespace of Canary Gate",
+				Sources: cli.EnvVars("CANARY_GATE_LEADER_ELECTION_NAMESPACE", "CANARY_GATE_NAMESPACE"),
+			},
+			&cli.DurationFlag{
+				Name:    flagLeaseDuration,
+				Usage:   "Set duration which the other replicas wait before they take the lease of a leader which stops renewing it",
+				Value:   15 * time.Second,
+				Sources: cli.EnvVars("CANARY_GATE_LEADER_ELECTION_LEASE_DURATION"),
+			},
+			&cli.DurationFlag{
+				Name:    flagRenewDeadline,
+				Usage:   "Set duration which the leader retries to renew the lease before it gives up the leadership",
+				Value:   10 * time.Second,
+				Sources: cli.EnvVars("CANARY_GATE_LEADER_ELECTION_RENEW_DEADLINE"),
+			},
+			&cli.DurationFlag{
+				Name:    flagRetryPeriod,
+				Usage:   "Set duration which the replicas wait between the attempts to take or renew the lease",
+				Value:   2 * time.Second,
+				Sources: cli.EnvVars("CANARY_GATE_LEADER_ELECTION_RETRY_PERIOD"),
+			},
+			&cli.StringFlag{
+				Name:    flagBackend,
+				Usage:   "Set default backend of the CanaryGates which do not set spec.backend, either flagger or argo",
+				Value:   piggysecv1alpha1.BackendFlagger,
+				Sources: cli.EnvVars("CANARY_GATE_BACKEND"),
+			},
+			&cli.FloatFlag{
+				Name:    flagGateRateLimit,
+				Usage:   "Set number of changes per second allowed for each gate through /open and /close. 0 disables the limit",
+				Value:   1,
+				Sources: cli.EnvVars("CANARY_GATE_RATE_LIMIT"),
+			},
+			&cli.IntFlag{
+				Name:    flagGateRateBurst,
+				Usage:   "Set number of changes of a gate allowed at once before the rate limit applies",
+				Value:   10,
+				Sources: cli.EnvVars("CANARY_GATE_RATE_BURST"),
+			},
+			&cli.IntFlag{
+				Name:    flagEventLogSampling,
+				Usage:   "Set number of repeats of a Flagger event logged once after its phase or checksum is unchanged. 0 logs every event. The suppressed events are logged in debug mode",
+				Value:   10,
+				Sources: cli.EnvVars("CANARY_GATE_EVENT_LOG_SAMPLING"),
+			},
+			&cli.StringSliceFlag{
+				Name:    flagAccessLogExclude,
+				Usage:   "Set paths whose requests are not written to the access log, which is logged in debug mode",
+				Value:   []string{"/metrics", "/healthz"},
+				Sources: cli.EnvVars("CANARY_GATE_ACCESS_LOG_EXCLUDE"),
+			},
+			&cli.StringFlag{
+				Name:    flagAuditLog,
+				Usage:   "Set the destination of the audit log, which has a line for every gate change and webhook decision: stdout, stderr or the path of a file. Empty disables the audit log",
+				Sources: cli.EnvVars("CANARY_GATE_AUDIT_LOG"),
+			},
+			&cli.StringFlag{
+				Name:    flagAuditLogFormat,
+				Usage:   "Set the format of the lines of the audit log: json or logfmt",
+				Value:   handler.AuditFormatJSON,
+				Sources: cli.EnvVars("CANARY_GATE_AUDIT_LOG_FORMAT"),
+			},
+			&cli.DurationFlag{
+				Name:    flagNotifyWindow,
+				Usage:   "Set the window in which a repeated notification of the same gate and canary is dropped, and a different one updates the sent message. 0 sends every notification",
+				Sources: cli.EnvVars("CANARY_GATE_NOTIFICATION_WINDOW"),
+			},
+			&cli.StringSliceFlag{
+				Name:    flagNotifyMetadata,
+				Usage:   "Set keys of the Flagger metadata which are sent in the notifications, e.g. team,version. The name, namespace and cluster are always sent. Empty sends all of the metadata",
+				Sources: cli.EnvVars("CANARY_GATE_NOTIFICATION_METADATA"),
+			},
+			&cli.BoolFlag{
+				Name:    flagDisableGateMetric,
+				Usage:   "Disable /metrics/gates, which lists every gate in the store on each scrape",
+				Sources: cli.EnvVars("CANARY_GATE_DISABLE_GATE_METRICS"),
+			},
+			&cli.DurationFlag{
+				Name:    flagRollbackCooldown,
+				Usage:   "Set the duration after a rollback during which the confirm gates of the canary cannot be opened without force. 0 disables the cooldown",
+				Sources: cli.EnvVars("CANARY_GATE_ROLLBACK_COOLDOWN"),
+			},
+			&cli.DurationFlag{
+				Name:    flagShutdownTimeout,
+				Usage:   "Set the time to wait for the requests in flight on SIGTERM before the store is shut down",
+				Value:   20 * time.Second,
+				Sources: cli.EnvVars("CANARY_GATE_SHUTDOWN_TIMEOUT"),
+			},
+			&cli.DurationFlag{
+				Name:    flagResyncInterval,
+				Usage:   "Set the interval in which the controller re-asserts the gates injected into the Flagger Canaries and Argo Rollouts, e.g. when they are removed by hand. 0 disables the resync",
+				Value:   10 * time.Minute,
+				Sources: cli.EnvVars("CANARY_GATE_RESYNC_INTERVAL"),
+			},
+			&cli.StringSliceFlag{
+				Name:    flagDefaultClosed,
+				Usage:   "Set gates which are closed by default in addition to the rollback gate, e.g. confirm-promotion,confirm-rollout",
+				Sources: cli.EnvVars("CANARY_GATE_DEFAULT_CLOSED"),
+			},
+			&cli.StringFlag{
+				Name:    flagAlertNamespace,
+				Usage:   "Set label of the Alertmanager alerts which holds the namespace of the CanaryGate",
+				Value:   handler.DefaultAlertMapping.NamespaceLabel,
+				Sources: cli.EnvVars("CANARY_GATE_ALERT_NAMESPACE_LABEL"),
+			},
+			&cli.StringFlag{
+				Name:    flagAlertName,
+				Usage:   "Set label of the Alertmanager alerts which holds the name of the CanaryGate",
+				Value:   handler.DefaultAlertMapping.NameLabel,
+				Sources: cli.EnvVars("CANARY_GATE_ALERT_DEPLOYMENT_LABEL"),
+			},
+			&cli.StringSliceFlag{
+				Name:    flagAlertGates,
+				Usage:   "Set gates which are closed while an Alertmanager alert is firing",
+				Value:   []string{string(service.HookConfirmPromotion), string(service.HookConfirmTrafficIncrease)},
+				Sources: cli.EnvVars("CANARY_GATE_ALERT_GATES"),
+			},
+			&cli.StringMapFlag{
+				Name:    flagWebhookHeader,
+				Usage:   "Set headers of the notification webhook requests, e.g. Authorization=\"Bearer token\"",
+				Sources: cli.EnvVars("WEBHOOK_HEADERS"),
+			},
 		},
 	}
 	ctx := ctrl.SetupSignalHandler()
@@ -136,24 +428,67 @@ func main() {
 	}
 }
 
+// initTracing sets the tracer provider which exports the spans with OTLP over HTTP, configured by the standard
+// OTEL_EXPORTER_OTLP_* environment variables. Tracing stays a no-op and the returned shutdown is nil unless an OTLP
+// endpoint is set or OTEL_TRACES_EXPORTER is otlp.
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+	exporter := os.Getenv("OTEL_TRACES_EXPORTER")
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" || exporter == "none" {
+		return nil, nil
+	}
+	if exporter != "otlp" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil, nil
+	}
+	otlpExporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the OTLP trace exporter: %w", err)
+	}
+	// the sampler and the resource are read from OTEL_TRACES_SAMPLER, OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(otlpExporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	log.Info().Msg("OpenTelemetry tracing is enabled")
+	return provider.Shutdown, nil
+}
+
 // launchController starts the controller manager with the specified health checks.
-func launchController(ctx context.Context, cmd *cli.Command, livez, readyz healthz.Checker) {
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+func launchController(ctx context.Context, cmd *cli.Command, stor store.Store, notifier controller.GateNotifier, livez, readyz healthz.Checker) {
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		HealthProbeBindAddress: cmd.String(flagControllerAddress),
 		Metrics: metricsserver.Options{
 			BindAddress: cmd.String(flagMetricsAddress),
 		},
-		LeaderElection:   true,
-		LeaderElectionID: "9f9b5a17.piggysec.com",
-	})
+	}
+	if err := leaderElection(cmd, &options); err != nil {
+		log.Fatal().Msgf("Unable to start controller: %s", err)
+	}
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		log.Fatal().Msgf("Unable to start controller: %s", err)
 	}
+	// The scheduled gates are changed in the store, unless the store is the CanaryGate which the controller changes
+	var writer controller.GateWriter
+	switch os.Getenv("CANARY_GATE_STORE") {
+	case "configmap", "memory", "file", "sql":
+		writer = storeWriter{stor}
+	}
 	if err = (&controller.CanaryGateReconciler{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		Recorder: mgr.GetEventRecorderFor("canary-gate-controller"),
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		Recorder:      mgr.GetEventRecorderFor("canary-gate-controller"),
+		Backend:       cmd.String(flagBackend),
+		WebhookSecret: cmd.String(flagWebhookSecret),
+		DefaultClosed: cmd.StringSlice(flagDefaultClosed),
+		Gates:         stor,
+		Writer:        writer,
+		Notifier:      notifier,
+		// re-assert the injected gates, which are not watched in the Canaries which are not owned
+		ResyncInterval: cmd.Duration(flagResyncInterval),
+		// the Service is read without a cache, which would watch the Services of every namespace
+		ServiceNamespace: os.Getenv("CANARY_GATE_NAMESPACE"),
+		Reader:           mgr.GetAPIReader(),
+		BasePath:         handler.BasePath(cmd.String(flagBasePath)),
 	}).SetupWithManager(mgr); err != nil {
 		log.Fatal().Msgf("Unable to create controller: %s", err)
 	}
@@ -180,12 +515,101 @@ func launchController(ctx context.Context, cmd *cli.Command, livez, readyz healt
 	}
 }
 
+// leaderElection sets the leader election of the controller from the flags. The lease is kept in the namespace of
+// Canary Gate unless a namespace is set, and the leader election can be disabled to run a single replica.
+func leaderElection(cmd *cli.Command, options *ctrl.Options) error {
+	if cmd.Bool(flagDisableLeaderElection) {
+		log.Warn().Msg("Leader election is disabled, only one replica of the controller must run")
+		return nil
+	}
+	leaseDuration, renewDeadline, retryPeriod := cmd.Duration(flagLeaseDuration), cmd.Duration(flagRenewDeadline), cmd.Duration(flagRetryPeriod)
+	if leaseDuration <= renewDeadline || renewDeadline <= retryPeriod || retryPeriod <= 0 {
+		return fmt.Errorf("leader election requires lease duration > renew deadline > retry period > 0, got %s, %s and %s", leaseDuration, renewDeadline, retryPeriod)
+	}
+	options.LeaderElection = true
+	options.LeaderElectionID = cmd.String(flagLeaderElectionID)
+	options.LeaderElectionNamespace = cmd.String(flagLeaderElectionNamespace)
+	options.LeaseDuration = &leaseDuration
+	options.RenewDeadline = &renewDeadline
+	options.RetryPeriod = &retryPeriod
+	log.Info().Msgf("Leader election uses lease [%s] in namespace [%s]", options.LeaderElectionID, options.LeaderElectionNamespace)
+	return nil
+}
+
 // appHealthz is a health check function for the application.
 func appHealthz(r *http.Request) error {
 	// app health check always returns nil, indicating the application is healthy.
 	return nil
 }
 
+// storeReadyz is a readiness check which fails when the store is not synced yet or its backend is unreachable.
+func storeReadyz(stor store.Store, synced *handler.StoreSync) healthz.Checker {
+	return func(r *http.Request) error {
+		if !synced.Synced() {
+			return fmt.Errorf("store is not synced")
+		}
+		return stor.Health(r.Context())
+	}
+}
+
+// gateNotifier sends the messages of the gates which the controller changes automatically
+type gateNotifier struct {
+	*handler.FlaggerHandler
+}
+
+// NotifyAutoChange sends the message of the gate which is changed by its TTL or its schedule
+func (n gateNotifier) NotifyAutoChange(namespace string, name string, gate service.HookType, open bool, reason string) {
+	n.FlaggerHandler.NotifyAutoChange(store.StoreKey{Namespace: namespace, Name: name, Type: gate}, open, reason)
+}
+
+// storeWriter changes the gates of the store for the controller
+type storeWriter struct {
+	store.Store
+}
+
+// SetGate opens or closes the gate of the store
+func (w storeWriter) SetGate(ctx context.Context, namespace string, name string, gate service.HookType, open bool, user string) {
+	key := store.StoreKey{Namespace: namespace, Name: name, Type: gate}
+	if open {
+		w.GateOpen(ctx, key, user)
+	} else {
+		w.GateClose(ctx, key, user)
+	}
+}
+
+// alertMapping reads the mapping of the Alertmanager alerts to the gates from the flags.
+func alertMapping(cmd *cli.Command) (handler.AlertMapping, error) {
+	mapping := handler.AlertMapping{
+		NamespaceLabel: cmd.String(flagAlertNamespace),
+		NameLabel:      cmd.String(flagAlertName),
+	}
+	gates, err := store.ParseGateTypes(cmd.StringSlice(flagAlertGates))
+	if err != nil {
+		return mapping, fmt.Errorf("%w in --%s", err, flagAlertGates)
+	}
+	mapping.Gates = gates
+	return mapping, nil
+}
+
+// canaryGateInformer starts the informer of the CanaryGates of all namespaces, which selects the CanaryGates by their
+// labels. It returns nil when the Kubernetes config is not found, e.g. the memory store out of a cluster.
+func canaryGateInformer(ctx context.Context) informers.GenericInformer {
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		log.Warn().Msgf("Unable to load the Kubernetes config, the gates cannot be changed by a label selector: %v", err)
+		return nil
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Warn().Msgf("Unable to create the Kubernetes client, the gates cannot be changed by a label selector: %v", err)
+		return nil
+	}
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	informer := factory.ForResource(store.GroupVersionResource)
+	factory.Start(ctx.Done())
+	return informer
+}
+
 // launchServer starts the HTTP server for Canary Gate.
 func launchServer(ctx context.Context, cmd *cli.Command) error {
 	switch count := cmd.Count(flagVerbose); count {
@@ -215,67 +639,248 @@ func launchServer(ctx context.Context, cmd *cli.Command) error {
 	var stor store.Store
 	var err error
 
+	// the default states are set before the stores and the controller read them
+	defaultClosed, err := store.ParseGateTypes(cmd.StringSlice(flagDefaultClosed))
+	if err != nil {
+		return fmt.Errorf("%w in --%s", err, flagDefaultClosed)
+	}
+	store.SetDefaultClosed(defaultClosed)
+
 	storeName := os.Getenv("CANARY_GATE_STORE")
 	switch storeName {
 	case "configmap":
 		stor, err = store.NewConfigMapStore(nil)
 	case "memory":
 		stor, err = store.NewMemoryStore()
+	case "file":
+		stor, err = store.NewFileStore(os.Getenv("CANARY_GATE_FILE"))
+	case "sql":
+		driver := os.Getenv("CANARY_GATE_SQL_DRIVER")
+		if driver == "" {
+			driver = "postgres"
+		}
+		stor, err = store.NewSQLStore(driver, os.Getenv("CANARY_GATE_SQL_DSN"))
 	default:
 		stor, err = store.NewCanaryGateStore(nil)
 	}
 	if err != nil {
 		return err
 	}
+	// the freeze closes the confirm gates of every canary, regardless of the store
+	freezer, err := store.NewFreezeStore(stor, nil)
+	if err != nil {
+		return err
+	}
+	stor = freezer
+	shutdownTracing, err := initTracing(ctx)
+	if err != nil {
+		return err
+	}
+	if shutdownTracing != nil {
+		stor = store.NewTracingStore(stor)
+	}
 
-	slack := noti.NewSlackClient(noti.SlackOption{
-		Token:   cmd.String(flagSlackToken),
-		Channel: cmd.String(flagSlackChannel),
-	})
+	// Every configured notifier receives the messages
+	var notifiers []noti.Client
+	if cmd.String(flagSlackToken) != "" {
+		notifiers = append(notifiers, noti.NewSlackClient(noti.SlackOption{
+			Token:   cmd.String(flagSlackToken),
+			Channel: cmd.String(flagSlackChannel),
+		}))
+	}
+	if cmd.String(flagTeamsWebhookURL) != "" {
+		notifiers = append(notifiers, noti.NewTeamsClient(noti.TeamsOption{
+			WebhookURL: cmd.String(flagTeamsWebhookURL),
+			ActionURL:  cmd.String(flagTeamsActionURL),
+		}))
+	}
+	if cmd.String(flagDiscordWebhookURL) != "" {
+		notifiers = append(notifiers, noti.NewDiscordClient(noti.DiscordOption{
+			WebhookURL: cmd.String(flagDiscordWebhookURL),
+		}))
+	}
+	if cmd.String(flagGoogleChatURL) != "" {
+		notifiers = append(notifiers, noti.NewGoogleChatClient(noti.GoogleChatOption{
+			WebhookURL: cmd.String(flagGoogleChatURL),
+		}))
+	}
+	if cmd.String(flagWebhookURL) != "" {
+		notifiers = append(notifiers, noti.NewWebhookClient(noti.WebhookOption{
+			URL:     cmd.String(flagWebhookURL),
+			Headers: cmd.StringMap(flagWebhookHeader),
+		}))
+	}
+	if cmd.String(flagPagerDutyKey) != "" {
+		notifiers = append(notifiers, noti.NewPagerDutyClient(noti.PagerDutyOption{
+			RoutingKey: cmd.String(flagPagerDutyKey),
+		}))
+	}
+	if cmd.String(flagSNSTopicARN) != "" {
+		snsClient, err := noti.NewSNSClient(noti.SNSOption{
+			TopicARN: cmd.String(flagSNSTopicARN),
+			Region:   cmd.String(flagSNSRegion),
+		})
+		if err != nil {
+			return err
+		}
+		notifiers = append(notifiers, snsClient)
+	}
+	// The notifiers of the URLs are selected by the scheme of each URL
+	if urls := cmd.StringSlice(flagNotifier); len(urls) > 0 {
+		urlNotifier, err := noti.NewClientFromURLs(urls)
+		if err != nil {
+			return fmt.Errorf("%w in --%s", err, flagNotifier)
+		}
+		notifiers = append(notifiers, urlNotifier)
+	}
+	notifier := noti.NewThrottledClient(noti.NewMultiClient(notifiers...), cmd.Duration(flagNotifyWindow))
 
 	listenAddress := cmd.String(flagListenAddress)
 	mux := http.NewServeMux()
 	serverHandler := handler.ServerHandler{}
-	handler := handler.NewHandler(cmd, slack, stor)
-	mux.Handle("/confirm-rollout", handler.ConfirmRollout())
-	mux.Handle("/pre-rollout", handler.PreRollout())
-	mux.Handle("/rollout", handler.Rollout())
-	mux.Handle("/confirm-traffic-increase", handler.ConfirmTrafficIncrease())
-	mux.Handle("/confirm-promotion", handler.ConfirmPromotion())
-	mux.Handle("/post-rollout", handler.PostRollout())
-	mux.Handle("/rollback", handler.Rollback())
-	mux.Handle("/event", handler.Event())
-	mux.Handle("/open", handler.OpenGate())
-	mux.Handle("/close", handler.CloseGate())
-	mux.Handle("/status", handler.StatusGate())
+	// The gates are not read until the store is synced, so a cache which is not synced yet cannot reject a gate
+	synced := handler.NewStoreSync(ctx, stor)
+	// Flagger webhooks are verified when the webhook secret is set
+	webhook := synced.Require
+	if secret := cmd.String(flagWebhookSecret); secret != "" {
+		webhook = func(next http.Handler) http.Handler { return synced.Require(handler.VerifySignature(secret, next)) }
+	}
+	// The decisions of the webhooks are signed when the response secret is set
+	if secret := cmd.String(flagResponseSecret); secret != "" {
+		verified := webhook
+		webhook = func(next http.Handler) http.Handler { return handler.SignResponse(secret, verified(next)) }
+	}
+	// The gate API requires the token when it is set
+	api := synced.Require
+	if token := cmd.String(flagAPIToken); token != "" {
+		api = func(next http.Handler) http.Handler { return synced.Require(handler.RequireToken(token, next)) }
+	}
+	// The gate changes are limited, the Flagger webhooks are not since Flagger controls their cadence
+	limited := func(next http.Handler) http.Handler { return next }
+	if perSecond := cmd.Float(flagGateRateLimit); perSecond > 0 {
+		limiter := handler.NewGateLimiter(perSecond, int(cmd.Int(flagGateRateBurst)))
+		limited = limiter.Limit
+	}
+	mapping, err := alertMapping(cmd)
+	if err != nil {
+		return err
+	}
+	flaggerHandler := handler.NewHandler(cmd, notifier, stor)
+	flaggerHandler.SampleEvents(int(cmd.Int(flagEventLogSampling)))
+	flaggerHandler.AllowMetadata(cmd.StringSlice(flagNotifyMetadata))
+	flaggerHandler.RollbackCooldown(cmd.Duration(flagRollbackCooldown))
+	flaggerHandler.UseFreezer(freezer)
+	var audit *handler.AuditLogger
+	if destination := cmd.String(flagAuditLog); destination != "" {
+		if audit, err = handler.NewAuditLogger(destination, cmd.String(flagAuditLogFormat)); err != nil {
+			return fmt.Errorf("%w in --%s", err, flagAuditLog)
+		}
+		flaggerHandler.UseAuditLogger(audit)
+	}
+	// The gates which are reverted by their TTL are notified; the controller notifies the CanaryGate store and the schedule
+	store.SetExpiryNotifier(func(key store.StoreKey, open bool, ttl time.Duration) {
+		flaggerHandler.NotifyAutoChange(key, open, fmt.Sprintf("after its TTL of %s", ttl))
+	})
+	mux.Handle("/confirm-rollout", webhook(flaggerHandler.ConfirmRollout()))
+	mux.Handle("/pre-rollout", webhook(flaggerHandler.PreRollout()))
+	mux.Handle("/rollout", webhook(flaggerHandler.Rollout()))
+	mux.Handle("/confirm-traffic-increase", webhook(flaggerHandler.ConfirmTrafficIncrease()))
+	mux.Handle("/confirm-promotion", webhook(flaggerHandler.ConfirmPromotion()))
+	mux.Handle("/confirm-finalize", webhook(flaggerHandler.ConfirmFinalize()))
+	mux.Handle("/post-rollout", webhook(flaggerHandler.PostRollout()))
+	mux.Handle("/rollback", webhook(flaggerHandler.Rollback()))
+	mux.Handle("/event", webhook(flaggerHandler.Event()))
+	mux.Handle("/open", api(limited(flaggerHandler.OpenGate())))
+	mux.Handle("/close", api(limited(flaggerHandler.CloseGate())))
+	mux.Handle("/reset", api(limited(flaggerHandler.ResetGate())))
+	if canaryGates := canaryGateInformer(ctx); canaryGates != nil {
+		mux.Handle("/selector/open", api(limited(flaggerHandler.OpenSelectedGates(canaryGates))))
+		mux.Handle("/selector/close", api(limited(flaggerHandler.CloseSelectedGates(canaryGates))))
+	}
+	mux.Handle("/status", api(flaggerHandler.StatusGate()))
+	mux.Handle("/history", api(flaggerHandler.History()))
+	mux.Handle("/phases", api(flaggerHandler.Phases()))
+	mux.Handle("/freeze", api(limited(flaggerHandler.Freeze())))
+	mux.Handle("/alerts", api(flaggerHandler.AlertmanagerReceiver(mapping)))
 	mux.Handle("/metrics", promhttp.Handler())
+	if !cmd.Bool(flagDisableGateMetric) {
+		mux.Handle("/metrics/gates", synced.Require(flaggerHandler.GateMetrics()))
+	}
 	mux.Handle("/version", serverHandler.Version())
-	// Note: The health check endpoints are merged with the controller manager.
+	mux.Handle("/openapi.json", serverHandler.OpenAPI())
+	mux.Handle("/healthz", serverHandler.Healthz())
+	mux.Handle("/readyz", synced.Require(serverHandler.Readyz(stor)))
+	if cmd.String(flagSlackToken) != "" {
+		if secret := cmd.String(flagSlackSecret); secret != "" {
+			mux.Handle("/slack/actions", synced.Require(flaggerHandler.SlackInteraction(secret)))
+		} else {
+			log.Warn().Msg("Slack signing secret is not set. Slack interactive buttons are disabled")
+		}
+	}
+	// Note: The health check endpoints are also merged with the controller manager.
 	ch := make(chan struct{})
+	// The base path is stripped before the access log, so the excluded paths do not have it
+	logged := handler.Mount(handler.BasePath(cmd.String(flagBasePath)), handler.AccessLog(cmd.StringSlice(flagAccessLogExclude), mux))
 	server := http.Server{
 		Addr:              listenAddress,
-		Handler:           mux,
+		Handler:           logged,
 		ReadHeaderTimeout: 2 * time.Second,
 	}
 
+	// The TLS server serves the same endpoints to the clients which reach the service directly, and requires their
+	// certificates when the client CA is set. Flagger and the API server proxy keep using the plain server.
+	var tlsServer *http.Server
+	if cmd.String(flagTLSCert) != "" {
+		tlsConfig, err := handler.NewTLSConfig(cmd.String(flagTLSCert), cmd.String(flagTLSKey), cmd.String(flagTLSClientCA))
+		if err != nil {
+			return err
+		}
+		tlsServer = &http.Server{
+			Addr:              cmd.String(flagTLSAddress),
+			Handler:           logged,
+			TLSConfig:         tlsConfig,
+			ReadHeaderTimeout: 2 * time.Second,
+		}
+		go func() {
+			log.Info().Msgf("Listening on https://%s", tlsServer.Addr)
+			if err := tlsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				log.Fatal().Msgf("TLS server failed: %v", err)
+			}
+		}()
+	}
+
 	// start controller for CRD and health checks
-	go launchController(ctx, cmd, appHealthz, appHealthz)
+	go launchController(ctx, cmd, stor, gateNotifier{&flaggerHandler}, appHealthz, storeReadyz(stor, synced))
 
 	// start server
 	go func() {
 		sigint := make(chan os.Signal, 1)
 		signal.Notify(sigint, syscall.SIGTERM)
 		<-sigint
-		// We received an interrupt signal, shut down.
-		if err := stor.Shutdown(); err != nil {
-			log.Error().Msgf("Store Shutdown: %v", err)
+		// We received an interrupt signal. The requests in flight are drained before the store is shut down.
+		servers := []*http.Server{&server}
+		if tlsServer != nil {
+			servers = append(servers, tlsServer)
+		}
+		_ = handler.GracefulShutdown(cmd.Duration(flagShutdownTimeout), synced, stor, servers...)
+		if err := audit.Close(); err != nil {
+			log.Error().Msgf("Unable to close the audit log: %v", err)
 		}
-		if err := server.Shutdown(ctx); err != nil {
-			// Error from closing listeners, or context timeout:
-			log.Error().Msgf("HTTP server Shutdown: %v", err)
+		if shutdownTracing != nil {
+			// the signal context is already cancelled, the remaining spans are flushed within the shutdown timeout
+			tracingCtx, cancel := context.WithTimeout(context.Background(), cmd.Duration(flagShutdownTimeout))
+			if err := shutdownTracing(tracingCtx); err != nil {
+				log.Error().Msgf("Tracing Shutdown: %v", err)
+			}
+			cancel()
 		}
 		close(ch)
 	}()
 	log.Info().Msgf("Listening on http://%s", listenAddress)
-	return server.ListenAndServe()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	// ListenAndServe returns as soon as the shutdown begins, so wait until the requests are drained
+	<-ch
+	return nil
 }
@@ -0,0 +1,178 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+const (
+	// DiscordInstructionsURL is linked from the title of the messages. Discord webhooks cannot send interactive buttons,
+	// so the gates are opened with the CLI or the API.
+	DiscordInstructionsURL = "https://github.com/KongZ/canary-gate#cli-installation"
+
+	// discordMessageKey is the key of the message ID returned by SendMessages
+	discordMessageKey = "discord"
+
+	discordColorInfo     = 0x3498db
+	discordColorApproval = 0xf1c40f
+	discordColorRollback = 0xe74c3c
+)
+
+type DiscordOption struct {
+	// WebhookURL is the URL of the Discord channel webhook
+	WebhookURL string
+}
+
+type discordClientWrapper struct {
+	client     *http.Client
+	webhookURL string
+}
+
+type discordMessage struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []discordEmbed `json:"embeds,omitempty"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	URL         string         `json:"url,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+func init() {
+	// discord://<webhook host and path>
+	Register("discord", func(u *url.URL) (Client, error) {
+		webhookURL, err := targetURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return NewDiscordClient(DiscordOption{WebhookURL: webhookURL}), nil
+	})
+}
+
+func NewDiscordClient(option DiscordOption) Client {
+	if option.WebhookURL == "" {
+		return &QuietNoti{}
+	}
+
+	return &discordClientWrapper{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		webhookURL: option.WebhookURL,
+	}
+}
+
+func (w *discordClientWrapper) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
+	fields := make([]discordField, 0, len(meta))
+	for _, k := range slices.Sorted(maps.Keys(meta)) {
+		fields = append(fields, discordField{Name: k, Value: meta[k], Inline: true})
+	}
+	embed := discordEmbed{
+		Title:       messageHeader(hookType),
+		Description: text,
+		Color:       discordColor(hookType),
+		Fields:      fields,
+	}
+	if hookType != service.HookEvent {
+		embed.URL = DiscordInstructionsURL
+		embed.Description = fmt.Sprintf("%s\n\nOpen the gate with `canary-gate open %s --namespace %s --deployment %s`",
+			text, hookType, meta[service.MetaNamespace], meta[service.MetaName])
+	}
+	// wait=true makes Discord return the message, so its ID can be used to edit it
+	var sent struct {
+		ID string `json:"id"`
+	}
+	if err := w.request(http.MethodPost, w.webhookURL+"?wait=true", discordMessage{Embeds: []discordEmbed{embed}}, &sent); err != nil {
+		return nil, err
+	}
+	return map[string]string{discordMessageKey: sent.ID}, nil
+}
+
+// UpdateMessages edits the content of the sent message and keeps its embed.
+func (w *discordClientWrapper) UpdateMessages(slackMessages map[string]string, text, context string) error {
+	id, ok := slackMessages[discordMessageKey]
+	if !ok || id == "" {
+		return nil
+	}
+	content := text
+	if context != "" {
+		content = fmt.Sprintf("%s\n-# %s", text, context)
+	}
+	return w.request(http.MethodPatch, w.webhookURL+"/messages/"+url.PathEscape(id), discordMessage{Content: content}, nil)
+}
+
+// AddFileToThreads is not supported by the Discord notifier.
+func (w *discordClientWrapper) AddFileToThreads(slackMessages map[string]string, fileName, content string) error {
+	return nil
+}
+
+// request sends the message and decodes the response into result when it is not nil
+func (w *discordClientWrapper) request(method string, url string, msg discordMessage, result any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("discord: error encoding message: %w", err)
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("discord: error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("discord: error sending message: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("discord: error sending message: %s", resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("discord: error decoding response: %w", err)
+	}
+	return nil
+}
+
+// discordColor returns the color of the embed for the given hook type
+func discordColor(hook service.HookType) int {
+	switch hook {
+	case service.HookRollback:
+		return discordColorRollback
+	case service.HookConfirmRollout, service.HookConfirmTrafficIncrease, service.HookConfirmPromotion, service.HookConfirmFinalize:
+		return discordColorApproval
+	}
+	return discordColorInfo
+}
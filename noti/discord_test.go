@@ -0,0 +1,78 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+func TestDiscordClient(t *testing.T) {
+	var received []discordMessage
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg discordMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		received = append(received, msg)
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		_, _ = w.Write([]byte(`{"id":"1234"}`))
+	}))
+	defer server.Close()
+
+	discord := NewDiscordClient(DiscordOption{WebhookURL: server.URL})
+	meta := make(map[string]string)
+	meta["user"] = "kongz"
+	meta["cluster"] = "k8s-cluster"
+	meta["name"] = "test-canary"
+	meta["namespace"] = "canary-ns"
+	msgs, err := discord.SendMessages("Event", service.HookConfirmPromotion, meta)
+	if err != nil {
+		t.Error(err)
+	}
+	if msgs[discordMessageKey] != "1234" {
+		t.Errorf("unexpected message IDs %v", msgs)
+	}
+	if err := discord.UpdateMessages(msgs, "Canary [canary-ns/test-canary] is Succeeded", "by kongz"); err != nil {
+		t.Error(err)
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(received))
+	}
+	if requests[0] != "POST /?wait=true" || requests[1] != "PATCH /messages/1234" {
+		t.Errorf("unexpected requests %v", requests)
+	}
+	embed := received[0].Embeds[0]
+	if embed.Title != messageHeader(service.HookConfirmPromotion) || embed.URL != DiscordInstructionsURL {
+		t.Errorf("unexpected embed %v", embed)
+	}
+	if len(embed.Fields) != 4 || embed.Fields[0].Name != "cluster" {
+		t.Errorf("unexpected fields %v", embed.Fields)
+	}
+	if received[1].Content != "Canary [canary-ns/test-canary] is Succeeded\n-# by kongz" {
+		t.Errorf("unexpected content %s", received[1].Content)
+	}
+
+	// an unconfigured client is quiet
+	if _, ok := NewDiscordClient(DiscordOption{}).(*QuietNoti); !ok {
+		t.Error("expected quiet client")
+	}
+}
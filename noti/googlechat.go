@@ -0,0 +1,211 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+const (
+	// GoogleChatInstructionsURL is linked from the button of the messages. Chat incoming webhooks cannot send
+	// interactive buttons, so the gates are opened with the CLI or the API.
+	GoogleChatInstructionsURL = "https://github.com/KongZ/canary-gate#cli-installation"
+
+	// googleChatThreadKey is the key of the thread name returned by SendMessages
+	googleChatThreadKey = "googlechat"
+)
+
+type GoogleChatOption struct {
+	// WebhookURL is the URL of the Google Chat space incoming webhook
+	WebhookURL string
+}
+
+type googleChatClientWrapper struct {
+	client     *http.Client
+	webhookURL string
+}
+
+type googleChatMessage struct {
+	Text    string               `json:"text,omitempty"`
+	CardsV2 []googleChatCardV2   `json:"cardsV2,omitempty"`
+	Thread  *googleChatThreadRef `json:"thread,omitempty"`
+}
+
+type googleChatThreadRef struct {
+	Name string `json:"name"`
+}
+
+type googleChatCardV2 struct {
+	CardID string         `json:"cardId"`
+	Card   googleChatCard `json:"card"`
+}
+
+type googleChatCard struct {
+	Header   googleChatHeader    `json:"header"`
+	Sections []googleChatSection `json:"sections"`
+}
+
+type googleChatHeader struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+}
+
+type googleChatSection struct {
+	Widgets []googleChatWidget `json:"widgets"`
+}
+
+type googleChatWidget struct {
+	TextParagraph *googleChatText          `json:"textParagraph,omitempty"`
+	DecoratedText *googleChatDecoratedText `json:"decoratedText,omitempty"`
+	ButtonList    *googleChatButtonList    `json:"buttonList,omitempty"`
+}
+
+type googleChatText struct {
+	Text string `json:"text"`
+}
+
+type googleChatDecoratedText struct {
+	TopLabel string `json:"topLabel"`
+	Text     string `json:"text"`
+}
+
+type googleChatButtonList struct {
+	Buttons []googleChatButton `json:"buttons"`
+}
+
+type googleChatButton struct {
+	Text    string            `json:"text"`
+	OnClick googleChatOnClick `json:"onClick"`
+}
+
+type googleChatOnClick struct {
+	OpenLink googleChatLink `json:"openLink"`
+}
+
+type googleChatLink struct {
+	URL string `json:"url"`
+}
+
+func init() {
+	// googlechat://<webhook host, path and query>
+	Register("googlechat", func(u *url.URL) (Client, error) {
+		webhookURL, err := targetURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return NewGoogleChatClient(GoogleChatOption{WebhookURL: webhookURL}), nil
+	})
+}
+
+func NewGoogleChatClient(option GoogleChatOption) Client {
+	if option.WebhookURL == "" {
+		return &QuietNoti{}
+	}
+
+	return &googleChatClientWrapper{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		webhookURL: option.WebhookURL,
+	}
+}
+
+func (w *googleChatClientWrapper) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
+	widgets := []googleChatWidget{{TextParagraph: &googleChatText{Text: text}}}
+	for _, k := range slices.Sorted(maps.Keys(meta)) {
+		widgets = append(widgets, googleChatWidget{DecoratedText: &googleChatDecoratedText{TopLabel: k, Text: meta[k]}})
+	}
+	if hookType != service.HookEvent {
+		widgets = append(widgets,
+			googleChatWidget{TextParagraph: &googleChatText{Text: fmt.Sprintf("Open the gate with <code>canary-gate open %s --namespace %s --deployment %s</code>",
+				hookType, meta[service.MetaNamespace], meta[service.MetaName])}},
+			googleChatWidget{ButtonList: &googleChatButtonList{Buttons: []googleChatButton{
+				{Text: "Approval instructions", OnClick: googleChatOnClick{OpenLink: googleChatLink{URL: GoogleChatInstructionsURL}}},
+			}}},
+		)
+	}
+	card := googleChatCardV2{
+		CardID: string(hookType),
+		Card: googleChatCard{
+			Header:   googleChatHeader{Title: messageHeader(hookType), Subtitle: fmt.Sprintf("%s/%s", meta[service.MetaNamespace], meta[service.MetaName])},
+			Sections: []googleChatSection{{Widgets: widgets}},
+		},
+	}
+	// the thread of the message is returned, so the updates are replied in the thread
+	var sent struct {
+		Thread googleChatThreadRef `json:"thread"`
+	}
+	if err := w.post(w.webhookURL, googleChatMessage{CardsV2: []googleChatCardV2{card}}, &sent); err != nil {
+		return nil, err
+	}
+	return map[string]string{googleChatThreadKey: sent.Thread.Name}, nil
+}
+
+// UpdateMessages replies to the thread of the sent message since Chat incoming webhooks cannot edit a sent message.
+func (w *googleChatClientWrapper) UpdateMessages(slackMessages map[string]string, text, context string) error {
+	thread, ok := slackMessages[googleChatThreadKey]
+	if !ok || thread == "" {
+		return nil
+	}
+	if context != "" {
+		text = fmt.Sprintf("%s\n%s", text, context)
+	}
+	u, err := url.Parse(w.webhookURL)
+	if err != nil {
+		return fmt.Errorf("google chat: invalid webhook URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("messageReplyOption", "REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD")
+	u.RawQuery = query.Encode()
+	return w.post(u.String(), googleChatMessage{Text: text, Thread: &googleChatThreadRef{Name: thread}}, nil)
+}
+
+// AddFileToThreads is not supported by Chat incoming webhooks.
+func (w *googleChatClientWrapper) AddFileToThreads(slackMessages map[string]string, fileName, content string) error {
+	return nil
+}
+
+// post sends the message and decodes the response into result when it is not nil
+func (w *googleChatClientWrapper) post(url string, msg googleChatMessage, result any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("google chat: error encoding message: %w", err)
+	}
+	resp, err := w.client.Post(url, "application/json; charset=UTF-8", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("google chat: error sending message: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("google chat: error sending message: %s", resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("google chat: error decoding response: %w", err)
+	}
+	return nil
+}
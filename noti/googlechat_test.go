@@ -0,0 +1,82 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+func TestGoogleChatClient(t *testing.T) {
+	var received []googleChatMessage
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg googleChatMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		received = append(received, msg)
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		_, _ = w.Write([]byte(`{"name":"spaces/AAA/messages/BBB","thread":{"name":"spaces/AAA/threads/CCC"}}`))
+	}))
+	defer server.Close()
+
+	chat := NewGoogleChatClient(GoogleChatOption{WebhookURL: server.URL + "/v1/spaces/AAA/messages?key=k"})
+	meta := make(map[string]string)
+	meta["user"] = "kongz"
+	meta["cluster"] = "k8s-cluster"
+	meta["name"] = "test-canary"
+	meta["namespace"] = "canary-ns"
+	msgs, err := chat.SendMessages("Event", service.HookConfirmPromotion, meta)
+	if err != nil {
+		t.Error(err)
+	}
+	if msgs[googleChatThreadKey] != "spaces/AAA/threads/CCC" {
+		t.Errorf("unexpected message IDs %v", msgs)
+	}
+	if err := chat.UpdateMessages(msgs, "Canary [canary-ns/test-canary] is Succeeded", "by kongz"); err != nil {
+		t.Error(err)
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(received))
+	}
+	if requests[0] != "POST /v1/spaces/AAA/messages?key=k" || requests[1] != "POST /v1/spaces/AAA/messages?key=k&messageReplyOption=REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD" {
+		t.Errorf("unexpected requests %v", requests)
+	}
+	card := received[0].CardsV2[0].Card
+	if card.Header.Title != messageHeader(service.HookConfirmPromotion) {
+		t.Errorf("unexpected header %v", card.Header)
+	}
+	widgets := card.Sections[0].Widgets
+	if len(widgets) != 7 || widgets[1].DecoratedText == nil || widgets[1].DecoratedText.TopLabel != "cluster" {
+		t.Errorf("unexpected widgets %v", widgets)
+	}
+	if button := widgets[6].ButtonList; button == nil || button.Buttons[0].OnClick.OpenLink.URL != GoogleChatInstructionsURL {
+		t.Errorf("unexpected button %v", button)
+	}
+	if received[1].Thread == nil || received[1].Thread.Name != "spaces/AAA/threads/CCC" || received[1].Text != "Canary [canary-ns/test-canary] is Succeeded\nby kongz" {
+		t.Errorf("unexpected reply %v", received[1])
+	}
+
+	// an unconfigured client is quiet
+	if _, ok := NewGoogleChatClient(GoogleChatOption{}).(*QuietNoti); !ok {
+		t.Error("expected quiet client")
+	}
+}
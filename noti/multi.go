@@ -0,0 +1,98 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+// MultiClient dispatches the messages to multiple clients. A failure of one client does not stop the others.
+// The message IDs of each client are prefixed by the index of the client, so updates are routed back to the client which sent the message.
+type MultiClient struct {
+	clients []Client
+}
+
+// NewMultiClient creates a client which dispatches to all given clients.
+// It returns the client itself when only one is given.
+func NewMultiClient(clients ...Client) Client {
+	switch len(clients) {
+	case 0:
+		return &QuietNoti{}
+	case 1:
+		return clients[0]
+	}
+	return &MultiClient{clients: clients}
+}
+
+func (m *MultiClient) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
+	messages := map[string]string{}
+	var errs []error
+	for i, client := range m.clients {
+		sent, err := client.SendMessages(text, hookType, meta)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for k, v := range sent {
+			messages[fmt.Sprintf("%d/%s", i, k)] = v
+		}
+	}
+	return messages, errors.Join(errs...)
+}
+
+func (m *MultiClient) UpdateMessages(slackMessages map[string]string, text, context string) error {
+	var errs []error
+	for i, messages := range m.split(slackMessages) {
+		if err := m.clients[i].UpdateMessages(messages, text, context); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *MultiClient) AddFileToThreads(slackMessages map[string]string, fileName, content string) error {
+	var errs []error
+	for i, messages := range m.split(slackMessages) {
+		if err := m.clients[i].AddFileToThreads(messages, fileName, content); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// split groups the message IDs by the index of the client which sent them
+func (m *MultiClient) split(slackMessages map[string]string) map[int]map[string]string {
+	result := map[int]map[string]string{}
+	for k, v := range slackMessages {
+		prefix, key, ok := strings.Cut(k, "/")
+		if !ok {
+			continue
+		}
+		i, err := strconv.Atoi(prefix)
+		if err != nil || i < 0 || i >= len(m.clients) {
+			continue
+		}
+		if result[i] == nil {
+			result[i] = map[string]string{}
+		}
+		result[i][key] = v
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+type testClient struct {
+	id      string
+	err     error
+	sent    []string
+	updates []map[string]string
+}
+
+func (c *testClient) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.sent = append(c.sent, text)
+	return map[string]string{c.id: "ts"}, nil
+}
+
+func (c *testClient) UpdateMessages(slackMessages map[string]string, text, context string) error {
+	c.updates = append(c.updates, slackMessages)
+	return c.err
+}
+
+func (c *testClient) AddFileToThreads(slackMessages map[string]string, fileName, content string) error {
+	return c.err
+}
+
+func TestMultiClient(t *testing.T) {
+	first := &testClient{id: "C123"}
+	failed := &testClient{id: "failed", err: errors.New("unavailable")}
+	last := &testClient{id: "https://example.com/hook"}
+	multi := NewMultiClient(first, failed, last)
+
+	// a failed client does not stop the others
+	msgs, err := multi.SendMessages("Event", service.HookConfirmPromotion, map[string]string{})
+	if err == nil {
+		t.Error("expected error of the failed client")
+	}
+	if len(msgs) != 2 || msgs["0/C123"] != "ts" || msgs["2/https://example.com/hook"] != "ts" {
+		t.Errorf("unexpected messages %v", msgs)
+	}
+
+	// updates are routed to the client which sent the message
+	if err := multi.UpdateMessages(msgs, "text", ""); err != nil {
+		t.Error(err)
+	}
+	if len(first.updates) != 1 || first.updates[0]["C123"] != "ts" || len(first.updates[0]) != 1 {
+		t.Errorf("unexpected updates %v", first.updates)
+	}
+	if len(failed.updates) != 0 {
+		t.Errorf("unexpected updates %v", failed.updates)
+	}
+	if len(last.updates) != 1 || last.updates[0]["https://example.com/hook"] != "ts" {
+		t.Errorf("unexpected updates %v", last.updates)
+	}
+
+	// a single client is not wrapped
+	if NewMultiClient(first) != Client(first) {
+		t.Error("expected the client itself")
+	}
+}
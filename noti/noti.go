@@ -15,7 +15,14 @@ limitations under the License.
 */
 package noti
 
-import "github.com/KongZ/canary-gate/service"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/KongZ/canary-gate/service"
+)
 
 //go:generate mockgen -destination=../mocks/mock_slack_client.go -package=mocks -mock_names=Client=MockSlackClient github.com/grafana/flagger-k6-webhook/pkg/slack Client
 
@@ -24,3 +31,67 @@ type Client interface {
 	UpdateMessages(slackMessages map[string]string, text, context string) error
 	AddFileToThreads(slackMessages map[string]string, fileName, content string) error
 }
+
+// messageHeader returns the title of the message for the given hook type
+func messageHeader(hook service.HookType) string {
+	header := "Event"
+	switch hook {
+	case service.HookConfirmPromotion:
+		header = "Confirm Promotion"
+	case service.HookConfirmFinalize:
+		header = "Confirm Finalize"
+	case service.HookConfirmTrafficIncrease:
+		header = "Confirm Traffic Increase"
+	case service.HookConfirmRollout:
+		header = "Confirm Rollout"
+	case service.HookPostRollout:
+		header = "Post Rollout"
+	case service.HookPreRollout:
+		header = "Pre-Rollout"
+	case service.HookRollback:
+		header = "Rollback"
+	case service.HookRollout:
+		header = "Rollout"
+	}
+	return header
+}
+
+// gateTarget returns the namespace and name of the CanaryGate which injected the webhook, which the buttons of the
+// messages act on. Canaries without the gate metadata use their own name and namespace, like the store key of the gate.
+func gateTarget(meta map[string]string) (namespace string, name string) {
+	namespace, name = meta[service.MetaNamespace], meta[service.MetaName]
+	if gateName := meta[service.MetaGateName]; gateName != "" {
+		name = gateName
+		if gateNamespace := meta[service.MetaGateNamespace]; gateNamespace != "" {
+			namespace = gateNamespace
+		}
+	}
+	return namespace, name
+}
+
+// postJSON sends the payload as a JSON body to the url with the additional headers
+func postJSON(client *http.Client, url string, headers map[string]string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding message: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending message: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("error sending message: %s", resp.Status)
+	}
+	return nil
+}
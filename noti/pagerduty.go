@@ -0,0 +1,141 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+const (
+	// PagerDutyEventsURL is the endpoint of the PagerDuty Events API v2
+	PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+	pagerDutyTrigger = "trigger"
+	pagerDutyResolve = "resolve"
+)
+
+type PagerDutyOption struct {
+	// RoutingKey is the integration key of the PagerDuty service
+	RoutingKey string
+	// URL of the Events API. PagerDutyEventsURL is used when it is empty
+	URL string
+}
+
+// PagerDutyEvent is the body of the PagerDuty Events API v2
+type PagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *PagerDutyPayload `json:"payload,omitempty"`
+}
+
+// PagerDutyPayload describes the alert of a trigger event
+type PagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// pagerDutyClientWrapper triggers an alert when a canary is rolled back or failed, and resolves it when the canary succeeds.
+// The alerts are deduplicated by the namespace and name of the canary.
+type pagerDutyClientWrapper struct {
+	client     *http.Client
+	url        string
+	routingKey string
+}
+
+func init() {
+	// pagerduty://<routing key>, or pagerduty://<routing key>@<events API host and path>
+	Register("pagerduty", func(u *url.URL) (Client, error) {
+		if u.User == nil {
+			if u.Host == "" {
+				return nil, fmt.Errorf("pagerduty://<routing key> requires a routing key")
+			}
+			return NewPagerDutyClient(PagerDutyOption{RoutingKey: u.Host}), nil
+		}
+		eventsURL, err := targetURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return NewPagerDutyClient(PagerDutyOption{RoutingKey: u.User.Username(), URL: eventsURL}), nil
+	})
+}
+
+func NewPagerDutyClient(option PagerDutyOption) Client {
+	if option.RoutingKey == "" {
+		return &QuietNoti{}
+	}
+	url := option.URL
+	if url == "" {
+		url = PagerDutyEventsURL
+	}
+
+	return &pagerDutyClientWrapper{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		url:        url,
+		routingKey: option.RoutingKey,
+	}
+}
+
+// SendMessages sends only the messages of a rollback or of a failed or succeeded phase. The other messages are ignored.
+func (p *pagerDutyClientWrapper) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
+	phase := service.Phase(meta[service.MetaPhase])
+	event := PagerDutyEvent{
+		RoutingKey: p.routingKey,
+		DedupKey:   fmt.Sprintf("%s/%s", meta[service.MetaNamespace], meta[service.MetaName]),
+	}
+	switch {
+	case hookType == service.HookRollback || phase == service.PhaseFailed:
+		event.EventAction = pagerDutyTrigger
+		event.Payload = &PagerDutyPayload{
+			Summary:       fmt.Sprintf("%s: %s", messageHeader(hookType), text),
+			Source:        event.DedupKey,
+			Severity:      "critical",
+			Component:     meta[service.MetaName],
+			Group:         meta[service.MetaNamespace],
+			CustomDetails: meta,
+		}
+		if cluster := meta[service.MetaCluster]; cluster != "" {
+			event.Payload.Source = fmt.Sprintf("%s:%s", cluster, event.DedupKey)
+		}
+	case phase == service.PhaseSucceeded:
+		event.EventAction = pagerDutyResolve
+	default:
+		return nil, nil
+	}
+	if err := postJSON(p.client, p.url, nil, event); err != nil {
+		return nil, fmt.Errorf("pagerduty: %w", err)
+	}
+	return map[string]string{p.url: event.DedupKey}, nil
+}
+
+// UpdateMessages is not supported by the PagerDuty notifier. Alerts are resolved by the messages of a succeeded phase.
+func (p *pagerDutyClientWrapper) UpdateMessages(slackMessages map[string]string, text, context string) error {
+	return nil
+}
+
+// AddFileToThreads is not supported by the PagerDuty notifier.
+func (p *pagerDutyClientWrapper) AddFileToThreads(slackMessages map[string]string, fileName, content string) error {
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+func TestPagerDutyClient(t *testing.T) {
+	var received []PagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event PagerDutyEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Error(err)
+		}
+		received = append(received, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	pagerDuty := NewPagerDutyClient(PagerDutyOption{RoutingKey: "key", URL: server.URL})
+	meta := map[string]string{"name": "test-canary", "namespace": "canary-ns", "phase": string(service.PhaseProgressing)}
+	// progressing events do not page
+	msgs, err := pagerDuty.SendMessages("Advance test-canary.canary-ns canary weight 10", service.HookEvent, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 0 || len(received) != 0 {
+		t.Fatalf("expected no event, got %v", received)
+	}
+	if _, err := pagerDuty.SendMessages("Rollback is approved", service.HookRollback, meta); err != nil {
+		t.Fatal(err)
+	}
+	meta["phase"] = string(service.PhaseFailed)
+	if _, err := pagerDuty.SendMessages("Canary failed", service.HookEvent, meta); err != nil {
+		t.Fatal(err)
+	}
+	meta["phase"] = string(service.PhaseSucceeded)
+	if _, err := pagerDuty.SendMessages("Promotion completed!", service.HookEvent, meta); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(received))
+	}
+	for i, action := range []string{"trigger", "trigger", "resolve"} {
+		if received[i].EventAction != action || received[i].DedupKey != "canary-ns/test-canary" || received[i].RoutingKey != "key" {
+			t.Errorf("unexpected event %+v", received[i])
+		}
+	}
+	if received[0].Payload == nil || received[0].Payload.Severity != "critical" || received[0].Payload.Source != "canary-ns/test-canary" {
+		t.Errorf("unexpected payload %+v", received[0].Payload)
+	}
+
+	// no routing key disables the notifier
+	if _, ok := NewPagerDutyClient(PagerDutyOption{}).(*QuietNoti); !ok {
+		t.Error("expected quiet notifier without routing key")
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Factory creates the notifier of a URL. The scheme of the URL is the transport, https unless the notifier URL has
+// a +http suffix, and the other parts are the notifier URL as it is given.
+type Factory func(u *url.URL) (Client, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes the notifier of the URL scheme available to NewClientFromURL. Each notifier registers itself in the
+// init function of its file. It panics when the scheme is registered twice.
+func Register(scheme string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	scheme = strings.ToLower(scheme)
+	if _, ok := registry[scheme]; ok {
+		panic(fmt.Sprintf("noti: notifier scheme [%s] is registered twice", scheme))
+	}
+	registry[scheme] = factory
+}
+
+// Schemes returns the registered notifier schemes, sorted
+func Schemes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	schemes := make([]string, 0, len(registry))
+	for scheme := range registry {
+		schemes = append(schemes, scheme)
+	}
+	slices.Sort(schemes)
+	return schemes
+}
+
+// NewClientFromURL creates the notifier of the URL, e.g. slack://<token>@<channel> or webhook+https://example.com/hook.
+// The scheme selects the notifier, and a +http or +https suffix the transport of the notifiers which post to the URL.
+// The errors do not include the URL, since it usually carries a token.
+func NewClientFromURL(rawURL string) (Client, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("invalid notifier URL: %w", err)
+	}
+	scheme, transport, found := strings.Cut(strings.ToLower(u.Scheme), "+")
+	if !found {
+		transport = "https"
+	}
+	if transport != "https" && transport != "http" {
+		return nil, fmt.Errorf("unknown transport [%s] of notifier [%s], either http or https", transport, scheme)
+	}
+	registryMu.RLock()
+	factory, ok := registry[scheme]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown notifier scheme [%s], one of %v", scheme, Schemes())
+	}
+	target := *u
+	target.Scheme = transport
+	client, err := factory(&target)
+	if err != nil {
+		return nil, fmt.Errorf("notifier [%s]: %w", scheme, err)
+	}
+	return client, nil
+}
+
+// NewClientFromURLs creates the notifiers of the URLs, which all receive the messages. Empty URLs are skipped.
+func NewClientFromURLs(rawURLs []string) (Client, error) {
+	var clients []Client
+	for _, rawURL := range rawURLs {
+		if strings.TrimSpace(rawURL) == "" {
+			continue
+		}
+		client, err := NewClientFromURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return NewMultiClient(clients...), nil
+}
+
+// targetURL returns the URL which the notifier posts to, without the user info and the query parameters of the
+// notifier options.
+func targetURL(u *url.URL, options ...string) (string, error) {
+	if u.Host == "" {
+		return "", fmt.Errorf("the URL has no host")
+	}
+	target := *u
+	target.User = nil
+	query := target.Query()
+	for _, option := range options {
+		query.Del(option)
+	}
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClientFromURL(t *testing.T) {
+	client, err := NewClientFromURL("slack://xoxb-1-2-abc@C0123ABC")
+	require.NoError(t, err)
+	require.IsType(t, &slackClientWrapper{}, client)
+	require.Equal(t, "C0123ABC", client.(*slackClientWrapper).channel)
+
+	client, err = NewClientFromURL("teams://example.webhook.office.com/webhookb2/abc?actionURL=https%3A%2F%2Fgate.example.com&sig=x")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.webhook.office.com/webhookb2/abc?sig=x", client.(*teamsClientWrapper).webhookURL)
+	require.Equal(t, "https://gate.example.com", client.(*teamsClientWrapper).actionURL)
+
+	client, err = NewClientFromURL("discord://discord.com/api/webhooks/1/abc")
+	require.NoError(t, err)
+	require.Equal(t, "https://discord.com/api/webhooks/1/abc", client.(*discordClientWrapper).webhookURL)
+
+	client, err = NewClientFromURL("googlechat://chat.googleapis.com/v1/spaces/AAA/messages?key=k&token=t")
+	require.NoError(t, err)
+	require.Equal(t, "https://chat.googleapis.com/v1/spaces/AAA/messages?key=k&token=t", client.(*googleChatClientWrapper).webhookURL)
+
+	// the transport follows the + of the scheme
+	client, err = NewClientFromURL("webhook+http://hooks.internal:8080/canary")
+	require.NoError(t, err)
+	require.Equal(t, "http://hooks.internal:8080/canary", client.(*webhookClientWrapper).url)
+	client, err = NewClientFromURL("WEBHOOK+HTTPS://hooks.example.com/canary")
+	require.NoError(t, err)
+	require.Equal(t, "https://hooks.example.com/canary", client.(*webhookClientWrapper).url)
+
+	client, err = NewClientFromURL("pagerduty://routing-key")
+	require.NoError(t, err)
+	require.Equal(t, "routing-key", client.(*pagerDutyClientWrapper).routingKey)
+	require.Equal(t, PagerDutyEventsURL, client.(*pagerDutyClientWrapper).url)
+	client, err = NewClientFromURL("pagerduty+http://routing-key@localhost:8080/v2/enqueue")
+	require.NoError(t, err)
+	require.Equal(t, "routing-key", client.(*pagerDutyClientWrapper).routingKey)
+	require.Equal(t, "http://localhost:8080/v2/enqueue", client.(*pagerDutyClientWrapper).url)
+
+	client, err = NewClientFromURL("sns:arn:aws:sns:eu-west-1:123456789012:canary-gate.fifo?region=eu-west-1")
+	require.NoError(t, err)
+	require.Equal(t, "arn:aws:sns:eu-west-1:123456789012:canary-gate.fifo", client.(*snsClientWrapper).topicARN)
+	require.True(t, client.(*snsClientWrapper).fifo)
+}
+
+func TestNewClientFromURLInvalid(t *testing.T) {
+	for rawURL, message := range map[string]string{
+		"smtp://mail.example.com":   "unknown notifier scheme [smtp]",
+		"webhook+ftp://example.com": "unknown transport [ftp]",
+		"slack://C0123ABC":          "requires a token and a channel",
+		"discord:///api/webhooks/1": "notifier [discord]: the URL has no host",
+		"pagerduty://":              "requires a routing key",
+		"sns:":                      "requires a topic ARN",
+		"sns:canary-gate":           "invalid topic ARN",
+		"slack://xoxb-secret@%zz":   "invalid notifier URL",
+	} {
+		_, err := NewClientFromURL(rawURL)
+		require.ErrorContainsf(t, err, message, "[%s]", rawURL)
+		require.NotContains(t, err.Error(), "xoxb-secret", "the error should not print the token")
+	}
+}
+
+func TestNewClientFromURLs(t *testing.T) {
+	client, err := NewClientFromURLs([]string{"webhook+https://a.example.com", " ", "pagerduty://key"})
+	require.NoError(t, err)
+	require.IsType(t, &MultiClient{}, client)
+	require.Len(t, client.(*MultiClient).clients, 2)
+
+	// a single notifier is not wrapped
+	client, err = NewClientFromURLs([]string{"webhook+https://a.example.com"})
+	require.NoError(t, err)
+	require.IsType(t, &webhookClientWrapper{}, client)
+
+	client, err = NewClientFromURLs(nil)
+	require.NoError(t, err)
+	require.IsType(t, &QuietNoti{}, client)
+
+	_, err = NewClientFromURLs([]string{"webhook+https://a.example.com", "unknown://b"})
+	require.Error(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	require.Equal(t, []string{"discord", "googlechat", "pagerduty", "slack", "sns", "teams", "webhook"}, Schemes())
+	require.Panics(t, func() { Register("Slack", nil) })
+}
@@ -18,12 +18,21 @@ package noti
 import (
 	"fmt"
 	"maps"
+	"net/url"
 	"slices"
+	"strings"
 
 	"github.com/KongZ/canary-gate/service"
 	"github.com/slack-go/slack"
 )
 
+const (
+	// SlackActionApprove is the action of the Approve button which opens the gate
+	SlackActionApprove = "approve"
+	// SlackActionHalt is the action of the Halt button which closes the gate
+	SlackActionHalt = "halt"
+)
+
 type SlackOption struct {
 	Token   string
 	Channel string
@@ -35,6 +44,17 @@ type slackClientWrapper struct {
 	channel string
 }
 
+func init() {
+	// slack://<token>@<channel>
+	Register("slack", func(u *url.URL) (Client, error) {
+		token := u.User.Username()
+		if token == "" || u.Host == "" {
+			return nil, fmt.Errorf("slack://<token>@<channel> requires a token and a channel")
+		}
+		return NewSlackClient(SlackOption{Token: token, Channel: u.Host}), nil
+	})
+}
+
 func NewSlackClient(option SlackOption) Client {
 	if option.Token == "" {
 		return &QuietNoti{}
@@ -48,7 +68,7 @@ func NewSlackClient(option SlackOption) Client {
 
 func (w *slackClientWrapper) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
 	slackMessages := map[string]string{}
-	channelID, ts, _, err := w.client.SendMessage(w.channel, messageBlocks(text, slackHeader(hookType), meta))
+	channelID, ts, _, err := w.client.SendMessage(w.channel, messageBlocks(text, hookType, meta))
 	if err != nil {
 		return nil, fmt.Errorf("error sending message to %s: %w", w.channel, err)
 	}
@@ -57,11 +77,11 @@ func (w *slackClientWrapper) SendMessages(text string, hookType service.HookType
 }
 
 func (w *slackClientWrapper) UpdateMessages(slackMessages map[string]string, text, context string) error {
-	// for channelID, ts := range slackMessages {
-	// 	if _, _, _, err := w.client.UpdateMessage(channelID, ts, messageBlocks(text, context)); err != nil {
-	// 		return fmt.Errorf("error updating message %s in channel %s: %w", ts, channelID, err)
-	// 	}
-	// }
+	for channelID, ts := range slackMessages {
+		if _, _, _, err := w.client.UpdateMessage(channelID, ts, updateBlocks(text, context)); err != nil {
+			return fmt.Errorf("error updating message %s in channel %s: %w", ts, channelID, err)
+		}
+	}
 	return nil
 }
 
@@ -81,47 +101,83 @@ func (w *slackClientWrapper) AddFileToThreads(slackMessages map[string]string, f
 	return nil
 }
 
-func messageBlocks(text string, header string, meta map[string]string) slack.MsgOption {
-	fields := make([]*slack.TextBlockObject, len(meta))
-	keys := slices.Sorted((maps.Keys(meta)))
-	for c, k := range keys {
-		fields[c] = slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*\n%s", k, meta[k]), false, false)
+// messageBlocks builds the message with the state of the gate, the phase of the canary and a context line of
+// the deployment. The action IDs and values of the buttons are kept, so the buttons of older messages still work.
+func messageBlocks(text string, hookType service.HookType, meta map[string]string) slack.MsgOption {
+	header := messageHeader(hookType)
+	fields := []*slack.TextBlockObject{}
+	for _, k := range slices.Sorted(maps.Keys(meta)) {
+		if slices.Contains(contextKeys, k) {
+			continue
+		}
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*\n%s", fieldName(k), meta[k]), false, false))
 	}
 	// TODO this should be change to random ID but we need to store the ID in storage
-	action := fmt.Sprintf("%s:%s:%s", meta[service.MetaCluster], meta[service.MetaNamespace], meta[service.MetaName])
+	namespace, name := gateTarget(meta)
+	action := fmt.Sprintf("%s:%s:%s", meta[service.MetaCluster], namespace, name)
 	blocks := []slack.Block{
 		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, header, true, false)),
 		slack.NewSectionBlock(slack.NewTextBlockObject(slack.PlainTextType, text, true, false), fields, nil),
-		slack.NewActionBlock("",
-			slack.NewButtonBlockElement("approve", "approve:"+action,
+		// the block ID carries the gate type which the buttons act on
+		slack.NewActionBlock(string(hookType),
+			slack.NewButtonBlockElement(SlackActionApprove, SlackActionApprove+":"+action,
 				slack.NewTextBlockObject("plain_text", "Approve", false, false),
 			).WithStyle(slack.StylePrimary),
-			slack.NewButtonBlockElement("halt", "halt:"+action,
+			slack.NewButtonBlockElement(SlackActionHalt, SlackActionHalt+":"+action,
 				slack.NewTextBlockObject("plain_text", "Halt", false, false),
 			).WithStyle(slack.StyleDanger),
 		),
 	}
+	if context := deploymentContext(meta); context != "" {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, context, false, false)))
+	}
 
 	return slack.MsgOptionBlocks(blocks...)
 }
 
-func slackHeader(hook service.HookType) string {
-	header := "Event"
-	switch hook {
-	case service.HookConfirmPromotion:
-		header = "Confirm Promotion"
-	case service.HookConfirmTrafficIncrease:
-		header = "Confirm Traffic Increase"
-	case service.HookConfirmRollout:
-		header = "Confirm Rollout"
-	case service.HookPostRollout:
-		header = "Post Rollout"
-	case service.HookPreRollout:
-		header = "Pre- ollout"
-	case service.HookRollback:
-		header = "Rollback"
-	case service.HookRollout:
-		header = "Rollout"
+// contextKeys are the metadata which are shown in the context line instead of the fields
+var contextKeys = []string{service.MetaName, service.MetaNamespace, service.MetaCluster}
+
+// fieldName returns the title of the field of the metadata
+func fieldName(key string) string {
+	if key == service.MetaGateState {
+		return "gate"
 	}
-	return header
+	return key
+}
+
+// deploymentContext returns the context line of the deployment and its cluster
+func deploymentContext(meta map[string]string) string {
+	if meta[service.MetaName] == "" {
+		return ""
+	}
+	context := fmt.Sprintf("Deployment `%s/%s`", meta[service.MetaNamespace], meta[service.MetaName])
+	if cluster := meta[service.MetaCluster]; cluster != "" {
+		context = fmt.Sprintf("%s on cluster `%s`", context, cluster)
+	}
+	return context
+}
+
+// ParseSlackAction decodes the value of an Approve or Halt button in form of "<action>:<cluster>:<namespace>:<name>".
+func ParseSlackAction(value string) (action string, cluster string, namespace string, name string, err error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 || parts[2] == "" || parts[3] == "" {
+		return "", "", "", "", fmt.Errorf("invalid slack action value [%s]", value)
+	}
+	if parts[0] != SlackActionApprove && parts[0] != SlackActionHalt {
+		return "", "", "", "", fmt.Errorf("unknown slack action [%s]", parts[0])
+	}
+	return parts[0], parts[1], parts[2], parts[3], nil
+}
+
+// updateBlocks rebuilds the message with the new text and a context line. The buttons are removed, so a decided
+// gate cannot be changed again from the message. The context is markdown, so it can mention the user.
+func updateBlocks(text string, context string) slack.MsgOption {
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.PlainTextType, text, true, false), nil, nil),
+	}
+	if context != "" {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, context, false, false)))
+	}
+	return slack.MsgOptionBlocks(blocks...)
 }
@@ -19,6 +19,8 @@ import (
 	"testing"
 
 	"github.com/KongZ/canary-gate/service"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/require"
 )
 
 var testSlackToken = ""
@@ -37,3 +39,55 @@ func TestSlackClient(t *testing.T) {
 	}
 	t.Log(msgs)
 }
+
+func TestParseSlackAction(t *testing.T) {
+	action, cluster, namespace, name, err := ParseSlackAction("approve:k8s-cluster:canary-ns:test-canary")
+	if err != nil {
+		t.Error(err)
+	}
+	if action != SlackActionApprove || cluster != "k8s-cluster" || namespace != "canary-ns" || name != "test-canary" {
+		t.Errorf("unexpected action %s %s %s %s", action, cluster, namespace, name)
+	}
+	for _, v := range []string{"", "approve", "approve::canary-ns:", "reject:k8s-cluster:canary-ns:test-canary"} {
+		if _, _, _, _, err := ParseSlackAction(v); err == nil {
+			t.Errorf("expected error for [%s]", v)
+		}
+	}
+}
+
+func TestSlackMessageBlocks(t *testing.T) {
+	meta := map[string]string{
+		service.MetaCluster:   "k8s-cluster",
+		service.MetaName:      "test-canary",
+		service.MetaNamespace: "canary-ns",
+		service.MetaPhase:     "Progressing",
+		service.MetaGateState: "closed",
+		// the webhookMetadata of the CanaryGate
+		"team": "payments",
+	}
+	_, values, err := slack.UnsafeApplyMsgOptions("", testSlackChannel, "", messageBlocks("Please confirm rollout action", service.HookConfirmRollout, meta))
+	require.NoError(t, err)
+	blocks := values.Get("blocks")
+	require.Contains(t, blocks, `*gate*\nclosed`)
+	require.Contains(t, blocks, `*phase*\nProgressing`)
+	require.Contains(t, blocks, `*team*\npayments`)
+	require.Contains(t, blocks, "Deployment `canary-ns/test-canary` on cluster `k8s-cluster`")
+	// the buttons keep their action IDs and values
+	require.Contains(t, blocks, `"block_id":"confirm-rollout"`)
+	require.Contains(t, blocks, `"action_id":"approve","value":"approve:k8s-cluster:canary-ns:test-canary"`)
+	require.Contains(t, blocks, `"action_id":"halt","value":"halt:k8s-cluster:canary-ns:test-canary"`)
+
+	// the buttons of a canary of a CanaryGate with multiple targets act on the CanaryGate
+	meta[service.MetaGateName] = "demo"
+	meta[service.MetaGateNamespace] = "gate-ns"
+	_, values, err = slack.UnsafeApplyMsgOptions("", testSlackChannel, "", messageBlocks("Please confirm rollout action", service.HookConfirmRollout, meta))
+	require.NoError(t, err)
+	require.Contains(t, values.Get("blocks"), `"action_id":"approve","value":"approve:k8s-cluster:gate-ns:demo"`)
+	require.Contains(t, values.Get("blocks"), "Deployment `canary-ns/test-canary` on cluster `k8s-cluster`")
+
+	// the updated message has no buttons
+	_, values, err = slack.UnsafeApplyMsgOptions("", testSlackChannel, "", updateBlocks("Gate [canary-ns/test-canary=confirm-rollout] is opened", "Approved by <@U123>"))
+	require.NoError(t, err)
+	require.NotContains(t, values.Get("blocks"), `"actions"`)
+	require.Contains(t, values.Get("blocks"), `Approved by \u003c@U123\u003e`)
+}
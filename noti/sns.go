@@ -0,0 +1,163 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+// snsTimeout is the timeout of a single publish
+const snsTimeout = 10 * time.Second
+
+type SNSOption struct {
+	// TopicARN is the topic which the messages are published to
+	TopicARN string
+	// Region of the topic. The region of the ARN is used when it is empty
+	Region string
+}
+
+// snsPublisher publishes a message to a topic. It is implemented by the SNS client of the AWS SDK.
+type snsPublisher interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// snsClientWrapper publishes the messages as the JSON of a WebhookPayload, so a subscribed Lambda or SQS queue
+// receives the same body as the webhook notifier. The event and type are also set as message attributes, which the
+// filter policies of the subscriptions can match.
+type snsClientWrapper struct {
+	client   snsPublisher
+	topicARN string
+	fifo     bool
+}
+
+func init() {
+	// sns:<topic ARN>?region=<region>
+	Register("sns", func(u *url.URL) (Client, error) {
+		if u.Opaque == "" {
+			return nil, fmt.Errorf("sns:<topic ARN> requires a topic ARN")
+		}
+		return NewSNSClient(SNSOption{TopicARN: u.Opaque, Region: u.Query().Get("region")})
+	})
+}
+
+// NewSNSClient returns the notifier which publishes to the topic. The credentials are read by the default credential
+// chain of the AWS SDK, e.g. the environment, the shared config files or the web identity of the service account.
+func NewSNSClient(option SNSOption) (Client, error) {
+	if option.TopicARN == "" {
+		return &QuietNoti{}, nil
+	}
+	topic, err := arn.Parse(option.TopicARN)
+	if err != nil {
+		return nil, fmt.Errorf("sns: invalid topic ARN [%s]: %w", option.TopicARN, err)
+	}
+	region := option.Region
+	if region == "" {
+		region = topic.Region
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("sns: unable to load the AWS config: %w", err)
+	}
+	return newSNSClient(sns.NewFromConfig(cfg), option.TopicARN), nil
+}
+
+func newSNSClient(client snsPublisher, topicARN string) *snsClientWrapper {
+	return &snsClientWrapper{
+		client:   client,
+		topicARN: topicARN,
+		fifo:     strings.HasSuffix(topicARN, ".fifo"),
+	}
+}
+
+// SendMessages publishes the message and returns its SNS message ID
+func (s *snsClientWrapper) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
+	payload := WebhookPayload{
+		Event:    WebhookEventMessage,
+		Type:     hookType,
+		Text:     text,
+		Metadata: meta,
+	}
+	group := fmt.Sprintf("%s/%s", meta[service.MetaNamespace], meta[service.MetaName])
+	id, err := s.publish(payload, group)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{s.topicARN: id}, nil
+}
+
+// UpdateMessages publishes an update which carries the message ID of the updated message
+func (s *snsClientWrapper) UpdateMessages(slackMessages map[string]string, text, context string) error {
+	id, ok := slackMessages[s.topicARN]
+	if !ok {
+		return nil
+	}
+	payload := WebhookPayload{
+		Event:   WebhookEventUpdate,
+		ID:      id,
+		Text:    text,
+		Context: context,
+	}
+	_, err := s.publish(payload, id)
+	return err
+}
+
+// AddFileToThreads is not supported by the SNS notifier.
+func (s *snsClientWrapper) AddFileToThreads(slackMessages map[string]string, fileName, content string) error {
+	return nil
+}
+
+// publish publishes the payload and returns the message ID. The messages of a FIFO topic are ordered by the group.
+func (s *snsClientWrapper) publish(payload WebhookPayload, group string) (string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("sns: error encoding message: %w", err)
+	}
+	input := &sns.PublishInput{
+		TopicArn: aws.String(s.topicARN),
+		Message:  aws.String(string(body)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"event": {DataType: aws.String("String"), StringValue: aws.String(payload.Event)},
+		},
+	}
+	if payload.Type != "" {
+		input.MessageAttributes["type"] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(string(payload.Type))}
+	}
+	if s.fifo {
+		input.MessageGroupId = aws.String(group)
+		input.MessageDeduplicationId = aws.String(strconv.FormatInt(time.Now().UnixNano(), 10))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), snsTimeout)
+	defer cancel()
+	output, err := s.client.Publish(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("sns: error sending message: %w", err)
+	}
+	return aws.ToString(output.MessageId), nil
+}
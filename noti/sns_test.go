@@ -0,0 +1,102 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+type fakePublisher struct {
+	inputs []*sns.PublishInput
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return &sns.PublishOutput{MessageId: aws.String(fmt.Sprintf("id-%d", len(f.inputs)))}, nil
+}
+
+func TestSNSClient(t *testing.T) {
+	topic := "arn:aws:sns:eu-west-1:123456789012:canary-gate"
+	publisher := &fakePublisher{}
+	client := newSNSClient(publisher, topic)
+	meta := map[string]string{"name": "test-canary", "namespace": "canary-ns"}
+	msgs, err := client.SendMessages("Rollback is approved", service.HookRollback, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs[topic] != "id-1" {
+		t.Fatalf("expected the message ID, got %v", msgs)
+	}
+	if err := client.UpdateMessages(msgs, "Rolled back", "by alice"); err != nil {
+		t.Fatal(err)
+	}
+	// a message which was not sent to the topic is not updated
+	if err := client.UpdateMessages(map[string]string{"other": "id"}, "Rolled back", ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(publisher.inputs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(publisher.inputs))
+	}
+	var sent, updated WebhookPayload
+	if err := json.Unmarshal([]byte(aws.ToString(publisher.inputs[0].Message)), &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Event != WebhookEventMessage || sent.Type != service.HookRollback || sent.Text != "Rollback is approved" || sent.Metadata["name"] != "test-canary" {
+		t.Errorf("unexpected message %+v", sent)
+	}
+	if aws.ToString(publisher.inputs[0].TopicArn) != topic || aws.ToString(publisher.inputs[0].MessageAttributes["type"].StringValue) != string(service.HookRollback) {
+		t.Errorf("unexpected input %+v", publisher.inputs[0])
+	}
+	if publisher.inputs[0].MessageGroupId != nil {
+		t.Error("expected no message group on a standard topic")
+	}
+	if err := json.Unmarshal([]byte(aws.ToString(publisher.inputs[1].Message)), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Event != WebhookEventUpdate || updated.ID != "id-1" || updated.Context != "by alice" {
+		t.Errorf("unexpected update %+v", updated)
+	}
+	if aws.ToString(publisher.inputs[1].MessageAttributes["event"].StringValue) != WebhookEventUpdate {
+		t.Errorf("unexpected attributes %+v", publisher.inputs[1].MessageAttributes)
+	}
+
+	// the messages of a canary are in the same group of a FIFO topic
+	fifo := newSNSClient(publisher, topic+".fifo")
+	if _, err := fifo.SendMessages("Canary failed", service.HookEvent, meta); err != nil {
+		t.Fatal(err)
+	}
+	if input := publisher.inputs[2]; aws.ToString(input.MessageGroupId) != "canary-ns/test-canary" || input.MessageDeduplicationId == nil {
+		t.Errorf("unexpected FIFO input %+v", input)
+	}
+
+	// no topic disables the notifier
+	if quiet, err := NewSNSClient(SNSOption{}); err != nil {
+		t.Fatal(err)
+	} else if _, ok := quiet.(*QuietNoti); !ok {
+		t.Error("expected quiet notifier without topic")
+	}
+	if _, err := NewSNSClient(SNSOption{TopicARN: "canary-gate"}); err == nil {
+		t.Error("expected an error of an invalid topic ARN")
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+// teamsMessageKey is the key of the synthetic message ID returned by SendMessages.
+// Teams incoming webhooks do not return an ID, so updates are posted as new cards.
+const teamsMessageKey = "teams"
+
+type TeamsOption struct {
+	// WebhookURL is the URL of the Teams incoming webhook
+	WebhookURL string
+	// ActionURL is an optional URL of a page which the Approve and Halt buttons of the confirm gates open. The page
+	// authenticates the user and opens or closes the gate.
+	ActionURL string
+}
+
+type teamsClientWrapper struct {
+	client     *http.Client
+	webhookURL string
+	actionURL  string
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string         `json:"$schema"`
+	Type    string         `json:"type"`
+	Version string         `json:"version"`
+	Body    []teamsElement `json:"body"`
+	Actions []teamsAction  `json:"actions,omitempty"`
+}
+
+type teamsElement struct {
+	Type     string      `json:"type"`
+	Text     string      `json:"text,omitempty"`
+	Size     string      `json:"size,omitempty"`
+	Weight   string      `json:"weight,omitempty"`
+	IsSubtle bool        `json:"isSubtle,omitempty"`
+	Wrap     bool        `json:"wrap,omitempty"`
+	Facts    []teamsFact `json:"facts,omitempty"`
+}
+
+type teamsFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type teamsAction struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// teamsActionGates are the gates whose messages have the Approve and Halt buttons
+var teamsActionGates = []service.HookType{
+	service.HookConfirmRollout,
+	service.HookConfirmTrafficIncrease,
+	service.HookConfirmPromotion,
+	service.HookConfirmFinalize,
+}
+
+func init() {
+	// teams://<webhook host and path>?actionURL=<canary-gate URL>
+	Register("teams", func(u *url.URL) (Client, error) {
+		webhookURL, err := targetURL(u, "actionURL")
+		if err != nil {
+			return nil, err
+		}
+		return NewTeamsClient(TeamsOption{WebhookURL: webhookURL, ActionURL: u.Query().Get("actionURL")}), nil
+	})
+}
+
+func NewTeamsClient(option TeamsOption) Client {
+	if option.WebhookURL == "" {
+		return &QuietNoti{}
+	}
+
+	return &teamsClientWrapper{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		webhookURL: option.WebhookURL,
+		actionURL:  option.ActionURL,
+	}
+}
+
+func (w *teamsClientWrapper) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
+	facts := make([]teamsFact, 0, len(meta))
+	for _, k := range slices.Sorted(maps.Keys(meta)) {
+		facts = append(facts, teamsFact{Title: k, Value: meta[k]})
+	}
+	card := teamsCard{
+		Body: []teamsElement{
+			{Type: "TextBlock", Text: messageHeader(hookType), Size: "Large", Weight: "Bolder"},
+			{Type: "TextBlock", Text: text, Wrap: true},
+			{Type: "FactSet", Facts: facts},
+		},
+		Actions: w.actions(hookType, meta),
+	}
+	if err := w.post(card); err != nil {
+		return nil, err
+	}
+	return map[string]string{teamsMessageKey: strconv.FormatInt(time.Now().Unix(), 10)}, nil
+}
+
+// UpdateMessages posts a new card since Teams incoming webhooks cannot edit a sent card.
+func (w *teamsClientWrapper) UpdateMessages(slackMessages map[string]string, text, context string) error {
+	if _, ok := slackMessages[teamsMessageKey]; !ok {
+		return nil
+	}
+	card := teamsCard{
+		Body: []teamsElement{
+			{Type: "TextBlock", Text: text, Wrap: true},
+		},
+	}
+	if context != "" {
+		card.Body = append(card.Body, teamsElement{Type: "TextBlock", Text: context, IsSubtle: true, Wrap: true})
+	}
+	return w.post(card)
+}
+
+// AddFileToThreads is not supported by Teams incoming webhooks.
+func (w *teamsClientWrapper) AddFileToThreads(slackMessages map[string]string, fileName, content string) error {
+	return nil
+}
+
+// actions creates the Approve and Halt buttons of the confirm gates when the action URL is configured. The buttons
+// open the action URL in the browser with the action, the gate type and the namespace and name of the gate in the
+// query, since a card cannot carry the token of the gate API nor tell which user clicked.
+func (w *teamsClientWrapper) actions(hookType service.HookType, meta map[string]string) []teamsAction {
+	if w.actionURL == "" || !slices.Contains(teamsActionGates, hookType) {
+		return nil
+	}
+	target, err := url.Parse(w.actionURL)
+	if err != nil {
+		return nil
+	}
+	namespace, name := gateTarget(meta)
+	action := func(title, action string) teamsAction {
+		query := target.Query()
+		query.Set("action", action)
+		query.Set("type", string(hookType))
+		query.Set("namespace", namespace)
+		query.Set("name", name)
+		u := *target
+		u.RawQuery = query.Encode()
+		return teamsAction{Type: "Action.OpenUrl", Title: title, URL: u.String()}
+	}
+	return []teamsAction{action("Approve", SlackActionApprove), action("Halt", SlackActionHalt)}
+}
+
+func (w *teamsClientWrapper) post(card teamsCard) error {
+	card.Schema = "http://adaptivecards.io/schemas/adaptive-card.json"
+	card.Type = "AdaptiveCard"
+	card.Version = "1.4"
+	msg := teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{
+			{ContentType: "application/vnd.microsoft.card.adaptive", Content: card},
+		},
+	}
+	if err := postJSON(w.client, w.webhookURL, nil, msg); err != nil {
+		return fmt.Errorf("teams: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+func TestTeamsClient(t *testing.T) {
+	var received []teamsMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg teamsMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		received = append(received, msg)
+	}))
+	defer server.Close()
+
+	teams := NewTeamsClient(TeamsOption{WebhookURL: server.URL, ActionURL: "https://canary-gate.example.com"})
+	meta := make(map[string]string)
+	meta["user"] = "kongz"
+	meta["cluster"] = "k8s-cluster"
+	meta["name"] = "test-canary"
+	meta["namespace"] = "canary-ns"
+	msgs, err := teams.SendMessages("Event", service.HookConfirmPromotion, meta)
+	if err != nil {
+		t.Error(err)
+	}
+	if err := teams.UpdateMessages(msgs, "Canary [canary-ns/test-canary] is Succeeded", ""); err != nil {
+		t.Error(err)
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(received))
+	}
+	card := received[0].Attachments[0].Content
+	if card.Body[0].Text != messageHeader(service.HookConfirmPromotion) {
+		t.Errorf("unexpected header %s", card.Body[0].Text)
+	}
+	if facts := card.Body[2].Facts; len(facts) != 4 || facts[0].Title != "cluster" {
+		t.Errorf("unexpected facts %v", facts)
+	}
+	if len(card.Actions) != 2 || card.Actions[0].Type != "Action.OpenUrl" ||
+		card.Actions[0].URL != "https://canary-gate.example.com?action=approve&name=test-canary&namespace=canary-ns&type=confirm-promotion" {
+		t.Errorf("unexpected actions %v", card.Actions)
+	}
+
+	// the buttons of a canary of a CanaryGate with multiple targets act on the CanaryGate
+	meta[service.MetaGateName] = "demo"
+	meta[service.MetaGateNamespace] = "gate-ns"
+	actions := teams.(*teamsClientWrapper).actions(service.HookConfirmPromotion, meta)
+	if len(actions) != 2 || actions[1].URL != "https://canary-gate.example.com?action=halt&name=demo&namespace=gate-ns&type=confirm-promotion" {
+		t.Errorf("unexpected actions %v", actions)
+	}
+
+	// the gates which do not wait for a decision have no buttons
+	for _, hook := range []service.HookType{service.HookEvent, service.HookRollback, service.HookPreRollout} {
+		if actions := teams.(*teamsClientWrapper).actions(hook, meta); len(actions) != 0 {
+			t.Errorf("unexpected actions of %s %v", hook, actions)
+		}
+	}
+
+	// an unconfigured client is quiet
+	if _, ok := NewTeamsClient(TeamsOption{}).(*QuietNoti); !ok {
+		t.Error("expected quiet client")
+	}
+}
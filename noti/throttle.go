@@ -0,0 +1,134 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+// ThrottledClient sends at most one message per hook type, phase and canary within the window.
+// A repeated message within the window is dropped, and a different one, e.g. a flipped gate state, updates the
+// message which was sent instead of posting a new one. The phase is a part of the key, so a terminal phase,
+// e.g. Succeeded after Failed, is always sent and resolves the incident of PagerDuty.
+type ThrottledClient struct {
+	client Client
+	window time.Duration
+	now    func() time.Time
+
+	mu   sync.Mutex
+	sent map[throttleKey]*sentMessage
+}
+
+// throttleKey identifies the messages of a hook type, phase and canary
+type throttleKey struct {
+	hookType  service.HookType
+	phase     string
+	namespace string
+	name      string
+}
+
+// sentMessage is the last message of a throttleKey
+type sentMessage struct {
+	at       time.Time
+	text     string
+	messages map[string]string
+	// done is closed when the message is sent, the other messages of the key wait for it
+	done chan struct{}
+}
+
+// NewThrottledClient creates a client which throttles the messages of the client.
+// It returns the client itself when the window is not positive.
+func NewThrottledClient(client Client, window time.Duration) Client {
+	if window <= 0 {
+		return client
+	}
+	return &ThrottledClient{
+		client: client,
+		window: window,
+		now:    time.Now,
+		sent:   map[throttleKey]*sentMessage{},
+	}
+}
+
+// SendMessages sends the message, or updates the message of the key which was sent within the window.
+// The lock is not held while the client sends, so a slow backend does not block the other canaries.
+func (c *ThrottledClient) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
+	key := throttleKey{hookType: hookType, phase: meta[service.MetaPhase], namespace: meta[service.MetaNamespace], name: meta[service.MetaName]}
+	if key.name == "" {
+		return c.client.SendMessages(text, hookType, meta)
+	}
+	c.mu.Lock()
+	last := c.lookup(key)
+	for last != nil && last.messages == nil {
+		// another message of the key is being sent
+		c.mu.Unlock()
+		<-last.done
+		c.mu.Lock()
+		last = c.lookup(key)
+	}
+	if last != nil {
+		messages := maps.Clone(last.messages)
+		if last.text == text {
+			c.mu.Unlock()
+			return messages, nil
+		}
+		last.text = text
+		c.mu.Unlock()
+		if err := c.client.UpdateMessages(messages, text, ""); err != nil {
+			return nil, err
+		}
+		return messages, nil
+	}
+	pending := &sentMessage{at: c.now(), text: text, done: make(chan struct{})}
+	c.sent[key] = pending
+	c.mu.Unlock()
+
+	messages, err := c.client.SendMessages(text, hookType, meta)
+	c.mu.Lock()
+	// a message which is not sent by any client is not throttled
+	if len(messages) > 0 {
+		pending.messages = maps.Clone(messages)
+	} else {
+		delete(c.sent, key)
+	}
+	c.mu.Unlock()
+	close(pending.done)
+	return messages, err
+}
+
+// lookup evicts the messages which are out of the window and returns the message of the key.
+// The caller must hold the lock.
+func (c *ThrottledClient) lookup(key throttleKey) *sentMessage {
+	now := c.now()
+	for k, s := range c.sent {
+		if s.messages != nil && now.Sub(s.at) >= c.window {
+			delete(c.sent, k)
+		}
+	}
+	return c.sent[key]
+}
+
+func (c *ThrottledClient) UpdateMessages(slackMessages map[string]string, text, context string) error {
+	return c.client.UpdateMessages(slackMessages, text, context)
+}
+
+func (c *ThrottledClient) AddFileToThreads(slackMessages map[string]string, fileName, content string) error {
+	return c.client.AddFileToThreads(slackMessages, fileName, content)
+}
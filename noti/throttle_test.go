@@ -0,0 +1,153 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+func TestThrottledClient(t *testing.T) {
+	client := &testClient{id: "C123"}
+	throttled := NewThrottledClient(client, time.Minute).(*ThrottledClient)
+	now := time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC)
+	throttled.now = func() time.Time { return now }
+	demo := map[string]string{service.MetaNamespace: "demo-ns", service.MetaName: "demo"}
+
+	// a repeated message within the window is dropped
+	for range 3 {
+		msgs, err := throttled.SendMessages("Canary [demo-ns/demo] is Progressing", service.HookEvent, demo)
+		if err != nil {
+			t.Error(err)
+		}
+		if msgs["C123"] != "ts" {
+			t.Errorf("unexpected messages %v", msgs)
+		}
+	}
+	if len(client.sent) != 1 || len(client.updates) != 0 {
+		t.Errorf("unexpected messages %v, updates %v", client.sent, client.updates)
+	}
+
+	// a different message within the window updates the sent message
+	now = now.Add(30 * time.Second)
+	if _, err := throttled.SendMessages("Canary [demo-ns/demo] is Promoting", service.HookEvent, demo); err != nil {
+		t.Error(err)
+	}
+	if len(client.sent) != 1 || len(client.updates) != 1 || client.updates[0]["C123"] != "ts" {
+		t.Errorf("unexpected messages %v, updates %v", client.sent, client.updates)
+	}
+
+	// another hook type or canary is not throttled
+	if _, err := throttled.SendMessages("Please confirm rollout action", service.HookConfirmRollout, demo); err != nil {
+		t.Error(err)
+	}
+	if _, err := throttled.SendMessages("Canary [demo-ns/web] is Progressing", service.HookEvent, map[string]string{service.MetaNamespace: "demo-ns", service.MetaName: "web"}); err != nil {
+		t.Error(err)
+	}
+	if len(client.sent) != 3 {
+		t.Errorf("unexpected messages %v", client.sent)
+	}
+
+	// a message after the window is sent again
+	now = now.Add(time.Minute)
+	if _, err := throttled.SendMessages("Canary [demo-ns/demo] is Promoting", service.HookEvent, demo); err != nil {
+		t.Error(err)
+	}
+	if len(client.sent) != 4 || len(client.updates) != 1 {
+		t.Errorf("unexpected messages %v, updates %v", client.sent, client.updates)
+	}
+
+	// no window does not wrap the client
+	if NewThrottledClient(client, 0) != Client(client) {
+		t.Error("expected the client itself")
+	}
+}
+
+func TestThrottledClientPhases(t *testing.T) {
+	client := &testClient{id: "C123"}
+	throttled := NewThrottledClient(client, time.Minute)
+	phase := func(phase string) map[string]string {
+		return map[string]string{service.MetaNamespace: "demo-ns", service.MetaName: "demo", service.MetaPhase: phase}
+	}
+
+	// a terminal phase after another phase within the window is sent, not updated
+	if _, err := throttled.SendMessages("Canary [demo-ns/demo] is Failed", service.HookEvent, phase("Failed")); err != nil {
+		t.Error(err)
+	}
+	if _, err := throttled.SendMessages("Canary [demo-ns/demo] is Succeeded", service.HookEvent, phase("Succeeded")); err != nil {
+		t.Error(err)
+	}
+	if len(client.sent) != 2 || len(client.updates) != 0 {
+		t.Errorf("unexpected messages %v, updates %v", client.sent, client.updates)
+	}
+}
+
+// blockingClient blocks the messages of a canary until it is released
+type blockingClient struct {
+	testClient
+	mu      sync.Mutex
+	release chan struct{}
+}
+
+func (c *blockingClient) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
+	if meta[service.MetaName] == "slow" {
+		<-c.release
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.testClient.SendMessages(text, hookType, meta)
+}
+
+func TestThrottledClientConcurrent(t *testing.T) {
+	client := &blockingClient{testClient: testClient{id: "C123"}, release: make(chan struct{})}
+	throttled := NewThrottledClient(client, time.Minute)
+	slow := map[string]string{service.MetaNamespace: "demo-ns", service.MetaName: "slow"}
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := throttled.SendMessages("Canary [demo-ns/slow] is Progressing", service.HookEvent, slow); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// a slow backend does not block the messages of the other canaries
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := throttled.SendMessages("Canary [demo-ns/demo] is Progressing", service.HookEvent, map[string]string{service.MetaNamespace: "demo-ns", service.MetaName: "demo"}); err != nil {
+			t.Error(err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the message is blocked by the slow backend")
+	}
+
+	// the messages of the slow canary wait for the first one and are throttled
+	close(client.release)
+	wg.Wait()
+	if len(client.sent) != 2 {
+		t.Errorf("unexpected messages %v", client.sent)
+	}
+}
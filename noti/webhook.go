@@ -0,0 +1,122 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+const (
+	// WebhookEventMessage is sent when a gate is reached
+	WebhookEventMessage = "message"
+	// WebhookEventUpdate is sent when a sent message is updated
+	WebhookEventUpdate = "update"
+)
+
+type WebhookOption struct {
+	// URL receives the JSON payloads
+	URL string
+	// Headers are added to every request, e.g. for authorization
+	Headers map[string]string
+}
+
+// WebhookPayload is the JSON body posted to the webhook URL
+type WebhookPayload struct {
+	// Event is either "message" or "update"
+	Event string `json:"event"`
+	// ID of the message. Updates carry the ID returned when the message was sent
+	ID string `json:"id"`
+	// Type of the hook which sends the message
+	Type service.HookType `json:"type,omitempty"`
+	// Text of the message
+	Text string `json:"text"`
+	// Context of the update
+	Context string `json:"context,omitempty"`
+	// Metadata of the canary
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type webhookClientWrapper struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+func init() {
+	// webhook+https://<host and path>
+	Register("webhook", func(u *url.URL) (Client, error) {
+		webhookURL, err := targetURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return NewWebhookClient(WebhookOption{URL: webhookURL}), nil
+	})
+}
+
+func NewWebhookClient(option WebhookOption) Client {
+	if option.URL == "" {
+		return &QuietNoti{}
+	}
+
+	return &webhookClientWrapper{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		url:     option.URL,
+		headers: option.Headers,
+	}
+}
+
+func (w *webhookClientWrapper) SendMessages(text string, hookType service.HookType, meta map[string]string) (map[string]string, error) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	payload := WebhookPayload{
+		Event:    WebhookEventMessage,
+		ID:       id,
+		Type:     hookType,
+		Text:     text,
+		Metadata: meta,
+	}
+	if err := postJSON(w.client, w.url, w.headers, payload); err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+	return map[string]string{w.url: id}, nil
+}
+
+func (w *webhookClientWrapper) UpdateMessages(slackMessages map[string]string, text, context string) error {
+	id, ok := slackMessages[w.url]
+	if !ok {
+		return nil
+	}
+	payload := WebhookPayload{
+		Event:   WebhookEventUpdate,
+		ID:      id,
+		Text:    text,
+		Context: context,
+	}
+	if err := postJSON(w.client, w.url, w.headers, payload); err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	return nil
+}
+
+// AddFileToThreads is not supported by the webhook notifier.
+func (w *webhookClientWrapper) AddFileToThreads(slackMessages map[string]string, fileName, content string) error {
+	return nil
+}
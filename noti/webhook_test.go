@@ -0,0 +1,68 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package noti
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KongZ/canary-gate/service"
+)
+
+func TestWebhookClient(t *testing.T) {
+	var received []WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		received = append(received, payload)
+	}))
+	defer server.Close()
+
+	webhook := NewWebhookClient(WebhookOption{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}})
+	meta := map[string]string{"name": "test-canary", "namespace": "canary-ns"}
+	msgs, err := webhook.SendMessages("Event", service.HookConfirmPromotion, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs[server.URL] == "" {
+		t.Fatalf("expected message ID keyed by URL, got %v", msgs)
+	}
+	if err := webhook.UpdateMessages(msgs, "Canary [canary-ns/test-canary] is Succeeded", "done"); err != nil {
+		t.Error(err)
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected 2 payloads, got %d", len(received))
+	}
+	if received[0].Event != WebhookEventMessage || received[0].Type != service.HookConfirmPromotion || received[0].Metadata["name"] != "test-canary" {
+		t.Errorf("unexpected message %+v", received[0])
+	}
+	if received[1].Event != WebhookEventUpdate || received[1].ID != received[0].ID {
+		t.Errorf("unexpected update %+v", received[1])
+	}
+
+	// a rejected request is reported
+	if _, err := NewWebhookClient(WebhookOption{URL: server.URL}).SendMessages("Event", service.HookEvent, meta); err == nil {
+		t.Error("expected error for unauthorized request")
+	}
+}
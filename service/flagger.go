@@ -29,6 +29,9 @@ const (
 	HookConfirmRollout HookType = "confirm-rollout"
 	// HookConfirmPromotion halt canary promotion until web returns HTTP 200
 	HookConfirmPromotion HookType = "confirm-promotion"
+	// HookConfirmFinalize halt the finalization of the promotion until web returns HTTP 200. Flagger has no finalize
+	// hook, so it is called as a confirm-promotion hook.
+	HookConfirmFinalize HookType = "confirm-finalize"
 	// HookEvent dispatches Flagger events to the specified endpoint
 	HookEvent HookType = "event"
 	// HookRollback rollback canary analysis if web returns HTTP 200
@@ -80,4 +83,18 @@ const (
 	MetaCluster string = "cluster"
 	// a name of response user
 	MetaUser string = "user"
+	// a phase of the canary analysis
+	MetaPhase string = "phase"
+	// a reason of a manual rollback
+	MetaReason string = "reason"
+	// a name of the CanaryGate which injected the webhook
+	MetaGateName string = "gate_name"
+	// a namespace of the CanaryGate which injected the webhook
+	MetaGateNamespace string = "gate_namespace"
+	// a secret which verifies the webhook requests of Flagger
+	MetaGateSecret string = "gate_secret"
+	// a state of the gate when the message is sent
+	MetaGateState string = "gate_state"
+	// true when the gate is changed automatically by its TTL or its schedule, not by a user
+	MetaAuto string = "auto"
 )
@@ -18,7 +18,12 @@ package store
 import (
 	"context"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
 
 	piggysecv1alpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
 	"github.com/KongZ/canary-gate/controller"
@@ -31,6 +36,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	kubernetesConfig "sigs.k8s.io/controller-runtime/pkg/client/config"
@@ -53,6 +60,25 @@ type CanaryGateStore struct {
 	configNS  string
 	event     record.EventBroadcaster
 	recorder  record.EventRecorderLogger
+	// informer and lister cache the CanaryGate objects when CANARY_GATE_STORE_CACHE is enabled
+	informer cache.SharedIndexInformer
+	lister   cache.GenericLister
+	stopCh   chan struct{}
+	// decisions holds the last decision of the webhook of each gate, keyed by namespace:name:type
+	decisions   map[string]savedDecision
+	decisionsMu sync.Mutex
+	// writes tracks the decisions which are being saved to the status
+	writes sync.WaitGroup
+}
+
+// decisionSaveInterval is how often an unchanged decision of the webhook is saved to the CanaryGate status.
+// Flagger calls the webhooks every few seconds, so every answer is not saved.
+const decisionSaveInterval = time.Minute
+
+// savedDecision is the last decision of the webhook of a gate and the time when it was last saved to the status
+type savedDecision struct {
+	decision Decision
+	saved    time.Time
 }
 
 var GroupVersionResource = schema.GroupVersionResource{
@@ -64,6 +90,7 @@ var GroupVersionResource = schema.GroupVersionResource{
 // CanaryGateStore creates new Kubernetes CRD to store gate states.
 // CanaryGate CRD is created in the namespace specified by the environment variable CANARY_GATE_NAMESPACE.
 // The CRD name is constructed as "<name>" in the namespace CANARY_GATE_NAMESPACE.
+// When CANARY_GATE_STORE_CACHE is true, gates are read from an informer cache and the API server is only called on cache miss.
 func NewCanaryGateStore(k8sClient dynamic.Interface) (Store, error) {
 	var k8s dynamic.Interface
 	var err error
@@ -92,10 +119,29 @@ func NewCanaryGateStore(k8sClient dynamic.Interface) (Store, error) {
 		configNS:  os.Getenv("CANARY_GATE_NAMESPACE"),
 		event:     eventBroadcaster,
 		recorder:  eventBroadcaster.NewRecorder(scheme, corev1.EventSource{Component: "canarygate"}),
+		decisions: map[string]savedDecision{},
+	}
+	if enabled, _ := strconv.ParseBool(os.Getenv("CANARY_GATE_STORE_CACHE")); enabled && k8s != nil {
+		store.startInformer()
 	}
 	return store, nil
 }
 
+// startInformer starts watching the CanaryGate objects in the configured namespace, or all namespaces if not configured.
+// It does not wait for the cache to sync; reads fall back to the API server until it does. WaitForSync waits for it.
+func (s *CanaryGateStore) startInformer() {
+	namespace := s.configNS
+	if namespace == "" {
+		namespace = metav1.NamespaceAll
+	}
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(s.k8sClient, 0, namespace, nil)
+	informer := factory.ForResource(GroupVersionResource)
+	s.informer = informer.Informer()
+	s.lister = informer.Lister()
+	s.stopCh = make(chan struct{})
+	factory.Start(s.stopCh)
+}
+
 func newDynamicClient() (dynamic.Interface, error) {
 	kubeConfig, err := kubernetesConfig.GetConfig()
 	if err != nil {
@@ -177,6 +223,39 @@ func (s *CanaryGateStore) GetCanaryGate(ctx context.Context, key StoreKey) (*pig
 	return &gate, nil
 }
 
+// getCachedCanaryGate reads the CanaryGate from the informer cache. It falls back to the API server
+// when the cache is disabled, not synced yet, or does not have the object.
+func (s *CanaryGateStore) getCachedCanaryGate(ctx context.Context, key StoreKey) (*piggysecv1alpha1.CanaryGate, error) {
+	return s.readCachedCanaryGate(ctx, key, s.CreateCanaryGateAndGet)
+}
+
+// lookupCanaryGate reads the CanaryGate from the informer cache like getCachedCanaryGate, but does not create
+// a missing CanaryGate when it falls back to the API server.
+func (s *CanaryGateStore) lookupCanaryGate(ctx context.Context, key StoreKey) (*piggysecv1alpha1.CanaryGate, error) {
+	return s.readCachedCanaryGate(ctx, key, s.GetCanaryGate)
+}
+
+// readCachedCanaryGate reads the CanaryGate from the informer cache, or with the fallback
+func (s *CanaryGateStore) readCachedCanaryGate(ctx context.Context, key StoreKey, fallback func(context.Context, StoreKey) (*piggysecv1alpha1.CanaryGate, error)) (*piggysecv1alpha1.CanaryGate, error) {
+	if s.lister == nil || !s.informer.HasSynced() {
+		return fallback(ctx, key)
+	}
+	obj, err := s.lister.ByNamespace(s.getCanaryGateNamespace(key)).Get(key.Name)
+	if err != nil {
+		log.Trace().Msgf("Canarygate [%s/%s] is not found in cache %v", s.getCanaryGateNamespace(key), key.Name, err)
+		return fallback(ctx, key)
+	}
+	unstructuredObj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fallback(ctx, key)
+	}
+	var gate piggysecv1alpha1.CanaryGate
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredObj.Object, &gate); err != nil {
+		return nil, err
+	}
+	return &gate, nil
+}
+
 func (s *CanaryGateStore) CreateCanaryGateAndGet(ctx context.Context, key StoreKey) (*piggysecv1alpha1.CanaryGate, error) {
 	gateNs := s.getCanaryGateNamespace(key)
 	conf, err := s.GetCanaryGate(ctx, key)
@@ -189,39 +268,30 @@ func (s *CanaryGateStore) CreateCanaryGateAndGet(ctx context.Context, key StoreK
 			log.Error().Msgf("Error to load configmap [%s/%s] %v.", gateNs, key.Name, statusError.ErrStatus.Message)
 			return nil, err
 		}
+		return nil, err
 	}
 	return conf, nil
 }
 
 func (s *CanaryGateStore) UpdateCanaryGate(ctx context.Context, key StoreKey, val bool) {
+	s.updateCanaryGate(ctx, key, val, 0, "", "")
+}
+
+// updateCanaryGate sets the gate value. A positive ttl records the time when the gate reverts to its default value
+// in the CanaryGate status. The controller then resets the gate once the time is reached.
+func (s *CanaryGateStore) updateCanaryGate(ctx context.Context, key StoreKey, val bool, ttl time.Duration, user string, reason string) {
 	gateNs := s.getCanaryGateNamespace(key)
-	// Perform the update
+	status := GateStatus(val)
+	message := changeMessage(key, status, user, reason)
+	// the gate, the message and the history are saved in a single update
 	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		conf, err := s.CreateCanaryGateAndGet(ctx, key)
 		if err != nil {
 			return err
 		}
-		// update gate fields
-		status := GateStatus(val)
-		switch key.Type {
-		case service.HookConfirmRollout:
-			conf.Spec.ConfirmRollout = status
-		case service.HookPreRollout:
-			conf.Spec.PreRollout = status
-		case service.HookRollout:
-			conf.Spec.Rollout = status
-		case service.HookConfirmTrafficIncrease:
-			conf.Spec.ConfirmTrafficIncrease = status
-		case service.HookPostRollout:
-			conf.Spec.PostRollout = status
-		case service.HookConfirmPromotion:
-			conf.Spec.ConfirmPromotion = status
-		case service.HookRollback:
-			conf.Spec.Rollback = status
-		}
-		conf.Status.Name = key.Name
-		conf.Status.Namespace = key.Namespace
-		conf.Status.Target = s.targetName(key.Namespace, key.Name)
+		s.setGate(conf, key, val, ttl, user)
+		conf.Status.Message = message
+		appendStatusHistory(&conf.Status, newHistoryEntry(key, status, user, reason))
 
 		// Convert back to unstructured
 		unstructuredObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(conf)
@@ -230,13 +300,128 @@ func (s *CanaryGateStore) UpdateCanaryGate(ctx context.Context, key StoreKey, va
 		}
 		log.Trace().Msgf("Saving to canarygate [%s/%s]. Gate [%s] is set to [%s]", gateNs, conf.Name, key, status)
 		_, err = s.k8sClient.Resource(GroupVersionResource).Namespace(gateNs).Update(ctx, &unstructured.Unstructured{Object: unstructuredObj}, metav1.UpdateOptions{})
-		log.Trace().Msgf("Recording event [%s/%s]. Gate [%s] is set to [%s]", gateNs, conf.Name, key, status)
-		s.UpdateEvent(ctx, key, "Updated", fmt.Sprintf("Gate [%s] is set to [%s]", key.String(), status))
 		return err
 	})
 	if retryErr != nil {
 		log.Error().Msgf("Unable to update canarygate [%s/%s] %v.", gateNs, key.Name, retryErr)
+		return
 	}
+	log.Trace().Msgf("Recording event [%s/%s]. Gate [%s] is set to [%s]", gateNs, key.Name, key, status)
+	s.recordEvent(ctx, key, "Updated", message)
+}
+
+// setGate sets the gate value with its expiry and the user who changed it
+func (s *CanaryGateStore) setGate(conf *piggysecv1alpha1.CanaryGate, key StoreKey, val bool, ttl time.Duration, user string) {
+	conf.Spec.SetGate(string(key.Type), GateStatus(val))
+	if ttl > 0 {
+		if conf.Status.Expiry == nil {
+			conf.Status.Expiry = map[string]string{}
+		}
+		conf.Status.Expiry[string(key.Type)] = time.Now().Add(ttl).UTC().Format(time.RFC3339)
+	} else {
+		delete(conf.Status.Expiry, string(key.Type))
+	}
+	if user != "" {
+		if conf.Status.ChangedBy == nil {
+			conf.Status.ChangedBy = map[string]string{}
+		}
+		conf.Status.ChangedBy[string(key.Type)] = user
+	} else {
+		delete(conf.Status.ChangedBy, string(key.Type))
+	}
+	if val {
+		delete(conf.Status.ClosedAt, string(key.Type))
+	} else {
+		if conf.Status.ClosedAt == nil {
+			conf.Status.ClosedAt = map[string]string{}
+		}
+		conf.Status.ClosedAt[string(key.Type)] = time.Now().UTC().Format(time.RFC3339)
+	}
+	// the pending approvals end when the gate is opened or closed
+	delete(conf.Status.Approvers, string(key.Type))
+	conf.Status.Name = key.Name
+	conf.Status.Namespace = key.Namespace
+	conf.Status.Target = s.targetName(key.Namespace, key.Name)
+}
+
+// CompareAndSet updates the CanaryGate only when the gate has the expected value. The update carries the
+// resourceVersion which was read, so a concurrent update fails it with a conflict and the gate is compared again.
+func (s *CanaryGateStore) CompareAndSet(ctx context.Context, key StoreKey, expected, desired bool) (bool, error) {
+	gateNs := s.getCanaryGateNamespace(key)
+	swapped := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		swapped = false
+		conf, err := s.CreateCanaryGateAndGet(ctx, key)
+		if err != nil {
+			return err
+		}
+		if gateValue(conf, key) != expected {
+			return nil
+		}
+		s.setGate(conf, key, desired, 0, "")
+		conf.Status.Message = gateMessage(key, GateStatus(desired), "")
+		appendStatusHistory(&conf.Status, newHistoryEntry(key, GateStatus(desired), "", ""))
+		unstructuredObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(conf)
+		if err != nil {
+			return err
+		}
+		if _, err = s.k8sClient.Resource(GroupVersionResource).Namespace(gateNs).Update(ctx, &unstructured.Unstructured{Object: unstructuredObj}, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		swapped = true
+		return nil
+	})
+	if err != nil || !swapped {
+		return false, err
+	}
+	s.recordEvent(ctx, key, "Updated", gateMessage(key, GateStatus(desired), ""))
+	return true, nil
+}
+
+// ConsumeGate closes the gate when spec.requireApproval lists it and it is opened. The cache is checked first, so the
+// gates which do not require an approval for each use are not read from the API server. The check and the close are
+// saved in a single update, so an approval is used only once.
+func (s *CanaryGateStore) ConsumeGate(ctx context.Context, key StoreKey) (bool, error) {
+	cached, err := s.lookupCanaryGate(ctx, key)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !cached.Spec.RequiresApproval(string(key.Type)) {
+		return false, nil
+	}
+	gateNs := s.getCanaryGateNamespace(key)
+	message := consumedMessage(key)
+	consumed := false
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		consumed = false
+		conf, err := s.GetCanaryGate(ctx, key)
+		if err != nil {
+			return err
+		}
+		if !conf.Spec.RequiresApproval(string(key.Type)) || !gateValue(conf, key) {
+			return nil
+		}
+		s.setGate(conf, key, false, 0, "")
+		conf.Status.Message = message
+		appendStatusHistory(&conf.Status, newHistoryEntry(key, GATE_CLOSE, "", ""))
+		unstructuredObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(conf)
+		if err != nil {
+			return err
+		}
+		if _, err = s.k8sClient.Resource(GroupVersionResource).Namespace(gateNs).Update(ctx, &unstructured.Unstructured{Object: unstructuredObj}, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		consumed = true
+		return nil
+	})
+	if err != nil || !consumed {
+		return false, err
+	}
+	s.recordEvent(ctx, key, "Consumed", message)
+	return true, nil
 }
 
 func (s *CanaryGateStore) GetLastEvent(ctx context.Context, key StoreKey) string {
@@ -258,7 +443,7 @@ func (s *CanaryGateStore) UpdateEvent(ctx context.Context, key StoreKey, status
 		}
 		conf.Status.Name = key.Name
 		conf.Status.Namespace = key.Namespace
-		conf.Status.Status = status
+		// the status is the reason of the event, status.status is the overall gate state recorded by the controller
 		conf.Status.Message = message
 		conf.Status.Target = s.targetName(key.Namespace, key.Name)
 		// Convert back to unstructured
@@ -266,67 +451,477 @@ func (s *CanaryGateStore) UpdateEvent(ctx context.Context, key StoreKey, status
 		if err != nil {
 			return err
 		}
-		_, err = s.k8sClient.Resource(GroupVersionResource).Namespace(gateNs).Update(ctx, &unstructured.Unstructured{Object: unstructuredObj}, metav1.UpdateOptions{})
 		log.Trace().Msgf("Updating canarygate [%s/%s] status", gateNs, conf.Name)
-		if message != "" {
-			if gate, err := s.GetCanaryGate(ctx, key); err == nil {
-				s.recorder.Event(
-					gate,                   // The object the event is about.
-					corev1.EventTypeNormal, // The type of event.
-					status,                 // A brief reason.
-					message,                // A human-readable message.
-				)
-			}
-		}
+		_, err = s.k8sClient.Resource(GroupVersionResource).Namespace(gateNs).Update(ctx, &unstructured.Unstructured{Object: unstructuredObj}, metav1.UpdateOptions{})
 		return err
 	})
 	if retryErr != nil {
 		log.Error().Msgf("Unable to update canarygate [%s/%s] %v.", gateNs, key.Name, retryErr)
+		return
 	}
+	s.recordEvent(ctx, key, status, message)
 }
 
-func (s *CanaryGateStore) GateOpen(key StoreKey) {
-	s.UpdateCanaryGate(context.TODO(), key, true)
+// recordEvent records a Kubernetes event on the CanaryGate. It is called once after the update succeeds,
+// so a conflict which retries the update does not record the event again.
+func (s *CanaryGateStore) recordEvent(ctx context.Context, key StoreKey, reason string, message string) {
+	if message == "" {
+		return
+	}
+	if gate, err := s.GetCanaryGate(ctx, key); err == nil {
+		s.recorder.Event(
+			gate,                   // The object the event is about.
+			corev1.EventTypeNormal, // The type of event.
+			reason,                 // A brief reason.
+			message,                // A human-readable message.
+		)
+	}
 }
 
-func (s *CanaryGateStore) GateClose(key StoreKey) {
-	s.UpdateCanaryGate(context.TODO(), key, false)
+func (s *CanaryGateStore) GateOpen(ctx context.Context, key StoreKey, user string) {
+	s.updateCanaryGate(ctx, key, true, 0, user, "")
 }
 
-func (s *CanaryGateStore) IsGateOpen(key StoreKey) bool {
+func (s *CanaryGateStore) RollbackGate(ctx context.Context, key StoreKey, user string, reason string) {
+	s.updateCanaryGate(ctx, key, true, 0, user, reason)
+}
+
+func (s *CanaryGateStore) OpenGateWithTTL(ctx context.Context, key StoreKey, ttl time.Duration, user string) {
+	s.updateCanaryGate(ctx, key, true, ttl, user, "")
+}
+
+func (s *CanaryGateStore) GateClose(ctx context.Context, key StoreKey, user string) {
+	s.updateCanaryGate(ctx, key, false, 0, user, "")
+}
+
+// GateReset clears the gate in the spec, so it follows the default of the CanaryGate. The gate, the message and
+// the history are saved in a single update.
+func (s *CanaryGateStore) GateReset(ctx context.Context, key StoreKey, user string) {
 	gateNs := s.getCanaryGateNamespace(key)
-	conf, err := s.CreateCanaryGateAndGet(context.Background(), key)
+	var message string
+	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		conf, err := s.CreateCanaryGateAndGet(ctx, key)
+		if err != nil {
+			return err
+		}
+		status := GateStatus(gateDefault(conf, key))
+		message = resetMessage(key, status, user)
+		conf.Spec.SetGate(string(key.Type), "")
+		delete(conf.Status.Expiry, string(key.Type))
+		delete(conf.Status.ChangedBy, string(key.Type))
+		delete(conf.Status.ClosedAt, string(key.Type))
+		delete(conf.Status.Approvers, string(key.Type))
+		conf.Status.Message = message
+		appendStatusHistory(&conf.Status, newHistoryEntry(key, status, user, ""))
+		unstructuredObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(conf)
+		if err != nil {
+			return err
+		}
+		_, err = s.k8sClient.Resource(GroupVersionResource).Namespace(gateNs).Update(ctx, &unstructured.Unstructured{Object: unstructuredObj}, metav1.UpdateOptions{})
+		return err
+	})
+	if retryErr != nil {
+		log.Error().Msgf("Unable to update canarygate [%s/%s] %v.", gateNs, key.Name, retryErr)
+		return
+	}
+	s.recordEvent(ctx, key, "Reset", message)
+}
+
+func (s *CanaryGateStore) GetChangedBy(ctx context.Context, key StoreKey) string {
+	gate, err := s.GetCanaryGate(ctx, key)
 	if err != nil {
-		log.Warn().Msgf("Unable to load canarygate [%s/%s]. Gate [%s] is set to [%s]", gateNs, key.Name, key, defaultText(key))
-		return defaultValue(key)
-	}
-	status := ""
-	if conf != nil {
-		switch key.Type {
-		case service.HookConfirmRollout:
-			status = conf.Spec.ConfirmRollout
-		case service.HookPreRollout:
-			status = conf.Spec.PreRollout
-		case service.HookRollout:
-			status = conf.Spec.Rollout
-		case service.HookConfirmTrafficIncrease:
-			status = conf.Spec.ConfirmTrafficIncrease
-		case service.HookPostRollout:
-			status = conf.Spec.PostRollout
-		case service.HookConfirmPromotion:
-			status = conf.Spec.ConfirmPromotion
-		case service.HookRollback:
-			status = conf.Spec.Rollback
+		return ""
+	}
+	return gate.Status.ChangedBy[string(key.Type)]
+}
+
+// Exists reports whether the CanaryGate of the key exists. The CanaryGate is read from the API server, not the cache.
+func (s *CanaryGateStore) Exists(ctx context.Context, key StoreKey) (bool, error) {
+	if _, err := s.GetCanaryGate(ctx, key); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return false, nil
 		}
+		return false, err
 	}
+	return true, nil
+}
+
+func (s *CanaryGateStore) GetClosedAt(ctx context.Context, key StoreKey) time.Time {
+	gate, err := s.getCachedCanaryGate(ctx, key)
+	if err != nil {
+		return time.Time{}
+	}
+	closedAt, _ := time.Parse(time.RFC3339, gate.Status.ClosedAt[string(key.Type)])
+	return closedAt
+}
+
+func (s *CanaryGateStore) IsGateOpen(ctx context.Context, key StoreKey) bool {
+	open, err := s.GateState(ctx, key)
+	if err != nil {
+		log.Warn().Msgf("Unable to load canarygate [%s/%s]. Gate [%s] is set to [%s]", s.getCanaryGateNamespace(key), key.Name, key, defaultText(key))
+	}
+	return open
+}
+
+// GateState reads the gate from the informer cache. A CanaryGate which cannot be created and is still not found has
+// the default gates.
+func (s *CanaryGateStore) GateState(ctx context.Context, key StoreKey) (bool, error) {
+	gateNs := s.getCanaryGateNamespace(key)
+	conf, err := s.getCachedCanaryGate(ctx, key)
+	if k8serrors.IsNotFound(err) {
+		return defaultValue(key), nil
+	}
+	if err != nil {
+		return defaultValue(key), &UnavailableError{Key: key, Err: err}
+	}
+	if conf == nil {
+		return defaultValue(key), nil
+	}
+	if isExpired(conf, key) {
+		log.Trace().Msgf("Gate [%s] of canarygate [%s/%s] is expired", key, gateNs, key.Name)
+		return gateDefault(conf, key), nil
+	}
+	status := conf.Spec.GetGate(string(key.Type))
 	log.Trace().Msgf("Loading from canarygate [%s/%s]. Gate [%s] is set to [%s]", gateNs, key.Name, key, status)
 	if status == "" {
-		return defaultValue(key)
+		return gateDefault(conf, key), nil
 	}
-	return GateBoolStatus(status)
+	return GateBoolStatus(status), nil
+}
+
+func (s *CanaryGateStore) List(ctx context.Context, namespace string, name string) (map[service.HookType]bool, error) {
+	conf, err := s.GetCanaryGate(ctx, StoreKey{Namespace: namespace, Name: name})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return defaultGates(namespace, name), nil
+		}
+		return nil, err
+	}
+	return GatesOf(conf), nil
+}
+
+// Deployments returns the deployments of the CanaryGates in the config namespace, or in all namespaces when it is not set
+func (s *CanaryGateStore) Deployments(ctx context.Context) ([]StoreKey, error) {
+	list, err := s.k8sClient.Resource(GroupVersionResource).Namespace(s.configNS).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	seen := map[StoreKey]bool{}
+	for _, item := range list.Items {
+		seen[StoreKey{Namespace: item.GetNamespace(), Name: item.GetName()}] = true
+	}
+	return sortedKeys(seen), nil
+}
+
+// GatesOf returns the states of all gate types of a CanaryGate. An expired or unset gate has its default state.
+func GatesOf(gate *piggysecv1alpha1.CanaryGate) map[service.HookType]bool {
+	gates := defaultGates(gate.Namespace, gate.Name)
+	for t := range gates {
+		key := StoreKey{Namespace: gate.Namespace, Name: gate.Name, Type: t}
+		if status := gate.Spec.GetGate(string(t)); status != "" && !isExpired(gate, key) {
+			gates[t] = GateBoolStatus(status)
+		} else {
+			gates[t] = gateDefault(gate, key)
+		}
+	}
+	return gates
+}
+
+// Health lists at most one canarygate to check that the API server is reachable
+func (s *CanaryGateStore) Health(ctx context.Context) error {
+	if s.k8sClient == nil {
+		return fmt.Errorf("kubernetes client is not configured")
+	}
+	_, err := s.k8sClient.Resource(GroupVersionResource).Namespace(s.configNS).List(ctx, metav1.ListOptions{Limit: 1})
+	return err
+}
+
+// WaitForSync blocks until the informer cache has listed the CanaryGates. It returns at once when the cache is disabled.
+func (s *CanaryGateStore) WaitForSync(ctx context.Context) error {
+	if s.informer == nil {
+		return nil
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), s.informer.HasSynced) {
+		return fmt.Errorf("canarygate cache is not synced: %w", ctx.Err())
+	}
+	return nil
 }
 
 func (s *CanaryGateStore) Shutdown() error {
+	if s.stopCh != nil {
+		close(s.stopCh)
+	}
+	s.writes.Wait()
 	s.event.Shutdown()
 	return nil
 }
+
+// gateDefault returns the default state of a gate. A gate which requires multiple approvals is closed until the quorum
+// is reached, and a gate which requires an approval for each use is closed until it is approved.
+func gateDefault(gate *piggysecv1alpha1.CanaryGate, key StoreKey) bool {
+	if gate.Spec.Approvals[string(key.Type)] > 1 || gate.Spec.RequiresApproval(string(key.Type)) {
+		return false
+	}
+	return defaultValue(key)
+}
+
+// gateValue returns the state of the gate in the spec, or its default when it is not set or is expired
+func gateValue(gate *piggysecv1alpha1.CanaryGate, key StoreKey) bool {
+	if status := gate.Spec.GetGate(string(key.Type)); status != "" && !isExpired(gate, key) {
+		return GateBoolStatus(status)
+	}
+	return gateDefault(gate, key)
+}
+
+// isExpired checks whether the gate was opened with a TTL which has already passed.
+func isExpired(gate *piggysecv1alpha1.CanaryGate, key StoreKey) bool {
+	val, ok := gate.Status.Expiry[string(key.Type)]
+	if !ok {
+		return false
+	}
+	expiry, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return false
+	}
+	return !time.Now().Before(expiry)
+}
+
+// updateStatus applies the mutate function to the CanaryGate status and saves it.
+// It returns the error of the last attempt when the status cannot be saved.
+func (s *CanaryGateStore) updateStatus(ctx context.Context, key StoreKey, mutate func(status *piggysecv1alpha1.CanaryGateStatus)) error {
+	gateNs := s.getCanaryGateNamespace(key)
+	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		conf, err := s.CreateCanaryGateAndGet(ctx, key)
+		if err != nil {
+			return err
+		}
+		mutate(&conf.Status)
+		unstructuredObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(conf)
+		if err != nil {
+			return err
+		}
+		_, err = s.k8sClient.Resource(GroupVersionResource).Namespace(gateNs).Update(ctx, &unstructured.Unstructured{Object: unstructuredObj}, metav1.UpdateOptions{})
+		return err
+	})
+	if retryErr != nil {
+		return fmt.Errorf("unable to update canarygate [%s/%s]: %w", gateNs, key.Name, retryErr)
+	}
+	return nil
+}
+
+// GetPhase reads the phase from the informer cache, like the gates.
+func (s *CanaryGateStore) GetPhase(ctx context.Context, key StoreKey) string {
+	gate, err := s.lookupCanaryGate(ctx, key)
+	if err != nil {
+		return ""
+	}
+	return gate.Status.Phase
+}
+
+// UpdatePhase saves the phase only when it changes. The last phase is read from the informer cache, like the gates.
+func (s *CanaryGateStore) UpdatePhase(ctx context.Context, key StoreKey, phase string) string {
+	var last string
+	if gate, err := s.lookupCanaryGate(ctx, key); err == nil {
+		last = gate.Status.Phase
+	}
+	if last != phase {
+		err := s.updateStatus(ctx, key, func(status *piggysecv1alpha1.CanaryGateStatus) {
+			status.Phase = phase
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("Unable to save the status of gate [%s].", key)
+		}
+	}
+	return last
+}
+
+func (s *CanaryGateStore) SetRolledBackAt(ctx context.Context, key StoreKey, at time.Time) {
+	err := s.updateStatus(ctx, key, func(status *piggysecv1alpha1.CanaryGateStatus) {
+		status.RolledBackAt = at.UTC().Format(time.RFC3339)
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("Unable to save the status of gate [%s].", key)
+	}
+}
+
+// GetRolledBackAt reads the time of the rollback from the informer cache, like the gates.
+func (s *CanaryGateStore) GetRolledBackAt(ctx context.Context, key StoreKey) time.Time {
+	gate, err := s.lookupCanaryGate(ctx, key)
+	if err != nil {
+		return time.Time{}
+	}
+	rolledBackAt, _ := time.Parse(time.RFC3339, gate.Status.RolledBackAt)
+	return rolledBackAt
+}
+
+// SetDecision keeps the decision in memory. It is saved to the CanaryGate status in the background when it changes,
+// or every decisionSaveInterval while it does not, so the webhooks do not update the CanaryGate on every call.
+func (s *CanaryGateStore) SetDecision(ctx context.Context, key StoreKey, decision Decision) {
+	s.decisionsMu.Lock()
+	last, ok := s.decisions[key.String()]
+	save := !ok || last.decision.Approved != decision.Approved || decision.Time.Sub(last.saved) >= decisionSaveInterval
+	if save {
+		last.saved = decision.Time
+	}
+	last.decision = decision
+	s.decisions[key.String()] = last
+	s.decisionsMu.Unlock()
+	if !save {
+		return
+	}
+	s.writes.Add(1)
+	go func() {
+		defer s.writes.Done()
+		err := s.updateStatus(context.WithoutCancel(ctx), key, func(status *piggysecv1alpha1.CanaryGateStatus) {
+			if status.Decisions == nil {
+				status.Decisions = map[string]piggysecv1alpha1.GateDecision{}
+			}
+			status.Decisions[string(key.Type)] = piggysecv1alpha1.GateDecision{
+				Decision: decision.String(),
+				Time:     decision.Time.UTC().Format(time.RFC3339),
+			}
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("Unable to save the status of gate [%s].", key)
+			// the next decision is saved again
+			s.decisionsMu.Lock()
+			if last, ok := s.decisions[key.String()]; ok && last.saved.Equal(decision.Time) {
+				last.saved = time.Time{}
+				s.decisions[key.String()] = last
+			}
+			s.decisionsMu.Unlock()
+		}
+	}()
+}
+
+// GetDecision returns the decision kept in memory, or reads it from the informer cache, like the gates, when the
+// webhook was not answered since the start.
+func (s *CanaryGateStore) GetDecision(ctx context.Context, key StoreKey) Decision {
+	s.decisionsMu.Lock()
+	last, ok := s.decisions[key.String()]
+	s.decisionsMu.Unlock()
+	if ok {
+		return last.decision
+	}
+	gate, err := s.lookupCanaryGate(ctx, key)
+	if err != nil {
+		return Decision{}
+	}
+	decision, ok := gate.Status.Decisions[string(key.Type)]
+	if !ok {
+		return Decision{}
+	}
+	decided, _ := time.Parse(time.RFC3339, decision.Time)
+	return Decision{Approved: decision.Decision == DecisionApproved, Time: decided}
+}
+
+func (s *CanaryGateStore) SaveMessages(ctx context.Context, key StoreKey, messages map[string]string) {
+	err := s.updateStatus(ctx, key, func(status *piggysecv1alpha1.CanaryGateStatus) {
+		status.Messages = maps.Clone(messages)
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("Unable to save the status of gate [%s].", key)
+	}
+}
+
+func (s *CanaryGateStore) GetMessages(ctx context.Context, key StoreKey) map[string]string {
+	gate, err := s.GetCanaryGate(ctx, key)
+	if err != nil || gate.Status.Messages == nil {
+		return map[string]string{}
+	}
+	return gate.Status.Messages
+}
+
+func (s *CanaryGateStore) AppendHistory(ctx context.Context, key StoreKey, entry HistoryEntry) {
+	err := s.updateStatus(ctx, key, func(status *piggysecv1alpha1.CanaryGateStatus) {
+		appendStatusHistory(status, entry)
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("Unable to save the status of gate [%s].", key)
+	}
+}
+
+// appendStatusHistory adds the entry to the status and keeps the last historyLimit entries
+func appendStatusHistory(status *piggysecv1alpha1.CanaryGateStatus, entry HistoryEntry) {
+	status.History = append(status.History, piggysecv1alpha1.GateChange{
+		Time:   entry.Time.UTC().Format(time.RFC3339),
+		Gate:   string(entry.Type),
+		Status: entry.Status,
+		User:   entry.User,
+		Reason: entry.Reason,
+	})
+	if len(status.History) > historyLimit {
+		status.History = status.History[len(status.History)-historyLimit:]
+	}
+}
+
+// GetHistory reads the history from the informer cache, so explaining a webhook decision does not read the API server.
+func (s *CanaryGateStore) GetHistory(ctx context.Context, key StoreKey) []HistoryEntry {
+	history := []HistoryEntry{}
+	gate, err := s.lookupCanaryGate(ctx, key)
+	if err != nil {
+		return history
+	}
+	for _, change := range gate.Status.History {
+		changed, _ := time.Parse(time.RFC3339, change.Time)
+		history = append(history, HistoryEntry{
+			Time:   changed,
+			Type:   service.HookType(change.Gate),
+			Status: change.Status,
+			User:   change.User,
+			Reason: change.Reason,
+		})
+	}
+	return history
+}
+
+// Approve records the user in the CanaryGate status when spec.approvals requires multiple approvers for the gate.
+// Each user is counted once. The approvers are cleared when the gate is opened or closed.
+func (s *CanaryGateStore) Approve(ctx context.Context, key StoreKey, user string) (Approval, error) {
+	gate, err := s.CreateCanaryGateAndGet(ctx, key)
+	if err != nil {
+		return Approval{}, err
+	}
+	required := gate.Spec.Approvals[string(key.Type)]
+	if required <= 1 {
+		return singleApproval(user), nil
+	}
+	if user == "" {
+		return Approval{}, fmt.Errorf("gate [%s] requires %d approvals, user is required", key.String(), required)
+	}
+	approval := Approval{Required: required}
+	err = s.updateStatus(ctx, key, func(status *piggysecv1alpha1.CanaryGateStatus) {
+		if status.Approvers == nil {
+			status.Approvers = map[string][]string{}
+		}
+		approvers := status.Approvers[string(key.Type)]
+		if !slices.Contains(approvers, user) {
+			approvers = append(approvers, user)
+		}
+		status.Approvers[string(key.Type)] = approvers
+		approval.Approvers = slices.Clone(approvers)
+	})
+	if err != nil {
+		return Approval{}, err
+	}
+	return approval, nil
+}
+
+func (s *CanaryGateStore) GetApproval(ctx context.Context, key StoreKey) Approval {
+	gate, err := s.GetCanaryGate(ctx, key)
+	if err != nil {
+		return Approval{Required: 1}
+	}
+	return Approval{
+		Approvers: slices.Clone(gate.Status.Approvers[string(key.Type)]),
+		Required:  max(gate.Spec.Approvals[string(key.Type)], 1),
+	}
+}
+
+func (s *CanaryGateStore) GetDependencies(ctx context.Context, key StoreKey) []service.HookType {
+	gate, err := s.GetCanaryGate(ctx, key)
+	if err != nil {
+		return gateDependencies(&piggysecv1alpha1.CanaryGateSpec{}, key)
+	}
+	return gateDependencies(&gate.Spec, key)
+}
@@ -17,13 +17,21 @@ package store
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
+	piggysecv1alpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
 	// A popular assertion library
 	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestCanaryGate(t *testing.T) {
@@ -44,20 +52,20 @@ func TestCanaryGate(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
-		result := store.IsGateOpen(sk)
+		result := store.IsGateOpen(context.TODO(), sk)
 		time.Sleep(10 * time.Millisecond) // wait for gate to create
 		require.Equalf(t, v.expectedInit, result, "[%s] [default] gate expected %v found %v", serviceType, v.expectedInit, result)
 
 		// close gate
-		store.GateClose(sk)
+		store.GateClose(t.Context(), sk, "")
 		time.Sleep(10 * time.Millisecond) // wait for gate to close
-		result = store.IsGateOpen(sk)
+		result = store.IsGateOpen(context.TODO(), sk)
 		require.Equalf(t, v.expectedAfterClose, result, "[%s] is [closed] gate expected %v found %v", serviceType, v.expectedAfterClose, result)
 
 		// open gate
-		store.GateOpen(sk)
+		store.GateOpen(t.Context(), sk, "")
 		time.Sleep(10 * time.Millisecond) // wait for gate to open
-		result = store.IsGateOpen(sk)
+		result = store.IsGateOpen(context.TODO(), sk)
 		require.Equalf(t, v.expectedAfterOpen, result, "[%s] is [opened] gate expected %v found %v", serviceType, v.expectedAfterOpen, result)
 
 		// shutdown store
@@ -89,3 +97,403 @@ func TestCanaryGateEvent(t *testing.T) {
 	result = store.GetLastEvent(context.TODO(), sk)
 	require.EqualValuesf(t, eventMessage, result, "Event message should be '%s', found '%s'", eventMessage, result)
 }
+
+func TestCanaryGateTTL(t *testing.T) {
+	sk := StoreKey{
+		Namespace: "canary-ns",
+		Name:      "test-canary",
+		Type:      service.HookConfirmPromotion,
+	}
+	scheme := runtime.NewScheme()
+	f := fake.NewSimpleDynamicClient(scheme)
+	store, err := NewCanaryGateStore(f)
+	require.NoError(t, err)
+	store.GateClose(t.Context(), sk, "")
+	store.OpenGateWithTTL(t.Context(), sk, time.Hour, "")
+	require.True(t, store.IsGateOpen(context.TODO(), sk), "gate should be opened before TTL")
+
+	gate, err := store.(*CanaryGateStore).GetCanaryGate(context.TODO(), sk)
+	require.NoError(t, err)
+	require.Contains(t, gate.Status.Expiry, string(sk.Type), "expiry should be recorded in status")
+
+	// expiry in the past makes the gate fall back to its default
+	gate.Status.Expiry[string(sk.Type)] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	require.True(t, isExpired(gate, sk))
+
+	// closing the gate clears the expiry
+	store.GateClose(t.Context(), sk, "")
+	gate, err = store.(*CanaryGateStore).GetCanaryGate(context.TODO(), sk)
+	require.NoError(t, err)
+	require.NotContains(t, gate.Status.Expiry, string(sk.Type), "expiry should be cleared")
+	require.False(t, store.IsGateOpen(context.TODO(), sk))
+}
+
+func TestCanaryGateDefaultClosed(t *testing.T) {
+	testDefaultClosed(t, func() Store {
+		store, err := NewCanaryGateStore(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestCanaryGateList(t *testing.T) {
+	store, err := NewCanaryGateStore(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	require.NoError(t, err)
+	testList(t, store)
+}
+
+func TestCanaryGateHistory(t *testing.T) {
+	store, err := NewCanaryGateStore(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	require.NoError(t, err)
+	testHistory(t, store)
+}
+
+func TestCanaryGateDeployments(t *testing.T) {
+	f := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		GroupVersionResource: "CanaryGateList",
+	})
+	store, err := NewCanaryGateStore(f)
+	require.NoError(t, err)
+	testDeployments(t, store)
+}
+
+func TestCanaryGatePhase(t *testing.T) {
+	store, err := NewCanaryGateStore(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	require.NoError(t, err)
+	testPhase(t, store)
+}
+
+func TestCanaryGateRolledBackAt(t *testing.T) {
+	store, err := NewCanaryGateStore(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	require.NoError(t, err)
+	testRolledBackAt(t, store)
+}
+
+func TestCanaryGateDecision(t *testing.T) {
+	store, err := NewCanaryGateStore(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	require.NoError(t, err)
+	testDecision(t, store)
+}
+
+func TestCanaryGateDecisionThrottled(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	f := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	s, err := NewCanaryGateStore(f)
+	require.NoError(t, err)
+	store := s.(*CanaryGateStore)
+	decided := time.Now().Truncate(time.Second)
+	store.SetDecision(t.Context(), sk, Decision{Approved: false, Time: decided})
+	store.writes.Wait()
+	f.ClearActions()
+
+	// the same decision is kept in memory until the interval has passed
+	store.SetDecision(t.Context(), sk, Decision{Approved: false, Time: decided.Add(10 * time.Second)})
+	store.writes.Wait()
+	require.Empty(t, f.Actions())
+	require.True(t, decided.Add(10*time.Second).Equal(store.GetDecision(t.Context(), sk).Time))
+	gate, err := store.GetCanaryGate(t.Context(), sk)
+	require.NoError(t, err)
+	require.Equal(t, decided.UTC().Format(time.RFC3339), gate.Status.Decisions[string(sk.Type)].Time)
+
+	// a changed decision is saved at once
+	store.SetDecision(t.Context(), sk, Decision{Approved: true, Time: decided.Add(20 * time.Second)})
+	store.writes.Wait()
+	gate, err = store.GetCanaryGate(t.Context(), sk)
+	require.NoError(t, err)
+	require.Equal(t, DecisionApproved, gate.Status.Decisions[string(sk.Type)].Decision)
+
+	// an unchanged decision is saved again after the interval
+	f.ClearActions()
+	store.SetDecision(t.Context(), sk, Decision{Approved: true, Time: decided.Add(20*time.Second + decisionSaveInterval)})
+	store.writes.Wait()
+	require.NotEmpty(t, f.Actions())
+}
+
+func TestCanaryGateHealth(t *testing.T) {
+	f := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		GroupVersionResource: "CanaryGateList",
+	})
+	store, err := NewCanaryGateStore(f)
+	require.NoError(t, err)
+	require.NoError(t, store.Health(context.TODO()))
+	f.PrependReactor("list", "canarygates", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	require.Error(t, store.Health(context.TODO()))
+}
+
+func TestCanaryGateChangedBy(t *testing.T) {
+	store, err := NewCanaryGateStore(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	require.NoError(t, err)
+	testChangedBy(t, store)
+}
+
+func TestCanaryGateClosedAt(t *testing.T) {
+	store, err := NewCanaryGateStore(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	require.NoError(t, err)
+	testClosedAt(t, store)
+}
+
+func TestCanaryGateWaitForSync(t *testing.T) {
+	// the store without a cache does not wait
+	store, err := NewCanaryGateStore(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	require.NoError(t, err)
+	require.NoError(t, store.WaitForSync(t.Context()))
+
+	// a cache which cannot sync fails with the context
+	t.Setenv("CANARY_GATE_STORE_CACHE", "true")
+	f := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		GroupVersionResource: "CanaryGateList",
+	})
+	f.PrependReactor("list", "canarygates", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("apiserver is unreachable")
+	})
+	store, err = NewCanaryGateStore(f)
+	require.NoError(t, err)
+	defer func() { _ = store.Shutdown() }()
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, store.WaitForSync(ctx), context.DeadlineExceeded)
+}
+
+func TestCanaryGateReset(t *testing.T) {
+	store, err := NewCanaryGateStore(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	require.NoError(t, err)
+	testReset(t, store)
+}
+
+func TestCanaryGateCache(t *testing.T) {
+	t.Setenv("CANARY_GATE_STORE_CACHE", "true")
+	sk := StoreKey{
+		Namespace: "canary-ns",
+		Name:      "test-canary",
+		Type:      service.HookConfirmPromotion,
+	}
+	f := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		GroupVersionResource: "CanaryGateList",
+	})
+	store, err := NewCanaryGateStore(f)
+	require.NoError(t, err)
+	cgStore := store.(*CanaryGateStore)
+	require.NotNil(t, cgStore.lister, "lister should be created when cache is enabled")
+	require.NoError(t, store.WaitForSync(t.Context()), "cache should be synced")
+	require.True(t, cgStore.informer.HasSynced())
+
+	// a cache miss falls back to the API server
+	require.True(t, store.IsGateOpen(context.TODO(), sk))
+	store.GateClose(t.Context(), sk, "")
+	require.Eventually(t, func() bool { return !store.IsGateOpen(context.TODO(), sk) }, time.Second, 10*time.Millisecond, "closed gate should be read from cache")
+	_, err = cgStore.lister.ByNamespace(sk.Namespace).Get(sk.Name)
+	require.NoError(t, err, "canarygate should be in cache")
+	store.GateOpen(t.Context(), sk, "")
+	require.Eventually(t, func() bool { return store.IsGateOpen(context.TODO(), sk) }, time.Second, 10*time.Millisecond, "opened gate should be read from cache")
+
+	// the history and the phase of the webhooks are read from the cache
+	gets := func() int {
+		count := 0
+		for _, action := range f.Actions() {
+			if action.GetVerb() == "get" {
+				count++
+			}
+		}
+		return count
+	}
+	before := gets()
+	store.GetHistory(context.TODO(), sk)
+	store.UpdatePhase(context.TODO(), sk, "")
+	require.Equal(t, before, gets(), "cached canarygate should not be read from the API server")
+	require.NoError(t, store.Shutdown())
+}
+
+func TestCanaryGateApprovals(t *testing.T) {
+	sk := StoreKey{
+		Namespace: "canary-ns",
+		Name:      "test-canary",
+		Type:      service.HookConfirmPromotion,
+	}
+	f := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&piggysecv1alpha1.CanaryGate{
+		TypeMeta:   metav1.TypeMeta{APIVersion: piggysecv1alpha1.GroupVersion.String(), Kind: "CanaryGate"},
+		ObjectMeta: metav1.ObjectMeta{Name: sk.Name, Namespace: sk.Namespace},
+		Spec: piggysecv1alpha1.CanaryGateSpec{
+			Approvals: map[string]int{string(service.HookConfirmPromotion): 2},
+		},
+	})
+	require.NoError(t, err)
+	_, err = f.Resource(GroupVersionResource).Namespace(sk.Namespace).Create(context.TODO(), &unstructured.Unstructured{Object: obj}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	store, err := NewCanaryGateStore(f)
+	require.NoError(t, err)
+
+	// a gate which requires multiple approvals is closed by default
+	require.False(t, store.IsGateOpen(context.TODO(), sk))
+	require.Equal(t, Approval{Required: 2}, store.GetApproval(context.TODO(), sk))
+	_, err = store.Approve(context.TODO(), sk, "")
+	require.Error(t, err, "anonymous approval should be rejected")
+
+	// the same user is counted once
+	approval, err := store.Approve(context.TODO(), sk, "alice")
+	require.NoError(t, err)
+	require.False(t, approval.Approved())
+	approval, err = store.Approve(context.TODO(), sk, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice"}, approval.Approvers)
+	require.False(t, store.IsGateOpen(context.TODO(), sk))
+
+	approval, err = store.Approve(context.TODO(), sk, "bob")
+	require.NoError(t, err)
+	require.True(t, approval.Approved())
+	require.Equal(t, "alice, bob", approval.ChangedBy())
+	require.Equal(t, 2, len(store.GetApproval(context.TODO(), sk).Approvers))
+
+	// opening the gate clears the pending approvers
+	store.GateOpen(t.Context(), sk, approval.ChangedBy())
+	require.True(t, store.IsGateOpen(context.TODO(), sk))
+	require.Empty(t, store.GetApproval(context.TODO(), sk).Approvers)
+
+	// other gates require a single approval
+	approval, err = store.Approve(context.TODO(), StoreKey{Namespace: sk.Namespace, Name: sk.Name, Type: service.HookConfirmRollout}, "")
+	require.NoError(t, err)
+	require.True(t, approval.Approved())
+
+	// an approval which cannot be saved is not reported as counted
+	f.PrependReactor("update", "canarygates", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	approval, err = store.Approve(context.TODO(), sk, "carol")
+	require.ErrorContains(t, err, "connection refused")
+	require.Equal(t, Approval{}, approval)
+	require.Empty(t, store.GetApproval(context.TODO(), sk).Approvers)
+}
+
+func TestCanaryGateRequireApproval(t *testing.T) {
+	sk := StoreKey{
+		Namespace: "canary-ns",
+		Name:      "test-canary",
+		Type:      service.HookConfirmPromotion,
+	}
+	f := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&piggysecv1alpha1.CanaryGate{
+		TypeMeta:   metav1.TypeMeta{APIVersion: piggysecv1alpha1.GroupVersion.String(), Kind: "CanaryGate"},
+		ObjectMeta: metav1.ObjectMeta{Name: sk.Name, Namespace: sk.Namespace},
+		Spec: piggysecv1alpha1.CanaryGateSpec{
+			RequireApproval: []string{string(service.HookConfirmPromotion)},
+		},
+	})
+	require.NoError(t, err)
+	_, err = f.Resource(GroupVersionResource).Namespace(sk.Namespace).Create(context.TODO(), &unstructured.Unstructured{Object: obj}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	store, err := NewCanaryGateStore(f)
+	require.NoError(t, err)
+
+	// a gate which requires an approval for each use is closed by default
+	require.False(t, store.IsGateOpen(context.TODO(), sk))
+	consumed, err := store.ConsumeGate(context.TODO(), sk)
+	require.NoError(t, err)
+	require.False(t, consumed, "a closed gate has no approval to use")
+
+	// the approval is used once
+	store.GateOpen(t.Context(), sk, "alice")
+	require.True(t, store.IsGateOpen(context.TODO(), sk))
+	consumed, err = store.ConsumeGate(context.TODO(), sk)
+	require.NoError(t, err)
+	require.True(t, consumed)
+	require.False(t, store.IsGateOpen(context.TODO(), sk))
+	consumed, err = store.ConsumeGate(context.TODO(), sk)
+	require.NoError(t, err)
+	require.False(t, consumed)
+	history := store.GetHistory(context.TODO(), sk)
+	require.Equal(t, GATE_CLOSE, history[len(history)-1].Status)
+	require.Equal(t, consumedMessage(sk), store.GetLastEvent(context.TODO(), sk))
+
+	// the other gates stay opened
+	other := StoreKey{Namespace: sk.Namespace, Name: sk.Name, Type: service.HookConfirmRollout}
+	require.True(t, store.IsGateOpen(context.TODO(), other))
+	consumed, err = store.ConsumeGate(context.TODO(), other)
+	require.NoError(t, err)
+	require.False(t, consumed)
+	require.True(t, store.IsGateOpen(context.TODO(), other))
+
+	// a missing CanaryGate has no gate to close
+	consumed, err = store.ConsumeGate(context.TODO(), StoreKey{Namespace: sk.Namespace, Name: "missing", Type: sk.Type})
+	require.NoError(t, err)
+	require.False(t, consumed)
+}
+
+func TestCanaryGateCompareAndSet(t *testing.T) {
+	store, err := NewCanaryGateStore(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	require.NoError(t, err)
+	testCompareAndSet(t, store)
+}
+
+func TestCanaryGateCompareAndSetConflict(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	f := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	store, err := NewCanaryGateStore(f)
+	require.NoError(t, err)
+	require.True(t, store.IsGateOpen(context.TODO(), sk))
+
+	// another writer closes the gate between the read and the update, so the update is rejected with a conflict
+	conflicted := false
+	f.PrependReactor("update", "canarygates", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicted {
+			return false, nil, nil
+		}
+		conflicted = true
+		obj := action.(k8stesting.UpdateAction).GetObject().(*unstructured.Unstructured).DeepCopy()
+		require.NoError(t, unstructured.SetNestedField(obj.Object, GATE_CLOSE, "spec", string(sk.Type)))
+		require.NoError(t, f.Tracker().Update(GroupVersionResource, obj, obj.GetNamespace()))
+		return true, nil, k8serrors.NewConflict(GroupVersionResource.GroupResource(), obj.GetName(), errors.New("object was modified"))
+	})
+	swapped, err := store.CompareAndSet(t.Context(), sk, true, false)
+	require.NoError(t, err)
+	require.True(t, conflicted)
+	require.False(t, swapped, "the gate closed by another writer should not be swapped again")
+	require.False(t, store.IsGateOpen(context.TODO(), sk))
+}
+
+func TestCanaryGateSingleUpdate(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	f := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	store, err := NewCanaryGateStore(f)
+	require.NoError(t, err)
+	require.True(t, store.IsGateOpen(context.TODO(), sk))
+
+	// the first update is rejected with a conflict and retried
+	conflicted := false
+	f.PrependReactor("update", "canarygates", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicted {
+			return false, nil, nil
+		}
+		conflicted = true
+		return true, nil, k8serrors.NewConflict(GroupVersionResource.GroupResource(), sk.Name, errors.New("object was modified"))
+	})
+	f.ClearActions()
+	store.GateClose(t.Context(), sk, "alice")
+	updates := 0
+	for _, action := range f.Actions() {
+		if action.GetVerb() == "update" {
+			updates++
+		}
+	}
+	require.True(t, conflicted)
+	require.Equal(t, 2, updates, "the gate, the message and the history should be saved in one update")
+	require.False(t, store.IsGateOpen(context.TODO(), sk))
+	require.Len(t, store.GetHistory(context.TODO(), sk), 1)
+	require.Contains(t, store.GetLastEvent(context.TODO(), sk), "alice")
+}
+
+func TestCanaryGateGateStateUnavailable(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback}
+	f := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	store, err := NewCanaryGateStore(f)
+	require.NoError(t, err)
+	f.PrependReactor("get", "canarygates", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	open, err := store.GateState(t.Context(), sk)
+	require.ErrorIs(t, err, ErrStoreUnavailable)
+	require.EqualError(t, err, "unable to read gate [canary-ns/test-canary=rollback]: connection refused")
+	require.False(t, open)
+	require.False(t, store.IsGateOpen(t.Context(), sk))
+}
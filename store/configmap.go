@@ -17,15 +17,22 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 	"sync"
+	"text/template"
+	"time"
 
+	piggysecv1alpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
 	"github.com/KongZ/canary-gate/service"
 	"github.com/rs/zerolog/log"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/util/retry"
 	kubernetesConfig "sigs.k8s.io/controller-runtime/pkg/client/config"
@@ -33,16 +40,31 @@ import (
 
 const ConfigMapSuffix = "cgate"
 
+// defaultConfigMapTemplate is the name of the ConfigMaps when CANARY_GATE_CONFIGMAP_TEMPLATE is not set
+const defaultConfigMapTemplate = "{{.Namespace}}-{{.Name}}-" + ConfigMapSuffix
+
+// ConfigMapLabel marks the ConfigMaps of the gates, whose deployment is in the namespace and name annotations since
+// a templated name cannot be parsed back
+const (
+	ConfigMapLabel               = "piggysec.com/canary-gate"
+	ConfigMapNamespaceAnnotation = "piggysec.com/namespace"
+	ConfigMapNameAnnotation      = "piggysec.com/name"
+)
+
 type ConfigMapStore struct {
 	data      *sync.Map
 	k8sClient kubernetes.Interface
 	configNS  string
+	expiry    *expiryTimers
+	// nameTemplate builds the name of the ConfigMap of a gate
+	nameTemplate *template.Template
 }
 
 // NewConfigMapStore creates a new ConfigMapStore instance.
 // ConfigMapstore uses Kubernetes ConfigMaps to store gate states.
 // ConfirMaps are created in the namespace specified by the environment variable CANARY_GATE_NAMESPACE.
-// The ConfigMap name is constructed as "<namespace>-<name>-cgate".
+// The ConfigMap name is constructed as "<namespace>-<name>-cgate", or with the Go template in the environment
+// variable CANARY_GATE_CONFIGMAP_TEMPLATE, which receives the .Namespace, .Name and .Type of the gate.
 func NewConfigMapStore(k8sClient kubernetes.Interface) (Store, error) {
 	var k8s kubernetes.Interface
 	var err error
@@ -54,14 +76,50 @@ func NewConfigMapStore(k8sClient kubernetes.Interface) (Store, error) {
 	} else {
 		k8s = k8sClient
 	}
+	nameTemplate, err := parseConfigMapTemplate(os.Getenv("CANARY_GATE_CONFIGMAP_TEMPLATE"))
+	if err != nil {
+		log.Error().Msgf("Invalid CANARY_GATE_CONFIGMAP_TEMPLATE %v. ConfigMaps are named [%s].", err, defaultConfigMapTemplate)
+		nameTemplate = template.Must(template.New("configmap").Parse(defaultConfigMapTemplate))
+	}
 	store := &ConfigMapStore{
-		data:      new(sync.Map),
-		k8sClient: k8s,
-		configNS:  os.Getenv("CANARY_GATE_NAMESPACE"),
+		data:         new(sync.Map),
+		k8sClient:    k8s,
+		configNS:     os.Getenv("CANARY_GATE_NAMESPACE"),
+		expiry:       &expiryTimers{},
+		nameTemplate: nameTemplate,
 	}
 	return store, nil
 }
 
+// parseConfigMapTemplate parses the template of the ConfigMap names. The template is executed with a sample gate,
+// so a template which fails or does not build a valid ConfigMap name is rejected on start.
+func parseConfigMapTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultConfigMapTemplate
+	}
+	tmpl, err := template.New("configmap").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	name, err := executeConfigMapTemplate(tmpl, StoreKey{Namespace: "namespace", Name: "name", Type: service.HookConfirmRollout})
+	if err != nil {
+		return nil, err
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configmap name [%s]: %s", name, strings.Join(errs, ", "))
+	}
+	return tmpl, nil
+}
+
+// executeConfigMapTemplate builds the ConfigMap name of a gate
+func executeConfigMapTemplate(tmpl *template.Template, key StoreKey) (string, error) {
+	var name strings.Builder
+	if err := tmpl.Execute(&name, key); err != nil {
+		return "", err
+	}
+	return name.String(), nil
+}
+
 func newK8sClient() (kubernetes.Interface, error) {
 	kubeConfig, err := kubernetesConfig.GetConfig()
 	if err != nil {
@@ -76,6 +134,13 @@ func newK8sClient() (kubernetes.Interface, error) {
 
 // getConfigMapName get store key name
 func (s *ConfigMapStore) getConfigMapName(key StoreKey) string {
+	if s.nameTemplate != nil {
+		name, err := executeConfigMapTemplate(s.nameTemplate, key)
+		if err == nil {
+			return name
+		}
+		log.Error().Msgf("Unable to build the configmap name of gate [%s] %v.", key, err)
+	}
 	return fmt.Sprintf("%s-%s-%s", key.Namespace, key.Name, ConfigMapSuffix)
 }
 
@@ -95,7 +160,8 @@ func (s *ConfigMapStore) createConfigMap(key StoreKey) *corev1.ConfigMap {
 		Data:       map[string]string{},
 	}
 	ns := s.getConfigMapNamespace(key)
-	configMap.Data[string(key.Type)] = GateStatus(defaultValue(key))
+	markConfigMap(configMap, key)
+	s.seedGates(configMap, key)
 	_, err := s.k8sClient.CoreV1().ConfigMaps(ns).Create(context.TODO(), configMap, metav1.CreateOptions{})
 	if err != nil {
 		log.Error().Msgf("Error while creating configmap [%s/%s] %v. Gate [%s] is set to [%s]", ns, confName, err, key.String(), defaultText(key))
@@ -103,18 +169,135 @@ func (s *ConfigMapStore) createConfigMap(key StoreKey) *corev1.ConfigMap {
 	return configMap
 }
 
-func (s *ConfigMapStore) updateGate(key StoreKey, val bool) {
+// seededKey is the configmap key of the gates which were seeded with their default state and not set since.
+// A seeded gate follows the current default, so a later change of the default closed gates applies to it.
+const seededKey = "seeded"
+
+// seedGates adds the default state of the gates which are missing in the configmap, so the configmap shows every gate
+// of the deployment. A name template with .Type keeps the gates in different configmaps, which are only seeded with
+// their own gates. The seeded gates which show another state than their current default are refreshed.
+// It returns whether a gate was added or refreshed.
+func (s *ConfigMapStore) seedGates(conf *corev1.ConfigMap, key StoreKey) bool {
+	changed := false
+	seeded := seededGates(conf.Data)
+	for _, t := range GateTypes {
+		gate := StoreKey{Namespace: key.Namespace, Name: key.Name, Type: t}
+		if s.getConfigMapName(gate) != conf.Name {
+			continue
+		}
+		val, ok := conf.Data[string(t)]
+		if ok && !slices.Contains(seeded, string(t)) {
+			continue
+		}
+		if val != defaultText(gate) {
+			conf.Data[string(t)] = defaultText(gate)
+			changed = true
+		}
+		if !ok {
+			seeded = append(seeded, string(t))
+		}
+	}
+	if changed {
+		conf.Data[seededKey] = strings.Join(seeded, ",")
+	}
+	return changed
+}
+
+// markConfigMap adds the label and the deployment annotations to the configmap, and returns whether it added them
+func markConfigMap(conf *corev1.ConfigMap, key StoreKey) bool {
+	if conf.Labels[ConfigMapLabel] == "true" && conf.Annotations[ConfigMapNamespaceAnnotation] == key.Namespace && conf.Annotations[ConfigMapNameAnnotation] == key.Name {
+		return false
+	}
+	if conf.Labels == nil {
+		conf.Labels = map[string]string{}
+	}
+	if conf.Annotations == nil {
+		conf.Annotations = map[string]string{}
+	}
+	conf.Labels[ConfigMapLabel] = "true"
+	conf.Annotations[ConfigMapNamespaceAnnotation] = key.Namespace
+	conf.Annotations[ConfigMapNameAnnotation] = key.Name
+	return true
+}
+
+// seededGates returns the gates which are seeded in the configmap data
+func seededGates(data map[string]string) []string {
+	if data[seededKey] == "" {
+		return nil
+	}
+	return strings.Split(data[seededKey], ",")
+}
+
+// setGate sets the gate explicitly, so it does not follow the default anymore
+func setGate(data map[string]string, key StoreKey, val bool) {
+	data[string(key.Type)] = GateStatus(val)
+	seeded := slices.DeleteFunc(seededGates(data), func(t string) bool { return t == string(key.Type) })
+	if len(seeded) == 0 {
+		delete(data, seededKey)
+	} else {
+		data[seededKey] = strings.Join(seeded, ",")
+	}
+}
+
+// resetGate marks the gate as seeded with its default state, so it follows the default like a gate which was never set
+func resetGate(data map[string]string, key StoreKey) {
+	data[string(key.Type)] = defaultText(key)
+	if seeded := seededGates(data); !slices.Contains(seeded, string(key.Type)) {
+		data[seededKey] = strings.Join(append(seeded, string(key.Type)), ",")
+	}
+	delete(data, changedByKey(key))
+	delete(data, closedAtKey(key))
+}
+
+// storedGate returns the state of the gate which was set explicitly in the configmap data
+func storedGate(data map[string]string, key StoreKey) (bool, bool) {
+	val, ok := data[string(key.Type)]
+	if !ok || slices.Contains(seededGates(data), string(key.Type)) {
+		return false, false
+	}
+	return GateBoolStatus(val), true
+}
+
+// reconcileGates seeds the gates which are missing in a loaded configmap and marks it, e.g. a configmap created by an
+// older version. The loaded configmap is returned when it cannot be updated, the missing gates have their default
+// state anyway.
+func (s *ConfigMapStore) reconcileGates(ctx context.Context, conf *corev1.ConfigMap, key StoreKey) *corev1.ConfigMap {
+	seeded := conf.DeepCopy()
+	if seeded.Data == nil {
+		seeded.Data = map[string]string{}
+	}
+	marked := markConfigMap(seeded, key)
+	if !s.seedGates(seeded, key) && !marked {
+		return conf
+	}
+	updated, err := s.k8sClient.CoreV1().ConfigMaps(conf.Namespace).Update(ctx, seeded, metav1.UpdateOptions{})
+	if err != nil {
+		log.Warn().Msgf("Unable to add the missing gates to configmap [%s/%s] %v.", conf.Namespace, conf.Name, err)
+		return conf
+	}
+	return updated
+}
+
+func (s *ConfigMapStore) updateGate(ctx context.Context, key StoreKey, val bool, user string, reason string) {
 	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		ctx := context.Background()
 		conf, err := s.CreateConfigMapAndGet(ctx, key)
 		if err != nil {
 			return err
 		}
-		conf.Data[string(key.Type)] = GateStatus(val)
+		setGate(conf.Data, key, val)
+		setClosedAt(conf.Data, key, val)
+		if user != "" {
+			conf.Data[changedByKey(key)] = user
+		} else {
+			delete(conf.Data, changedByKey(key))
+		}
 		log.Trace().Msgf("Saving to configmap [%s/%s]. Gate [%s] is set to [%s]", conf.Namespace, conf.Name, key, conf.Data[string(key.Type)])
 		_, err = s.k8sClient.CoreV1().ConfigMaps(conf.Namespace).Update(ctx, conf, metav1.UpdateOptions{})
 		log.Trace().Msgf("Recording event [%s/%s]. Gate [%s] is set to [%s]", conf.Namespace, conf.Name, key, GateStatus(val))
-		s.UpdateEvent(ctx, key, "Updated", fmt.Sprintf("Gate [%s] is set to [%s]", key.String(), GateStatus(val)))
+		s.UpdateEvent(ctx, key, "Updated", changeMessage(key, GateStatus(val), user, reason))
+		if err == nil {
+			s.AppendHistory(ctx, key, newHistoryEntry(key, GateStatus(val), user, reason))
+		}
 		return err
 	})
 	if retryErr != nil {
@@ -124,28 +307,210 @@ func (s *ConfigMapStore) updateGate(key StoreKey, val bool) {
 	}
 }
 
-func (s *ConfigMapStore) GateOpen(key StoreKey) {
-	s.updateGate(key, true)
+func (s *ConfigMapStore) GateOpen(ctx context.Context, key StoreKey, user string) {
+	s.expiry.cancel(key)
+	s.updateGate(ctx, key, true, user, "")
+}
+
+func (s *ConfigMapStore) RollbackGate(ctx context.Context, key StoreKey, user string, reason string) {
+	s.expiry.cancel(key)
+	s.updateGate(ctx, key, true, user, reason)
+}
+
+func (s *ConfigMapStore) OpenGateWithTTL(ctx context.Context, key StoreKey, ttl time.Duration, user string) {
+	s.GateOpen(ctx, key, user)
+	s.expiry.schedule(key, ttl, func() {
+		s.updateGate(context.Background(), key, defaultValue(key), "", "")
+		s.UpdateEvent(context.Background(), key, "Expired", expiredMessage(key, ttl))
+		notifyExpired(key, ttl)
+	})
+}
+
+func (s *ConfigMapStore) GateClose(ctx context.Context, key StoreKey, user string) {
+	s.expiry.cancel(key)
+	s.updateGate(ctx, key, false, user, "")
+}
+
+// GateReset removes the explicit state of the gate. The configmap keeps a key for every gate, so the gate is marked
+// as seeded and follows its default state.
+func (s *ConfigMapStore) GateReset(ctx context.Context, key StoreKey, user string) {
+	s.expiry.cancel(key)
+	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		conf, err := s.CreateConfigMapAndGet(ctx, key)
+		if err != nil {
+			return err
+		}
+		resetGate(conf.Data, key)
+		_, err = s.k8sClient.CoreV1().ConfigMaps(conf.Namespace).Update(ctx, conf, metav1.UpdateOptions{})
+		return err
+	})
+	if retryErr != nil {
+		log.Error().Msgf("Unable to update configmap [%s/%s] %v.", s.getConfigMapNamespace(key), s.getConfigMapName(key), retryErr)
+		return
+	}
+	status := defaultText(key)
+	s.UpdateEvent(ctx, key, "Reset", resetMessage(key, status, user))
+	s.AppendHistory(ctx, key, newHistoryEntry(key, status, user, ""))
+}
+
+// CompareAndSet updates the configmap only when the gate has the expected value. A concurrent update changes the
+// resourceVersion of the configmap, so the update fails with a conflict and the gate is compared again.
+func (s *ConfigMapStore) CompareAndSet(ctx context.Context, key StoreKey, expected, desired bool) (bool, error) {
+	swapped := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		swapped = false
+		conf, err := s.CreateConfigMapAndGet(ctx, key)
+		if err != nil {
+			return err
+		}
+		current, ok := storedGate(conf.Data, key)
+		if !ok {
+			current = defaultValue(key)
+		}
+		if current != expected {
+			return nil
+		}
+		setGate(conf.Data, key, desired)
+		setClosedAt(conf.Data, key, desired)
+		delete(conf.Data, changedByKey(key))
+		if _, err = s.k8sClient.CoreV1().ConfigMaps(conf.Namespace).Update(ctx, conf, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		swapped = true
+		return nil
+	})
+	if err != nil || !swapped {
+		return false, err
+	}
+	s.expiry.cancel(key)
+	s.UpdateEvent(ctx, key, "Updated", gateMessage(key, GateStatus(desired), ""))
+	s.AppendHistory(ctx, key, newHistoryEntry(key, GateStatus(desired), "", ""))
+	return true, nil
+}
+
+func (s *ConfigMapStore) GetChangedBy(ctx context.Context, key StoreKey) string {
+	conf, err := s.GetConfigMap(ctx, key)
+	if err != nil {
+		return ""
+	}
+	return conf.Data[changedByKey(key)]
+}
+
+// changedByKey returns the configmap key of the user who changed the gate
+func changedByKey(key StoreKey) string {
+	return string(key.Type) + "-by"
+}
+
+// closedAtKey returns the configmap key of the time when the gate was closed
+func closedAtKey(key StoreKey) string {
+	return string(key.Type) + "-closed-at"
+}
+
+// setClosedAt records the time (RFC3339) when the gate is closed and removes it when the gate is opened
+func setClosedAt(data map[string]string, key StoreKey, val bool) {
+	if val {
+		delete(data, closedAtKey(key))
+	} else {
+		data[closedAtKey(key)] = time.Now().UTC().Format(time.RFC3339)
+	}
+}
+
+// Exists always reports true since the ConfigMap is created on the first change of a gate
+func (s *ConfigMapStore) Exists(ctx context.Context, key StoreKey) (bool, error) {
+	return true, nil
+}
+
+func (s *ConfigMapStore) GetClosedAt(ctx context.Context, key StoreKey) time.Time {
+	conf, err := s.GetConfigMap(ctx, key)
+	if err != nil {
+		return time.Time{}
+	}
+	closedAt, _ := time.Parse(time.RFC3339, conf.Data[closedAtKey(key)])
+	return closedAt
+}
+
+func (s *ConfigMapStore) IsGateOpen(ctx context.Context, key StoreKey) bool {
+	open, _ := s.GateState(ctx, key)
+	return open
+}
+
+// GateState reads the gate from the configmap, which is created when it is missing. A configmap which cannot be
+// created and is still not found has the default gates.
+func (s *ConfigMapStore) GateState(ctx context.Context, key StoreKey) (bool, error) {
+	conf, err := s.CreateConfigMapAndGet(ctx, key)
+	if k8serrors.IsNotFound(err) {
+		return defaultValue(key), nil
+	}
+	if err != nil {
+		return defaultValue(key), &UnavailableError{Key: key, Err: err}
+	}
+	log.Trace().Msgf("Loading from configmap [%s/%s]. Gate [%s] is set to [%s]", conf.Namespace, conf.Name, key, conf.Data[string(key.Type)])
+	if val, ok := storedGate(conf.Data, key); ok {
+		return val, nil
+	}
+	return defaultValue(key), nil
 }
 
-func (s *ConfigMapStore) GateClose(key StoreKey) {
-	s.updateGate(key, false)
+func (s *ConfigMapStore) List(ctx context.Context, namespace string, name string) (map[service.HookType]bool, error) {
+	gates := defaultGates(namespace, name)
+	// a name template with .Type keeps the gates in different configmaps, each configmap is read once
+	configMaps := map[string]*corev1.ConfigMap{}
+	for t := range gates {
+		key := StoreKey{Namespace: namespace, Name: name, Type: t}
+		confName := s.getConfigMapName(key)
+		conf, ok := configMaps[confName]
+		if !ok {
+			var err error
+			conf, err = s.GetConfigMap(ctx, key)
+			if k8serrors.IsNotFound(err) {
+				conf = nil
+			} else if err != nil {
+				return nil, err
+			}
+			configMaps[confName] = conf
+		}
+		if conf == nil {
+			continue
+		}
+		if val, ok := storedGate(conf.Data, key); ok {
+			gates[t] = val
+		}
+	}
+	return gates, nil
 }
 
-func (s *ConfigMapStore) IsGateOpen(key StoreKey) bool {
-	conf, err := s.CreateConfigMapAndGet(context.Background(), key)
+// Deployments returns the deployments of the labeled configmaps. The configmaps are labeled when they are created or
+// changed, so the configmaps of an older version which are not changed since are not listed.
+func (s *ConfigMapStore) Deployments(ctx context.Context) ([]StoreKey, error) {
+	list, err := s.k8sClient.CoreV1().ConfigMaps(s.configNS).List(ctx, metav1.ListOptions{LabelSelector: ConfigMapLabel + "=true"})
 	if err != nil {
-		return defaultValue(key)
+		return nil, err
+	}
+	seen := map[StoreKey]bool{}
+	for _, conf := range list.Items {
+		if key, err := NewStoreKey(conf.Annotations[ConfigMapNamespaceAnnotation], conf.Annotations[ConfigMapNameAnnotation], ""); err == nil {
+			seen[key] = true
+		}
 	}
-	val, ok := conf.Data[string(key.Type)]
-	log.Trace().Msgf("Loading from configmap [%s/%s]. Gate [%s] is set to [%s]", conf.Namespace, conf.Name, key, val)
-	if ok {
-		return val == GATE_OPEN
+	return sortedKeys(seen), nil
+}
+
+// Health lists at most one configmap to check that the API server is reachable
+func (s *ConfigMapStore) Health(ctx context.Context) error {
+	if s.k8sClient == nil {
+		return fmt.Errorf("kubernetes client is not configured")
 	}
-	return defaultValue(key)
+	_, err := s.k8sClient.CoreV1().ConfigMaps(s.configNS).List(ctx, metav1.ListOptions{Limit: 1})
+	return err
+}
+
+// WaitForSync returns at once since the configmaps are read from the API server
+func (s *ConfigMapStore) WaitForSync(ctx context.Context) error {
+	return nil
 }
 
 func (s *ConfigMapStore) Shutdown() error {
+	s.expiry.stop()
 	return nil
 }
 
@@ -168,8 +533,9 @@ func (s *ConfigMapStore) CreateConfigMapAndGet(ctx context.Context, key StoreKey
 			log.Error().Msgf("Error to load configmap [%s/%s] %v.", ns, confName, statusError.ErrStatus.Message)
 			return nil, err
 		}
+		return conf, err
 	}
-	return conf, err
+	return s.reconcileGates(ctx, conf, key), nil
 }
 
 func (s *ConfigMapStore) UpdateEvent(ctx context.Context, key StoreKey, status string, message string) {
@@ -197,3 +563,204 @@ func (s *ConfigMapStore) GetLastEvent(ctx context.Context, key StoreKey) string
 	}
 	return conf.Data[string(service.HookEvent)]
 }
+
+func (s *ConfigMapStore) GetPhase(ctx context.Context, key StoreKey) string {
+	conf, err := s.GetConfigMap(ctx, key)
+	if err != nil {
+		return ""
+	}
+	return conf.Data[phaseKey]
+}
+
+// UpdatePhase saves the phase only when it changes. The phase is returned as unchanged when the configmap cannot be updated.
+func (s *ConfigMapStore) UpdatePhase(ctx context.Context, key StoreKey, phase string) string {
+	var last string
+	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		conf, err := s.CreateConfigMapAndGet(ctx, key)
+		if err != nil {
+			return err
+		}
+		last = conf.Data[phaseKey]
+		if last == phase {
+			return nil
+		}
+		conf.Data[phaseKey] = phase
+		_, err = s.k8sClient.CoreV1().ConfigMaps(conf.Namespace).Update(ctx, conf, metav1.UpdateOptions{})
+		return err
+	})
+	if retryErr != nil {
+		confName := s.getConfigMapName(key)
+		ns := s.getConfigMapNamespace(key)
+		log.Error().Msgf("Unable to update configmap [%s/%s] %v.", ns, confName, retryErr)
+		return phase
+	}
+	return last
+}
+
+// SetRolledBackAt records the time (RFC3339) of the rollback in the configmap
+func (s *ConfigMapStore) SetRolledBackAt(ctx context.Context, key StoreKey, at time.Time) {
+	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		conf, err := s.CreateConfigMapAndGet(ctx, key)
+		if err != nil {
+			return err
+		}
+		conf.Data[rolledBackAtKey] = at.UTC().Format(time.RFC3339)
+		_, err = s.k8sClient.CoreV1().ConfigMaps(conf.Namespace).Update(ctx, conf, metav1.UpdateOptions{})
+		return err
+	})
+	if retryErr != nil {
+		confName := s.getConfigMapName(key)
+		ns := s.getConfigMapNamespace(key)
+		log.Error().Msgf("Unable to update configmap [%s/%s] %v.", ns, confName, retryErr)
+	}
+}
+
+func (s *ConfigMapStore) GetRolledBackAt(ctx context.Context, key StoreKey) time.Time {
+	conf, err := s.GetConfigMap(ctx, key)
+	if err != nil {
+		return time.Time{}
+	}
+	rolledBackAt, _ := time.Parse(time.RFC3339, conf.Data[rolledBackAtKey])
+	return rolledBackAt
+}
+
+// SetDecision records the decision of the webhook as JSON in the configmap
+func (s *ConfigMapStore) SetDecision(ctx context.Context, key StoreKey, decision Decision) {
+	decision.Time = decision.Time.UTC()
+	val, err := json.Marshal(decision)
+	if err != nil {
+		log.Error().Msgf("Unable to encode decision %v.", err)
+		return
+	}
+	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		conf, err := s.CreateConfigMapAndGet(ctx, key)
+		if err != nil {
+			return err
+		}
+		conf.Data[decisionKey(key)] = string(val)
+		_, err = s.k8sClient.CoreV1().ConfigMaps(conf.Namespace).Update(ctx, conf, metav1.UpdateOptions{})
+		return err
+	})
+	if retryErr != nil {
+		confName := s.getConfigMapName(key)
+		ns := s.getConfigMapNamespace(key)
+		log.Error().Msgf("Unable to update configmap [%s/%s] %v.", ns, confName, retryErr)
+	}
+}
+
+func (s *ConfigMapStore) GetDecision(ctx context.Context, key StoreKey) Decision {
+	conf, err := s.GetConfigMap(ctx, key)
+	if err != nil {
+		return Decision{}
+	}
+	var decision Decision
+	if val := conf.Data[decisionKey(key)]; val != "" {
+		if err := json.Unmarshal([]byte(val), &decision); err != nil {
+			log.Error().Msgf("Unable to decode decision %v.", err)
+			return Decision{}
+		}
+	}
+	return decision
+}
+
+// decisionKey returns the configmap key of the last answer of the webhook of the gate
+func decisionKey(key StoreKey) string {
+	return string(key.Type) + "-decision"
+}
+
+func (s *ConfigMapStore) SaveMessages(ctx context.Context, key StoreKey, messages map[string]string) {
+	val, err := json.Marshal(messages)
+	if err != nil {
+		log.Error().Msgf("Unable to encode messages %v.", err)
+		return
+	}
+	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		conf, err := s.CreateConfigMapAndGet(ctx, key)
+		if err != nil {
+			return err
+		}
+		conf.Data[messagesKey] = string(val)
+		_, err = s.k8sClient.CoreV1().ConfigMaps(conf.Namespace).Update(ctx, conf, metav1.UpdateOptions{})
+		return err
+	})
+	if retryErr != nil {
+		confName := s.getConfigMapName(key)
+		ns := s.getConfigMapNamespace(key)
+		log.Error().Msgf("Unable to update configmap [%s/%s] %v.", ns, confName, retryErr)
+	}
+}
+
+func (s *ConfigMapStore) GetMessages(ctx context.Context, key StoreKey) map[string]string {
+	messages := map[string]string{}
+	conf, err := s.GetConfigMap(ctx, key)
+	if err != nil {
+		return messages
+	}
+	if val, ok := conf.Data[messagesKey]; ok {
+		if err := json.Unmarshal([]byte(val), &messages); err != nil {
+			log.Error().Msgf("Unable to decode messages of configmap [%s/%s] %v.", conf.Namespace, conf.Name, err)
+		}
+	}
+	return messages
+}
+
+func (s *ConfigMapStore) AppendHistory(ctx context.Context, key StoreKey, entry HistoryEntry) {
+	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		conf, err := s.CreateConfigMapAndGet(ctx, key)
+		if err != nil {
+			return err
+		}
+		val, err := json.Marshal(appendHistory(decodeHistory(conf.Data[historyKey]), entry))
+		if err != nil {
+			return err
+		}
+		conf.Data[historyKey] = string(val)
+		_, err = s.k8sClient.CoreV1().ConfigMaps(conf.Namespace).Update(ctx, conf, metav1.UpdateOptions{})
+		return err
+	})
+	if retryErr != nil {
+		confName := s.getConfigMapName(key)
+		ns := s.getConfigMapNamespace(key)
+		log.Error().Msgf("Unable to update configmap [%s/%s] %v.", ns, confName, retryErr)
+	}
+}
+
+func (s *ConfigMapStore) GetHistory(ctx context.Context, key StoreKey) []HistoryEntry {
+	conf, err := s.GetConfigMap(ctx, key)
+	if err != nil {
+		return []HistoryEntry{}
+	}
+	return decodeHistory(conf.Data[historyKey])
+}
+
+// Approve does not record the user, multiple approvers are only supported by the CanaryGate store.
+func (s *ConfigMapStore) Approve(ctx context.Context, key StoreKey, user string) (Approval, error) {
+	return singleApproval(user), nil
+}
+
+func (s *ConfigMapStore) GetApproval(ctx context.Context, key StoreKey) Approval {
+	return Approval{Required: 1}
+}
+
+// ConsumeGate does not close the gate, since only the CanaryGate store has gates which require an approval for each use.
+func (s *ConfigMapStore) ConsumeGate(ctx context.Context, key StoreKey) (bool, error) {
+	return false, nil
+}
+
+// GetDependencies returns the default dependencies, which can only be overridden by the CanaryGate store.
+func (s *ConfigMapStore) GetDependencies(ctx context.Context, key StoreKey) []service.HookType {
+	return gateDependencies(&piggysecv1alpha1.CanaryGateSpec{}, key)
+}
+
+// decodeHistory decodes the gate change history stored in the configmap
+func decodeHistory(val string) []HistoryEntry {
+	history := []HistoryEntry{}
+	if val == "" {
+		return history
+	}
+	if err := json.Unmarshal([]byte(val), &history); err != nil {
+		log.Error().Msgf("Unable to decode history %v.", err)
+		return []HistoryEntry{}
+	}
+	return history
+}
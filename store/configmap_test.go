@@ -17,14 +17,22 @@ package store
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/KongZ/canary-gate/service"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
-	// k8stesting "k8s.io/client-go/testing"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func StrToBool(str string) bool {
@@ -41,28 +49,83 @@ type TestCase struct {
 	expectedAfterOpen  bool
 }
 
-var typeCases = []TestCase{
-	{
-		service.HookConfirmRollout, true, false, true,
-	},
-	{
-		service.HookRollout, true, false, true,
-	},
-	{
-		service.HookConfirmPromotion, true, false, true,
-	},
-	{
-		service.HookConfirmTrafficIncrease, true, false, true,
-	},
-	{
-		service.HookPostRollout, true, false, true,
-	},
-	{
-		service.HookPreRollout, true, false, true,
-	},
-	{
-		service.HookRollback, false, false, true,
-	},
+var typeCases = gateCases()
+
+// gateCases returns the test cases of all gates when the given gates are closed by default in addition to the rollback gate
+func gateCases(defaultClosed ...service.HookType) []TestCase {
+	cases := make([]TestCase, 0, len(GateTypes))
+	for _, t := range GateTypes {
+		closed := t == service.HookRollback || slices.Contains(defaultClosed, t)
+		cases = append(cases, TestCase{serviceType: t, expectedInit: !closed, expectedAfterClose: false, expectedAfterOpen: true})
+	}
+	return cases
+}
+
+// testDefaultClosed verifies that the store honors the gates which are closed by default
+func testDefaultClosed(t *testing.T, newStore func() Store) {
+	defaultClosed := []service.HookType{service.HookConfirmPromotion, service.HookConfirmRollout}
+	SetDefaultClosed(defaultClosed)
+	t.Cleanup(func() { SetDefaultClosed(nil) })
+	store := newStore()
+	gates, err := store.List(context.TODO(), "canary-ns", "test-canary")
+	require.NoError(t, err)
+	for _, v := range gateCases(defaultClosed...) {
+		sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: v.serviceType}
+		require.Equalf(t, v.expectedInit, gates[v.serviceType], "[%s] listed default gate", v.serviceType)
+		require.Equalf(t, v.expectedInit, store.IsGateOpen(context.TODO(), sk), "[%s] default gate", v.serviceType)
+	}
+	store.GateOpen(t.Context(), StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}, "")
+	require.True(t, store.IsGateOpen(context.TODO(), StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}))
+	require.NoError(t, store.Shutdown())
+}
+
+func TestConfigMapDefaultClosed(t *testing.T) {
+	testDefaultClosed(t, func() Store {
+		store, err := NewConfigMapStore(fake.NewSimpleClientset())
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestParseGateTypes(t *testing.T) {
+	gates, err := ParseGateTypes([]string{"confirm-promotion", " confirm-rollout ", ""})
+	require.NoError(t, err)
+	require.Equal(t, []service.HookType{service.HookConfirmPromotion, service.HookConfirmRollout}, gates)
+	_, err = ParseGateTypes([]string{"promote"})
+	require.Error(t, err)
+}
+
+func TestNewStoreKey(t *testing.T) {
+	key, err := NewStoreKey(" canary-ns ", "test-canary\t", " Confirm-Promotion")
+	require.NoError(t, err)
+	require.Equal(t, StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}, key)
+	key, err = NewStoreKey("canary-ns", "test-canary", "")
+	require.NoError(t, err)
+	require.Empty(t, key.Type)
+
+	cases := []struct {
+		namespace string
+		name      string
+		gate      service.HookType
+		field     string
+	}{
+		{"", "test-canary", service.HookConfirmPromotion, "namespace"},
+		{"  ", "test-canary", service.HookConfirmPromotion, "namespace"},
+		{"canary-ns", "", service.HookConfirmPromotion, "name"},
+		{"canary:ns", "test-canary", service.HookConfirmPromotion, "namespace"},
+		{"Canary-NS", "test-canary", service.HookConfirmPromotion, "namespace"},
+		{"canary-ns", "test:canary", service.HookConfirmPromotion, "name"},
+		{"canary-ns", "test/canary", service.HookConfirmPromotion, "name"},
+		{"canary-ns", "test-canary", "promote", "type"},
+		{"canary-ns", "test-canary", service.HookAll, "type"},
+	}
+	for _, c := range cases {
+		_, err := NewStoreKey(c.namespace, c.name, c.gate)
+		var keyErr *KeyError
+		require.ErrorAsf(t, err, &keyErr, "[%s/%s=%s]", c.namespace, c.name, c.gate)
+		require.Equalf(t, c.field, keyErr.Field, "[%s/%s=%s]", c.namespace, c.name, c.gate)
+	}
+	require.Error(t, StoreKey{Name: "test-canary", Type: service.HookConfirmPromotion}.Validate())
 }
 
 func TestConfigMapGate(t *testing.T) {
@@ -89,22 +152,22 @@ func TestConfigMapGate(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
-		result := store.IsGateOpen(sk)
+		result := store.IsGateOpen(context.TODO(), sk)
 		time.Sleep(10 * time.Millisecond) // wait for gate to create
 		if v.expectedInit != result {
 			t.Fatalf("[%s] [default] gate expected %v found %v", serviceType, v.expectedInit, result)
 		}
 		// close gate
-		store.GateClose(sk)
+		store.GateClose(t.Context(), sk, "")
 		time.Sleep(10 * time.Millisecond) // wait for gate to close
-		result = store.IsGateOpen(sk)
+		result = store.IsGateOpen(context.TODO(), sk)
 		if v.expectedAfterClose != result {
 			t.Fatalf("[%s] is [closed] gate expected %v found %v", serviceType, v.expectedAfterClose, result)
 		}
 		// open gate
-		store.GateOpen(sk)
+		store.GateOpen(t.Context(), sk, "")
 		time.Sleep(10 * time.Millisecond) // wait for gate to open
-		result = store.IsGateOpen(sk)
+		result = store.IsGateOpen(context.TODO(), sk)
 		if v.expectedAfterOpen != result {
 			t.Fatalf("[%s] is [opened] gate expected %v found %v", serviceType, v.expectedAfterOpen, result)
 		}
@@ -131,3 +194,441 @@ func TestConfigMapEvent(t *testing.T) {
 	result = store.GetLastEvent(context.TODO(), sk)
 	require.EqualValuesf(t, eventMessage, result, "Event message should be '%s', found '%s'", eventMessage, result)
 }
+
+func TestConfigMapMessages(t *testing.T) {
+	sk := StoreKey{
+		Namespace: "canary-ns",
+		Name:      "test-canary",
+	}
+	f := fake.NewSimpleClientset()
+	store, err := NewConfigMapStore(f)
+	require.NoError(t, err)
+	require.Empty(t, store.GetMessages(context.TODO(), sk))
+	messages := map[string]string{"C123": "1700000000.000100"}
+	store.SaveMessages(context.TODO(), sk, messages)
+	require.Equal(t, messages, store.GetMessages(context.TODO(), sk))
+}
+
+// testList verifies that List returns the defaults first and then the stored states of all gates
+func testList(t *testing.T, store Store) {
+	gates, err := store.List(context.TODO(), "canary-ns", "test-canary")
+	require.NoError(t, err)
+	require.Len(t, gates, len(GateTypes))
+	for _, v := range typeCases {
+		require.Equalf(t, v.expectedInit, gates[v.serviceType], "[%s] default gate", v.serviceType)
+	}
+	store.GateClose(t.Context(), StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}, "")
+	store.GateOpen(t.Context(), StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback}, "")
+	gates, err = store.List(context.TODO(), "canary-ns", "test-canary")
+	require.NoError(t, err)
+	require.False(t, gates[service.HookConfirmPromotion])
+	require.True(t, gates[service.HookRollback])
+	require.True(t, gates[service.HookConfirmRollout])
+}
+
+func TestConfigMapList(t *testing.T) {
+	store, err := NewConfigMapStore(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	testList(t, store)
+}
+
+// testChangedBy verifies that the store records the user who changed a gate
+func testChangedBy(t *testing.T, store Store) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	require.Empty(t, store.GetChangedBy(context.TODO(), sk))
+	store.GateClose(t.Context(), sk, "alice")
+	require.Equal(t, "alice", store.GetChangedBy(context.TODO(), sk))
+	require.Equal(t, "Gate [canary-ns/test-canary=confirm-promotion] is set to [closed] by [alice]", store.GetLastEvent(context.TODO(), sk))
+	store.GateOpen(t.Context(), sk, "bob")
+	require.Equal(t, "bob", store.GetChangedBy(context.TODO(), sk))
+	// a change without user clears the previous user
+	store.GateOpen(t.Context(), sk, "")
+	require.Empty(t, store.GetChangedBy(context.TODO(), sk))
+}
+
+// testClosedAt verifies that the store records the time when a gate was closed until it is opened
+func testClosedAt(t *testing.T, store Store) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	require.True(t, store.GetClosedAt(context.TODO(), sk).IsZero())
+	// the time is stored in seconds by some stores
+	before := time.Now().Truncate(time.Second)
+	store.GateClose(t.Context(), sk, "alice")
+	closedAt := store.GetClosedAt(context.TODO(), sk)
+	require.False(t, closedAt.Before(before))
+	require.False(t, closedAt.After(time.Now()))
+	store.GateOpen(t.Context(), sk, "bob")
+	require.True(t, store.GetClosedAt(context.TODO(), sk).IsZero())
+	swapped, err := store.CompareAndSet(t.Context(), sk, true, false)
+	require.NoError(t, err)
+	require.True(t, swapped)
+	require.False(t, store.GetClosedAt(context.TODO(), sk).IsZero())
+}
+
+// testReset verifies that a reset gate follows its default state again
+func testReset(t *testing.T, store Store) {
+	opened := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	closed := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback}
+	store.GateClose(t.Context(), opened, "alice")
+	store.GateOpen(t.Context(), closed, "alice")
+	store.GateReset(t.Context(), opened, "bob")
+	store.GateReset(t.Context(), closed, "bob")
+	require.True(t, store.IsGateOpen(context.TODO(), opened))
+	require.False(t, store.IsGateOpen(context.TODO(), closed))
+	gates, err := store.List(context.TODO(), "canary-ns", "test-canary")
+	require.NoError(t, err)
+	require.True(t, gates[service.HookConfirmPromotion])
+	require.False(t, gates[service.HookRollback])
+	require.Empty(t, store.GetChangedBy(context.TODO(), opened))
+	require.True(t, store.GetClosedAt(context.TODO(), opened).IsZero())
+	require.Equal(t, "Gate [canary-ns/test-canary=rollback] is reset to its default [closed] by [bob]", store.GetLastEvent(context.TODO(), closed))
+	history := store.GetHistory(context.TODO(), opened)
+	require.Len(t, history, 4)
+	require.Equal(t, HistoryEntry{Time: history[2].Time, Type: service.HookConfirmPromotion, Status: GATE_OPEN, User: "bob"}, history[2])
+
+	// the reset gate follows a later change of the default
+	SetDefaultClosed([]service.HookType{service.HookConfirmPromotion})
+	t.Cleanup(func() { SetDefaultClosed(nil) })
+	require.False(t, store.IsGateOpen(context.TODO(), opened))
+}
+
+// testHistory verifies that the store keeps the last gate changes
+func testHistory(t *testing.T, store Store) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	require.Empty(t, store.GetHistory(context.TODO(), sk))
+	store.GateClose(t.Context(), sk, "alice")
+	store.GateOpen(t.Context(), sk, "bob")
+	history := store.GetHistory(context.TODO(), sk)
+	require.Len(t, history, 2)
+	require.Equal(t, HistoryEntry{Time: history[0].Time, Type: service.HookConfirmPromotion, Status: GATE_CLOSE, User: "alice"}, history[0])
+	require.Equal(t, HistoryEntry{Time: history[1].Time, Type: service.HookConfirmPromotion, Status: GATE_OPEN, User: "bob"}, history[1])
+	require.False(t, history[0].Time.IsZero())
+	// only the last changes are kept
+	for i := 0; i < historyLimit; i++ {
+		store.AppendHistory(context.TODO(), sk, newHistoryEntry(sk, GATE_OPEN, "carol", ""))
+	}
+	history = store.GetHistory(context.TODO(), sk)
+	require.Len(t, history, historyLimit)
+	require.Equal(t, "carol", history[0].User)
+}
+
+func testPhase(t *testing.T, store Store) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary"}
+	require.Empty(t, store.GetPhase(context.TODO(), sk))
+	require.Equal(t, "", store.UpdatePhase(context.TODO(), sk, string(service.PhaseProgressing)))
+	require.Equal(t, string(service.PhaseProgressing), store.GetPhase(context.TODO(), sk))
+	require.Equal(t, string(service.PhaseProgressing), store.UpdatePhase(context.TODO(), sk, string(service.PhaseProgressing)))
+	require.Equal(t, string(service.PhaseProgressing), store.UpdatePhase(context.TODO(), sk, string(service.PhaseSucceeded)))
+	require.Equal(t, string(service.PhaseSucceeded), store.UpdatePhase(context.TODO(), sk, string(service.PhaseSucceeded)))
+	require.Equal(t, string(service.PhaseSucceeded), store.GetPhase(context.TODO(), sk))
+}
+
+// testRolledBackAt verifies that the time of the last rollback is kept per deployment
+func testRolledBackAt(t *testing.T, store Store) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary"}
+	require.True(t, store.GetRolledBackAt(t.Context(), sk).IsZero())
+	first := time.Now().Add(-time.Hour).Truncate(time.Second)
+	store.SetRolledBackAt(t.Context(), sk, first)
+	require.True(t, first.Equal(store.GetRolledBackAt(t.Context(), sk)))
+	last := time.Now().Truncate(time.Second)
+	store.SetRolledBackAt(t.Context(), sk, last)
+	require.True(t, last.Equal(store.GetRolledBackAt(t.Context(), sk)))
+	require.True(t, store.GetRolledBackAt(t.Context(), StoreKey{Namespace: "canary-ns", Name: "demo"}).IsZero())
+}
+
+// testDecision verifies that the last answer of the webhook is recorded per gate
+func testDecision(t *testing.T, store Store) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	require.True(t, store.GetDecision(t.Context(), sk).IsZero())
+	rejected := time.Now().Add(-time.Minute).Truncate(time.Second)
+	store.SetDecision(t.Context(), sk, Decision{Approved: false, Time: rejected})
+	decision := store.GetDecision(t.Context(), sk)
+	require.False(t, decision.Approved)
+	require.Equal(t, DecisionRejected, decision.String())
+	require.True(t, rejected.Equal(decision.Time))
+	approved := time.Now().Truncate(time.Second)
+	store.SetDecision(t.Context(), sk, Decision{Approved: true, Time: approved})
+	decision = store.GetDecision(t.Context(), sk)
+	require.True(t, decision.Approved)
+	require.Equal(t, DecisionApproved, decision.String())
+	require.True(t, approved.Equal(decision.Time))
+	// the decision is kept per gate
+	require.True(t, store.GetDecision(t.Context(), StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback}).IsZero())
+}
+
+// testDeployments verifies that Deployments lists the deployments which have a state in the store
+func testDeployments(t *testing.T, store Store) {
+	keys, err := store.Deployments(t.Context())
+	require.NoError(t, err)
+	require.Empty(t, keys)
+	store.GateClose(t.Context(), StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}, "")
+	store.GateOpen(t.Context(), StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback}, "")
+	store.GateClose(t.Context(), StoreKey{Namespace: "another-ns", Name: "demo", Type: service.HookConfirmRollout}, "")
+	keys, err = store.Deployments(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, []StoreKey{{Namespace: "another-ns", Name: "demo"}, {Namespace: "canary-ns", Name: "test-canary"}}, keys)
+}
+
+func TestConfigMapDeployments(t *testing.T) {
+	store, err := NewConfigMapStore(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	testDeployments(t, store)
+}
+
+func TestConfigMapPhase(t *testing.T) {
+	store, err := NewConfigMapStore(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	testPhase(t, store)
+}
+
+func TestConfigMapRolledBackAt(t *testing.T) {
+	store, err := NewConfigMapStore(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	testRolledBackAt(t, store)
+}
+
+func TestConfigMapDecision(t *testing.T) {
+	store, err := NewConfigMapStore(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	testDecision(t, store)
+}
+
+func TestConfigMapHistory(t *testing.T) {
+	store, err := NewConfigMapStore(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	testHistory(t, store)
+}
+
+func TestConfigMapHealth(t *testing.T) {
+	f := fake.NewSimpleClientset()
+	store, err := NewConfigMapStore(f)
+	require.NoError(t, err)
+	require.NoError(t, store.Health(context.TODO()))
+	f.PrependReactor("list", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	require.Error(t, store.Health(context.TODO()))
+}
+
+func TestConfigMapChangedBy(t *testing.T) {
+	store, err := NewConfigMapStore(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	testChangedBy(t, store)
+}
+
+func TestConfigMapClosedAt(t *testing.T) {
+	store, err := NewConfigMapStore(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	testClosedAt(t, store)
+}
+
+func TestConfigMapReset(t *testing.T) {
+	store, err := NewConfigMapStore(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	testReset(t, store)
+}
+
+// testCompareAndSet verifies that the gate is set only when it has the expected state
+func testCompareAndSet(t *testing.T, store Store) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	// an unset gate is compared with its default state
+	swapped, err := store.CompareAndSet(t.Context(), sk, false, true)
+	require.NoError(t, err)
+	require.False(t, swapped)
+	require.True(t, store.IsGateOpen(context.TODO(), sk))
+	swapped, err = store.CompareAndSet(t.Context(), sk, true, false)
+	require.NoError(t, err)
+	require.True(t, swapped)
+	require.False(t, store.IsGateOpen(context.TODO(), sk))
+	swapped, err = store.CompareAndSet(t.Context(), sk, true, false)
+	require.NoError(t, err)
+	require.False(t, swapped)
+	history := store.GetHistory(context.TODO(), sk)
+	require.Len(t, history, 1)
+	require.Equal(t, GATE_CLOSE, history[0].Status)
+}
+
+// testContendedCompareAndSet verifies that only one of the concurrent swaps of the same state succeeds
+func testContendedCompareAndSet(t *testing.T, store Store) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	var swaps atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			swapped, err := store.CompareAndSet(t.Context(), sk, true, false)
+			if err != nil {
+				t.Error(err)
+			}
+			if swapped {
+				swaps.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), swaps.Load())
+	require.False(t, store.IsGateOpen(context.TODO(), sk))
+}
+
+func TestConfigMapCompareAndSet(t *testing.T) {
+	store, err := NewConfigMapStore(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	testCompareAndSet(t, store)
+}
+
+func TestConfigMapCompareAndSetConflict(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	f := fake.NewSimpleClientset()
+	store, err := NewConfigMapStore(f)
+	require.NoError(t, err)
+	require.True(t, store.IsGateOpen(context.TODO(), sk))
+
+	// another writer closes the gate between the read and the update, so the update is rejected with a conflict
+	gvr := corev1.SchemeGroupVersion.WithResource("configmaps")
+	conflicted := false
+	f.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicted {
+			return false, nil, nil
+		}
+		conflicted = true
+		conf := action.(k8stesting.UpdateAction).GetObject().(*corev1.ConfigMap).DeepCopy()
+		conf.Data[string(sk.Type)] = GATE_CLOSE
+		require.NoError(t, f.Tracker().Update(gvr, conf, conf.Namespace))
+		return true, nil, k8serrors.NewConflict(gvr.GroupResource(), conf.Name, errors.New("object was modified"))
+	})
+	swapped, err := store.CompareAndSet(t.Context(), sk, true, false)
+	require.NoError(t, err)
+	require.True(t, conflicted)
+	require.False(t, swapped, "the gate closed by another writer should not be swapped again")
+
+	swapped, err = store.CompareAndSet(t.Context(), sk, false, true)
+	require.NoError(t, err)
+	require.True(t, swapped)
+	require.True(t, store.IsGateOpen(context.TODO(), sk))
+}
+
+func TestConfigMapTemplate(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	t.Setenv("CANARY_GATE_NAMESPACE", "gate-ns")
+	t.Setenv("CANARY_GATE_CONFIGMAP_TEMPLATE", "prod-{{.Namespace}}-{{.Name}}")
+	f := fake.NewSimpleClientset()
+	store, err := NewConfigMapStore(f)
+	require.NoError(t, err)
+	store.GateClose(t.Context(), sk, "alice")
+	// CANARY_GATE_NAMESPACE still places the configmap
+	conf, err := f.CoreV1().ConfigMaps("gate-ns").Get(context.TODO(), "prod-canary-ns-test-canary", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, GATE_CLOSE, conf.Data[string(service.HookConfirmPromotion)])
+	require.False(t, store.IsGateOpen(context.TODO(), sk))
+
+	// the gates are kept in different configmaps when the template uses the type
+	t.Setenv("CANARY_GATE_CONFIGMAP_TEMPLATE", "{{.Namespace}}-{{.Name}}-{{.Type}}")
+	store, err = NewConfigMapStore(f)
+	require.NoError(t, err)
+	store.GateClose(t.Context(), sk, "alice")
+	_, err = f.CoreV1().ConfigMaps("gate-ns").Get(context.TODO(), "canary-ns-test-canary-confirm-promotion", metav1.GetOptions{})
+	require.NoError(t, err)
+	gates, err := store.List(context.TODO(), sk.Namespace, sk.Name)
+	require.NoError(t, err)
+	require.False(t, gates[service.HookConfirmPromotion])
+	require.True(t, gates[service.HookConfirmRollout])
+}
+
+func TestParseConfigMapTemplate(t *testing.T) {
+	tmpl, err := parseConfigMapTemplate("")
+	require.NoError(t, err)
+	name, err := executeConfigMapTemplate(tmpl, StoreKey{Namespace: "canary-ns", Name: "test-canary"})
+	require.NoError(t, err)
+	require.Equal(t, "canary-ns-test-canary-cgate", name)
+	// invalid templates and names are rejected
+	for _, text := range []string{"{{.Namespace", "{{.Cluster}}-{{.Name}}", "{{.Namespace}}_{{.Name}}", "Gate-{{.Name}}"} {
+		_, err := parseConfigMapTemplate(text)
+		require.Error(t, err, text)
+	}
+
+	// an invalid template falls back to the default name
+	t.Setenv("CANARY_GATE_CONFIGMAP_TEMPLATE", "{{.Cluster}}")
+	store, err := NewConfigMapStore(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	require.Equal(t, "canary-ns-test-canary-cgate", store.(*ConfigMapStore).getConfigMapName(StoreKey{Namespace: "canary-ns", Name: "test-canary"}))
+}
+
+func TestConfigMapSeedGates(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	f := fake.NewSimpleClientset()
+	store, err := NewConfigMapStore(f)
+	require.NoError(t, err)
+	require.True(t, store.IsGateOpen(context.TODO(), sk))
+	conf, err := f.CoreV1().ConfigMaps("canary-ns").Get(context.TODO(), "canary-ns-test-canary-cgate", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Len(t, conf.Data, len(GateTypes)+1)
+	require.Len(t, seededGates(conf.Data), len(GateTypes))
+	for _, gate := range GateTypes {
+		require.Equal(t, defaultText(StoreKey{Namespace: sk.Namespace, Name: sk.Name, Type: gate}), conf.Data[string(gate)], gate)
+	}
+
+	// the missing gates of an existing configmap are added when it is loaded, the stored gates are kept
+	conf.Data = map[string]string{string(service.HookRollback): GATE_OPEN}
+	_, err = f.CoreV1().ConfigMaps("canary-ns").Update(context.TODO(), conf, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.True(t, store.IsGateOpen(context.TODO(), StoreKey{Namespace: sk.Namespace, Name: sk.Name, Type: service.HookRollback}))
+	conf, err = f.CoreV1().ConfigMaps("canary-ns").Get(context.TODO(), "canary-ns-test-canary-cgate", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Len(t, conf.Data, len(GateTypes)+1)
+	require.Equal(t, GATE_OPEN, conf.Data[string(service.HookRollback)])
+	require.Equal(t, GATE_OPEN, conf.Data[string(service.HookConfirmPromotion)])
+	require.NotContains(t, seededGates(conf.Data), string(service.HookRollback))
+}
+
+func TestConfigMapSeededDefaults(t *testing.T) {
+	defer SetDefaultClosed(nil)
+	promotion := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	rollout := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmRollout}
+	f := fake.NewSimpleClientset()
+	store, err := NewConfigMapStore(f)
+	require.NoError(t, err)
+	require.True(t, store.IsGateOpen(context.TODO(), promotion))
+	store.GateOpen(t.Context(), rollout, "alice")
+
+	// the seeded gates follow a later change of the default, the gates which were set are kept
+	SetDefaultClosed([]service.HookType{service.HookConfirmPromotion, service.HookConfirmRollout})
+	require.False(t, store.IsGateOpen(context.TODO(), promotion))
+	require.True(t, store.IsGateOpen(context.TODO(), rollout))
+	gates, err := store.List(context.TODO(), "canary-ns", "test-canary")
+	require.NoError(t, err)
+	require.False(t, gates[service.HookConfirmPromotion])
+	require.True(t, gates[service.HookConfirmRollout])
+	conf, err := f.CoreV1().ConfigMaps("canary-ns").Get(context.TODO(), "canary-ns-test-canary-cgate", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, GATE_CLOSE, conf.Data[string(service.HookConfirmPromotion)])
+
+	// a seeded gate is compared against its default
+	swapped, err := store.CompareAndSet(t.Context(), promotion, false, true)
+	require.NoError(t, err)
+	require.True(t, swapped)
+	require.True(t, store.IsGateOpen(context.TODO(), promotion))
+}
+
+func TestConfigMapGateStateUnavailable(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	f := fake.NewSimpleClientset()
+	store, err := NewConfigMapStore(f)
+	require.NoError(t, err)
+	open, err := store.GateState(t.Context(), sk)
+	require.NoError(t, err)
+	require.True(t, open)
+
+	// the API server fails, which is not a missing configmap
+	f.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewServiceUnavailable("etcd is unavailable")
+	})
+	open, err = store.GateState(t.Context(), sk)
+	require.ErrorIs(t, err, ErrStoreUnavailable)
+	var unavailable *UnavailableError
+	require.ErrorAs(t, err, &unavailable)
+	require.Equal(t, sk, unavailable.Key)
+	require.True(t, k8serrors.IsServiceUnavailable(err))
+	// IsGateOpen still answers the default state
+	require.True(t, open)
+	require.True(t, store.IsGateOpen(t.Context(), sk))
+}
@@ -0,0 +1,463 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	piggysecv1alpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/rs/zerolog/log"
+)
+
+// fileState is the content of the store file.
+// Gates, ChangedBy, Expiry and ClosedAt are keyed by namespace:name:type, the others by namespace:name.
+type fileState struct {
+	Gates     map[string]bool              `json:"gates"`
+	ChangedBy map[string]string            `json:"changedBy,omitempty"`
+	Expiry    map[string]time.Time         `json:"expiry,omitempty"`
+	ClosedAt  map[string]time.Time         `json:"closedAt,omitempty"`
+	Events    map[string]string            `json:"events,omitempty"`
+	Phases    map[string]string            `json:"phases,omitempty"`
+	Messages  map[string]map[string]string `json:"messages,omitempty"`
+	History   map[string][]HistoryEntry    `json:"history,omitempty"`
+	// RolledBackAt is the time when the canary was last rolled back
+	RolledBackAt map[string]time.Time `json:"rolledBackAt,omitempty"`
+	// Decisions is the last answer of the webhook of each gate, keyed by namespace:name:type
+	Decisions map[string]Decision `json:"decisions,omitempty"`
+}
+
+type FileStore struct {
+	path   string
+	mu     sync.RWMutex
+	state  fileState
+	expiry *expiryTimers
+	// err is the result of the last write of the file
+	err error
+}
+
+// NewFileStore creates a new FileStore instance.
+// FileStore keeps the gate states in a JSON file, which is written on every change and loaded on start.
+// It is suitable for single-node deployments which cannot create ConfigMaps or CanaryGates.
+func NewFileStore(path string) (Store, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file path of the store is required")
+	}
+	store := &FileStore{
+		path:   path,
+		expiry: &expiryTimers{},
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("unable to read store file [%s]: %w", path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &store.state); err != nil {
+			return nil, fmt.Errorf("unable to decode store file [%s]: %w", path, err)
+		}
+	}
+	store.init()
+	// restore the pending expirations of the gates opened with a TTL
+	for k, expiry := range store.state.Expiry {
+		parts := strings.SplitN(k, ":", 3)
+		if len(parts) != 3 {
+			delete(store.state.Expiry, k)
+			continue
+		}
+		key, err := NewStoreKey(parts[0], parts[1], service.HookType(parts[2]))
+		if err != nil {
+			log.Warn().Msgf("Dropping the expiry of the malformed key [%s] %v", k, err)
+			delete(store.state.Expiry, k)
+			continue
+		}
+		store.scheduleExpiry(key, max(time.Until(expiry), 0))
+	}
+	return store, nil
+}
+
+// init creates the maps which are missing in the file
+func (s *FileStore) init() {
+	if s.state.Gates == nil {
+		s.state.Gates = map[string]bool{}
+	}
+	if s.state.ChangedBy == nil {
+		s.state.ChangedBy = map[string]string{}
+	}
+	if s.state.Expiry == nil {
+		s.state.Expiry = map[string]time.Time{}
+	}
+	if s.state.ClosedAt == nil {
+		s.state.ClosedAt = map[string]time.Time{}
+	}
+	if s.state.Events == nil {
+		s.state.Events = map[string]string{}
+	}
+	if s.state.Phases == nil {
+		s.state.Phases = map[string]string{}
+	}
+	if s.state.RolledBackAt == nil {
+		s.state.RolledBackAt = map[string]time.Time{}
+	}
+	if s.state.Decisions == nil {
+		s.state.Decisions = map[string]Decision{}
+	}
+	if s.state.Messages == nil {
+		s.state.Messages = map[string]map[string]string{}
+	}
+	if s.state.History == nil {
+		s.state.History = map[string][]HistoryEntry{}
+	}
+}
+
+func (s *FileStore) GateOpen(ctx context.Context, key StoreKey, user string) {
+	s.expiry.cancel(key)
+	s.updateGate(key, true, user, "", time.Time{})
+	s.UpdateEvent(ctx, key, "Updated", gateMessage(key, GATE_OPEN, user))
+}
+
+func (s *FileStore) RollbackGate(ctx context.Context, key StoreKey, user string, reason string) {
+	s.expiry.cancel(key)
+	s.updateGate(key, true, user, reason, time.Time{})
+	s.UpdateEvent(ctx, key, "Rollback", changeMessage(key, GATE_OPEN, user, reason))
+}
+
+func (s *FileStore) OpenGateWithTTL(ctx context.Context, key StoreKey, ttl time.Duration, user string) {
+	s.expiry.cancel(key)
+	s.updateGate(key, true, user, "", time.Now().Add(ttl))
+	s.UpdateEvent(ctx, key, "Updated", gateMessage(key, GATE_OPEN, user))
+	s.scheduleExpiry(key, ttl)
+}
+
+func (s *FileStore) GateClose(ctx context.Context, key StoreKey, user string) {
+	s.expiry.cancel(key)
+	s.updateGate(key, false, user, "", time.Time{})
+	s.UpdateEvent(ctx, key, "Updated", gateMessage(key, GATE_CLOSE, user))
+}
+
+// GateReset deletes the gate from the file, so it is read with its default value
+func (s *FileStore) GateReset(ctx context.Context, key StoreKey, user string) {
+	s.expiry.cancel(key)
+	status := defaultText(key)
+	s.mu.Lock()
+	k := s.getKey(key)
+	delete(s.state.Gates, k)
+	delete(s.state.ChangedBy, k)
+	delete(s.state.Expiry, k)
+	delete(s.state.ClosedAt, k)
+	h := s.getDeploymentKey(key)
+	s.state.History[h] = appendHistory(s.state.History[h], newHistoryEntry(key, status, user, ""))
+	s.flush()
+	s.mu.Unlock()
+	s.UpdateEvent(ctx, key, "Reset", resetMessage(key, status, user))
+}
+
+// scheduleExpiry resets the gate to its default state after the ttl
+func (s *FileStore) scheduleExpiry(key StoreKey, ttl time.Duration) {
+	s.expiry.schedule(key, ttl, func() {
+		s.updateGate(key, defaultValue(key), "", "", time.Time{})
+		s.UpdateEvent(context.Background(), key, "Expired", expiredMessage(key, ttl))
+		notifyExpired(key, ttl)
+	})
+}
+
+// CompareAndSet checks and writes the gate under the write lock.
+func (s *FileStore) CompareAndSet(ctx context.Context, key StoreKey, expected, desired bool) (bool, error) {
+	s.mu.Lock()
+	current, ok := s.state.Gates[s.getKey(key)]
+	if !ok {
+		current = defaultValue(key)
+	}
+	if current != expected {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.setGate(key, desired, "", "", time.Time{})
+	err := s.err
+	s.mu.Unlock()
+	s.expiry.cancel(key)
+	s.UpdateEvent(ctx, key, "Updated", gateMessage(key, GateStatus(desired), ""))
+	return true, err
+}
+
+// updateGate saves the gate state with the user who changed it. A zero expiry removes the pending expiration.
+func (s *FileStore) updateGate(key StoreKey, val bool, user string, reason string, expiry time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setGate(key, val, user, reason, expiry)
+}
+
+// setGate writes the gate state and its history. The caller must hold the write lock.
+func (s *FileStore) setGate(key StoreKey, val bool, user string, reason string, expiry time.Time) {
+	k := s.getKey(key)
+	s.state.Gates[k] = val
+	s.state.ChangedBy[k] = user
+	if expiry.IsZero() {
+		delete(s.state.Expiry, k)
+	} else {
+		s.state.Expiry[k] = expiry.UTC()
+	}
+	if val {
+		delete(s.state.ClosedAt, k)
+	} else {
+		s.state.ClosedAt[k] = time.Now().UTC()
+	}
+	h := s.getDeploymentKey(key)
+	s.state.History[h] = appendHistory(s.state.History[h], newHistoryEntry(key, GateStatus(val), user, reason))
+	s.flush()
+}
+
+func (s *FileStore) GetChangedBy(ctx context.Context, key StoreKey) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.ChangedBy[s.getKey(key)]
+}
+
+// Exists always reports true since the file store has no gate resource
+func (s *FileStore) Exists(ctx context.Context, key StoreKey) (bool, error) {
+	return true, nil
+}
+
+func (s *FileStore) GetClosedAt(ctx context.Context, key StoreKey) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.ClosedAt[s.getKey(key)]
+}
+
+func (s *FileStore) IsGateOpen(ctx context.Context, key StoreKey) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if val, ok := s.state.Gates[s.getKey(key)]; ok {
+		return val
+	}
+	return defaultValue(key)
+}
+
+// GateState never fails, the file is read once when the store is created
+func (s *FileStore) GateState(ctx context.Context, key StoreKey) (bool, error) {
+	return s.IsGateOpen(ctx, key), nil
+}
+
+func (s *FileStore) List(ctx context.Context, namespace string, name string) (map[service.HookType]bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	gates := defaultGates(namespace, name)
+	for t := range gates {
+		if val, ok := s.state.Gates[s.getKey(StoreKey{Namespace: namespace, Name: name, Type: t})]; ok {
+			gates[t] = val
+		}
+	}
+	return gates, nil
+}
+
+// Deployments returns the deployments of the gates and the events in the file
+func (s *FileStore) Deployments(ctx context.Context) ([]StoreKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := map[StoreKey]bool{}
+	for k := range s.state.Gates {
+		if key, ok := parseKey(k); ok {
+			seen[key] = true
+		}
+	}
+	for k := range s.state.Events {
+		if key, ok := parseKey(k); ok {
+			seen[key] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+func (s *FileStore) UpdateEvent(ctx context.Context, key StoreKey, status string, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Events[s.getDeploymentKey(key)] = message
+	s.flush()
+}
+
+func (s *FileStore) GetLastEvent(ctx context.Context, key StoreKey) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.Events[s.getDeploymentKey(key)]
+}
+
+func (s *FileStore) GetPhase(ctx context.Context, key StoreKey) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.Phases[s.getDeploymentKey(key)]
+}
+
+// UpdatePhase writes the file only when the phase changes.
+func (s *FileStore) UpdatePhase(ctx context.Context, key StoreKey, phase string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := s.getDeploymentKey(key)
+	last := s.state.Phases[k]
+	if last != phase {
+		s.state.Phases[k] = phase
+		s.flush()
+	}
+	return last
+}
+
+func (s *FileStore) SetRolledBackAt(ctx context.Context, key StoreKey, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.RolledBackAt[s.getDeploymentKey(key)] = at.UTC()
+	s.flush()
+}
+
+func (s *FileStore) GetRolledBackAt(ctx context.Context, key StoreKey) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.RolledBackAt[s.getDeploymentKey(key)]
+}
+
+func (s *FileStore) SetDecision(ctx context.Context, key StoreKey, decision Decision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	decision.Time = decision.Time.UTC()
+	s.state.Decisions[s.getKey(key)] = decision
+	s.flush()
+}
+
+func (s *FileStore) GetDecision(ctx context.Context, key StoreKey) Decision {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.Decisions[s.getKey(key)]
+}
+
+func (s *FileStore) SaveMessages(ctx context.Context, key StoreKey, messages map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Messages[s.getDeploymentKey(key)] = maps.Clone(messages)
+	s.flush()
+}
+
+func (s *FileStore) GetMessages(ctx context.Context, key StoreKey) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if messages, ok := s.state.Messages[s.getDeploymentKey(key)]; ok {
+		return maps.Clone(messages)
+	}
+	return map[string]string{}
+}
+
+func (s *FileStore) AppendHistory(ctx context.Context, key StoreKey, entry HistoryEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := s.getDeploymentKey(key)
+	s.state.History[k] = appendHistory(s.state.History[k], entry)
+	s.flush()
+}
+
+func (s *FileStore) GetHistory(ctx context.Context, key StoreKey) []HistoryEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if history, ok := s.state.History[s.getDeploymentKey(key)]; ok {
+		return slices.Clone(history)
+	}
+	return []HistoryEntry{}
+}
+
+// Approve does not record the user, multiple approvers are only supported by the CanaryGate store.
+func (s *FileStore) Approve(ctx context.Context, key StoreKey, user string) (Approval, error) {
+	return singleApproval(user), nil
+}
+
+func (s *FileStore) GetApproval(ctx context.Context, key StoreKey) Approval {
+	return Approval{Required: 1}
+}
+
+// ConsumeGate does not close the gate, since only the CanaryGate store has gates which require an approval for each use.
+func (s *FileStore) ConsumeGate(ctx context.Context, key StoreKey) (bool, error) {
+	return false, nil
+}
+
+// GetDependencies returns the default dependencies, which can only be overridden by the CanaryGate store.
+func (s *FileStore) GetDependencies(ctx context.Context, key StoreKey) []service.HookType {
+	return gateDependencies(&piggysecv1alpha1.CanaryGateSpec{}, key)
+}
+
+// Health returns the error of the last write of the file, if any.
+func (s *FileStore) Health(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
+
+// WaitForSync returns at once since the file is loaded when the store is created
+func (s *FileStore) WaitForSync(ctx context.Context) error {
+	return nil
+}
+
+func (s *FileStore) Shutdown() error {
+	s.expiry.stop()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+	return s.err
+}
+
+// flush writes the state to a temporary file and renames it, so a crash does not leave a partial file.
+// The caller must hold the write lock.
+func (s *FileStore) flush() {
+	s.err = s.write()
+	if s.err != nil {
+		log.Error().Msgf("Unable to write store file [%s] %v.", s.path, s.err)
+	}
+}
+
+func (s *FileStore) write() error {
+	data, err := json.MarshalIndent(&s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// getKey get store key name of a gate
+func (s *FileStore) getKey(key StoreKey) string {
+	return fmt.Sprintf("%s:%s:%s", key.Namespace, key.Name, key.Type)
+}
+
+// getDeploymentKey get store key name of the events, messages and history of a deployment
+func (s *FileStore) getDeploymentKey(key StoreKey) string {
+	return fmt.Sprintf("%s:%s", key.Namespace, key.Name)
+}
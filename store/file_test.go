@@ -0,0 +1,218 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFileStore(t *testing.T) (Store, string) {
+	path := filepath.Join(t.TempDir(), "canary-gate.json")
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+	return store, path
+}
+
+func TestFileGate(t *testing.T) {
+	for _, v := range typeCases {
+		serviceType := v.serviceType
+		sk := StoreKey{
+			Namespace: "canary-ns",
+			Name:      "test-canary",
+			Type:      serviceType,
+		}
+		// Tests
+		store, path := newTestFileStore(t)
+		result := store.IsGateOpen(context.TODO(), sk)
+		if v.expectedInit != result {
+			t.Fatalf("[%s] [default] gate expected %v found %v", serviceType, v.expectedInit, result)
+		}
+		// close gate
+		store.GateClose(t.Context(), sk, "")
+		result = store.IsGateOpen(context.TODO(), sk)
+		if v.expectedAfterClose != result {
+			t.Fatalf("[%s] [open] gate expected %v found %v", serviceType, v.expectedAfterClose, result)
+		}
+		// open gate
+		store.GateOpen(t.Context(), sk, "")
+		result = store.IsGateOpen(context.TODO(), sk)
+		if v.expectedAfterOpen != result {
+			t.Fatalf("[%s] [close] gate expected %v found %v", serviceType, v.expectedAfterOpen, result)
+		}
+		// shutdown store
+		err := store.Shutdown()
+		require.NoError(t, err, "Shutdown should not return an error")
+
+		// the state is loaded from the file
+		store, err = NewFileStore(path)
+		require.NoError(t, err)
+		require.Equal(t, v.expectedAfterOpen, store.IsGateOpen(context.TODO(), sk), "[%s] gate should be loaded from file", serviceType)
+		require.NoError(t, store.Shutdown())
+	}
+}
+
+func TestFileGateEvent(t *testing.T) {
+	sk := StoreKey{
+		Namespace: "canary-ns",
+		Name:      "test-canary",
+	}
+	store, path := newTestFileStore(t)
+	result := store.GetLastEvent(context.TODO(), sk)
+	require.EqualValuesf(t, "", result, "Event should be empty, found %s", result)
+	eventMessage := "Test event message"
+	store.UpdateEvent(context.TODO(), sk, "status", eventMessage)
+	result = store.GetLastEvent(context.TODO(), sk)
+	require.EqualValuesf(t, eventMessage, result, "Event message should be '%s', found '%s'", eventMessage, result)
+
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+	require.Equal(t, eventMessage, store.GetLastEvent(context.TODO(), sk))
+}
+
+func TestFileGateTTL(t *testing.T) {
+	sk := StoreKey{
+		Namespace: "canary-ns",
+		Name:      "test-canary",
+		Type:      service.HookRollback,
+	}
+	store, path := newTestFileStore(t)
+	store.OpenGateWithTTL(t.Context(), sk, 20*time.Millisecond, "")
+	require.True(t, store.IsGateOpen(context.TODO(), sk), "gate should be opened before TTL")
+	require.Eventually(t, func() bool { return !store.IsGateOpen(context.TODO(), sk) }, time.Second, 5*time.Millisecond, "gate should revert to default after TTL")
+
+	// a manual change cancels the pending expiry
+	store.OpenGateWithTTL(t.Context(), sk, 20*time.Millisecond, "")
+	store.GateOpen(t.Context(), sk, "")
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, store.IsGateOpen(context.TODO(), sk), "manual open should cancel TTL")
+
+	// a pending expiry is restored from the file
+	store.OpenGateWithTTL(t.Context(), sk, 50*time.Millisecond, "")
+	require.NoError(t, store.Shutdown())
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+	require.True(t, store.IsGateOpen(context.TODO(), sk), "gate should be opened before TTL")
+	require.Eventually(t, func() bool { return !store.IsGateOpen(context.TODO(), sk) }, time.Second, 5*time.Millisecond, "restored gate should revert to default after TTL")
+	require.NoError(t, store.Shutdown())
+}
+
+func TestFileMessages(t *testing.T) {
+	sk := StoreKey{
+		Namespace: "canary-ns",
+		Name:      "test-canary",
+	}
+	store, _ := newTestFileStore(t)
+	require.Empty(t, store.GetMessages(context.TODO(), sk))
+	messages := map[string]string{"C123": "1700000000.000100"}
+	store.SaveMessages(context.TODO(), sk, messages)
+	require.Equal(t, messages, store.GetMessages(context.TODO(), sk))
+}
+
+func TestFileDefaultClosed(t *testing.T) {
+	testDefaultClosed(t, func() Store {
+		store, _ := newTestFileStore(t)
+		return store
+	})
+}
+
+func TestFileList(t *testing.T) {
+	store, _ := newTestFileStore(t)
+	testList(t, store)
+}
+
+func TestFileHistory(t *testing.T) {
+	store, _ := newTestFileStore(t)
+	testHistory(t, store)
+}
+
+func TestFileDeployments(t *testing.T) {
+	store, _ := newTestFileStore(t)
+	testDeployments(t, store)
+}
+
+func TestFilePhase(t *testing.T) {
+	store, _ := newTestFileStore(t)
+	testPhase(t, store)
+}
+
+func TestFileRolledBackAt(t *testing.T) {
+	store, path := newTestFileStore(t)
+	testRolledBackAt(t, store)
+
+	// the time of the rollback is kept in the file
+	reopened, err := NewFileStore(path)
+	require.NoError(t, err)
+	require.False(t, reopened.GetRolledBackAt(t.Context(), StoreKey{Namespace: "canary-ns", Name: "test-canary"}).IsZero())
+}
+
+func TestFileDecision(t *testing.T) {
+	store, path := newTestFileStore(t)
+	testDecision(t, store)
+
+	// the decision is kept in the file
+	reopened, err := NewFileStore(path)
+	require.NoError(t, err)
+	require.True(t, reopened.GetDecision(t.Context(), StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}).Approved)
+}
+
+func TestFileChangedBy(t *testing.T) {
+	store, _ := newTestFileStore(t)
+	testChangedBy(t, store)
+}
+
+func TestFileClosedAt(t *testing.T) {
+	store, _ := newTestFileStore(t)
+	testClosedAt(t, store)
+}
+
+func TestFileReset(t *testing.T) {
+	store, _ := newTestFileStore(t)
+	testReset(t, store)
+}
+
+func TestFileCompareAndSet(t *testing.T) {
+	store, _ := newTestFileStore(t)
+	testCompareAndSet(t, store)
+}
+
+func TestFileContendedCompareAndSet(t *testing.T) {
+	store, _ := newTestFileStore(t)
+	testContendedCompareAndSet(t, store)
+}
+
+func TestFileInvalid(t *testing.T) {
+	_, err := NewFileStore("")
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "canary-gate.json")
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+	_, err = NewFileStore(path)
+	require.Error(t, err)
+
+	// an unwritable file is reported by the health check
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "missing", "canary-gate.json"))
+	require.NoError(t, err)
+	require.NoError(t, store.Health(context.TODO()))
+	store.GateOpen(t.Context(), StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback}, "")
+	require.Error(t, store.Health(context.TODO()))
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+)
+
+// FreezeConfigMapName is the name of the ConfigMap which holds the freeze in the namespace of canary-gate
+const FreezeConfigMapName = "canary-gate-freeze"
+
+// FreezeGates lists the confirm gates which read closed while the gates are frozen
+var FreezeGates = []service.HookType{
+	service.HookConfirmRollout,
+	service.HookConfirmTrafficIncrease,
+	service.HookConfirmPromotion,
+	service.HookConfirmFinalize,
+}
+
+// Freeze is the maintenance mode which closes the confirm gates of every canary
+type Freeze struct {
+	// Frozen is true while the confirm gates are closed
+	Frozen bool `json:"frozen"`
+	// User who last froze or unfroze the gates
+	User string `json:"user,omitempty"`
+	// Reason of the freeze
+	Reason string `json:"reason,omitempty"`
+	// Time when the gates were last frozen or unfrozen
+	Time time.Time `json:"time,omitzero"`
+}
+
+// Freezer reads and changes the freeze of the confirm gates
+type Freezer interface {
+	// SetFreeze freezes or unfreezes the confirm gates of every canary
+	SetFreeze(ctx context.Context, freeze Freeze) error
+	// GetFreeze returns the freeze, or an error when it cannot be read
+	GetFreeze(ctx context.Context) (Freeze, error)
+}
+
+// FreezeStore closes the confirm gates of the store while the gates are frozen, regardless of the state of each gate.
+// The state of the gates is kept, so they read their own state again once unfrozen. The freeze is kept in the
+// ConfigMap canary-gate-freeze, so it is shared by the replicas, or in memory without a Kubernetes client.
+type FreezeStore struct {
+	Store
+	k8sClient kubernetes.Interface
+	namespace string
+	// informer keeps the freeze current with a watch of the ConfigMap, so the webhooks do not read the API server
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+
+	mu     sync.RWMutex
+	cached Freeze
+}
+
+// NewFreezeStore wraps the store with the freeze, which is kept in the ConfigMap canary-gate-freeze in the namespace
+// specified by the environment variable CANARY_GATE_NAMESPACE. The ConfigMap is watched, so the freeze is read from
+// memory. Without a Kubernetes config, the freeze is kept in memory and is not shared by the replicas.
+func NewFreezeStore(store Store, k8sClient kubernetes.Interface) (*FreezeStore, error) {
+	if k8sClient == nil {
+		var err error
+		if k8sClient, err = newK8sClient(); err != nil {
+			log.Warn().Msgf("Unable to create the Kubernetes client, the freeze of the gates is kept in memory: %v", err)
+			return &FreezeStore{Store: store}, nil
+		}
+	}
+	namespace := os.Getenv("CANARY_GATE_NAMESPACE")
+	if namespace == "" {
+		return nil, fmt.Errorf("CANARY_GATE_NAMESPACE is required to keep the freeze of the gates in the ConfigMap %s", FreezeConfigMapName)
+	}
+	s := &FreezeStore{Store: store, k8sClient: k8sClient, namespace: namespace}
+	if err := s.startInformer(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// startInformer watches the ConfigMap of the freeze. It does not wait for the cache to sync; the freeze is read from
+// the API server until it does.
+func (s *FreezeStore) startInformer() error {
+	factory := informers.NewSharedInformerFactoryWithOptions(s.k8sClient, 0,
+		informers.WithNamespace(s.namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", FreezeConfigMapName).String()
+		}),
+	)
+	s.informer = factory.Core().V1().ConfigMaps().Informer()
+	update := func(obj any) {
+		if conf, ok := obj.(*corev1.ConfigMap); ok && conf.Name == FreezeConfigMapName {
+			s.setCached(parseFreeze(conf))
+		}
+	}
+	_, err := s.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj any) { update(obj) },
+		DeleteFunc: func(obj any) { s.setCached(Freeze{}) },
+	})
+	if err != nil {
+		return fmt.Errorf("unable to watch the ConfigMap %s: %w", FreezeConfigMapName, err)
+	}
+	s.stopCh = make(chan struct{})
+	factory.Start(s.stopCh)
+	return nil
+}
+
+// WaitForSync blocks until the freeze and the caches of the store are synced
+func (s *FreezeStore) WaitForSync(ctx context.Context) error {
+	if s.informer != nil && !cache.WaitForCacheSync(ctx.Done(), s.informer.HasSynced) {
+		return fmt.Errorf("freeze cache is not synced: %w", ctx.Err())
+	}
+	return s.Store.WaitForSync(ctx)
+}
+
+// Shutdown stops the watch of the freeze and shuts the store down
+func (s *FreezeStore) Shutdown() error {
+	if s.stopCh != nil {
+		close(s.stopCh)
+	}
+	return s.Store.Shutdown()
+}
+
+// frozen reports whether the gate reads closed because of the freeze
+func frozen(freeze Freeze, key StoreKey) bool {
+	return freeze.Frozen && slices.Contains(FreezeGates, key.Type)
+}
+
+// IsGateOpen answers a confirm gate closed while the gates are frozen. A freeze which cannot be read also answers the
+// confirm gate closed, like GateState which does not answer it.
+func (s *FreezeStore) IsGateOpen(ctx context.Context, key StoreKey) bool {
+	if slices.Contains(FreezeGates, key.Type) {
+		freeze, err := s.GetFreeze(ctx)
+		if err != nil {
+			log.Error().Msgf("Unable to read the freeze of gate [%s], the gate is closed %v.", key.String(), err)
+			return false
+		}
+		if frozen(freeze, key) {
+			return false
+		}
+	}
+	return s.Store.IsGateOpen(ctx, key)
+}
+
+// GateState answers a confirm gate closed while the gates are frozen, or an UnavailableError when the freeze cannot
+// be read
+func (s *FreezeStore) GateState(ctx context.Context, key StoreKey) (bool, error) {
+	if slices.Contains(FreezeGates, key.Type) {
+		freeze, err := s.GetFreeze(ctx)
+		if err != nil {
+			return false, &UnavailableError{Key: key, Err: err}
+		}
+		if frozen(freeze, key) {
+			return false, nil
+		}
+	}
+	return s.Store.GateState(ctx, key)
+}
+
+// List answers the confirm gates closed while the gates are frozen
+func (s *FreezeStore) List(ctx context.Context, namespace string, name string) (map[service.HookType]bool, error) {
+	gates, err := s.Store.List(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	freeze, err := s.GetFreeze(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if freeze.Frozen {
+		for _, gate := range FreezeGates {
+			if _, ok := gates[gate]; ok {
+				gates[gate] = false
+			}
+		}
+	}
+	return gates, nil
+}
+
+// setCached keeps the freeze in memory
+func (s *FreezeStore) setCached(freeze Freeze) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cached = freeze
+}
+
+func (s *FreezeStore) SetFreeze(ctx context.Context, freeze Freeze) error {
+	freeze.Time = freeze.Time.UTC()
+	if s.k8sClient == nil {
+		s.setCached(freeze)
+		return nil
+	}
+	data := map[string]string{
+		"frozen": strconv.FormatBool(freeze.Frozen),
+		"user":   freeze.User,
+		"reason": freeze.Reason,
+		"time":   freeze.Time.Format(time.RFC3339),
+	}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		conf, err := s.k8sClient.CoreV1().ConfigMaps(s.namespace).Get(ctx, FreezeConfigMapName, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			_, err = s.k8sClient.CoreV1().ConfigMaps(s.namespace).Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: FreezeConfigMapName, Namespace: s.namespace},
+				Data:       data,
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		conf.Data = data
+		_, err = s.k8sClient.CoreV1().ConfigMaps(s.namespace).Update(ctx, conf, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// the replica which changed the freeze reads it at once, the others when the watch sees it
+	s.setCached(freeze)
+	return nil
+}
+
+// GetFreeze returns the freeze kept current by the watch of the ConfigMap. The ConfigMap is read until the watch is
+// synced. A missing ConfigMap is not frozen.
+func (s *FreezeStore) GetFreeze(ctx context.Context) (Freeze, error) {
+	if s.k8sClient == nil || s.informer.HasSynced() {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.cached, nil
+	}
+	conf, err := s.k8sClient.CoreV1().ConfigMaps(s.namespace).Get(ctx, FreezeConfigMapName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return Freeze{}, nil
+	}
+	if err != nil {
+		return Freeze{}, err
+	}
+	return parseFreeze(conf), nil
+}
+
+// parseFreeze reads the freeze from the data of the ConfigMap
+func parseFreeze(conf *corev1.ConfigMap) Freeze {
+	frozen, _ := strconv.ParseBool(conf.Data["frozen"])
+	changed, _ := time.Parse(time.RFC3339, conf.Data["time"])
+	return Freeze{Frozen: frozen, User: conf.Data["user"], Reason: conf.Data["reason"], Time: changed}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestFreezeStore(t *testing.T) {
+	memory, err := NewMemoryStore()
+	require.NoError(t, err)
+	f := fake.NewSimpleClientset()
+	t.Setenv("CANARY_GATE_NAMESPACE", "canary-gate")
+	store, err := NewFreezeStore(memory, f)
+	require.NoError(t, err)
+	defer store.Shutdown()
+	promotion := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	rollback := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback}
+	store.GateOpen(t.Context(), promotion, "alice")
+	store.GateOpen(t.Context(), rollback, "alice")
+
+	// a missing configmap is not frozen
+	freeze, err := store.GetFreeze(t.Context())
+	require.NoError(t, err)
+	require.False(t, freeze.Frozen)
+	require.True(t, store.IsGateOpen(t.Context(), promotion))
+
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, store.SetFreeze(t.Context(), Freeze{Frozen: true, User: "bob", Reason: "holidays", Time: at}))
+	freeze, err = store.GetFreeze(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, Freeze{Frozen: true, User: "bob", Reason: "holidays", Time: at}, freeze)
+	conf, err := f.CoreV1().ConfigMaps("canary-gate").Get(t.Context(), FreezeConfigMapName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "true", conf.Data["frozen"])
+
+	// the freeze takes precedence over an opened confirm gate, and leaves the other gates
+	require.False(t, store.IsGateOpen(t.Context(), promotion))
+	open, err := store.GateState(t.Context(), promotion)
+	require.NoError(t, err)
+	require.False(t, open)
+	require.True(t, store.IsGateOpen(t.Context(), rollback))
+	gates, err := store.List(t.Context(), "canary-ns", "test-canary")
+	require.NoError(t, err)
+	require.False(t, gates[service.HookConfirmPromotion])
+	require.True(t, gates[service.HookRollback])
+	// a gate opened while frozen is kept closed
+	store.GateOpen(t.Context(), StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmRollout}, "alice")
+	require.False(t, store.IsGateOpen(t.Context(), StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmRollout}))
+
+	// another replica reads the same freeze
+	replica, err := NewFreezeStore(memory, f)
+	require.NoError(t, err)
+	defer replica.Shutdown()
+	require.False(t, replica.IsGateOpen(t.Context(), promotion))
+
+	// the gates have their own state again once unfrozen, and the other replica sees it through the watch
+	require.NoError(t, store.WaitForSync(t.Context()))
+	require.NoError(t, replica.SetFreeze(t.Context(), Freeze{User: "bob"}))
+	require.True(t, replica.IsGateOpen(t.Context(), promotion))
+	require.Eventually(t, func() bool { return store.IsGateOpen(t.Context(), promotion) }, 5*time.Second, 10*time.Millisecond)
+	open, err = store.GateState(t.Context(), promotion)
+	require.NoError(t, err)
+	require.True(t, open)
+}
+
+func TestFreezeStoreNamespace(t *testing.T) {
+	memory, err := NewMemoryStore()
+	require.NoError(t, err)
+	t.Setenv("CANARY_GATE_NAMESPACE", "")
+	_, err = NewFreezeStore(memory, fake.NewSimpleClientset())
+	require.ErrorContains(t, err, "CANARY_GATE_NAMESPACE is required")
+}
+
+func TestFreezeStoreUnavailable(t *testing.T) {
+	memory, err := NewMemoryStore()
+	require.NoError(t, err)
+	f := fake.NewSimpleClientset()
+	// the ConfigMap can neither be watched nor read
+	for _, verb := range []string{"get", "list"} {
+		f.PrependReactor(verb, "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, k8serrors.NewServiceUnavailable("etcd is unavailable")
+		})
+	}
+	t.Setenv("CANARY_GATE_NAMESPACE", "canary-gate")
+	store, err := NewFreezeStore(memory, f)
+	require.NoError(t, err)
+	defer store.Shutdown()
+	promotion := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	store.GateOpen(t.Context(), promotion, "alice")
+
+	// the webhooks are not answered on a freeze which cannot be read
+	_, err = store.GateState(t.Context(), promotion)
+	require.ErrorIs(t, err, ErrStoreUnavailable)
+	_, err = store.List(t.Context(), "canary-ns", "test-canary")
+	require.Error(t, err)
+	// IsGateOpen answers the confirm gate closed, like GateState
+	require.False(t, store.IsGateOpen(t.Context(), promotion))
+	// the other gates do not read the freeze
+	open, err := store.GateState(t.Context(), StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback})
+	require.NoError(t, err)
+	require.False(t, open)
+}
+
+func TestFreezeStoreCached(t *testing.T) {
+	memory, err := NewMemoryStore()
+	require.NoError(t, err)
+	f := fake.NewSimpleClientset()
+	t.Setenv("CANARY_GATE_NAMESPACE", "canary-gate")
+	store, err := NewFreezeStore(memory, f)
+	require.NoError(t, err)
+	defer store.Shutdown()
+	require.NoError(t, store.WaitForSync(t.Context()))
+	promotion := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	store.GateOpen(t.Context(), promotion, "alice")
+
+	// the synced freeze is read from memory, so a failing API server does not fail the webhooks
+	f.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewServiceUnavailable("etcd is unavailable")
+	})
+	f.ClearActions()
+	open, err := store.GateState(t.Context(), promotion)
+	require.NoError(t, err)
+	require.True(t, open)
+	require.Empty(t, f.Actions())
+}
@@ -18,13 +18,20 @@ package store
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
+	"time"
 
+	piggysecv1alpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
 	"github.com/KongZ/canary-gate/service"
 )
 
 type MemoryStore struct {
-	data *sync.Map
+	data   *sync.Map
+	expiry *expiryTimers
+	// history guards the read-modify-write of the gate change history
+	history sync.Mutex
 }
 
 // NewMemoryStore creates a new MemoryStore instance.
@@ -32,34 +39,151 @@ type MemoryStore struct {
 // It is suitable for testing or scenarios where persistence is not required.
 func NewMemoryStore() (Store, error) {
 	store := &MemoryStore{
-		data: new(sync.Map),
+		data:   new(sync.Map),
+		expiry: &expiryTimers{},
 	}
 	return store, nil
 }
 
-func (s *MemoryStore) GateOpen(key StoreKey) {
-	s.data.Store(s.getKey(key), true)
-	s.UpdateEvent(context.Background(), key, "Updated", fmt.Sprintf("Gate [%s] is set to [%s]", key.String(), GATE_OPEN))
+func (s *MemoryStore) GateOpen(ctx context.Context, key StoreKey, user string) {
+	s.expiry.cancel(key)
+	s.updateGate(ctx, key, true, user, "")
+	s.UpdateEvent(ctx, key, "Updated", gateMessage(key, GATE_OPEN, user))
 }
 
-func (s *MemoryStore) GateClose(key StoreKey) {
-	s.data.Store(s.getKey(key), false)
-	s.UpdateEvent(context.Background(), key, "Updated", fmt.Sprintf("Gate [%s] is set to [%s]", key.String(), GATE_CLOSE))
+func (s *MemoryStore) RollbackGate(ctx context.Context, key StoreKey, user string, reason string) {
+	s.expiry.cancel(key)
+	s.updateGate(ctx, key, true, user, reason)
+	s.UpdateEvent(ctx, key, "Rollback", changeMessage(key, GATE_OPEN, user, reason))
 }
 
-func (s *MemoryStore) IsGateOpen(key StoreKey) bool {
-	val, ok := s.data.LoadOrStore(s.getKey(key), defaultValue(key))
-	if ok {
+func (s *MemoryStore) OpenGateWithTTL(ctx context.Context, key StoreKey, ttl time.Duration, user string) {
+	s.GateOpen(ctx, key, user)
+	s.expiry.schedule(key, ttl, func() {
+		s.updateGate(context.Background(), key, defaultValue(key), "", "")
+		s.UpdateEvent(context.Background(), key, "Expired", expiredMessage(key, ttl))
+		notifyExpired(key, ttl)
+	})
+}
+
+func (s *MemoryStore) GateClose(ctx context.Context, key StoreKey, user string) {
+	s.expiry.cancel(key)
+	s.updateGate(ctx, key, false, user, "")
+	s.UpdateEvent(ctx, key, "Updated", gateMessage(key, GATE_CLOSE, user))
+}
+
+// GateReset deletes the gate from the map, so it is read with its default value
+func (s *MemoryStore) GateReset(ctx context.Context, key StoreKey, user string) {
+	s.expiry.cancel(key)
+	s.data.Delete(s.getKey(key))
+	s.data.Delete(s.getChangedByKey(key))
+	s.data.Delete(s.getClosedAtKey(key))
+	status := defaultText(key)
+	s.AppendHistory(ctx, key, newHistoryEntry(key, status, user, ""))
+	s.UpdateEvent(ctx, key, "Reset", resetMessage(key, status, user))
+}
+
+func (s *MemoryStore) updateGate(ctx context.Context, key StoreKey, val bool, user string, reason string) {
+	s.data.Store(s.getKey(key), val)
+	s.data.Store(s.getChangedByKey(key), user)
+	s.setClosedAt(key, val)
+	s.AppendHistory(ctx, key, newHistoryEntry(key, GateStatus(val), user, reason))
+}
+
+// CompareAndSet swaps the gate value in the map. An unset gate is compared with its default value.
+func (s *MemoryStore) CompareAndSet(ctx context.Context, key StoreKey, expected, desired bool) (bool, error) {
+	k := s.getKey(key)
+	s.data.LoadOrStore(k, defaultValue(key))
+	if !s.data.CompareAndSwap(k, expected, desired) {
+		return false, nil
+	}
+	s.expiry.cancel(key)
+	s.data.Store(s.getChangedByKey(key), "")
+	s.setClosedAt(key, desired)
+	s.AppendHistory(ctx, key, newHistoryEntry(key, GateStatus(desired), "", ""))
+	s.UpdateEvent(ctx, key, "Updated", gateMessage(key, GateStatus(desired), ""))
+	return true, nil
+}
+
+// setClosedAt records the time when the gate is closed and removes it when the gate is opened
+func (s *MemoryStore) setClosedAt(key StoreKey, val bool) {
+	if val {
+		s.data.Delete(s.getClosedAtKey(key))
+	} else {
+		s.data.Store(s.getClosedAtKey(key), time.Now())
+	}
+}
+
+// Exists always reports true since the memory store has no gate resource
+func (s *MemoryStore) Exists(ctx context.Context, key StoreKey) (bool, error) {
+	return true, nil
+}
+
+func (s *MemoryStore) GetClosedAt(ctx context.Context, key StoreKey) time.Time {
+	if v, ok := s.data.Load(s.getClosedAtKey(key)); ok {
+		return v.(time.Time)
+	}
+	return time.Time{}
+}
+
+func (s *MemoryStore) GetChangedBy(ctx context.Context, key StoreKey) string {
+	if v, ok := s.data.Load(s.getChangedByKey(key)); ok {
+		return v.(string)
+	}
+	return ""
+}
+
+// IsGateOpen reads the gate without storing its default, so an unset or reset gate follows the current default
+func (s *MemoryStore) IsGateOpen(ctx context.Context, key StoreKey) bool {
+	if val, ok := s.data.Load(s.getKey(key)); ok {
 		return val.(bool)
 	}
 	return defaultValue(key)
 }
 
+// GateState never fails, the gates are in memory
+func (s *MemoryStore) GateState(ctx context.Context, key StoreKey) (bool, error) {
+	return s.IsGateOpen(ctx, key), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, namespace string, name string) (map[service.HookType]bool, error) {
+	gates := defaultGates(namespace, name)
+	for t := range gates {
+		if val, ok := s.data.Load(s.getKey(StoreKey{Namespace: namespace, Name: name, Type: t})); ok {
+			gates[t] = val.(bool)
+		}
+	}
+	return gates, nil
+}
+
+// Deployments returns the deployments of the stored keys, which are in the form of "<namespace>:<name>:<suffix>".
+// The malformed keys are skipped.
+func (s *MemoryStore) Deployments(ctx context.Context) ([]StoreKey, error) {
+	seen := map[StoreKey]bool{}
+	s.data.Range(func(k, _ any) bool {
+		if key, ok := parseKey(k.(string)); ok {
+			seen[key] = true
+		}
+		return true
+	})
+	return sortedKeys(seen), nil
+}
+
 func (s *MemoryStore) UpdateEvent(ctx context.Context, key StoreKey, status string, message string) {
 	s.data.Store(s.getEventKey(key), message)
 }
 
+func (s *MemoryStore) Health(ctx context.Context) error {
+	return nil
+}
+
+// WaitForSync returns at once since the memory store has no cache
+func (s *MemoryStore) WaitForSync(ctx context.Context) error {
+	return nil
+}
+
 func (s *MemoryStore) Shutdown() error {
+	s.expiry.stop()
 	return nil
 }
 
@@ -68,6 +192,16 @@ func (s *MemoryStore) getKey(key StoreKey) string {
 	return fmt.Sprintf("%s:%s:%s", key.Namespace, key.Name, key.Type)
 }
 
+// getChangedByKey get store key name of the user who changed the gate
+func (s *MemoryStore) getChangedByKey(key StoreKey) string {
+	return s.getKey(key) + "-by"
+}
+
+// getClosedAtKey get store key name of the time when the gate was closed
+func (s *MemoryStore) getClosedAtKey(key StoreKey) string {
+	return s.getKey(key) + "-closed-at"
+}
+
 // StoreKey get store key name
 func (s *MemoryStore) getEventKey(key StoreKey) string {
 	return fmt.Sprintf("%s:%s:%s", key.Namespace, key.Name, string(service.HookEvent))
@@ -79,3 +213,107 @@ func (s *MemoryStore) GetLastEvent(ctx context.Context, key StoreKey) string {
 	}
 	return ""
 }
+
+func (s *MemoryStore) GetPhase(ctx context.Context, key StoreKey) string {
+	if v, ok := s.data.Load(s.getPhaseKey(key)); ok {
+		return v.(string)
+	}
+	return ""
+}
+
+func (s *MemoryStore) UpdatePhase(ctx context.Context, key StoreKey, phase string) string {
+	if last, ok := s.data.Swap(s.getPhaseKey(key), phase); ok {
+		return last.(string)
+	}
+	return ""
+}
+
+func (s *MemoryStore) SetRolledBackAt(ctx context.Context, key StoreKey, at time.Time) {
+	s.data.Store(s.getRolledBackAtKey(key), at)
+}
+
+func (s *MemoryStore) GetRolledBackAt(ctx context.Context, key StoreKey) time.Time {
+	if v, ok := s.data.Load(s.getRolledBackAtKey(key)); ok {
+		return v.(time.Time)
+	}
+	return time.Time{}
+}
+
+func (s *MemoryStore) SetDecision(ctx context.Context, key StoreKey, decision Decision) {
+	s.data.Store(s.getDecisionKey(key), decision)
+}
+
+func (s *MemoryStore) GetDecision(ctx context.Context, key StoreKey) Decision {
+	if v, ok := s.data.Load(s.getDecisionKey(key)); ok {
+		return v.(Decision)
+	}
+	return Decision{}
+}
+
+func (s *MemoryStore) SaveMessages(ctx context.Context, key StoreKey, messages map[string]string) {
+	s.data.Store(s.getMessagesKey(key), maps.Clone(messages))
+}
+
+func (s *MemoryStore) GetMessages(ctx context.Context, key StoreKey) map[string]string {
+	if v, ok := s.data.Load(s.getMessagesKey(key)); ok {
+		return maps.Clone(v.(map[string]string))
+	}
+	return map[string]string{}
+}
+
+// getPhaseKey get store key name of the last phase of the canary
+func (s *MemoryStore) getPhaseKey(key StoreKey) string {
+	return fmt.Sprintf("%s:%s:%s", key.Namespace, key.Name, phaseKey)
+}
+
+// getDecisionKey get store key name of the last answer of the webhook of the gate
+func (s *MemoryStore) getDecisionKey(key StoreKey) string {
+	return s.getKey(key) + "-decision"
+}
+
+// getRolledBackAtKey get store key name of the time when the canary was last rolled back
+func (s *MemoryStore) getRolledBackAtKey(key StoreKey) string {
+	return fmt.Sprintf("%s:%s:%s", key.Namespace, key.Name, rolledBackAtKey)
+}
+
+// getMessagesKey get store key name of notification messages
+func (s *MemoryStore) getMessagesKey(key StoreKey) string {
+	return fmt.Sprintf("%s:%s:%s", key.Namespace, key.Name, messagesKey)
+}
+
+func (s *MemoryStore) AppendHistory(ctx context.Context, key StoreKey, entry HistoryEntry) {
+	s.history.Lock()
+	defer s.history.Unlock()
+	s.data.Store(s.getHistoryKey(key), appendHistory(s.GetHistory(ctx, key), entry))
+}
+
+func (s *MemoryStore) GetHistory(ctx context.Context, key StoreKey) []HistoryEntry {
+	if v, ok := s.data.Load(s.getHistoryKey(key)); ok {
+		return slices.Clone(v.([]HistoryEntry))
+	}
+	return []HistoryEntry{}
+}
+
+// Approve does not record the user, multiple approvers are only supported by the CanaryGate store.
+func (s *MemoryStore) Approve(ctx context.Context, key StoreKey, user string) (Approval, error) {
+	return singleApproval(user), nil
+}
+
+func (s *MemoryStore) GetApproval(ctx context.Context, key StoreKey) Approval {
+	return Approval{Required: 1}
+}
+
+// ConsumeGate does not close the gate, since only the CanaryGate store has gates which require an approval for each use.
+func (s *MemoryStore) ConsumeGate(ctx context.Context, key StoreKey) (bool, error) {
+	return false, nil
+}
+
+// GetDependencies returns the default dependencies, which can only be overridden by the CanaryGate store.
+func (s *MemoryStore) GetDependencies(ctx context.Context, key StoreKey) []service.HookType {
+	return gateDependencies(&piggysecv1alpha1.CanaryGateSpec{}, key)
+}
+
+// getHistoryKey get store key name of the gate change history
+func (s *MemoryStore) getHistoryKey(key StoreKey) string {
+	return fmt.Sprintf("%s:%s:%s", key.Namespace, key.Name, historyKey)
+}
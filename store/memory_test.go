@@ -17,8 +17,11 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/KongZ/canary-gate/service"
 	"github.com/stretchr/testify/require"
 )
 
@@ -35,19 +38,19 @@ func TestMemoryGate(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
-		result := store.IsGateOpen(sk)
+		result := store.IsGateOpen(context.TODO(), sk)
 		if v.expectedInit != result {
 			t.Fatalf("[%s] [default] gate expected %v found %v", serviceType, v.expectedInit, result)
 		}
 		// close gate
-		store.GateClose(sk)
-		result = store.IsGateOpen(sk)
+		store.GateClose(t.Context(), sk, "")
+		result = store.IsGateOpen(context.TODO(), sk)
 		if v.expectedAfterClose != result {
 			t.Fatalf("[%s] [open] gate expected %v found %v", serviceType, v.expectedAfterClose, result)
 		}
 		// open gate
-		store.GateOpen(sk)
-		result = store.IsGateOpen(sk)
+		store.GateOpen(t.Context(), sk, "")
+		result = store.IsGateOpen(context.TODO(), sk)
 		if v.expectedAfterOpen != result {
 			t.Fatalf("[%s] [close] gate expected %v found %v", serviceType, v.expectedAfterOpen, result)
 		}
@@ -73,3 +76,143 @@ func TestMemoryGateEvent(t *testing.T) {
 	result = store.GetLastEvent(context.TODO(), sk)
 	require.EqualValuesf(t, eventMessage, result, "Event message should be '%s', found '%s'", eventMessage, result)
 }
+
+func TestMemoryGateTTL(t *testing.T) {
+	sk := StoreKey{
+		Namespace: "canary-ns",
+		Name:      "test-canary",
+		Type:      service.HookRollback,
+	}
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	store.OpenGateWithTTL(t.Context(), sk, 20*time.Millisecond, "")
+	require.True(t, store.IsGateOpen(context.TODO(), sk), "gate should be opened before TTL")
+	require.Eventually(t, func() bool { return !store.IsGateOpen(context.TODO(), sk) }, time.Second, 5*time.Millisecond, "gate should revert to default after TTL")
+
+	// a manual change cancels the pending expiry
+	store.OpenGateWithTTL(t.Context(), sk, 20*time.Millisecond, "")
+	store.GateOpen(t.Context(), sk, "")
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, store.IsGateOpen(context.TODO(), sk), "manual open should cancel TTL")
+	require.NoError(t, store.Shutdown())
+}
+
+func TestExpiryNotifier(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback}
+	expired := make(chan string, 2)
+	SetExpiryNotifier(func(key StoreKey, open bool, ttl time.Duration) {
+		expired <- fmt.Sprintf("%s %s %s", key.String(), GateStatus(open), ttl)
+	})
+	defer SetExpiryNotifier(nil)
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	defer func() { _ = store.Shutdown() }()
+
+	// the revert at the end of the TTL is notified with the default state
+	store.OpenGateWithTTL(t.Context(), sk, 20*time.Millisecond, "alice")
+	select {
+	case msg := <-expired:
+		require.Equal(t, "canary-ns/test-canary=rollback closed 20ms", msg)
+	case <-time.After(time.Second):
+		require.Fail(t, "expiry should be notified")
+	}
+
+	// a manual close before the end of the TTL is not notified
+	store.OpenGateWithTTL(t.Context(), sk, 20*time.Millisecond, "alice")
+	store.GateClose(t.Context(), sk, "alice")
+	time.Sleep(50 * time.Millisecond)
+	require.Empty(t, expired)
+}
+
+func TestMemoryMessages(t *testing.T) {
+	sk := StoreKey{
+		Namespace: "canary-ns",
+		Name:      "test-canary",
+	}
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	require.Empty(t, store.GetMessages(context.TODO(), sk))
+	messages := map[string]string{"C123": "1700000000.000100"}
+	store.SaveMessages(context.TODO(), sk, messages)
+	require.Equal(t, messages, store.GetMessages(context.TODO(), sk))
+}
+
+func TestMemoryDefaultClosed(t *testing.T) {
+	testDefaultClosed(t, func() Store {
+		store, err := NewMemoryStore()
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestMemoryList(t *testing.T) {
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	testList(t, store)
+}
+
+func TestMemoryHistory(t *testing.T) {
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	testHistory(t, store)
+}
+
+func TestMemoryDeployments(t *testing.T) {
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	testDeployments(t, store)
+
+	// a key without a namespace, written before the keys were validated, is skipped
+	store.GateClose(t.Context(), StoreKey{Name: "orphan", Type: service.HookConfirmPromotion}, "")
+	keys, err := store.Deployments(t.Context())
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+}
+
+func TestMemoryPhase(t *testing.T) {
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	testPhase(t, store)
+}
+
+func TestMemoryRolledBackAt(t *testing.T) {
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	testRolledBackAt(t, store)
+}
+
+func TestMemoryDecision(t *testing.T) {
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	testDecision(t, store)
+}
+
+func TestMemoryChangedBy(t *testing.T) {
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	testChangedBy(t, store)
+}
+
+func TestMemoryClosedAt(t *testing.T) {
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	testClosedAt(t, store)
+}
+
+func TestMemoryReset(t *testing.T) {
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	testReset(t, store)
+}
+
+func TestMemoryCompareAndSet(t *testing.T) {
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	testCompareAndSet(t, store)
+}
+
+func TestMemoryContendedCompareAndSet(t *testing.T) {
+	store, err := NewMemoryStore()
+	require.NoError(t, err)
+	testContendedCompareAndSet(t, store)
+}
@@ -0,0 +1,665 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	piggysecv1alpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
+	"github.com/KongZ/canary-gate/service"
+	"github.com/rs/zerolog/log"
+)
+
+// sqlDialect is the SQL syntax of a database, which differs in placeholders, upserts and auto-increment columns
+type sqlDialect string
+
+const (
+	dialectPostgres sqlDialect = "postgres"
+	dialectMySQL    sqlDialect = "mysql"
+	dialectSQLite   sqlDialect = "sqlite"
+)
+
+// sqlDialects maps the names of the registered database/sql drivers to their dialect
+var sqlDialects = map[string]sqlDialect{
+	"postgres": dialectPostgres,
+	"pgx":      dialectPostgres,
+	"mysql":    dialectMySQL,
+	"sqlite":   dialectSQLite,
+	"sqlite3":  dialectSQLite,
+}
+
+// sqlMigrations creates the tables of the store. The migrations are applied once, in order, and recorded in the
+// schema_migrations table; a new migration is appended and never edited. {{id}} is the auto-increment primary key.
+var sqlMigrations = []string{
+	`CREATE TABLE gates (
+		namespace VARCHAR(253) NOT NULL,
+		name VARCHAR(253) NOT NULL,
+		type VARCHAR(64) NOT NULL,
+		open BOOLEAN NOT NULL,
+		changed_by VARCHAR(255) NOT NULL,
+		changed_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NULL,
+		closed_at TIMESTAMP NULL,
+		PRIMARY KEY (namespace, name, type)
+	)`,
+	`CREATE TABLE events (
+		namespace VARCHAR(253) NOT NULL,
+		name VARCHAR(253) NOT NULL,
+		status VARCHAR(64) NULL,
+		message TEXT NULL,
+		phase VARCHAR(64) NULL,
+		messages TEXT NULL,
+		PRIMARY KEY (namespace, name)
+	)`,
+	`CREATE TABLE gate_history (
+		id {{id}},
+		namespace VARCHAR(253) NOT NULL,
+		name VARCHAR(253) NOT NULL,
+		type VARCHAR(64) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		changed_by VARCHAR(255) NOT NULL,
+		reason TEXT NULL,
+		changed_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX gate_history_deployment ON gate_history (namespace, name, id)`,
+	`ALTER TABLE events ADD COLUMN rolled_back_at TIMESTAMP NULL`,
+	`CREATE TABLE gate_decisions (
+		namespace VARCHAR(253) NOT NULL,
+		name VARCHAR(253) NOT NULL,
+		type VARCHAR(64) NOT NULL,
+		approved BOOLEAN NOT NULL,
+		decided_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (namespace, name, type)
+	)`,
+}
+
+// SQLStore keeps the gates in a relational database through database/sql.
+// The gate history is kept in full for auditing, GetHistory returns the last changes.
+type SQLStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+	expiry  *expiryTimers
+}
+
+// NewSQLStore creates a new SQLStore instance, and creates or migrates the tables.
+// The driver must be registered by importing it, e.g. postgres or mysql. The MySQL DSN requires parseTime=true.
+func NewSQLStore(driver string, dsn string) (Store, error) {
+	dialect, ok := sqlDialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported SQL driver [%s]", driver)
+	}
+	if dsn == "" {
+		return nil, fmt.Errorf("DSN of the SQL store is required")
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open SQL database: %w", err)
+	}
+	store := &SQLStore{
+		db:      db,
+		dialect: dialect,
+		expiry:  &expiryTimers{},
+	}
+	ctx := context.Background()
+	if err := store.migrate(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := store.restoreExpiry(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// migrate applies the migrations which are not recorded yet
+func (s *SQLStore) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("unable to create schema_migrations table: %w", err)
+	}
+	var applied int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&applied); err != nil {
+		return fmt.Errorf("unable to read schema version: %w", err)
+	}
+	for i := applied; i < len(sqlMigrations); i++ {
+		err := s.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, s.ddl(sqlMigrations[i])); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), i+1)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("unable to apply migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// restoreExpiry schedules the pending expirations of the gates opened with a TTL
+func (s *SQLStore) restoreExpiry(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT namespace, name, type, expires_at FROM gates WHERE expires_at IS NOT NULL`)
+	if err != nil {
+		return fmt.Errorf("unable to read gate expirations: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var key StoreKey
+		var expiry time.Time
+		if err := rows.Scan(&key.Namespace, &key.Name, &key.Type, &expiry); err != nil {
+			return fmt.Errorf("unable to read gate expirations: %w", err)
+		}
+		s.scheduleExpiry(key, max(time.Until(expiry), 0))
+	}
+	return rows.Err()
+}
+
+func (s *SQLStore) GateOpen(ctx context.Context, key StoreKey, user string) {
+	s.expiry.cancel(key)
+	s.updateGate(ctx, key, true, user, "", time.Time{})
+	s.UpdateEvent(ctx, key, "Updated", gateMessage(key, GATE_OPEN, user))
+}
+
+func (s *SQLStore) RollbackGate(ctx context.Context, key StoreKey, user string, reason string) {
+	s.expiry.cancel(key)
+	s.updateGate(ctx, key, true, user, reason, time.Time{})
+	s.UpdateEvent(ctx, key, "Rollback", changeMessage(key, GATE_OPEN, user, reason))
+}
+
+func (s *SQLStore) OpenGateWithTTL(ctx context.Context, key StoreKey, ttl time.Duration, user string) {
+	s.expiry.cancel(key)
+	s.updateGate(ctx, key, true, user, "", time.Now().Add(ttl))
+	s.UpdateEvent(ctx, key, "Updated", gateMessage(key, GATE_OPEN, user))
+	s.scheduleExpiry(key, ttl)
+}
+
+func (s *SQLStore) GateClose(ctx context.Context, key StoreKey, user string) {
+	s.expiry.cancel(key)
+	s.updateGate(ctx, key, false, user, "", time.Time{})
+	s.UpdateEvent(ctx, key, "Updated", gateMessage(key, GATE_CLOSE, user))
+}
+
+// GateReset deletes the row of the gate, so it is read with its default value
+func (s *SQLStore) GateReset(ctx context.Context, key StoreKey, user string) {
+	s.expiry.cancel(key)
+	status := defaultText(key)
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(s.rebind(`DELETE FROM gates WHERE namespace = ? AND name = ? AND type = ?`), key.Namespace, key.Name, string(key.Type)); err != nil {
+			return err
+		}
+		return s.insertHistory(tx, key, newHistoryEntry(key, status, user, ""))
+	})
+	if err != nil {
+		log.Error().Msgf("Unable to reset gate [%s] %v.", key.String(), err)
+		return
+	}
+	s.UpdateEvent(ctx, key, "Reset", resetMessage(key, status, user))
+}
+
+// scheduleExpiry resets the gate to its default state after the ttl
+func (s *SQLStore) scheduleExpiry(key StoreKey, ttl time.Duration) {
+	s.expiry.schedule(key, ttl, func() {
+		s.updateGate(context.Background(), key, defaultValue(key), "", "", time.Time{})
+		s.UpdateEvent(context.Background(), key, "Expired", expiredMessage(key, ttl))
+		notifyExpired(key, ttl)
+	})
+}
+
+// updateGate saves the gate state with the user who changed it. A zero expiry removes the pending expiration.
+func (s *SQLStore) updateGate(ctx context.Context, key StoreKey, val bool, user string, reason string, expiry time.Time) {
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.setGate(tx, key, val, user, reason, expiry)
+	})
+	if err != nil {
+		log.Error().Msgf("Unable to update gate [%s] %v.", key.String(), err)
+	}
+}
+
+// setGate upserts the gate state and appends the change to the history
+func (s *SQLStore) setGate(tx *sql.Tx, key StoreKey, val bool, user string, reason string, expiry time.Time) error {
+	now := time.Now().UTC()
+	query := `INSERT INTO gates (namespace, name, type, open, changed_by, changed_at, expires_at, closed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?) ` +
+		s.upsert([]string{"namespace", "name", "type"}, []string{"open", "changed_by", "changed_at", "expires_at", "closed_at"})
+	if _, err := tx.Exec(s.rebind(query), key.Namespace, key.Name, string(key.Type), val, user, now, nullTime(expiry), closedAt(val, now)); err != nil {
+		return err
+	}
+	return s.insertHistory(tx, key, newHistoryEntry(key, GateStatus(val), user, reason))
+}
+
+// CompareAndSet writes the gate with a conditional update, so a concurrent change makes the update match no row.
+// A gate without a row is compared with its default state and inserted; a concurrent insert fails on the primary key.
+func (s *SQLStore) CompareAndSet(ctx context.Context, key StoreKey, expected, desired bool) (bool, error) {
+	swapped, err := s.compareAndSet(ctx, key, expected, desired)
+	if err != nil {
+		// the row was inserted by a concurrent change, which is compared by the conditional update
+		if exists, _ := s.gateExists(ctx, key); exists {
+			swapped, err = s.compareAndSet(ctx, key, expected, desired)
+		}
+	}
+	if err != nil || !swapped {
+		return false, err
+	}
+	s.expiry.cancel(key)
+	s.UpdateEvent(ctx, key, "Updated", gateMessage(key, GateStatus(desired), ""))
+	return true, nil
+}
+
+func (s *SQLStore) compareAndSet(ctx context.Context, key StoreKey, expected, desired bool) (bool, error) {
+	swapped := false
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now().UTC()
+		// the row is updated whenever the gate matches, even when expected and desired are equal
+		result, err := tx.ExecContext(ctx, s.rebind(`UPDATE gates SET open = ?, changed_by = ?, changed_at = ?, expires_at = NULL, closed_at = ?
+			WHERE namespace = ? AND name = ? AND type = ? AND open = ?`),
+			desired, "", now, closedAt(desired, now), key.Namespace, key.Name, string(key.Type), expected)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			var open bool
+			err := tx.QueryRowContext(ctx, s.rebind(`SELECT open FROM gates WHERE namespace = ? AND name = ? AND type = ?`),
+				key.Namespace, key.Name, string(key.Type)).Scan(&open)
+			if err == nil {
+				// MySQL reports no affected rows when the values are unchanged
+				if open != expected || expected != desired {
+					return nil
+				}
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			} else if defaultValue(key) != expected {
+				return nil
+			} else if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO gates (namespace, name, type, open, changed_by, changed_at, expires_at, closed_at) VALUES (?, ?, ?, ?, ?, ?, NULL, ?)`),
+				key.Namespace, key.Name, string(key.Type), desired, "", now, closedAt(desired, now)); err != nil {
+				return err
+			}
+		}
+		swapped = true
+		return s.insertHistory(tx, key, newHistoryEntry(key, GateStatus(desired), "", ""))
+	})
+	return swapped, err
+}
+
+// gateExists reports whether the gate has a row
+func (s *SQLStore) gateExists(ctx context.Context, key StoreKey) (bool, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM gates WHERE namespace = ? AND name = ? AND type = ?`),
+		key.Namespace, key.Name, string(key.Type)).Scan(&count)
+	return count > 0, err
+}
+
+func (s *SQLStore) GetChangedBy(ctx context.Context, key StoreKey) string {
+	var user string
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT changed_by FROM gates WHERE namespace = ? AND name = ? AND type = ?`),
+		key.Namespace, key.Name, string(key.Type)).Scan(&user)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Error().Msgf("Unable to read gate [%s] %v.", key.String(), err)
+	}
+	return user
+}
+
+// Exists always reports true since the SQL store creates the rows on the first change
+func (s *SQLStore) Exists(ctx context.Context, key StoreKey) (bool, error) {
+	return true, nil
+}
+
+func (s *SQLStore) GetClosedAt(ctx context.Context, key StoreKey) time.Time {
+	var closed sql.NullTime
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT closed_at FROM gates WHERE namespace = ? AND name = ? AND type = ?`),
+		key.Namespace, key.Name, string(key.Type)).Scan(&closed)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Error().Msgf("Unable to read gate [%s] %v.", key.String(), err)
+	}
+	if !closed.Valid {
+		return time.Time{}
+	}
+	return closed.Time
+}
+
+func (s *SQLStore) IsGateOpen(ctx context.Context, key StoreKey) bool {
+	open, err := s.GateState(ctx, key)
+	if err != nil {
+		log.Error().Msgf("Unable to read gate [%s] %v.", key.String(), err)
+		return defaultValue(key)
+	}
+	return open
+}
+
+func (s *SQLStore) GateState(ctx context.Context, key StoreKey) (bool, error) {
+	var open bool
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT open FROM gates WHERE namespace = ? AND name = ? AND type = ?`),
+		key.Namespace, key.Name, string(key.Type)).Scan(&open)
+	if errors.Is(err, sql.ErrNoRows) {
+		return defaultValue(key), nil
+	}
+	if err != nil {
+		return defaultValue(key), &UnavailableError{Key: key, Err: err}
+	}
+	return open, nil
+}
+
+func (s *SQLStore) List(ctx context.Context, namespace string, name string) (map[service.HookType]bool, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT type, open FROM gates WHERE namespace = ? AND name = ?`), namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	gates := defaultGates(namespace, name)
+	for rows.Next() {
+		var t service.HookType
+		var open bool
+		if err := rows.Scan(&t, &open); err != nil {
+			return nil, err
+		}
+		if _, ok := gates[t]; ok {
+			gates[t] = open
+		}
+	}
+	return gates, rows.Err()
+}
+
+// Deployments returns the deployments of the gates and the events tables. The malformed rows are skipped.
+func (s *SQLStore) Deployments(ctx context.Context) ([]StoreKey, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT namespace, name FROM gates UNION SELECT namespace, name FROM events ORDER BY namespace, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	keys := []StoreKey{}
+	for rows.Next() {
+		var namespace, name string
+		if err := rows.Scan(&namespace, &name); err != nil {
+			return nil, err
+		}
+		if key, err := NewStoreKey(namespace, name, ""); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, rows.Err()
+}
+
+func (s *SQLStore) UpdateEvent(ctx context.Context, key StoreKey, status string, message string) {
+	query := `INSERT INTO events (namespace, name, status, message) VALUES (?, ?, ?, ?) ` +
+		s.upsert([]string{"namespace", "name"}, []string{"status", "message"})
+	if _, err := s.db.ExecContext(ctx, s.rebind(query), key.Namespace, key.Name, status, message); err != nil {
+		log.Error().Msgf("Unable to update event of [%s/%s] %v.", key.Namespace, key.Name, err)
+	}
+}
+
+func (s *SQLStore) GetLastEvent(ctx context.Context, key StoreKey) string {
+	return s.eventColumn(ctx, key, "message")
+}
+
+func (s *SQLStore) GetPhase(ctx context.Context, key StoreKey) string {
+	return s.eventColumn(ctx, key, "phase")
+}
+
+// UpdatePhase reads and writes the phase in a transaction.
+func (s *SQLStore) UpdatePhase(ctx context.Context, key StoreKey, phase string) string {
+	var last sql.NullString
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, s.rebind(`SELECT phase FROM events WHERE namespace = ? AND name = ?`), key.Namespace, key.Name).Scan(&last)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if last.String == phase {
+			return nil
+		}
+		query := `INSERT INTO events (namespace, name, phase) VALUES (?, ?, ?) ` + s.upsert([]string{"namespace", "name"}, []string{"phase"})
+		_, err = tx.ExecContext(ctx, s.rebind(query), key.Namespace, key.Name, phase)
+		return err
+	})
+	if err != nil {
+		log.Error().Msgf("Unable to update phase of [%s/%s] %v.", key.Namespace, key.Name, err)
+	}
+	return last.String
+}
+
+func (s *SQLStore) SetRolledBackAt(ctx context.Context, key StoreKey, at time.Time) {
+	query := `INSERT INTO events (namespace, name, rolled_back_at) VALUES (?, ?, ?) ` + s.upsert([]string{"namespace", "name"}, []string{"rolled_back_at"})
+	if _, err := s.db.ExecContext(ctx, s.rebind(query), key.Namespace, key.Name, at.UTC()); err != nil {
+		log.Error().Msgf("Unable to save rollback of [%s/%s] %v.", key.Namespace, key.Name, err)
+	}
+}
+
+func (s *SQLStore) GetRolledBackAt(ctx context.Context, key StoreKey) time.Time {
+	var rolledBack sql.NullTime
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT rolled_back_at FROM events WHERE namespace = ? AND name = ?`),
+		key.Namespace, key.Name).Scan(&rolledBack)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Error().Msgf("Unable to read rollback of [%s/%s] %v.", key.Namespace, key.Name, err)
+	}
+	if !rolledBack.Valid {
+		return time.Time{}
+	}
+	return rolledBack.Time
+}
+
+func (s *SQLStore) SetDecision(ctx context.Context, key StoreKey, decision Decision) {
+	query := `INSERT INTO gate_decisions (namespace, name, type, approved, decided_at) VALUES (?, ?, ?, ?, ?) ` +
+		s.upsert([]string{"namespace", "name", "type"}, []string{"approved", "decided_at"})
+	if _, err := s.db.ExecContext(ctx, s.rebind(query), key.Namespace, key.Name, string(key.Type), decision.Approved, decision.Time.UTC()); err != nil {
+		log.Error().Msgf("Unable to save decision of gate [%s] %v.", key.String(), err)
+	}
+}
+
+func (s *SQLStore) GetDecision(ctx context.Context, key StoreKey) Decision {
+	var decision Decision
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT approved, decided_at FROM gate_decisions WHERE namespace = ? AND name = ? AND type = ?`),
+		key.Namespace, key.Name, string(key.Type)).Scan(&decision.Approved, &decision.Time)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Error().Msgf("Unable to read decision of gate [%s] %v.", key.String(), err)
+		}
+		return Decision{}
+	}
+	return decision
+}
+
+// SaveMessages stores the IDs of the messages as a JSON object
+func (s *SQLStore) SaveMessages(ctx context.Context, key StoreKey, messages map[string]string) {
+	data, err := json.Marshal(messages)
+	if err != nil {
+		log.Error().Msgf("Unable to encode messages of [%s/%s] %v.", key.Namespace, key.Name, err)
+		return
+	}
+	query := `INSERT INTO events (namespace, name, messages) VALUES (?, ?, ?) ` + s.upsert([]string{"namespace", "name"}, []string{"messages"})
+	if _, err := s.db.ExecContext(ctx, s.rebind(query), key.Namespace, key.Name, string(data)); err != nil {
+		log.Error().Msgf("Unable to save messages of [%s/%s] %v.", key.Namespace, key.Name, err)
+	}
+}
+
+func (s *SQLStore) GetMessages(ctx context.Context, key StoreKey) map[string]string {
+	messages := map[string]string{}
+	if data := s.eventColumn(ctx, key, "messages"); data != "" {
+		if err := json.Unmarshal([]byte(data), &messages); err != nil {
+			log.Error().Msgf("Unable to decode messages of [%s/%s] %v.", key.Namespace, key.Name, err)
+		}
+	}
+	return messages
+}
+
+// eventColumn reads a column of the events row of the deployment
+func (s *SQLStore) eventColumn(ctx context.Context, key StoreKey, column string) string {
+	var value sql.NullString
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+column+` FROM events WHERE namespace = ? AND name = ?`), key.Namespace, key.Name).Scan(&value)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Error().Msgf("Unable to read %s of [%s/%s] %v.", column, key.Namespace, key.Name, err)
+	}
+	return value.String
+}
+
+func (s *SQLStore) AppendHistory(ctx context.Context, key StoreKey, entry HistoryEntry) {
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.insertHistory(tx, key, entry)
+	})
+	if err != nil {
+		log.Error().Msgf("Unable to append history of [%s/%s] %v.", key.Namespace, key.Name, err)
+	}
+}
+
+func (s *SQLStore) insertHistory(tx *sql.Tx, key StoreKey, entry HistoryEntry) error {
+	_, err := tx.Exec(s.rebind(`INSERT INTO gate_history (namespace, name, type, status, changed_by, reason, changed_at) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		key.Namespace, key.Name, string(entry.Type), entry.Status, entry.User, entry.Reason, entry.Time.UTC())
+	return err
+}
+
+// GetHistory returns the last historyLimit changes of the deployment, the oldest first.
+func (s *SQLStore) GetHistory(ctx context.Context, key StoreKey) []HistoryEntry {
+	history := []HistoryEntry{}
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT type, status, changed_by, reason, changed_at FROM gate_history
+		WHERE namespace = ? AND name = ? ORDER BY id DESC LIMIT `+strconv.Itoa(historyLimit)), key.Namespace, key.Name)
+	if err != nil {
+		log.Error().Msgf("Unable to read history of [%s/%s] %v.", key.Namespace, key.Name, err)
+		return history
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var entry HistoryEntry
+		var reason sql.NullString
+		if err := rows.Scan(&entry.Type, &entry.Status, &entry.User, &reason, &entry.Time); err != nil {
+			log.Error().Msgf("Unable to read history of [%s/%s] %v.", key.Namespace, key.Name, err)
+			return []HistoryEntry{}
+		}
+		entry.Reason = reason.String
+		entry.Time = entry.Time.UTC()
+		history = append(history, entry)
+	}
+	slices.Reverse(history)
+	return history
+}
+
+// Approve does not record the user, multiple approvers are only supported by the CanaryGate store.
+func (s *SQLStore) Approve(ctx context.Context, key StoreKey, user string) (Approval, error) {
+	return singleApproval(user), nil
+}
+
+func (s *SQLStore) GetApproval(ctx context.Context, key StoreKey) Approval {
+	return Approval{Required: 1}
+}
+
+// ConsumeGate does not close the gate, since only the CanaryGate store has gates which require an approval for each use.
+func (s *SQLStore) ConsumeGate(ctx context.Context, key StoreKey) (bool, error) {
+	return false, nil
+}
+
+// GetDependencies returns the default dependencies, which can only be overridden by the CanaryGate store.
+func (s *SQLStore) GetDependencies(ctx context.Context, key StoreKey) []service.HookType {
+	return gateDependencies(&piggysecv1alpha1.CanaryGateSpec{}, key)
+}
+
+// Health pings the database.
+func (s *SQLStore) Health(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// WaitForSync returns at once since the gates are read from the database
+func (s *SQLStore) WaitForSync(ctx context.Context) error {
+	return nil
+}
+
+func (s *SQLStore) Shutdown() error {
+	s.expiry.stop()
+	return s.db.Close()
+}
+
+// inTx runs fn in a transaction, which is committed when fn returns no error and rolled back otherwise
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// rebind replaces the ? placeholders of the query with the placeholders of the dialect
+func (s *SQLStore) rebind(query string) string {
+	if s.dialect != dialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// upsert returns the clause which updates the columns of the row when a row with the same keys exists
+func (s *SQLStore) upsert(keys []string, columns []string) string {
+	set := make([]string, len(columns))
+	for i, c := range columns {
+		if s.dialect == dialectMySQL {
+			set[i] = fmt.Sprintf("%s = VALUES(%s)", c, c)
+		} else {
+			set[i] = fmt.Sprintf("%s = excluded.%s", c, c)
+		}
+	}
+	if s.dialect == dialectMySQL {
+		return "ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(keys, ", "), strings.Join(set, ", "))
+}
+
+// ddl replaces the column types of a migration which differ between the dialects
+func (s *SQLStore) ddl(migration string) string {
+	id := "BIGSERIAL PRIMARY KEY"
+	switch s.dialect {
+	case dialectMySQL:
+		id = "BIGINT AUTO_INCREMENT PRIMARY KEY"
+	case dialectSQLite:
+		id = "INTEGER PRIMARY KEY AUTOINCREMENT"
+	}
+	return strings.ReplaceAll(migration, "{{id}}", id)
+}
+
+// nullTime returns NULL for the zero time
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+// closedAt returns the time when a closed gate was closed, or NULL for an opened gate
+func closedAt(open bool, now time.Time) sql.NullTime {
+	return sql.NullTime{Time: now, Valid: !open}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+// newTestSQLStore creates a SQLStore on a SQLite database file, so every connection of the pool sees the same data
+func newTestSQLStore(t *testing.T) (Store, string) {
+	dsn := filepath.Join(t.TempDir(), "canary-gate.db") + "?_pragma=busy_timeout(5000)"
+	store, err := NewSQLStore("sqlite", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Shutdown() })
+	return store, dsn
+}
+
+func TestSQLGate(t *testing.T) {
+	for _, v := range typeCases {
+		sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: v.serviceType}
+		store, dsn := newTestSQLStore(t)
+		require.Equalf(t, v.expectedInit, store.IsGateOpen(context.TODO(), sk), "[%s] [default] gate", v.serviceType)
+		store.GateClose(t.Context(), sk, "")
+		require.Equalf(t, v.expectedAfterClose, store.IsGateOpen(context.TODO(), sk), "[%s] [close] gate", v.serviceType)
+		store.GateOpen(t.Context(), sk, "")
+		require.Equalf(t, v.expectedAfterOpen, store.IsGateOpen(context.TODO(), sk), "[%s] [open] gate", v.serviceType)
+		require.NoError(t, store.Shutdown())
+
+		// the state is kept in the database, and the migrations are not applied again
+		store, err := NewSQLStore("sqlite", dsn)
+		require.NoError(t, err)
+		require.Equalf(t, v.expectedAfterOpen, store.IsGateOpen(context.TODO(), sk), "[%s] gate should be loaded from the database", v.serviceType)
+		require.NoError(t, store.Shutdown())
+	}
+}
+
+func TestSQLGateEvent(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary"}
+	store, _ := newTestSQLStore(t)
+	require.Empty(t, store.GetLastEvent(context.TODO(), sk))
+	store.UpdateEvent(context.TODO(), sk, "status", "Test event message")
+	require.Equal(t, "Test event message", store.GetLastEvent(context.TODO(), sk))
+	// the phase and the messages do not overwrite the event
+	store.UpdatePhase(context.TODO(), sk, string(service.PhaseProgressing))
+	store.SaveMessages(context.TODO(), sk, map[string]string{"C123": "1700000000.000100"})
+	require.Equal(t, "Test event message", store.GetLastEvent(context.TODO(), sk))
+}
+
+func TestSQLGateTTL(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookRollback}
+	store, dsn := newTestSQLStore(t)
+	store.OpenGateWithTTL(t.Context(), sk, 20*time.Millisecond, "")
+	require.True(t, store.IsGateOpen(context.TODO(), sk), "gate should be opened before TTL")
+	require.Eventually(t, func() bool { return !store.IsGateOpen(context.TODO(), sk) }, time.Second, 5*time.Millisecond, "gate should revert to default after TTL")
+
+	// a pending expiry is restored from the database
+	store.OpenGateWithTTL(t.Context(), sk, 100*time.Millisecond, "")
+	require.NoError(t, store.Shutdown())
+	store, err := NewSQLStore("sqlite", dsn)
+	require.NoError(t, err)
+	require.True(t, store.IsGateOpen(context.TODO(), sk), "gate should be opened before TTL")
+	require.Eventually(t, func() bool { return !store.IsGateOpen(context.TODO(), sk) }, time.Second, 5*time.Millisecond, "restored gate should revert to default after TTL")
+	require.NoError(t, store.Shutdown())
+}
+
+func TestSQLMessages(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary"}
+	store, _ := newTestSQLStore(t)
+	require.Empty(t, store.GetMessages(context.TODO(), sk))
+	messages := map[string]string{"C123": "1700000000.000100"}
+	store.SaveMessages(context.TODO(), sk, messages)
+	require.Equal(t, messages, store.GetMessages(context.TODO(), sk))
+}
+
+func TestSQLDefaultClosed(t *testing.T) {
+	testDefaultClosed(t, func() Store {
+		store, _ := newTestSQLStore(t)
+		return store
+	})
+}
+
+func TestSQLList(t *testing.T) {
+	store, _ := newTestSQLStore(t)
+	testList(t, store)
+}
+
+func TestSQLHistory(t *testing.T) {
+	store, _ := newTestSQLStore(t)
+	testHistory(t, store)
+}
+
+func TestSQLDeployments(t *testing.T) {
+	store, _ := newTestSQLStore(t)
+	testDeployments(t, store)
+}
+
+func TestSQLPhase(t *testing.T) {
+	store, _ := newTestSQLStore(t)
+	testPhase(t, store)
+}
+
+func TestSQLRolledBackAt(t *testing.T) {
+	store, _ := newTestSQLStore(t)
+	testRolledBackAt(t, store)
+}
+
+func TestSQLDecision(t *testing.T) {
+	store, _ := newTestSQLStore(t)
+	testDecision(t, store)
+}
+
+func TestSQLChangedBy(t *testing.T) {
+	store, _ := newTestSQLStore(t)
+	testChangedBy(t, store)
+}
+
+func TestSQLClosedAt(t *testing.T) {
+	store, _ := newTestSQLStore(t)
+	testClosedAt(t, store)
+}
+
+func TestSQLReset(t *testing.T) {
+	store, _ := newTestSQLStore(t)
+	testReset(t, store)
+}
+
+func TestSQLCompareAndSet(t *testing.T) {
+	store, _ := newTestSQLStore(t)
+	testCompareAndSet(t, store)
+}
+
+func TestSQLContendedCompareAndSet(t *testing.T) {
+	store, _ := newTestSQLStore(t)
+	testContendedCompareAndSet(t, store)
+}
+
+func TestSQLCancelledWrite(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	store, _ := newTestSQLStore(t)
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	// the writes of a cancelled request are abandoned
+	store.GateClose(ctx, sk, "alice")
+	require.True(t, store.IsGateOpen(context.TODO(), sk), "gate should not be closed by a cancelled request")
+	require.Empty(t, store.GetHistory(context.TODO(), sk))
+	_, err := store.CompareAndSet(ctx, sk, true, false)
+	require.ErrorIs(t, err, context.Canceled)
+	require.True(t, store.IsGateOpen(context.TODO(), sk))
+}
+
+func TestSQLInvalid(t *testing.T) {
+	_, err := NewSQLStore("oracle", "dsn")
+	require.Error(t, err)
+	_, err = NewSQLStore("sqlite", "")
+	require.Error(t, err)
+
+	store, _ := newTestSQLStore(t)
+	require.NoError(t, store.Health(context.TODO()))
+	require.NoError(t, store.Shutdown())
+	require.Error(t, store.Health(context.TODO()))
+}
+
+func TestSQLDialect(t *testing.T) {
+	postgres := &SQLStore{dialect: dialectPostgres}
+	require.Equal(t, "SELECT a FROM t WHERE b = $1 AND c = $2", postgres.rebind("SELECT a FROM t WHERE b = ? AND c = ?"))
+	require.Equal(t, "ON CONFLICT (namespace, name) DO UPDATE SET phase = excluded.phase", postgres.upsert([]string{"namespace", "name"}, []string{"phase"}))
+	require.Contains(t, postgres.ddl(sqlMigrations[2]), "id BIGSERIAL PRIMARY KEY")
+
+	mysql := &SQLStore{dialect: dialectMySQL}
+	require.Equal(t, "SELECT a FROM t WHERE b = ?", mysql.rebind("SELECT a FROM t WHERE b = ?"))
+	require.Equal(t, "ON DUPLICATE KEY UPDATE phase = VALUES(phase)", mysql.upsert([]string{"namespace", "name"}, []string{"phase"}))
+	require.Contains(t, mysql.ddl(sqlMigrations[2]), "id BIGINT AUTO_INCREMENT PRIMARY KEY")
+}
+
+func TestSQLGateStateUnavailable(t *testing.T) {
+	sk := StoreKey{Namespace: "canary-ns", Name: "test-canary", Type: service.HookConfirmPromotion}
+	store, _ := newTestSQLStore(t)
+	store.GateClose(t.Context(), sk, "")
+	open, err := store.GateState(t.Context(), sk)
+	require.NoError(t, err)
+	require.False(t, open)
+
+	// the closed gate is not answered as opened by default without an error
+	require.NoError(t, store.Shutdown())
+	open, err = store.GateState(t.Context(), sk)
+	require.ErrorIs(t, err, ErrStoreUnavailable)
+	require.True(t, open)
+	require.True(t, store.IsGateOpen(t.Context(), sk))
+}
@@ -17,8 +17,16 @@ package store
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
+	piggysecv1alpha1 "github.com/KongZ/canary-gate/api/v1alpha1"
 	"github.com/KongZ/canary-gate/service"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // Canary Gate Store constants when gate is open
@@ -27,6 +35,33 @@ const GATE_OPEN = "opened"
 // Canary Gate Store constants when gate is closed
 const GATE_CLOSE = "closed"
 
+// messagesKey is the store key of the notification message IDs
+const messagesKey = "messages"
+
+// phaseKey is the name of the last recorded phase of the canary in the store
+const phaseKey = "phase"
+
+// rolledBackAtKey is the store key of the time when the canary was last rolled back
+const rolledBackAtKey = "rolled-back-at"
+
+// historyKey is the store key of the gate change history
+const historyKey = "history"
+
+// historyLimit is the maximum number of gate changes kept in the history
+const historyLimit = 50
+
+// GateTypes lists all gate types in the order of the canary lifecycle.
+var GateTypes = []service.HookType{
+	service.HookConfirmRollout,
+	service.HookPreRollout,
+	service.HookRollout,
+	service.HookConfirmTrafficIncrease,
+	service.HookConfirmPromotion,
+	service.HookConfirmFinalize,
+	service.HookPostRollout,
+	service.HookRollback,
+}
+
 // StoreKey represents a unique key for a gate in the store.
 type StoreKey struct {
 	// Namespace is the namespace of the gate.
@@ -37,25 +72,269 @@ type StoreKey struct {
 	Type service.HookType
 }
 
+// KeyError explains why a field of a StoreKey is invalid
+type KeyError struct {
+	// Field is the invalid field, namespace, name or type
+	Field string
+	// Reason explains why the field is invalid
+	Reason string
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// ErrStoreUnavailable is matched by the errors of the stores whose backend cannot be read, which is different from
+// a gate which is not stored and has its default state
+var ErrStoreUnavailable = errors.New("store is unavailable")
+
+// UnavailableError is a failure of the backend of a store to read the gate of a key
+type UnavailableError struct {
+	// Key of the gate which is read
+	Key StoreKey
+	// Err is the error of the backend
+	Err error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("unable to read gate [%s]: %v", e.Key.String(), e.Err)
+}
+
+// Unwrap returns the error of the backend
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes the error match ErrStoreUnavailable
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrStoreUnavailable
+}
+
+// NewStoreKey returns the key of a gate with the namespace and name trimmed and the type trimmed and lowercased, and
+// the error of Validate. An empty type returns the key of the deployment.
+func NewStoreKey(namespace, name string, t service.HookType) (StoreKey, error) {
+	key := StoreKey{
+		Namespace: strings.TrimSpace(namespace),
+		Name:      strings.TrimSpace(name),
+		Type:      NormalizeGate(t),
+	}
+	return key, key.Validate()
+}
+
+// NormalizeGate returns the gate type trimmed and lowercased
+func NormalizeGate(t service.HookType) service.HookType {
+	return service.HookType(strings.ToLower(strings.TrimSpace(string(t))))
+}
+
+// Validate returns a *KeyError when the namespace is not a Kubernetes namespace, the name is not a Kubernetes object
+// name, or the type is set and is not a gate. The keys of the deployments have no type.
+func (k StoreKey) Validate() error {
+	if k.Namespace == "" {
+		return &KeyError{Field: "namespace", Reason: "required"}
+	}
+	if errs := validation.IsDNS1123Label(k.Namespace); len(errs) > 0 {
+		return &KeyError{Field: "namespace", Reason: errs[0]}
+	}
+	if k.Name == "" {
+		return &KeyError{Field: "name", Reason: "required"}
+	}
+	if errs := validation.IsDNS1123Subdomain(k.Name); len(errs) > 0 {
+		return &KeyError{Field: "name", Reason: errs[0]}
+	}
+	if k.Type != "" && !slices.Contains(GateTypes, k.Type) {
+		return &KeyError{Field: "type", Reason: fmt.Sprintf("unknown gate [%s]", k.Type)}
+	}
+	return nil
+}
+
+// parseKey returns the key of the deployment of a stored key in the form of "<namespace>:<name>[:<suffix>]", or
+// false when the stored key is malformed, e.g. ":name:type" written before the keys were validated
+func parseKey(stored string) (StoreKey, bool) {
+	parts := strings.SplitN(stored, ":", 3)
+	if len(parts) < 2 {
+		return StoreKey{}, false
+	}
+	key, err := NewStoreKey(parts[0], parts[1], "")
+	return key, err == nil
+}
+
+// HistoryEntry records an open or close of a gate.
+type HistoryEntry struct {
+	// Time of the change
+	Time time.Time `json:"time"`
+	// Type is the type of the gate
+	Type service.HookType `json:"type"`
+	// Status of the gate after the change
+	Status string `json:"status"`
+	// User who changed the gate
+	User string `json:"user,omitempty"`
+	// Reason of a manual rollback
+	Reason string `json:"reason,omitempty"`
+}
+
+// Decisions of the webhook of a gate
+const (
+	DecisionApproved = "approved"
+	DecisionRejected = "rejected"
+)
+
+// Decision is the last answer of the webhook of a gate
+type Decision struct {
+	// Approved is true when the webhook was approved
+	Approved bool `json:"approved"`
+	// Time when the webhook was answered
+	Time time.Time `json:"time"`
+}
+
+// IsZero reports whether the webhook of the gate was never answered
+func (d Decision) IsZero() bool {
+	return d.Time.IsZero()
+}
+
+// String returns the decision, approved or rejected
+func (d Decision) String() string {
+	if d.Approved {
+		return DecisionApproved
+	}
+	return DecisionRejected
+}
+
+// Approval holds the approvers of a gate which is not opened yet.
+type Approval struct {
+	// Approvers are the distinct users who approved the gate
+	Approvers []string `json:"approvers,omitempty"`
+	// Required is the number of approvers which opens the gate
+	Required int `json:"required"`
+}
+
+// Approved returns true when the number of approvers reaches the required number.
+func (a Approval) Approved() bool {
+	return len(a.Approvers) >= a.Required
+}
+
+// ChangedBy returns the approvers as the user who opened the gate.
+func (a Approval) ChangedBy() string {
+	return strings.Join(a.Approvers, ", ")
+}
+
 // Store is an interface that defines methods for managing gate states.
 type Store interface {
-	// GateOpen opens the gate for a given key.
-	GateOpen(key StoreKey)
-	// GateClose closes the gate for a given key.
-	GateClose(key StoreKey)
-	// IsGateOpen checks if the gate is open for a given key.
-	IsGateOpen(key StoreKey) bool
+	// GateOpen opens the gate for a given key. The user is optional and records who opened the gate.
+	// The write is abandoned when the context is cancelled.
+	GateOpen(ctx context.Context, key StoreKey, user string)
+	// OpenGateWithTTL opens the gate for a given key and reverts it to the default value after ttl.
+	// The revert does not use the context, it runs after the caller has returned.
+	OpenGateWithTTL(ctx context.Context, key StoreKey, ttl time.Duration, user string)
+	// GateClose closes the gate for a given key. The user is optional and records who closed the gate.
+	// The write is abandoned when the context is cancelled.
+	GateClose(ctx context.Context, key StoreKey, user string)
+	// GateReset removes the stored state of the gate for a given key, so the gate follows its default state again.
+	// The user is optional and is recorded in the history.
+	GateReset(ctx context.Context, key StoreKey, user string)
+	// RollbackGate opens the rollback gate for a manual rollback and records the reason with the change and the event.
+	RollbackGate(ctx context.Context, key StoreKey, user string, reason string)
+	// IsGateOpen checks if the gate is open for a given key. The default state is returned when the store fails.
+	IsGateOpen(ctx context.Context, key StoreKey) bool
+	// GateState checks if the gate is open for a given key like IsGateOpen, but returns an UnavailableError when the
+	// backend of the store cannot be read. A gate which is not stored has its default state without an error.
+	GateState(ctx context.Context, key StoreKey) (bool, error)
+	// CompareAndSet sets the gate to desired only if its current state is expected, and returns whether it was set.
+	// The check and the write are atomic; a concurrent change makes it compare against the new state.
+	CompareAndSet(ctx context.Context, key StoreKey, expected, desired bool) (bool, error)
+	// GetChangedBy returns the user who last opened or closed the gate for a given key.
+	GetChangedBy(ctx context.Context, key StoreKey) string
+	// List returns the states of all gate types of a deployment in one call.
+	List(ctx context.Context, namespace string, name string) (map[service.HookType]bool, error)
+	// Deployments returns the keys of the deployments which have a state in the store, without a gate type.
+	Deployments(ctx context.Context) ([]StoreKey, error)
 	// Shutdown is called to clean up resources used by the store.
 	Shutdown() error
+	// Health returns an error when the backend of the store is unreachable.
+	Health(ctx context.Context) error
+	// WaitForSync blocks until the caches of the store are synced, and returns an error when the context is done
+	// before. The stores without a cache return at once.
+	WaitForSync(ctx context.Context) error
 	// UpdateEvent updates the event message for a given key.
 	UpdateEvent(ctx context.Context, key StoreKey, status string, message string)
 	// Returns the last event message for a given key.
 	GetLastEvent(ctx context.Context, key StoreKey) string
+	// UpdatePhase records the phase of the canary for a given key and returns the previously recorded phase.
+	UpdatePhase(ctx context.Context, key StoreKey, phase string) string
+	// GetPhase returns the last recorded phase of the canary for a given key.
+	GetPhase(ctx context.Context, key StoreKey) string
+	// SaveMessages stores the IDs of the notification messages sent for a given key.
+	SaveMessages(ctx context.Context, key StoreKey, messages map[string]string)
+	// GetMessages returns the IDs of the notification messages sent for a given key.
+	GetMessages(ctx context.Context, key StoreKey) map[string]string
+	// AppendHistory records a gate change. Only the last changes are kept.
+	AppendHistory(ctx context.Context, key StoreKey, entry HistoryEntry)
+	// GetHistory returns the gate changes of a deployment, the oldest first.
+	GetHistory(ctx context.Context, key StoreKey) []HistoryEntry
+	// Approve records the user as an approver of the gate for a given key and returns the approvals.
+	// It does not open the gate; the caller opens it once the approval is approved.
+	Approve(ctx context.Context, key StoreKey, user string) (Approval, error)
+	// GetApproval returns the pending approvals of the gate for a given key.
+	GetApproval(ctx context.Context, key StoreKey) Approval
+	// GetDependencies returns the gates which must be opened before the gate for a given key is opened.
+	GetDependencies(ctx context.Context, key StoreKey) []service.HookType
+	// ConsumeGate closes the opened gate for a given key after its webhook has used the approval, when the gate
+	// requires an approval for each use. It returns whether the gate was closed.
+	ConsumeGate(ctx context.Context, key StoreKey) (bool, error)
+	// Exists reports whether the deployment of a given key has a gate resource. The stores which create their
+	// resources on the first change always report true.
+	Exists(ctx context.Context, key StoreKey) (bool, error)
+	// GetClosedAt returns the time when the gate for a given key was last closed, or the zero time when it is opened
+	// or was never closed.
+	GetClosedAt(ctx context.Context, key StoreKey) time.Time
+	// SetRolledBackAt records the time when the canary for a given key was rolled back.
+	SetRolledBackAt(ctx context.Context, key StoreKey, at time.Time)
+	// GetRolledBackAt returns the time when the canary for a given key was last rolled back, or the zero time when it
+	// was never rolled back.
+	GetRolledBackAt(ctx context.Context, key StoreKey) time.Time
+	// SetDecision records the answer of the webhook of the gate for a given key.
+	SetDecision(ctx context.Context, key StoreKey, decision Decision)
+	// GetDecision returns the last answer of the webhook of the gate for a given key, or the zero Decision when the
+	// webhook was never answered.
+	GetDecision(ctx context.Context, key StoreKey) Decision
+}
+
+// defaultClosed lists the gates which are closed until they are opened
+var defaultClosed = []service.HookType{service.HookRollback}
+
+// SetDefaultClosed sets the gates which are closed by default in addition to the rollback gate.
+// It is called once at startup, before the stores are created.
+func SetDefaultClosed(gates []service.HookType) {
+	defaultClosed = append([]service.HookType{service.HookRollback}, gates...)
+}
+
+// ParseGateTypes parses the names of gates, and rejects the names which are not gates
+func ParseGateTypes(names []string) ([]service.HookType, error) {
+	gates := make([]service.HookType, 0, len(names))
+	for _, name := range names {
+		gate := NormalizeGate(service.HookType(name))
+		if gate == "" {
+			continue
+		}
+		if !slices.Contains(GateTypes, gate) {
+			return nil, fmt.Errorf("unknown gate [%s]", name)
+		}
+		gates = append(gates, gate)
+	}
+	return gates, nil
 }
 
 // defaultValue returns the default gate status based on the hook type.
 func defaultValue(key StoreKey) bool {
-	return key.Type != service.HookRollback
+	return !slices.Contains(defaultClosed, key.Type)
+}
+
+// defaultGates returns the default states of all gate types of a deployment.
+func defaultGates(namespace string, name string) map[service.HookType]bool {
+	gates := make(map[service.HookType]bool, len(GateTypes))
+	for _, t := range GateTypes {
+		gates[t] = defaultValue(StoreKey{Namespace: namespace, Name: name, Type: t})
+	}
+	return gates
 }
 
 // defaultText returns the default text representation of the gate status based on the hook type.
@@ -66,6 +345,76 @@ func defaultText(key StoreKey) string {
 	return GATE_CLOSE
 }
 
+// gateMessage returns the event message of a gate change
+func gateMessage(key StoreKey, status string, user string) string {
+	if user == "" {
+		return fmt.Sprintf("Gate [%s] is set to [%s]", key.String(), status)
+	}
+	return fmt.Sprintf("Gate [%s] is set to [%s] by [%s]", key.String(), status, user)
+}
+
+// resetMessage returns the event message of a gate which is reset to its default state
+func resetMessage(key StoreKey, status string, user string) string {
+	if user == "" {
+		return fmt.Sprintf("Gate [%s] is reset to its default [%s]", key.String(), status)
+	}
+	return fmt.Sprintf("Gate [%s] is reset to its default [%s] by [%s]", key.String(), status, user)
+}
+
+// consumedMessage returns the event message of a gate which is closed after its approval was used
+func consumedMessage(key StoreKey) string {
+	return fmt.Sprintf("Gate [%s] is set to [%s] after its approval was used", key.String(), GATE_CLOSE)
+}
+
+// changeMessage returns the event message of a gate change, or of a manual rollback when the reason is set
+func changeMessage(key StoreKey, status string, user string, reason string) string {
+	if reason == "" {
+		return gateMessage(key, status, user)
+	}
+	if user == "" {
+		return fmt.Sprintf("Canary [%s/%s] is rolled back manually: %s", key.Namespace, key.Name, reason)
+	}
+	return fmt.Sprintf("Canary [%s/%s] is rolled back manually by [%s]: %s", key.Namespace, key.Name, user, reason)
+}
+
+// newHistoryEntry creates a history entry of a gate change. The reason is only set by a manual rollback.
+func newHistoryEntry(key StoreKey, status string, user string, reason string) HistoryEntry {
+	return HistoryEntry{Time: time.Now().UTC(), Type: key.Type, Status: status, User: user, Reason: reason}
+}
+
+// gateDependencies returns the dependencies of the gate in the spec as hook types
+func gateDependencies(spec *piggysecv1alpha1.CanaryGateSpec, key StoreKey) []service.HookType {
+	deps := spec.GetDependencies(string(key.Type))
+	result := make([]service.HookType, len(deps))
+	for i, dep := range deps {
+		result[i] = service.HookType(dep)
+	}
+	return result
+}
+
+// singleApproval returns the approval of a gate which requires a single approver
+func singleApproval(user string) Approval {
+	return Approval{Approvers: []string{user}, Required: 1}
+}
+
+// appendHistory appends the entry and drops the oldest entries beyond historyLimit
+func appendHistory(history []HistoryEntry, entry HistoryEntry) []HistoryEntry {
+	history = append(history, entry)
+	if len(history) > historyLimit {
+		history = history[len(history)-historyLimit:]
+	}
+	return history
+}
+
+// sortedKeys returns the keys of the set sorted by namespace and name
+func sortedKeys(set map[StoreKey]bool) []StoreKey {
+	keys := slices.Collect(maps.Keys(set))
+	slices.SortFunc(keys, func(a, b StoreKey) int {
+		return strings.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+	return keys
+}
+
 // GateStatus converts a boolean value to a string representation of the gate status.
 func GateStatus(val bool) string {
 	if val {
@@ -0,0 +1,279 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/KongZ/canary-gate/service"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the store operations. It is a no-op until a tracer provider is set.
+var tracer = otel.Tracer("github.com/KongZ/canary-gate/store")
+
+// TracingStore records a span for every store operation which receives a context, so the spans are children of
+// the request which called the store. Shutdown has no context and is passed to the store as it is.
+type TracingStore struct {
+	Store
+}
+
+// NewTracingStore wraps the store with OpenTelemetry spans
+func NewTracingStore(store Store) Store {
+	return &TracingStore{Store: store}
+}
+
+// start starts the span of a store operation with the attributes of the gate
+func (s *TracingStore) start(ctx context.Context, name string, key StoreKey) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("canary_gate.namespace", key.Namespace),
+		attribute.String("canary_gate.name", key.Name),
+	}
+	if key.Type != "" {
+		attrs = append(attrs, attribute.String("canary_gate.gate", string(key.Type)))
+	}
+	return tracer.Start(ctx, "store."+name, trace.WithAttributes(attrs...))
+}
+
+func (s *TracingStore) IsGateOpen(ctx context.Context, key StoreKey) bool {
+	ctx, span := s.start(ctx, "IsGateOpen", key)
+	defer span.End()
+	open := s.Store.IsGateOpen(ctx, key)
+	span.SetAttributes(attribute.Bool("canary_gate.open", open))
+	return open
+}
+
+func (s *TracingStore) GateState(ctx context.Context, key StoreKey) (bool, error) {
+	ctx, span := s.start(ctx, "GateState", key)
+	defer span.End()
+	open, err := s.Store.GateState(ctx, key)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.SetAttributes(attribute.Bool("canary_gate.open", open))
+	return open, err
+}
+
+func (s *TracingStore) GateOpen(ctx context.Context, key StoreKey, user string) {
+	ctx, span := s.start(ctx, "GateOpen", key)
+	defer span.End()
+	s.Store.GateOpen(ctx, key, user)
+}
+
+func (s *TracingStore) OpenGateWithTTL(ctx context.Context, key StoreKey, ttl time.Duration, user string) {
+	ctx, span := s.start(ctx, "OpenGateWithTTL", key)
+	defer span.End()
+	s.Store.OpenGateWithTTL(ctx, key, ttl, user)
+}
+
+func (s *TracingStore) GateClose(ctx context.Context, key StoreKey, user string) {
+	ctx, span := s.start(ctx, "GateClose", key)
+	defer span.End()
+	s.Store.GateClose(ctx, key, user)
+}
+
+func (s *TracingStore) GateReset(ctx context.Context, key StoreKey, user string) {
+	ctx, span := s.start(ctx, "GateReset", key)
+	defer span.End()
+	s.Store.GateReset(ctx, key, user)
+}
+
+func (s *TracingStore) RollbackGate(ctx context.Context, key StoreKey, user string, reason string) {
+	ctx, span := s.start(ctx, "RollbackGate", key)
+	defer span.End()
+	s.Store.RollbackGate(ctx, key, user, reason)
+}
+
+func (s *TracingStore) CompareAndSet(ctx context.Context, key StoreKey, expected, desired bool) (bool, error) {
+	ctx, span := s.start(ctx, "CompareAndSet", key)
+	defer span.End()
+	swapped, err := s.Store.CompareAndSet(ctx, key, expected, desired)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.SetAttributes(attribute.Bool("canary_gate.swapped", swapped))
+	return swapped, err
+}
+
+func (s *TracingStore) GetChangedBy(ctx context.Context, key StoreKey) string {
+	ctx, span := s.start(ctx, "GetChangedBy", key)
+	defer span.End()
+	return s.Store.GetChangedBy(ctx, key)
+}
+
+func (s *TracingStore) List(ctx context.Context, namespace string, name string) (map[service.HookType]bool, error) {
+	ctx, span := s.start(ctx, "List", StoreKey{Namespace: namespace, Name: name})
+	defer span.End()
+	gates, err := s.Store.List(ctx, namespace, name)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return gates, err
+}
+
+func (s *TracingStore) Deployments(ctx context.Context) ([]StoreKey, error) {
+	ctx, span := tracer.Start(ctx, "store.Deployments")
+	defer span.End()
+	keys, err := s.Store.Deployments(ctx)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return keys, err
+}
+
+func (s *TracingStore) Health(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "store.Health")
+	defer span.End()
+	err := s.Store.Health(ctx)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (s *TracingStore) WaitForSync(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "store.WaitForSync")
+	defer span.End()
+	err := s.Store.WaitForSync(ctx)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (s *TracingStore) UpdateEvent(ctx context.Context, key StoreKey, status string, message string) {
+	ctx, span := s.start(ctx, "UpdateEvent", key)
+	defer span.End()
+	s.Store.UpdateEvent(ctx, key, status, message)
+}
+
+func (s *TracingStore) GetLastEvent(ctx context.Context, key StoreKey) string {
+	ctx, span := s.start(ctx, "GetLastEvent", key)
+	defer span.End()
+	return s.Store.GetLastEvent(ctx, key)
+}
+
+func (s *TracingStore) UpdatePhase(ctx context.Context, key StoreKey, phase string) string {
+	ctx, span := s.start(ctx, "UpdatePhase", key)
+	defer span.End()
+	return s.Store.UpdatePhase(ctx, key, phase)
+}
+
+func (s *TracingStore) GetPhase(ctx context.Context, key StoreKey) string {
+	ctx, span := s.start(ctx, "GetPhase", key)
+	defer span.End()
+	return s.Store.GetPhase(ctx, key)
+}
+
+func (s *TracingStore) SaveMessages(ctx context.Context, key StoreKey, messages map[string]string) {
+	ctx, span := s.start(ctx, "SaveMessages", key)
+	defer span.End()
+	s.Store.SaveMessages(ctx, key, messages)
+}
+
+func (s *TracingStore) GetMessages(ctx context.Context, key StoreKey) map[string]string {
+	ctx, span := s.start(ctx, "GetMessages", key)
+	defer span.End()
+	return s.Store.GetMessages(ctx, key)
+}
+
+func (s *TracingStore) AppendHistory(ctx context.Context, key StoreKey, entry HistoryEntry) {
+	ctx, span := s.start(ctx, "AppendHistory", key)
+	defer span.End()
+	s.Store.AppendHistory(ctx, key, entry)
+}
+
+func (s *TracingStore) GetHistory(ctx context.Context, key StoreKey) []HistoryEntry {
+	ctx, span := s.start(ctx, "GetHistory", key)
+	defer span.End()
+	return s.Store.GetHistory(ctx, key)
+}
+
+func (s *TracingStore) Approve(ctx context.Context, key StoreKey, user string) (Approval, error) {
+	ctx, span := s.start(ctx, "Approve", key)
+	defer span.End()
+	approval, err := s.Store.Approve(ctx, key, user)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return approval, err
+}
+
+func (s *TracingStore) GetApproval(ctx context.Context, key StoreKey) Approval {
+	ctx, span := s.start(ctx, "GetApproval", key)
+	defer span.End()
+	return s.Store.GetApproval(ctx, key)
+}
+
+func (s *TracingStore) GetDependencies(ctx context.Context, key StoreKey) []service.HookType {
+	ctx, span := s.start(ctx, "GetDependencies", key)
+	defer span.End()
+	return s.Store.GetDependencies(ctx, key)
+}
+
+func (s *TracingStore) ConsumeGate(ctx context.Context, key StoreKey) (bool, error) {
+	ctx, span := s.start(ctx, "ConsumeGate", key)
+	defer span.End()
+	consumed, err := s.Store.ConsumeGate(ctx, key)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.SetAttributes(attribute.Bool("canary_gate.consumed", consumed))
+	return consumed, err
+}
+
+func (s *TracingStore) Exists(ctx context.Context, key StoreKey) (bool, error) {
+	ctx, span := s.start(ctx, "Exists", key)
+	defer span.End()
+	exists, err := s.Store.Exists(ctx, key)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return exists, err
+}
+
+func (s *TracingStore) GetClosedAt(ctx context.Context, key StoreKey) time.Time {
+	ctx, span := s.start(ctx, "GetClosedAt", key)
+	defer span.End()
+	return s.Store.GetClosedAt(ctx, key)
+}
+
+func (s *TracingStore) SetRolledBackAt(ctx context.Context, key StoreKey, at time.Time) {
+	ctx, span := s.start(ctx, "SetRolledBackAt", key)
+	defer span.End()
+	s.Store.SetRolledBackAt(ctx, key, at)
+}
+
+func (s *TracingStore) GetRolledBackAt(ctx context.Context, key StoreKey) time.Time {
+	ctx, span := s.start(ctx, "GetRolledBackAt", key)
+	defer span.End()
+	return s.Store.GetRolledBackAt(ctx, key)
+}
+
+func (s *TracingStore) SetDecision(ctx context.Context, key StoreKey, decision Decision) {
+	ctx, span := s.start(ctx, "SetDecision", key)
+	defer span.End()
+	s.Store.SetDecision(ctx, key, decision)
+}
+
+func (s *TracingStore) GetDecision(ctx context.Context, key StoreKey) Decision {
+	ctx, span := s.start(ctx, "GetDecision", key)
+	defer span.End()
+	return s.Store.GetDecision(ctx, key)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2025 The canary-gate authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package store
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ExpiryNotifier is called after a gate reverts to its default state at the end of its TTL. open is the state of
+// the gate after the revert.
+type ExpiryNotifier func(key StoreKey, open bool, ttl time.Duration)
+
+// expiryNotifier is called by the expirations of all stores
+var expiryNotifier atomic.Pointer[ExpiryNotifier]
+
+// SetExpiryNotifier sets the function which is called after a gate reverts at the end of its TTL.
+// The stores which keep the TTL in the CanaryGate leave the revert to the controller, which notifies it instead.
+func SetExpiryNotifier(fn ExpiryNotifier) {
+	expiryNotifier.Store(&fn)
+}
+
+// notifyExpired calls the expiry notifier, if it is set
+func notifyExpired(key StoreKey, ttl time.Duration) {
+	if fn := expiryNotifier.Load(); fn != nil && *fn != nil {
+		(*fn)(key, defaultValue(key), ttl)
+	}
+}
+
+// expiryTimers keeps track of the pending expirations of gates opened with a TTL.
+type expiryTimers struct {
+	mu     sync.Mutex
+	timers map[StoreKey]*time.Timer
+}
+
+// schedule runs fn after ttl. Any pending expiration of the same key is cancelled.
+func (t *expiryTimers) schedule(key StoreKey, ttl time.Duration, fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timers == nil {
+		t.timers = map[StoreKey]*time.Timer{}
+	}
+	if old, ok := t.timers[key]; ok {
+		old.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(ttl, func() {
+		// only run if the timer was not replaced or cancelled in the meantime
+		t.mu.Lock()
+		current := t.timers[key] == timer
+		if current {
+			delete(t.timers, key)
+		}
+		t.mu.Unlock()
+		if current {
+			fn()
+		}
+	})
+	t.timers[key] = timer
+}
+
+// cancel stops the pending expiration of a key, if any.
+func (t *expiryTimers) cancel(key StoreKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if old, ok := t.timers[key]; ok {
+		old.Stop()
+		delete(t.timers, key)
+	}
+}
+
+// stop cancels all pending expirations.
+func (t *expiryTimers) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, timer := range t.timers {
+		timer.Stop()
+		delete(t.timers, key)
+	}
+}
+
+// expiredMessage returns the event message recorded when a gate reverts to its default value.
+func expiredMessage(key StoreKey, ttl time.Duration) string {
+	return fmt.Sprintf("Gate [%s] is expired after [%s] and reset to [%s]", key.String(), ttl, defaultText(key))
+}